@@ -0,0 +1,316 @@
+// Package agent runs the backup jobs of a central server from a network
+// segment the server cannot reach. The agent connects out to the server, so
+// no inbound connection to the segment is needed.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// retryDelay is the wait after a failed request to the server.
+const retryDelay = 5 * time.Second
+
+// Config configures an agent. The token needs the agent scope, which only
+// allows the agent endpoints, as jobs carry device credentials.
+type Config struct {
+	ServerURL string // base URL of the server, e.g. https://netcfg.example.com
+	Token     string
+	Name      string
+	Sites     []string
+	Workers   int // jobs run at the same time
+}
+
+// Agent pulls backup jobs for its sites from the server, runs them with the
+// local connectors and uploads the results.
+type Agent struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc // by job ID
+
+	regMu        sync.Mutex // one registration at a time
+	registeredAt time.Time
+}
+
+// StatusError is an error response from the server.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server answered %d: %s", e.Status, e.Message)
+}
+
+// New creates an agent.
+func New(cfg Config) *Agent {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	cfg.ServerURL = strings.TrimRight(cfg.ServerURL, "/")
+	return &Agent{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: time.Minute},
+		running: make(map[int64]context.CancelFunc),
+	}
+}
+
+// Run registers the agent and runs jobs until ctx is cancelled or the server
+// rejects the token. The agent registers again when the server restarts.
+func (a *Agent) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var fatalErr error
+	var fatalOnce sync.Once
+	fail := func(err error) {
+		fatalOnce.Do(func() {
+			fatalErr = err
+			cancel()
+		})
+	}
+
+	if err := a.register(ctx, time.Time{}); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.heartbeats(ctx, fail)
+	}()
+	for w := 1; w <= a.cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.poll(ctx, fail)
+		}()
+	}
+	wg.Wait()
+	return fatalErr
+}
+
+// register announces the agent and its sites, retrying until the server
+// answers. It does nothing if the agent registered after since, so that
+// workers that all found the agent unknown register it once.
+func (a *Agent) register(ctx context.Context, since time.Time) error {
+	a.regMu.Lock()
+	defer a.regMu.Unlock()
+	if a.registeredAt.After(since) {
+		return nil
+	}
+
+	reg := models.AgentRegistration{Name: a.cfg.Name, Sites: a.cfg.Sites}
+	for {
+		var agent models.Agent
+		_, err := a.call(ctx, "POST", "/agents", reg, &agent)
+		if err == nil {
+			a.registeredAt = time.Now()
+			utils.Log.WithFields(map[string]interface{}{"agent": a.cfg.Name, "sites": a.cfg.Sites}).Info("Registered with the server")
+			return nil
+		}
+		if fatal(err) || ctx.Err() != nil {
+			return err
+		}
+		utils.Log.WithField("error", err).Warn("Failed to register with the server, retrying")
+		if !sleep(ctx, retryDelay) {
+			return ctx.Err()
+		}
+	}
+}
+
+// heartbeats reports to the server until ctx is cancelled and stops the jobs
+// the server took back.
+func (a *Agent) heartbeats(ctx context.Context, fail func(error)) {
+	for sleep(ctx, core.AgentHeartbeatInterval) {
+		var beat models.AgentHeartbeat
+		sent := time.Now()
+		if _, err := a.call(ctx, "POST", a.path("/heartbeat"), nil, &beat); err != nil {
+			a.recover(ctx, err, sent, fail)
+			continue
+		}
+		a.mu.Lock()
+		for _, id := range beat.Cancel {
+			if cancel, ok := a.running[id]; ok {
+				utils.Log.WithFields(map[string]interface{}{"agent": a.cfg.Name, "job_id": id}).Warn("The server took the job back, stopping it")
+				cancel()
+			}
+		}
+		a.mu.Unlock()
+	}
+}
+
+// poll asks the server for jobs and runs them until ctx is cancelled.
+func (a *Agent) poll(ctx context.Context, fail func(error)) {
+	for ctx.Err() == nil {
+		var job models.AgentJob
+		sent := time.Now()
+		status, err := a.call(ctx, "POST", a.path("/jobs/next"), nil, &job)
+		if err != nil {
+			a.recover(ctx, err, sent, fail)
+			continue
+		}
+		if status == http.StatusNoContent {
+			continue
+		}
+		a.runJob(ctx, job)
+	}
+}
+
+// runJob runs the commands of a job on its device and uploads the result.
+func (a *Agent) runJob(ctx context.Context, job models.AgentJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.mu.Lock()
+	a.running[job.ID] = cancel
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.running, job.ID)
+		a.mu.Unlock()
+	}()
+
+	entry := utils.Log.WithFields(map[string]interface{}{
+		"agent":    a.cfg.Name,
+		"job_id":   job.ID,
+		"host":     job.Device.Host,
+		"protocol": job.Device.Protocol,
+	})
+	entry.Info("Agent picked up the task")
+	start := time.Now()
+
+	var result models.AgentResult
+	results, err := core.RunDeviceCommands(jobCtx, job.Device, job.Commands, entry, nil)
+	if jobCtx.Err() != nil {
+		// The server took the job back, or the agent is stopping.
+		entry.Warn("Job stopped")
+		return
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Category = connectors.Category(err)
+		entry.WithField("error", err).Error("Error executing commands")
+	} else {
+		result.Results = results
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err := a.call(ctx, "POST", a.path(fmt.Sprintf("/jobs/%d/result", job.ID)), result, nil)
+		if err == nil {
+			entry.Infof("Job finished in %.2f seconds", time.Since(start).Seconds())
+			return
+		}
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Status == http.StatusConflict || attempt == 3 || !sleep(ctx, retryDelay) {
+			entry.WithField("error", err).Error("Failed to upload the job result")
+			return
+		}
+	}
+}
+
+// recover handles a failed request sent at the given time: it registers
+// again when the server no longer knows the agent, stops the agent when the
+// token is rejected, and otherwise waits before the next request.
+func (a *Agent) recover(ctx context.Context, err error, sent time.Time, fail func(error)) {
+	if ctx.Err() != nil {
+		return
+	}
+	if fatal(err) {
+		fail(err)
+		return
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		utils.Log.WithField("agent", a.cfg.Name).Warn("The server does not know the agent, registering again")
+		if err := a.register(ctx, sent); err != nil && fatal(err) {
+			fail(err)
+		}
+		return
+	}
+	utils.Log.WithField("error", err).Warn("Request to the server failed")
+	sleep(ctx, retryDelay)
+}
+
+// path returns the API path of the agent's own resources.
+func (a *Agent) path(suffix string) string {
+	return "/agents/" + url.PathEscape(a.cfg.Name) + suffix
+}
+
+// call sends a JSON request to the API and decodes the JSON response into
+// out. It returns the status of a successful response.
+func (a *Agent) call(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.cfg.ServerURL+"/api/v1"+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach the server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return resp.StatusCode, &StatusError{Status: resp.StatusCode, Message: apiErr.Error}
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("invalid response from server: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// fatal reports whether the server rejected the agent's token or rights.
+func fatal(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.Status == http.StatusUnauthorized || statusErr.Status == http.StatusForbidden || statusErr.Status == http.StatusBadRequest)
+}
+
+// sleep waits for d or until ctx is cancelled, and reports whether it waited
+// the full time.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// mockIdP is an OpenID Connect provider that issues ID tokens signed with
+// an RSA key ("rsa1") or an EC key ("ec1").
+type mockIdP struct {
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu sync.Mutex
+	// codes maps issued authorization codes to their PKCE challenge and nonce.
+	codes map[string]mockGrant
+	// claims are added to the ID tokens issued by the token endpoint.
+	claims map[string]interface{}
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+const (
+	mockClientID     = "netcfg"
+	mockClientSecret = "s3cret+/="
+	mockRedirectURL  = "https://netcfg.example.com/auth/oidc/callback"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{rsaKey: rsaKey, ecKey: ecKey, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize?tenant=1",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/keys",
+			"end_session_endpoint":   idp.srv.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, size))), "y": b64(ecKey.Y.FillBytes(make([]byte, size)))},
+			{"kty": "RSA", "kid": "enc1", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+		}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// authorize plays the user logging in at the provider: it checks the login
+// URL and returns the code the provider redirects back with.
+func (idp *mockIdP) authorize(t *testing.T, loginURL string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	for name, want := range map[string]string{
+		"tenant":                "1",
+		"response_type":         "code",
+		"client_id":             mockClientID,
+		"redirect_uri":          mockRedirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(name); got != want {
+			t.Errorf("login URL %s = %q, want %q", name, got, want)
+		}
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("login URL scope %q lacks openid", q.Get("scope"))
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code = "code" + q.Get("state")
+	idp.codes[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code, q.Get("state")
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != mockClientID || secret != mockClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != mockRedirectURL {
+		tokenError("invalid_request")
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	claims := idp.claims
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || b64(sum[:]) != grant.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	idToken := idp.sign("RS256", "rsa1", idp.idClaims(grant.nonce, claims))
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+// idClaims returns valid ID token claims for the nonce with extra merged in.
+func (idp *mockIdP) idClaims(nonce string, extra map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":                idp.srv.URL,
+		"aud":                mockClientID,
+		"sub":                "248289761001",
+		"preferred_username": "jdoe",
+		"groups":             []string{"netops"},
+		"nonce":              nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for name, v := range extra {
+		if v == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = v
+		}
+	}
+	return claims
+}
+
+// sign returns a JWS over the claims. Unknown algorithms get a garbage signature.
+func (idp *mockIdP) sign(alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		// Signed with the public RSA modulus as the secret, the classic
+		// algorithm confusion attack.
+		mac := hmac.New(sha256.New, idp.rsaKey.N.Bytes())
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	return signed + "." + b64(sig)
+}
+
+func (idp *mockIdP) provider(t *testing.T, roles map[string]string) *OIDCProvider {
+	t.Helper()
+	p, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:       idp.srv.URL + "/",
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		RoleMap:      roles,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider(t, nil)
+	logout, ok := p.LogoutURL("https://netcfg.example.com/login")
+	if !ok || !strings.HasPrefix(logout, idp.srv.URL+"/logout?") || !strings.Contains(logout, "client_id="+mockClientID) {
+		t.Errorf("logout URL %q, %v", logout, ok)
+	}
+
+	cfg := OIDCConfig{Issuer: idp.srv.URL, ClientID: mockClientID, RedirectURL: mockRedirectURL}
+	for name, change := range map[string]func(c *OIDCConfig){
+		"other issuer":  func(c *OIDCConfig) { c.Issuer = idp.srv.URL + "/tenant" },
+		"no client ID":  func(c *OIDCConfig) { c.ClientID = "" },
+		"unknown role":  func(c *OIDCConfig) { c.RoleMap = map[string]string{"netops": "superuser"} },
+		"no discovery":  func(c *OIDCConfig) { c.Issuer = "http://127.0.0.1:1" },
+		"issuer is 404": func(c *OIDCConfig) { c.Issuer = idp.srv.URL + "/keys" },
+	} {
+		c := cfg
+		change(&c)
+		if _, err := NewOIDCProvider(context.Background(), c); err == nil {
+			t.Errorf("%s: provider was created", name)
+		}
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider(t, map[string]string{"netops": models.RoleOperator})
+
+	verifier, _ := RandomToken()
+	code, state := idp.authorize(t, p.AuthCodeURL("state1", "nonce1", verifier))
+	if state != "state1" {
+		t.Errorf("state %q was not passed through", state)
+	}
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if claims.Username != "jdoe" || claims.Subject != "248289761001" || len(claims.Groups) != 1 {
+		t.Errorf("claims %+v", claims)
+	}
+	if role, ok := p.Role(claims); !ok || role != models.RoleOperator {
+		t.Errorf("role %q, %v", role, ok)
+	}
+
+	// A code is used once, and only with the verifier it was issued for.
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce1"); err == nil {
+		t.Error("a code was exchanged twice")
+	}
+	code, _ = idp.authorize(t, p.AuthCodeURL("state2", "nonce2", verifier))
+	other, _ := RandomToken()
+	if _, err := p.Exchange(context.Background(), code, other, "nonce2"); err == nil {
+		t.Error("a code was exchanged with the wrong PKCE verifier")
+	}
+
+	// The nonce of the ID token must be the one of this login.
+	code, _ = idp.authorize(t, p.AuthCodeURL("state3", "nonce3", verifier))
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-of-another-login"); err == nil {
+		t.Error("an ID token with another login's nonce was accepted")
+	}
+
+	// A token without any usable name is rejected.
+	idp.claims = map[string]interface{}{"sub": nil, "preferred_username": nil}
+	code, _ = idp.authorize(t, p.AuthCodeURL("state4", "nonce4", verifier))
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce4"); err == nil {
+		t.Error("an ID token without subject was accepted")
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider(t, nil)
+	ctx := context.Background()
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa1", "ES256": "ec1"}[alg]
+		if _, err := p.Verify(ctx, idp.sign(alg, kid, idp.idClaims("n", nil)), "n"); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+	}
+
+	tampered := strings.Split(idp.sign("RS256", "rsa1", idp.idClaims("n", nil)), ".")
+	tampered[1] = b64([]byte(`{"iss":"` + idp.srv.URL + `","aud":"netcfg","sub":"admin","nonce":"n","exp":9999999999}`))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"tampered claims", strings.Join(tampered, ".")},
+		{"alg none", strings.TrimSuffix(idp.sign("none", "rsa1", idp.idClaims("n", nil)), ".") + "."},
+		{"HMAC with the public key", idp.sign("HS256", "rsa1", idp.idClaims("n", nil))},
+		{"RSA algorithm with the EC key", idp.sign("RS256", "ec1", idp.idClaims("n", nil))},
+		{"encryption key", idp.sign("RS256", "enc1", idp.idClaims("n", nil))},
+		{"unknown key", idp.sign("RS256", "rsa2", idp.idClaims("n", nil))},
+		{"other issuer", idp.sign("RS256", "rsa1", idp.idClaims("n", map[string]interface{}{"iss": "https://evil.example.com"}))},
+		{"other audience", idp.sign("RS256", "rsa1", idp.idClaims("n", map[string]interface{}{"aud": []string{"other", "client"}}))},
+		{"no audience", idp.sign("RS256", "rsa1", idp.idClaims("n", map[string]interface{}{"aud": nil}))},
+		{"expired", idp.sign("RS256", "rsa1", idp.idClaims("n", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}))},
+		{"no expiry", idp.sign("RS256", "rsa1", idp.idClaims("n", map[string]interface{}{"exp": nil}))},
+		{"other nonce", idp.sign("RS256", "rsa1", idp.idClaims("m", nil))},
+		{"malformed", "a.b"},
+	}
+	for _, tt := range tests {
+		if _, err := p.Verify(ctx, tt.token, "n"); err == nil {
+			t.Errorf("%s: token was accepted", tt.name)
+		}
+	}
+
+	// An audience list including the client and a small clock skew are fine.
+	claims := idp.idClaims("n", map[string]interface{}{"aud": []string{"other", mockClientID}, "exp": time.Now().Add(-time.Minute).Unix()})
+	if _, err := p.Verify(ctx, idp.sign("RS256", "rsa1", claims), "n"); err != nil {
+		t.Errorf("audience list: %v", err)
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider(t, map[string]string{
+		"helpdesk": models.RoleViewer,
+		"netops":   models.RoleOperator,
+		"netadmin": models.RoleAdmin,
+	})
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"helpdesk"}, models.RoleViewer},
+		{[]string{"helpdesk", "netops"}, models.RoleOperator},
+		{[]string{"netadmin", "helpdesk", "netops"}, models.RoleAdmin},
+		{[]string{"netops", "sales"}, models.RoleOperator},
+		{[]string{"sales"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		role, ok := p.Role(&OIDCClaims{Groups: tt.groups})
+		if role != tt.want || ok != (tt.want != "") {
+			t.Errorf("groups %v: role %q, %v, want %q", tt.groups, role, ok, tt.want)
+		}
+	}
+
+	// Groups come from the configured claim, as a list or a single string.
+	idp.claims = map[string]interface{}{"groups": nil, "roles": "netadmin"}
+	p.cfg.GroupsClaim = "roles"
+	claims, err := p.Verify(context.Background(), idp.sign("RS256", "rsa1", idp.idClaims("n", idp.claims)), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role, _ := p.Role(claims); role != models.RoleAdmin {
+		t.Errorf("role from a string claim: %q", role)
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	roles, err := ParseRoleMap(" netops=operator, netadmin = admin ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 || roles["netops"] != "operator" || roles["netadmin"] != "admin" {
+		t.Errorf("roles %v", roles)
+	}
+	for _, s := range []string{"netops", "=admin"} {
+		if _, err := ParseRoleMap(s); err == nil {
+			t.Errorf("%q was accepted", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// TokenPrefix starts every API token, so that leaked tokens are easy to spot.
+const TokenPrefix = "ncb_"
+
+// GenerateToken returns a new API token secret and the hash to store. The
+// secret is random, so a plain SHA-256 hash is enough to protect it.
+func GenerateToken() (secret, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret = TokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return secret, HashToken(secret), nil
+}
+
+// HashToken returns the stored hash of a token secret.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenDisplayPrefix returns the part of a secret shown in token lists.
+func TokenDisplayPrefix(secret string) string {
+	rest := strings.TrimPrefix(secret, TokenPrefix)
+	if len(rest) > 6 {
+		rest = rest[:6]
+	}
+	return TokenPrefix + rest
+}
+
+// NewAPIToken validates the settings of a token and generates its secret.
+// A zero ttl creates a token that does not expire.
+func NewAPIToken(name, kind, owner, scope string, ttl time.Duration) (models.APIToken, string, error) {
+	token := models.APIToken{Name: strings.TrimSpace(name), Kind: kind, Owner: owner, Scope: scope}
+	switch {
+	case token.Name == "":
+		return token, "", errors.New("token name is required")
+	case kind != models.TokenPersonal && kind != models.TokenService:
+		return token, "", fmt.Errorf("unknown token kind '%s'", kind)
+	case kind == models.TokenPersonal && owner == "":
+		return token, "", errors.New("a personal token needs an owner")
+	case models.ScopeRole(scope) == "":
+		return token, "", fmt.Errorf("unknown scope '%s' (%s)", scope, strings.Join(models.TokenScopes, ", "))
+	case ttl < 0:
+		return token, "", errors.New("expiry must not be in the past")
+	}
+
+	secret, hash, err := GenerateToken()
+	if err != nil {
+		return token, "", err
+	}
+	token.Hash = hash
+	token.Prefix = TokenDisplayPrefix(secret)
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		token.ExpiresAt = &expires
+	}
+	return token, secret, nil
+}
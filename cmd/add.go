@@ -25,10 +25,12 @@ var addCmd = &cobra.Command{
 		newDevice.Host = askQuestion(reader, "Enter hostname or IP address: ")
 		newDevice.Username = askQuestion(reader, "Enter username: ")
 
-		protocol := askChoice(reader, "Select protocol:", []string{"ssh", "telnet"})
+		newDevice.Platform = askChoice(reader, "Select platform:", models.Platforms)
+
+		protocol := askChoice(reader, "Select protocol:", models.Protocols)
 		newDevice.Protocol = protocol
 
-		if protocol == "ssh" {
+		if protocol == "ssh" || protocol == "netconf" {
 			authMethod := askChoice(reader, "Select authentication method:", []string{"key", "password"})
 			if authMethod == "key" {
 				defaultKeyPath := fmt.Sprintf("%s/.ssh/id_rsa", os.Getenv("HOME"))
@@ -36,11 +38,19 @@ var addCmd = &cobra.Command{
 			} else {
 				newDevice.PasswordEnv = askQuestion(reader, "Enter environment variable name for the password: ")
 			}
+		} else if protocol == "http" {
+			newDevice.HTTP = askHTTPSettings(reader, nil)
+			if newDevice.HTTP.Auth != models.HTTPAuthNone {
+				newDevice.PasswordEnv = askQuestion(reader, "Enter environment variable name for the password or token: ")
+			}
 		} else { // telnet
 			newDevice.PasswordEnv = askQuestion(reader, "Enter environment variable name for the password: ")
 			newDevice.Prompt = askQuestionWithDefault(reader, "Enter Telnet prompt symbol:", "#")
 		}
 
+		newDevice.Tags = models.ParseTags(askQuestionWithDefault(reader, "Tags (comma-separated, optional)", ""))
+		newDevice.Role = askQuestionWithDefault(reader, "Role for golden config (optional)", "")
+
 		fmt.Println("Enter commands to execute, one per line. Type 'done' when finished.")
 		for {
 			cmdStr := askQuestion(reader, "> ")
@@ -113,3 +123,33 @@ func askChoice(reader *bufio.Reader, query string, choices []string) string {
 		fmt.Printf("Invalid choice. Please select one of: %s\n", strings.Join(choices, ", "))
 	}
 }
+
+// askHTTPSettings asks for the settings of a device with the http protocol,
+// offering the current ones, if any, as defaults.
+func askHTTPSettings(reader *bufio.Reader, current *models.HTTPSettings) *models.HTTPSettings {
+	settings := models.HTTPSettings{}
+	if current != nil {
+		settings = *current
+	}
+	if settings.Auth == "" {
+		settings.Auth = models.HTTPAuthBasic
+	}
+	auths := []string{models.HTTPAuthNone, models.HTTPAuthBasic, models.HTTPAuthToken, models.HTTPAuthLogin}
+	settings.Auth = askChoiceWithDefault(reader, "Authentication scheme", auths, settings.Auth)
+	switch settings.Auth {
+	case models.HTTPAuthToken:
+		header := settings.TokenHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		settings.TokenHeader = askQuestionWithDefault(reader, "Header of the token (Authorization sends 'Bearer <token>')", header)
+	case models.HTTPAuthLogin:
+		if settings.LoginPath == "" {
+			settings.LoginPath = askQuestion(reader, "Enter the path the login form is posted to: ")
+		} else {
+			settings.LoginPath = askQuestionWithDefault(reader, "Path the login form is posted to", settings.LoginPath)
+		}
+	}
+	settings.CAFile = askQuestionWithDefault(reader, "CA file to verify the certificate with (optional)", settings.CAFile)
+	return &settings
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cobrich/netcfg-backup/agent"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Back up the devices of remote sites for a central server",
+	Long: `Runs as an agent of a central server, for networks only reachable from a
+host inside them. The agent connects out to the server, registers the sites
+it serves and runs the backup jobs of the devices tagged with those sites
+with its local connectors. The server saves the results.
+
+Authenticate with an API token of the agent scope in --token or NETCFG_TOKEN.
+It only allows the agent endpoints; only admins can create one, since jobs
+carry device credentials. Passwords in password_env are read from the
+agent's environment. When an agent stops responding, its jobs go to another
+agent of the same site.
+
+The server must listen on an address the agent can reach: it only listens on
+localhost by default, so start it with e.g. "server --listen :8080".`,
+	Example: `  netcfg-backup agent --server https://netcfg.example.com --name dc2-jump --sites dc2,dc2-oob`,
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		serverURL, _ := cmd.Flags().GetString("server")
+		token, _ := cmd.Flags().GetString("token")
+		if token == "" {
+			token = os.Getenv("NETCFG_TOKEN")
+		}
+		name, _ := cmd.Flags().GetString("name")
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		sitesFlag, _ := cmd.Flags().GetString("sites")
+		sites := models.ParseTags(sitesFlag)
+		if len(sites) == 0 {
+			fmt.Println("❌ Give the sites the agent serves with --sites")
+			os.Exit(1)
+		}
+		workers, _ := cmd.Flags().GetInt("workers")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("Agent %s serving %v for %s\n", name, sites, serverURL)
+		err := agent.New(agent.Config{
+			ServerURL: serverURL,
+			Token:     token,
+			Name:      name,
+			Sites:     sites,
+			Workers:   workers,
+		}).Run(ctx)
+		if err != nil {
+			fmt.Printf("❌ Agent stopped: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().String("server", "http://localhost:8080", "URL of the central server")
+	agentCmd.Flags().String("token", "", "API token of the agent scope (default $NETCFG_TOKEN)")
+	agentCmd.Flags().String("name", "", "Agent name, unique per server (default: the host name)")
+	agentCmd.Flags().String("sites", "", "Comma-separated sites served; devices tagged with a site are backed up by its agents")
+	agentCmd.Flags().Int("workers", 4, "Number of jobs run at the same time")
+}
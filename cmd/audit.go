@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/spf13/cobra"
+)
+
+// auditCmd prints the audit log of configuration changes.
+var auditCmd = &cobra.Command{
+	Use:   "audit [host]",
+	Short: "Shows the audit log of configuration changes",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+		host := ""
+		if len(args) == 1 {
+			host = args[0]
+		}
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		entries, err := deviceStore.GetAuditLog(host, limit)
+		if err != nil {
+			fmt.Printf("Error loading audit log: %v\n", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("The audit log is empty.")
+			return
+		}
+
+		fmt.Printf("%-6s %-19s %-12s %-10s %-20s %-12s %-30s %s\n", "ID", "TIME", "USER", "ACTION", "HOST", "STATUS", "SOURCE", "DETAILS")
+		for _, e := range entries {
+			fmt.Printf("%-6d %-19s %-12s %-10s %-20s %-12s %-30s %s\n",
+				e.ID, e.Time.Format("2006-01-02 15:04:05"), e.User, e.Action, e.Host, e.Status, e.Source, e.Details)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().Int("limit", 50, "Number of entries to show")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cobrich/netcfg-backup/compliance"
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// complianceCmd groups the compliance subcommands.
+var complianceCmd = &cobra.Command{
+	Use:   "compliance",
+	Short: "Checks device configurations against compliance policies",
+}
+
+// complianceCheckCmd evaluates the latest backups against the policies.
+var complianceCheckCmd = &cobra.Command{
+	Use:   "check [host...]",
+	Short: "Checks the latest backup of each device against the policy files",
+	Long: `Evaluates the YAML policies in the policy directory against the latest backup of the
+given devices, or of all active devices if none are given. Results are stored and
+replace the results of the previous check.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		policiesDir, _ := cmd.Flags().GetString("policies")
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+		showAll, _ := cmd.Flags().GetBool("all")
+
+		engine, err := loadComplianceEngine(policiesDir)
+		if err != nil {
+			fmt.Printf("Error loading policies: %v\n", err)
+			os.Exit(1)
+		}
+		if engine == nil {
+			fmt.Printf("No policy files found in '%s'.\n", policiesDir)
+			return
+		}
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		var devices []models.Device
+		if len(args) == 0 {
+			all, err := deviceStore.GetAllDevices()
+			if err != nil {
+				fmt.Printf("Error loading devices: %v\n", err)
+				os.Exit(1)
+			}
+			for _, dev := range all {
+				if !dev.IsPending() {
+					devices = append(devices, dev)
+				}
+			}
+		} else {
+			for _, host := range args {
+				dev, err := deviceStore.GetDeviceByHost(host)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				devices = append(devices, *dev)
+			}
+		}
+
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		totalViolations := 0
+		for _, dev := range devices {
+			results, err := backupService.CheckCompliance(engine, dev)
+			if err != nil {
+				fmt.Printf("⚠️  %s: %v\n", dev.Host, err)
+				continue
+			}
+			counts := compliance.CountViolations(results)
+			violations := 0
+			for _, n := range counts {
+				violations += n
+			}
+			totalViolations += violations
+
+			fmt.Printf("\n%s: %d rules checked, %d violations\n", dev.Host, len(results), violations)
+			printComplianceResults(results, showAll)
+		}
+
+		if totalViolations > 0 {
+			fmt.Printf("\n❌ %d violations found.\n", totalViolations)
+			os.Exit(2)
+		}
+		fmt.Println("\n✅ All checked devices are compliant.")
+	},
+}
+
+// complianceShowCmd prints the stored results of the last check.
+var complianceShowCmd = &cobra.Command{
+	Use:   "show [host]",
+	Short: "Shows the results of the last compliance check",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		showAll, _ := cmd.Flags().GetBool("all")
+		host := ""
+		if len(args) == 1 {
+			host = args[0]
+		}
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		results, err := deviceStore.GetComplianceResults(host)
+		if err != nil {
+			fmt.Printf("Error loading compliance results: %v\n", err)
+			os.Exit(1)
+		}
+		if len(results) == 0 {
+			fmt.Println("No compliance results yet. Use 'netcfg-backup compliance check'.")
+			return
+		}
+		printComplianceResults(results, showAll)
+	},
+}
+
+// printComplianceResults prints failed results, or all results when showAll is set.
+func printComplianceResults(results []models.ComplianceResult, showAll bool) {
+	fmt.Printf("  %-20s %-10s %-20s %-25s %s\n", "HOST", "SEVERITY", "POLICY", "RULE", "RESULT")
+	for _, r := range results {
+		if r.Passed && !showAll {
+			continue
+		}
+		outcome := "PASS"
+		if !r.Passed {
+			outcome = "FAIL: " + r.Message
+		}
+		fmt.Printf("  %-20s %-10s %-20s %-25s %s\n", r.Host, r.Severity, r.Policy, r.RuleID, outcome)
+	}
+}
+
+// loadComplianceEngine loads the policies in dir. It returns nil when there are none.
+func loadComplianceEngine(dir string) (*compliance.Engine, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	policies, err := compliance.LoadPolicies(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	return compliance.NewEngine(policies), nil
+}
+
+func init() {
+	rootCmd.AddCommand(complianceCmd)
+	complianceCmd.AddCommand(complianceCheckCmd)
+	complianceCmd.AddCommand(complianceShowCmd)
+
+	complianceCheckCmd.Flags().String("policies", "policies", "Directory with YAML policy files")
+	complianceCheckCmd.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	complianceCheckCmd.Flags().Bool("all", false, "Also show rules that passed")
+	complianceShowCmd.Flags().Bool("all", false, "Also show rules that passed")
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/discovery"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// discoverCmd represents the discover command
+var discoverCmd = &cobra.Command{
+	Use:   "discover [seed hosts...]",
+	Short: "Discovers new devices by crawling CDP/LLDP neighbors",
+	Long: `Starts from seed devices in the inventory, reads their CDP and LLDP neighbor tables
+and recursively crawls the neighbors found there. Seeds default to all active devices.
+
+New devices inherit the credentials of the device they were seen from and are added
+to the inventory as 'pending'. Pending devices are not backed up until approved
+with 'discover approve'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		depth, _ := cmd.Flags().GetInt("depth")
+		subnets, _ := cmd.Flags().GetStringSlice("subnet")
+		blacklist, _ := cmd.Flags().GetStringSlice("blacklist")
+		workers, _ := cmd.Flags().GetInt("workers")
+		timeoutSeconds, _ := cmd.Flags().GetInt("timeout")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var allowed []*net.IPNet
+		for _, cidr := range subnets {
+			_, subnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				fmt.Printf("Error: invalid subnet '%s': %v\n", cidr, err)
+				os.Exit(1)
+			}
+			allowed = append(allowed, subnet)
+		}
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		inventory, err := deviceStore.GetAllDevices()
+		if err != nil {
+			fmt.Printf("Error loading devices: %v\n", err)
+			os.Exit(1)
+		}
+
+		var seeds []models.Device
+		if len(args) == 0 {
+			for _, dev := range inventory {
+				if !dev.IsPending() {
+					seeds = append(seeds, dev)
+				}
+			}
+		} else {
+			for _, host := range args {
+				dev, err := deviceStore.GetDeviceByHost(host)
+				if err != nil {
+					fmt.Printf("Error: seed must be an inventory device: %v\n", err)
+					os.Exit(1)
+				}
+				seeds = append(seeds, *dev)
+			}
+		}
+		if len(seeds) == 0 {
+			fmt.Println("No seed devices. Use 'netcfg-backup add' to add one.")
+			return
+		}
+
+		crawler := discovery.NewCrawler(inventory, discovery.Options{
+			MaxDepth:       depth,
+			AllowedSubnets: allowed,
+			Blacklist:      blacklist,
+			Workers:        workers,
+			Timeout:        time.Duration(timeoutSeconds) * time.Second,
+		})
+		result := crawler.Crawl(seeds)
+
+		for host, err := range result.Failed {
+			fmt.Printf("⚠️  %s: %v\n", host, err)
+		}
+
+		if dryRun {
+			for _, dev := range result.Discovered {
+				fmt.Printf("Found device: %-20s platform=%s\n", dev.Host, dev.Platform)
+			}
+			fmt.Printf("\nDry run: %d devices queried, %d new devices found, nothing saved.\n", len(result.Neighbors), len(result.Discovered))
+			return
+		}
+
+		for host, neighbors := range result.Neighbors {
+			if err := deviceStore.ReplaceNeighbors(host, neighbors); err != nil {
+				fmt.Printf("Error saving neighbors of %s: %v\n", host, err)
+			}
+		}
+
+		added := 0
+		for _, dev := range result.Discovered {
+			if err := deviceStore.AddDevice(dev); err != nil {
+				if _, ok := err.(*storage.ErrDeviceExists); !ok {
+					fmt.Printf("Failed to add device %s: %v\n", dev.Host, err)
+				}
+				continue
+			}
+			fmt.Printf("Added pending device: %-20s platform=%s\n", dev.Host, dev.Platform)
+			added++
+		}
+
+		fmt.Printf("\n✅ Discovery complete. %d devices queried, %d new pending devices added.\n", len(result.Neighbors), added)
+	},
+}
+
+// discoverGraphCmd exports the neighbor adjacency graph.
+var discoverGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Exports the neighbor adjacency graph as Graphviz DOT or JSON",
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		neighbors, err := deviceStore.GetAllNeighbors()
+		if err != nil {
+			fmt.Printf("Error loading neighbors: %v\n", err)
+			os.Exit(1)
+		}
+		graph := discovery.BuildGraph(neighbors)
+
+		w := os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Printf("Error creating output file: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch format {
+		case "dot":
+			err = graph.WriteDOT(w)
+		case "json":
+			err = graph.WriteJSON(w)
+		default:
+			fmt.Printf("Error: unknown format '%s' (use dot or json)\n", format)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error writing graph: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// discoverApproveCmd marks pending devices as active so they are backed up.
+var discoverApproveCmd = &cobra.Command{
+	Use:   "approve [host...]",
+	Short: "Approves pending devices for backup",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, host := range args {
+			dev, err := deviceStore.GetDeviceByHost(host)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			dev.Status = models.DeviceStatusActive
+			if err := deviceStore.UpdateDevice(*dev); err != nil {
+				fmt.Printf("Error updating device: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✅ Device '%s' approved.\n", host)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+	discoverCmd.AddCommand(discoverGraphCmd)
+	discoverCmd.AddCommand(discoverApproveCmd)
+
+	discoverCmd.Flags().Int("depth", 2, "Maximum number of hops to crawl from the seed devices")
+	discoverCmd.Flags().StringSlice("subnet", []string{}, "Only crawl management addresses in this CIDR (can be specified multiple times)")
+	discoverCmd.Flags().StringSlice("blacklist", []string{}, "Never crawl or add this host (can be specified multiple times)")
+	discoverCmd.Flags().Int("workers", 10, "Number of devices to query concurrently")
+	discoverCmd.Flags().Int("timeout", 10, "Connection timeout in seconds")
+	discoverCmd.Flags().Bool("dry-run", false, "Print discovered devices without saving anything")
+
+	discoverGraphCmd.Flags().String("format", "dot", "Output format (dot or json)")
+	discoverGraphCmd.Flags().StringP("output", "o", "", "Write the graph to a file instead of stdout")
+}
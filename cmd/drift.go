@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/golden"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// driftCmd compares the latest backups with the golden config templates.
+var driftCmd = &cobra.Command{
+	Use:   "drift [host...]",
+	Short: "Compares the latest backups with the golden config of each device's role",
+	Long: `Renders the golden config template of each device's role (<golden-dir>/<role>.tmpl)
+with the device's variables and compares it with the configuration in the latest backup.
+
+Lines are compared as an indented hierarchy. By default only the sections declared in the
+template are checked for extra lines; use --strict to also report top-level lines the
+template does not mention. Devices without a role are skipped when no hosts are given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		goldenDir, _ := cmd.Flags().GetString("golden")
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+		strict, _ := cmd.Flags().GetBool("strict")
+		showIntent, _ := cmd.Flags().GetBool("show-intent")
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		var devices []models.Device
+		if len(args) == 0 {
+			all, err := deviceStore.GetAllDevices()
+			if err != nil {
+				fmt.Printf("Error loading devices: %v\n", err)
+				os.Exit(1)
+			}
+			for _, dev := range all {
+				if !dev.IsPending() && dev.Role != "" {
+					devices = append(devices, dev)
+				}
+			}
+		} else {
+			for _, host := range args {
+				dev, err := deviceStore.GetDeviceByHost(host)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				devices = append(devices, *dev)
+			}
+		}
+		if len(devices) == 0 {
+			fmt.Println("No devices with a role. Set one with 'netcfg-backup edit'.")
+			return
+		}
+
+		renderer := golden.NewRenderer(goldenDir)
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		drifted := 0
+		for _, dev := range devices {
+			report, err := backupService.DetectDrift(renderer, dev, configdiff.Options{Strict: strict})
+			if errors.Is(err, golden.ErrNoRole) {
+				fmt.Printf("⚠️  %s: no role set, skipping\n", dev.Host)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("⚠️  %s: %v\n", dev.Host, err)
+				continue
+			}
+
+			if showIntent {
+				fmt.Printf("\n--- Golden config of %s (role %s) ---\n%s\n", dev.Host, dev.Role, report.Intent)
+			}
+			if report.Diff.Empty() {
+				fmt.Printf("✅ %s: no drift (role %s)\n", dev.Host, dev.Role)
+				continue
+			}
+			drifted++
+			fmt.Printf("\n❌ %s: %d missing, %d extra (role %s, %s)\n",
+				dev.Host, len(report.Diff.Missing), len(report.Diff.Extra), dev.Role, report.Backup)
+			for _, c := range report.Diff.Missing {
+				fmt.Printf("  - %s\n", c)
+			}
+			for _, c := range report.Diff.Extra {
+				fmt.Printf("  + %s\n", c)
+			}
+		}
+
+		if drifted > 0 {
+			fmt.Printf("\n%d devices drifted from their golden config.\n", drifted)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+
+	driftCmd.Flags().String("golden", "golden", "Directory with golden config templates (<role>.tmpl)")
+	driftCmd.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	driftCmd.Flags().Bool("strict", false, "Also report top-level lines that the template does not mention")
+	driftCmd.Flags().Bool("show-intent", false, "Print the rendered golden config")
+}
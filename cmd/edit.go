@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/cobrich/netcfg-backup/models"
 	"github.com/cobrich/netcfg-backup/storage"
 	"github.com/spf13/cobra"
 )
@@ -45,14 +46,20 @@ For each field, the current value is displayed. Press Enter to keep the current
 		// Interactively ask for new values, showing the old ones as defaults
 		device.Username = askQuestionWithDefault(reader, "Username", device.Username)
 
+		platform := device.Platform
+		if platform == "" {
+			platform = models.PlatformGeneric
+		}
+		device.Platform = askChoiceWithDefault(reader, "Platform", models.Platforms, platform)
+
 		// Edit Protocol
 		// Note: Changing protocol might invalidate auth method, so we handle that.
-		newProtocol := askChoiceWithDefault(reader, "Protocol (ssh/telnet)", []string{"ssh", "telnet"}, device.Protocol)
+		newProtocol := askChoiceWithDefault(reader, "Protocol ("+strings.Join(models.Protocols, "/")+")", models.Protocols, device.Protocol)
 		protocolChanged := newProtocol != device.Protocol
 		device.Protocol = newProtocol
 
 		// Edit Auth Method (conditionally)
-		if device.Protocol == "ssh" {
+		if device.Protocol == "ssh" || device.Protocol == "netconf" {
 			currentAuthMethod := "password"
 			if device.KeyPath != "" {
 				currentAuthMethod = "key"
@@ -71,6 +78,12 @@ For each field, the current value is displayed. Press Enter to keep the current
 				device.PasswordEnv = askQuestionWithDefault(reader, "Environment variable for the password", device.PasswordEnv)
 				device.KeyPath = "" // Clear key path if password is used
 			}
+		} else if device.Protocol == "http" {
+			device.HTTP = askHTTPSettings(reader, device.HTTP)
+			if device.HTTP.Auth != models.HTTPAuthNone {
+				device.PasswordEnv = askQuestionWithDefault(reader, "Environment variable for the password or token", device.PasswordEnv)
+			}
+			device.KeyPath = "" // Clear key path for HTTP
 		} else { // telnet
 			device.PasswordEnv = askQuestionWithDefault(reader, "Environment variable for the password", device.PasswordEnv)
 			device.Prompt = askQuestionWithDefault(reader, "Telnet prompt symbol", device.Prompt)
@@ -82,6 +95,9 @@ For each field, the current value is displayed. Press Enter to keep the current
 			device.Prompt = askQuestionWithDefault(reader, "Telnet prompt symbol", "#")
 		}
 
+		device.Tags = models.ParseTags(askQuestionWithDefault(reader, "Tags (comma-separated)", strings.Join(device.Tags, ",")))
+		device.Role = askQuestionWithDefault(reader, "Role for golden config", device.Role)
+
 		// Edit Commands
 		fmt.Printf("Current commands: %v\n", device.Commands)
 		if askChoice(reader, "Do you want to re-enter all commands?", []string{"yes", "no"}) == "yes" {
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cobrich/netcfg-backup/connectors"
@@ -31,6 +34,11 @@ All connection parameters must be provided via command-line flags.`,
 		timeout := time.Duration(timeoutSeconds) * time.Second
 		allowInsecure, _ := cmd.Flags().GetBool("insecure-algos")
 		telnetPrompt, _ := cmd.Flags().GetString("prompt")
+		httpScheme, _ := cmd.Flags().GetString("http-scheme")
+		httpAuth, _ := cmd.Flags().GetString("http-auth")
+		tokenHeader, _ := cmd.Flags().GetString("http-token-header")
+		loginPath, _ := cmd.Flags().GetString("http-login-path")
+		caFile, _ := cmd.Flags().GetString("ca-file")
 
 		// Simple validation
 		if host == "" || username == "" || len(commands) == 0 {
@@ -40,11 +48,26 @@ All connection parameters must be provided via command-line flags.`,
 
 		// Create only one Device object
 		device := models.Device{
-			Host:     host,
-			Username: username,
-			Protocol: protocol,
-			KeyPath:  keyPath,
-			Commands: commands,
+			Host:               host,
+			Username:           username,
+			Protocol:           protocol,
+			KeyPath:            keyPath,
+			Commands:           commands,
+			Prompt:             telnetPrompt,
+			AllowInsecureAlgos: allowInsecure,
+		}
+		if protocol == "http" {
+			device.HTTP = &models.HTTPSettings{
+				Scheme:      httpScheme,
+				Auth:        httpAuth,
+				TokenHeader: tokenHeader,
+				LoginPath:   loginPath,
+				CAFile:      caFile,
+			}
+			if err := device.HTTP.Validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
 		if passwordEnv != "" {
@@ -57,32 +80,15 @@ All connection parameters must be provided via command-line flags.`,
 			"protocol": device.Protocol,
 		})
 
-		var connector connectors.Connector
-
-		switch device.Protocol {
-		case "ssh":
-			connector = &connectors.SSHConnector{
-				Host:               device.Host,
-				Username:           device.Username,
-				Password:           device.Password,
-				KeyPath:            device.KeyPath,
-				Timeout:            timeout,
-				AllowInsecureAlgos: allowInsecure,
-			}
-		case "telnet":
-			connector = &connectors.TelnetConnector{
-				Host:     device.Host,
-				Username: device.Username,
-				Password: device.Password,
-				Prompt:   telnetPrompt,
-				Timeout:  timeout,
-			}
-		default:
+		connector, err := connectors.New(device, timeout)
+		if err != nil {
 			entry.Errorf("Unknown protocol: %s", device.Protocol)
 			os.Exit(1)
 		}
 
-		results, err := connector.RunCommands(device.Commands)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		results, err := connector.RunCommands(ctx, device.Commands)
 		if err != nil {
 			entry.Errorf("Error executing commands: %v", err)
 			os.Exit(1)
@@ -102,11 +108,16 @@ func init() {
 	// Define flags for exec
 	execCmd.Flags().String("host", "", "Target device hostname or IP address (required)")
 	execCmd.Flags().String("username", "", "Username for authentication (required)")
-	execCmd.Flags().String("protocol", "ssh", "Connection protocol (ssh or telnet)")
+	execCmd.Flags().String("protocol", "ssh", "Connection protocol (ssh, telnet, netconf or http)")
 	execCmd.Flags().String("key-path", "", "Path to SSH private key file")
 	execCmd.Flags().String("password-env", "", "Environment variable for the password")
 	execCmd.Flags().StringSlice("command", []string{}, "Command to execute (required, can be specified multiple times)")
 	execCmd.Flags().Int("timeout", 15, "Connection timeout in seconds")
 	execCmd.Flags().Bool("insecure-algos", false, "Allow insecure legacy SSH algorithms")
 	execCmd.Flags().String("prompt", "#", "Telnet prompt symbol to expect")
+	execCmd.Flags().String("http-scheme", "https", "URL scheme of the http protocol (https or http)")
+	execCmd.Flags().String("http-auth", models.HTTPAuthBasic, "Authentication of the http protocol (none, basic, token or login)")
+	execCmd.Flags().String("http-token-header", "", "Header of the token auth (default: Authorization: Bearer)")
+	execCmd.Flags().String("http-login-path", "", "Path the login auth posts the credentials to")
+	execCmd.Flags().String("ca-file", "", "CA file to verify the certificate of the http protocol with")
 }
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// factsCmd represents the facts command
+var factsCmd = &cobra.Command{
+	Use:   "facts [host...]",
+	Short: "Collects device facts (model, serial, OS version, uptime)",
+	Long: `Runs the platform-specific fact commands on the given devices, or on all active
+devices if none are given, and stores the parsed facts in the database.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		var devices []models.Device
+		if len(args) == 0 {
+			all, err := deviceStore.GetAllDevices()
+			if err != nil {
+				fmt.Printf("Error loading devices: %v\n", err)
+				os.Exit(1)
+			}
+			for _, dev := range all {
+				if !dev.IsPending() {
+					devices = append(devices, dev)
+				}
+			}
+		} else {
+			for _, host := range args {
+				dev, err := deviceStore.GetDeviceByHost(host)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				devices = append(devices, *dev)
+			}
+		}
+
+		if len(devices) == 0 {
+			fmt.Println("No devices configured. Use 'netcfg-backup add' to add one.")
+			return
+		}
+
+		backupService := core.NewBackupService(deviceStore, "", numWorkers)
+		collected, failed := backupService.CollectFacts(devices)
+
+		printFactsTable(collected)
+		for host, err := range failed {
+			fmt.Printf("⚠️  %s: %v\n", host, err)
+		}
+		fmt.Printf("\n✅ Facts collected from %d of %d devices.\n", len(collected), len(devices))
+	},
+}
+
+// factsShowCmd prints the facts history of a device.
+var factsShowCmd = &cobra.Command{
+	Use:   "show [host]",
+	Short: "Shows the facts history of a device",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		history, err := deviceStore.GetFactsHistory(args[0], limit)
+		if err != nil {
+			fmt.Printf("Error loading facts: %v\n", err)
+			os.Exit(1)
+		}
+		if len(history) == 0 {
+			fmt.Printf("No facts collected for '%s' yet. Use 'netcfg-backup facts %s'.\n", args[0], args[0])
+			return
+		}
+
+		fmt.Printf("%-20s %-20s %-20s %-15s %s\n", "COLLECTED", "MODEL", "SERIAL", "OS VERSION", "UPTIME")
+		fmt.Println("--------------------------------------------------------------------------------------------")
+		for _, f := range history {
+			fmt.Printf("%-20s %-20s %-20s %-15s %s\n", f.CollectedAt.Format("2006-01-02 15:04:05"), f.Model, f.SerialNumber, f.OSVersion, f.Uptime)
+		}
+	},
+}
+
+// factsReportCmd prints a hardware and software inventory summary.
+var factsReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Prints a hardware and software inventory report",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		latest, err := deviceStore.GetLatestFacts()
+		if err != nil {
+			fmt.Printf("Error loading facts: %v\n", err)
+			os.Exit(1)
+		}
+		if len(latest) == 0 {
+			fmt.Println("No facts collected yet. Use 'netcfg-backup facts' first.")
+			return
+		}
+
+		report := core.BuildInventoryReport(latest)
+
+		fmt.Printf("%-10s %-25s %s\n", "VENDOR", "MODEL", "COUNT")
+		fmt.Println("------------------------------------------")
+		for _, row := range report.Models {
+			fmt.Printf("%-10s %-25s %d\n", row.Vendor, row.Name, row.Count)
+		}
+		fmt.Println()
+		fmt.Printf("%-10s %-25s %s\n", "VENDOR", "OS VERSION", "COUNT")
+		fmt.Println("------------------------------------------")
+		for _, row := range report.OSVersions {
+			fmt.Printf("%-10s %-25s %d\n", row.Vendor, row.Name, row.Count)
+		}
+	},
+}
+
+// printFactsTable prints collected facts sorted by host.
+func printFactsTable(collected []models.DeviceFacts) {
+	sort.Slice(collected, func(i, j int) bool { return collected[i].Host < collected[j].Host })
+
+	fmt.Printf("%-20s %-20s %-10s %-20s %-20s %s\n", "HOST", "HOSTNAME", "VENDOR", "MODEL", "SERIAL", "OS VERSION")
+	fmt.Println("------------------------------------------------------------------------------------------------------------")
+	for _, f := range collected {
+		fmt.Printf("%-20s %-20s %-10s %-20s %-20s %s\n", f.Host, f.Hostname, f.Vendor, f.Model, f.SerialNumber, f.OSVersion)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(factsCmd)
+	factsCmd.AddCommand(factsShowCmd)
+	factsCmd.AddCommand(factsReportCmd)
+
+	factsShowCmd.Flags().Int("limit", 20, "Maximum number of records to show")
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// jobCmd groups the bulk configuration change subcommands.
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "Manages bulk configuration change jobs",
+	Long: `A change job pushes a configuration snippet to every device matched by a selector.
+The snippet is a Go template rendered per device with the same data as golden config
+templates ({{.Host}}, {{.Vars.name}}, hasTag ...).
+
+Each device gets a backup before and after its change; a change the device rejects,
+or after which the device cannot be backed up, is rolled back. With --canary N the job
+first changes N devices and waits for 'job approve'. Once more than --max-failures
+devices have failed, the remaining ones are skipped and the job is aborted.`,
+}
+
+// jobCreateCmd creates a change job, or previews it with --dry-run.
+var jobCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a change job from a template file",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		name, _ := cmd.Flags().GetString("name")
+		templateFile, _ := cmd.Flags().GetString("template")
+		hosts, _ := cmd.Flags().GetStringSlice("host")
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		platforms, _ := cmd.Flags().GetStringSlice("platform")
+		roles, _ := cmd.Flags().GetStringSlice("role")
+		canary, _ := cmd.Flags().GetInt("canary")
+		maxFailures, _ := cmd.Flags().GetInt("max-failures")
+		confirmTimeout, _ := cmd.Flags().GetDuration("confirm-timeout")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+
+		text, err := os.ReadFile(templateFile)
+		if err != nil {
+			fmt.Printf("Error reading template: %v\n", err)
+			os.Exit(1)
+		}
+		if name == "" {
+			name = templateFile
+		}
+
+		job := models.ChangeJob{
+			Name:     name,
+			User:     currentUser(),
+			Template: string(text),
+			Selector: models.DeviceSelector{
+				Hosts:     hosts,
+				Tags:      tags,
+				Platforms: platforms,
+				Roles:     roles,
+			},
+			Canary:         canary,
+			MaxFailures:    maxFailures,
+			ConfirmTimeout: confirmTimeout,
+			Force:          force,
+			Status:         models.JobPending,
+		}
+
+		deviceStore := openSQLiteStore()
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		if dryRun {
+			printChangePreviews(backupService, &job)
+			return
+		}
+
+		id, err := deviceStore.CreateChangeJob(job)
+		if err != nil {
+			fmt.Printf("Error creating job: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Change job %d created. Preview it with 'job run %d --dry-run' and start it with 'job run %d'.\n", id, id, id)
+	},
+}
+
+// jobRunCmd starts a pending job.
+var jobRunCmd = &cobra.Command{
+	Use:   "run [id]",
+	Short: "Starts a change job (its canary stage if it has one)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+
+		deviceStore := openSQLiteStore()
+		job := loadJob(deviceStore, args[0])
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		if dryRun {
+			printChangePreviews(backupService, job)
+			return
+		}
+
+		err := backupService.RunChangeJob(job)
+		printJobResults(deviceStore, job)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n", err)
+			os.Exit(1)
+		}
+		if job.Status == models.JobAwaitingApproval {
+			fmt.Printf("\nCanary stage done. Continue with 'job approve %d' or stop with 'job abort %d'.\n", job.ID, job.ID)
+		}
+	},
+}
+
+// jobApproveCmd rolls a job out after its canary stage.
+var jobApproveCmd = &cobra.Command{
+	Use:   "approve [id]",
+	Short: "Rolls a change job out to the remaining devices after its canary stage",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+
+		deviceStore := openSQLiteStore()
+		job := loadJob(deviceStore, args[0])
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		err := backupService.ApproveChangeJob(job)
+		printJobResults(deviceStore, job)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// jobAbortCmd stops a job that has not finished.
+var jobAbortCmd = &cobra.Command{
+	Use:   "abort [id]",
+	Short: "Aborts a pending change job or one awaiting approval",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceStore := openSQLiteStore()
+		job := loadJob(deviceStore, args[0])
+		if job.Status != models.JobPending && job.Status != models.JobAwaitingApproval {
+			fmt.Printf("Error: change job %d is %s.\n", job.ID, job.Status)
+			os.Exit(1)
+		}
+		if err := deviceStore.UpdateChangeJobStatus(job.ID, models.JobAborted); err != nil {
+			fmt.Printf("Error aborting job: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Change job %d aborted.\n", job.ID)
+	},
+}
+
+// jobListCmd lists the most recent jobs.
+var jobListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists change jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		jobs, err := openSQLiteStore().ListChangeJobs(limit)
+		if err != nil {
+			fmt.Printf("Error loading jobs: %v\n", err)
+			os.Exit(1)
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No change jobs yet. Create one with 'netcfg-backup job create'.")
+			return
+		}
+		fmt.Printf("%-5s %-25s %-18s %-12s %-7s %-12s %s\n", "ID", "NAME", "STATUS", "USER", "CANARY", "MAX FAILS", "CREATED")
+		for _, j := range jobs {
+			fmt.Printf("%-5d %-25s %-18s %-12s %-7d %-12d %s\n",
+				j.ID, j.Name, j.Status, j.User, j.Canary, j.MaxFailures, j.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+// jobShowCmd prints a job and its per-device results.
+var jobShowCmd = &cobra.Command{
+	Use:   "show [id]",
+	Short: "Shows a change job and its per-device results",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceStore := openSQLiteStore()
+		job := loadJob(deviceStore, args[0])
+
+		fmt.Printf("Job %d: %s (%s)\n", job.ID, job.Name, job.Status)
+		fmt.Printf("Created by %s at %s\n", job.User, job.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Selector: %+v\n", job.Selector)
+		fmt.Printf("Template:\n%s\n", job.Template)
+		printJobResults(deviceStore, job)
+	},
+}
+
+// printChangePreviews renders a job for every selected device and prints the diffs.
+func printChangePreviews(backupService *core.BackupService, job *models.ChangeJob) {
+	previews, err := backupService.PreviewChangeJob(job)
+	if err != nil {
+		fmt.Printf("Error previewing job: %v\n", err)
+		os.Exit(1)
+	}
+	if len(previews) == 0 {
+		fmt.Println("The selector matches no devices.")
+		return
+	}
+	for i, p := range previews {
+		stage := models.StageRollout
+		if job.Canary > 0 && i < job.Canary && job.Canary < len(previews) {
+			stage = models.StageCanary
+		}
+		fmt.Printf("\n=== %s (%s) ===\n", p.Host, stage)
+		if p.Error != "" {
+			fmt.Printf("⚠️  %s\n", p.Error)
+			continue
+		}
+		printPushPreview(p.Preview)
+	}
+}
+
+// printJobResults prints the per-device results of a job.
+func printJobResults(deviceStore storage.ChangeJobStore, job *models.ChangeJob) {
+	results, err := deviceStore.GetChangeJobResults(job.ID)
+	if err != nil {
+		fmt.Printf("Error loading job results: %v\n", err)
+		return
+	}
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("\n%-20s %-8s %-10s %-6s %-8s %s\n", "HOST", "STAGE", "STATUS", "ADDED", "REMOVED", "MESSAGE")
+	for _, r := range results {
+		fmt.Printf("%-20s %-8s %-10s %-6d %-8d %s\n", r.Host, r.Stage, r.Status, r.Added, r.Removed, r.Message)
+	}
+}
+
+// openSQLiteStore opens the database or exits.
+func openSQLiteStore() *storage.SQLiteStore {
+	dbPath, err := storage.GetDefaultDBPath()
+	if err != nil {
+		fmt.Printf("Error determining database path: %v\n", err)
+		os.Exit(1)
+	}
+	deviceStore, err := storage.NewSQLiteStore(dbPath)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	return deviceStore
+}
+
+// loadJob loads a job by its ID argument.
+func loadJob(deviceStore *storage.SQLiteStore, arg string) *models.ChangeJob {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		fmt.Printf("Error: invalid job ID '%s'\n", arg)
+		os.Exit(1)
+	}
+	job, err := deviceStore.GetChangeJob(id)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return job
+}
+
+func init() {
+	rootCmd.AddCommand(jobCmd)
+	jobCmd.AddCommand(jobCreateCmd)
+	jobCmd.AddCommand(jobRunCmd)
+	jobCmd.AddCommand(jobApproveCmd)
+	jobCmd.AddCommand(jobAbortCmd)
+	jobCmd.AddCommand(jobListCmd)
+	jobCmd.AddCommand(jobShowCmd)
+
+	jobCreateCmd.Flags().String("name", "", "Name of the job (default: the template file)")
+	jobCreateCmd.Flags().StringP("template", "t", "", "File with the configuration snippet (Go template)")
+	jobCreateCmd.MarkFlagRequired("template")
+	jobCreateCmd.Flags().StringSlice("host", nil, "Select hosts matching these patterns (e.g. 'sw-*')")
+	jobCreateCmd.Flags().StringSlice("tag", nil, "Select devices with any of these tags")
+	jobCreateCmd.Flags().StringSlice("platform", nil, "Select devices of these platforms")
+	jobCreateCmd.Flags().StringSlice("role", nil, "Select devices with these roles")
+	jobCreateCmd.Flags().Int("canary", 0, "Change this many devices first and wait for approval")
+	jobCreateCmd.Flags().Int("max-failures", 0, "Abort the job once more devices than this have failed")
+	jobCreateCmd.Flags().Duration("confirm-timeout", 5*time.Minute, "Rollback timer armed on each device while its change is verified")
+	jobCreateCmd.Flags().Bool("force", false, "Also change platforms without a rollback mechanism")
+	jobCreateCmd.Flags().Bool("dry-run", false, "Only render the snippet and show each device's diff")
+
+	for _, c := range []*cobra.Command{jobCreateCmd, jobRunCmd, jobApproveCmd} {
+		c.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	}
+	jobRunCmd.Flags().Bool("dry-run", false, "Only render the snippet and show each device's diff")
+	jobListCmd.Flags().Int("limit", 20, "Number of jobs to show")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/cobrich/netcfg-backup/models"
 	"github.com/cobrich/netcfg-backup/storage"
 	"github.com/spf13/cobra"
 )
@@ -40,9 +41,20 @@ var listCmd = &cobra.Command{
 			return
 		}
 
+		wide, _ := cmd.Flags().GetBool("wide")
+		if wide {
+			latest, err := deviceStore.GetLatestFacts()
+			if err != nil {
+				fmt.Printf("Error loading facts: %v\n", err)
+				os.Exit(1)
+			}
+			printWideList(devices, latest)
+			return
+		}
+
 		// Print a nice table header
-		fmt.Printf("%-20s %-15s %-10s %s\n", "HOST", "USERNAME", "PROTOCOL", "AUTH METHOD")
-		fmt.Println("-----------------------------------------------------------------")
+		fmt.Printf("%-20s %-15s %-10s %-12s %s\n", "HOST", "USERNAME", "PROTOCOL", "AUTH METHOD", "STATUS")
+		fmt.Println("------------------------------------------------------------------------")
 
 		// Loop through the devices and print the information
 		for _, dev := range devices {
@@ -50,11 +62,27 @@ var listCmd = &cobra.Command{
 			if dev.KeyPath != "" {
 				authMethod = "SSH Key"
 			}
-			fmt.Printf("%-20s %-15s %-10s %s\n", dev.Host, dev.Username, dev.Protocol, authMethod)
+			status := dev.Status
+			if status == "" {
+				status = models.DeviceStatusActive
+			}
+			fmt.Printf("%-20s %-15s %-10s %-12s %s\n", dev.Host, dev.Username, dev.Protocol, authMethod, status)
 		}
 	},
 }
 
+// printWideList prints the devices together with their latest collected facts.
+func printWideList(devices []models.Device, latest map[string]models.DeviceFacts) {
+	fmt.Printf("%-20s %-15s %-10s %-20s %-20s %-15s %s\n", "HOST", "PLATFORM", "PROTOCOL", "MODEL", "SERIAL", "OS VERSION", "UPTIME")
+	fmt.Println("------------------------------------------------------------------------------------------------------------------------")
+	for _, dev := range devices {
+		f := latest[dev.Host]
+		fmt.Printf("%-20s %-15s %-10s %-20s %-20s %-15s %s\n", dev.Host, dev.Platform, dev.Protocol, f.Model, f.SerialNumber, f.OSVersion, f.Uptime)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().BoolP("wide", "w", false, "Also show the latest collected facts (model, serial, OS version, uptime)")
 }
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/notify"
+	"github.com/spf13/cobra"
+)
+
+// notifyCmd groups the notification subcommands.
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Manages notifications about failures, changes and compliance violations",
+}
+
+// notifyTestCmd sends a test notification to every configured notifier.
+var notifyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Sends a test notification to every notifier in the configuration file",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("config")
+		dispatcher, err := loadNotifications(file)
+		if err != nil {
+			fmt.Printf("Error loading notification config: %v\n", err)
+			os.Exit(1)
+		}
+		if dispatcher == nil {
+			fmt.Printf("Notification config '%s' not found.\n", file)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		errs := dispatcher.Test(ctx)
+
+		names := make([]string, 0, len(errs))
+		for name := range errs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		failed := false
+		for _, name := range names {
+			if errs[name] != nil {
+				fmt.Printf("❌ %s: %v\n", name, errs[name])
+				failed = true
+			} else {
+				fmt.Printf("✅ %s\n", name)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadNotifications reads the notification config. A missing file disables notifications.
+func loadNotifications(file string) (*notify.Dispatcher, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return notify.LoadConfig(file)
+}
+
+func init() {
+	rootCmd.AddCommand(notifyCmd)
+	notifyCmd.AddCommand(notifyTestCmd)
+
+	notifyTestCmd.Flags().String("config", "notifications.yaml", "Notification configuration file")
+}
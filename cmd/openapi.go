@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cobrich/netcfg-backup/server"
+	"github.com/spf13/cobra"
+)
+
+// openapiCmd prints the OpenAPI document of the REST API.
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Prints the OpenAPI document of the REST API",
+	Long: `Prints the OpenAPI 3 document of the /api/v1 REST API. The running server
+also serves it at /api/v1/openapi.json.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		data, err := json.MarshalIndent(server.OpenAPISpec(), "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating document: %v\n", err)
+			os.Exit(1)
+		}
+		data = append(data, '\n')
+
+		if output == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			fmt.Printf("Error writing document: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ OpenAPI document written to %s\n", output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+
+	openapiCmd.Flags().StringP("output", "o", "", "Write the document to this file instead of stdout")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/parser"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// parseCmd represents the parse command
+var parseCmd = &cobra.Command{
+	Use:   "parse [host]",
+	Short: "Shows structured records (interfaces, VLANs, routes, users, NTP) from a backup",
+	Long: `Parses a stored backup of a device into structured records using the templates
+for the device's platform. The latest backup is used unless --file is given.
+
+The records are also saved as JSON next to the backup file, so other tools can
+read them without parsing the raw output.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		host := args[0]
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+		file, _ := cmd.Flags().GetString("file")
+		recordType, _ := cmd.Flags().GetString("type")
+		format, _ := cmd.Flags().GetString("format")
+		reparse, _ := cmd.Flags().GetBool("reparse")
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Backups of devices removed from the inventory are parsed with all templates.
+		dev := models.Device{Host: host, Platform: models.PlatformGeneric}
+		if stored, err := deviceStore.GetDeviceByHost(host); err == nil {
+			dev = *stored
+		}
+
+		var backupFile string
+		if file != "" {
+			backupFile = filepath.Join(backupPath, host, filepath.Base(file))
+		} else {
+			backupFile, err = utils.LatestBackupFile(backupPath, host)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if reparse {
+			os.Remove(parser.JSONPath(backupFile))
+		}
+		doc, err := core.LoadRecords(dev, backupFile)
+		if err != nil {
+			fmt.Printf("Error reading backup: %v\n", err)
+			os.Exit(1)
+		}
+		records := parser.Filter(doc.Records, recordType)
+
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(records); err != nil {
+				fmt.Printf("Error encoding records: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Printf("Backup: %s\n", doc.Backup)
+		for _, t := range parser.RecordTypes(records) {
+			fmt.Printf("\n=== %s (%d) ===\n", t, len(records[t]))
+			printRecords(records[t])
+		}
+	},
+}
+
+// printRecords prints records as a table whose columns are the union of their fields.
+func printRecords(records []parser.Record) {
+	if len(records) == 0 {
+		fmt.Println("(none)")
+		return
+	}
+
+	seen := make(map[string]bool)
+	var columns []string
+	for _, rec := range records {
+		for k := range rec {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, rec := range records {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = rec[c]
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(parseCmd)
+
+	parseCmd.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	parseCmd.Flags().String("file", "", "Backup file name to parse (default: latest)")
+	parseCmd.Flags().String("type", "", "Only show one record type (interfaces, vlans, static_routes, users, ntp_servers)")
+	parseCmd.Flags().String("format", "table", "Output format (table or json)")
+	parseCmd.Flags().Bool("reparse", false, "Ignore stored records and parse the backup again")
+}
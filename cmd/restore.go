@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd pushes a stored backup or a set of lines back to a device.
+var restoreCmd = &cobra.Command{
+	Use:   "restore [host] [backup]",
+	Short: "Restores a backup or pushes configuration lines to a device",
+	Long: `Pushes the configuration of a stored backup (a file name in the host's backup
+directory, a path, or "latest") back to the device, replacing its running configuration.
+With --lines, the lines of the given file are merged into the running configuration instead.
+
+The change is previewed first. After it is applied, a backup is taken to verify that the
+device is still reachable, and the change must be confirmed before --confirm-timeout or it
+is rolled back. Platform mechanisms protect the change where they exist: IOS revert timers
+or "configure replace" (with --replace-url), NX-OS checkpoints, EOS configuration sessions
+with a commit timer and JunOS "commit confirmed". A backup is taken before every change and
+every push is recorded in the audit log.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.InitLogger()
+
+		host := args[0]
+		backupPath, _ := cmd.Flags().GetString("backup-path")
+		linesFile, _ := cmd.Flags().GetString("lines")
+		merge, _ := cmd.Flags().GetBool("merge")
+		replaceURL, _ := cmd.Flags().GetString("replace-url")
+		confirmTimeout, _ := cmd.Flags().GetDuration("confirm-timeout")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		assumeYes, _ := cmd.Flags().GetBool("yes")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if (len(args) == 2) == (linesFile != "") {
+			fmt.Println("Error: give either a backup or --lines.")
+			os.Exit(1)
+		}
+
+		dbPath, err := storage.GetDefaultDBPath()
+		if err != nil {
+			fmt.Printf("Error determining database path: %v\n", err)
+			os.Exit(1)
+		}
+		deviceStore, err := storage.NewSQLiteStore(dbPath)
+		if err != nil {
+			fmt.Printf("Error opening database: %v\n", err)
+			os.Exit(1)
+		}
+		dev, err := deviceStore.GetDeviceByHost(host)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := core.PushOptions{
+			ReplaceURL:     replaceURL,
+			ConfirmTimeout: confirmTimeout,
+			Force:          force,
+			User:           currentUser(),
+		}
+		if linesFile != "" {
+			data, err := os.ReadFile(linesFile)
+			if err != nil {
+				fmt.Printf("Error reading lines: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Lines = strings.Split(string(data), "\n")
+			opts.Source = "lines:" + filepath.Base(linesFile)
+		} else {
+			backupFile, err := resolveBackupFile(backupPath, host, args[1])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			results, err := utils.ReadBackupFile(backupFile)
+			if err != nil {
+				fmt.Printf("Error reading backup: %v\n", err)
+				os.Exit(1)
+			}
+			running, err := core.RunningConfig(dev.Platform, results)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Lines = strings.Split(running, "\n")
+			opts.Replace = !merge
+			opts.Source = "backup:" + filepath.Base(backupFile)
+		}
+
+		backupService := core.NewBackupService(deviceStore, backupPath, numWorkers)
+
+		preview, err := backupService.PreviewPush(*dev, opts)
+		if err != nil {
+			fmt.Printf("Error preparing the change: %v\n", err)
+			os.Exit(1)
+		}
+		printPushPreview(preview)
+		if dryRun {
+			return
+		}
+		if preview.Warning != "" && !force {
+			fmt.Println("\nUse --force to push anyway.")
+			os.Exit(1)
+		}
+
+		reader := bufio.NewReader(os.Stdin)
+		if !assumeYes && askChoice(reader, "\nApply this change?", []string{"yes", "no"}) != "yes" {
+			fmt.Println("Aborted.")
+			return
+		}
+
+		result, err := backupService.Push(*dev, opts)
+		if result != nil {
+			printPushResult(result)
+		}
+		if err != nil {
+			fmt.Printf("\n❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\nThe change is rolled back at %s unless it is confirmed.\n", result.Deadline.Format("15:04:05"))
+		answer := make(chan string, 1)
+		go func() {
+			answer <- askChoice(reader, "Keep the change?", []string{"yes", "no"})
+		}()
+
+		select {
+		case a := <-answer:
+			if a == "yes" {
+				if err := backupService.ConfirmPush(result.ID, opts.User); err != nil {
+					fmt.Printf("❌ %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println("✅ Change confirmed.")
+				return
+			}
+			if err := backupService.RollbackPush(result.ID, opts.User); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		case <-time.After(time.Until(result.Deadline) + time.Second):
+			fmt.Println("\nNo confirmation received.")
+		}
+
+		status, _ := backupService.PushStatus(result.ID)
+		fmt.Printf("↩️  Change %s: %s\n", status.Status, status.Message)
+		os.Exit(1)
+	},
+}
+
+// resolveBackupFile finds a backup of a host by path, file name or "latest".
+func resolveBackupFile(basePath, host, name string) (string, error) {
+	if name == "latest" {
+		return utils.LatestBackupFile(basePath, host)
+	}
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	path := filepath.Join(basePath, host, filepath.Base(name))
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("backup '%s' of host '%s' not found", name, host)
+	}
+	return path, nil
+}
+
+// printPushPreview prints the line changes and commands of a planned push.
+func printPushPreview(p *core.PushPreview) {
+	if p.Backup != "" {
+		fmt.Printf("Preview against %s\n", p.Backup)
+	}
+	fmt.Printf("Mechanism: %s\n\n", p.Plan.Mechanism)
+	for _, c := range p.Diff.Missing {
+		fmt.Printf("  + %s\n", c)
+	}
+	for _, c := range p.Diff.Extra {
+		fmt.Printf("  - %s\n", c)
+	}
+	if p.Diff.Empty() {
+		fmt.Println("  (no line changes)")
+	}
+	fmt.Println("\nCommands:")
+	for _, l := range p.Plan.Apply {
+		fmt.Printf("  %s\n", l)
+	}
+	if p.Warning != "" {
+		fmt.Printf("\n⚠️  %s\n", p.Warning)
+	}
+}
+
+// printPushResult prints what a push changed on the device.
+func printPushResult(r *core.PushResult) {
+	fmt.Printf("\nPush #%d to %s: %s\n", r.ID, r.Host, r.Status)
+	fmt.Printf("  Pre-change backup:  %s\n", r.PreBackup)
+	if r.PostBackup != "" {
+		fmt.Printf("  Post-change backup: %s\n", r.PostBackup)
+	}
+	for _, e := range r.Errors {
+		fmt.Printf("  ! %s\n", e)
+	}
+	for _, c := range r.Diff.Missing {
+		fmt.Printf("  + %s\n", c)
+	}
+	for _, c := range r.Diff.Extra {
+		fmt.Printf("  - %s\n", c)
+	}
+	if r.Message != "" {
+		fmt.Printf("  %s\n", r.Message)
+	}
+}
+
+// currentUser returns the name of the OS user for the audit log.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	restoreCmd.Flags().String("lines", "", "File with configuration lines to merge instead of a backup")
+	restoreCmd.Flags().Bool("merge", false, "Merge the backup into the running configuration instead of replacing it")
+	restoreCmd.Flags().String("replace-url", "", "Location of the backup as seen from the device, for 'configure replace' (IOS, NX-OS)")
+	restoreCmd.Flags().Duration("confirm-timeout", 5*time.Minute, "Time to confirm the change before it is rolled back")
+	restoreCmd.Flags().Bool("dry-run", false, "Only show the preview")
+	restoreCmd.Flags().BoolP("yes", "y", false, "Apply without asking (the change must still be confirmed)")
+	restoreCmd.Flags().Bool("force", false, "Push to platforms without a rollback mechanism")
+}
@@ -1,11 +1,23 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/server"
 	"github.com/cobrich/netcfg-backup/storage"
 	"github.com/cobrich/netcfg-backup/utils"
 
@@ -18,7 +30,31 @@ const numWorkers = 10
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Runs the backup process for all configured devices",
+	Long: `Runs the backup process for all configured devices.
+
+With --follow the run is started on a running server instead, and its live
+progress is printed until it ends. Authenticate with an API token of the
+run-backup scope in --token or NETCFG_TOKEN. If a run is already in
+progress, that run is followed.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if follow, _ := cmd.Flags().GetBool("follow"); follow {
+			serverURL, _ := cmd.Flags().GetString("server")
+			token, _ := cmd.Flags().GetString("token")
+			if token == "" {
+				token = os.Getenv("NETCFG_TOKEN")
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			failed, err := followRun(ctx, strings.TrimRight(serverURL, "/"), token)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
 
 		backupPath := flag.String("backup-path", "backups", "Path to the backup directory")
 		flag.Parse()
@@ -56,17 +92,222 @@ var runCmd = &cobra.Command{
 			return
 		}
 
-		backupService := core.NewBackupService(deviceStore, *backupPath, 10) // 10 - numWorkers
-		if err := backupService.Run(); err != nil {
+		backupService := core.NewBackupService(deviceStore, *backupPath, numWorkers)
+		collectFacts, _ := cmd.Flags().GetBool("facts")
+		backupService.SetCollectFacts(collectFacts)
+		setRetry(cmd, backupService)
+		if err := setLimits(cmd, backupService); err != nil {
+			utils.Log.Fatalf("Failed to load limits: %v", err)
+		}
+
+		policiesDir, _ := cmd.Flags().GetString("policies")
+		engine, err := loadComplianceEngine(policiesDir)
+		if err != nil {
+			utils.Log.Fatalf("Failed to load compliance policies: %v", err)
+		}
+		if engine != nil {
+			backupService.SetCompliance(engine)
+		}
+		// Ctrl-C cancels the run; the devices being backed up are
+		// disconnected and recorded as cancelled.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := backupService.Run(ctx); err != nil {
 			utils.Log.Fatalf("Backup process failed: %v", err)
 		}
 	},
 }
 
+// followRun starts a backup run on a server, or joins the one in progress,
+// and prints its progress events until it finishes. Cancelling ctx cancels
+// the run on the server. It returns the number of failed or cancelled devices.
+func followRun(ctx context.Context, serverURL, token string) (int, error) {
+	// Subscribe before starting the run, so that no event is missed.
+	events, err := apiRequest("GET", serverURL+"/events", token, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer events.Body.Close()
+
+	var runID int64
+	resp, err := apiRequest("POST", serverURL+server.APIPrefix+"/runs", token, strings.NewReader("{}"))
+	if err != nil {
+		var apiErr *apiStatusError
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict {
+			return 0, err
+		}
+		fmt.Println("A run is already in progress; following it.")
+	} else {
+		var run models.Run
+		err = json.NewDecoder(resp.Body).Decode(&run)
+		resp.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("invalid response from server: %w", err)
+		}
+		runID = run.ID
+		fmt.Printf("Started run %d of %d devices.\n", run.ID, run.Total)
+	}
+
+	cancelled := make(chan int64, 1)
+	go func() {
+		<-ctx.Done()
+		id := <-cancelled
+		fmt.Printf("Cancelling run %d...\n", id)
+		resp, err := apiRequest("POST", fmt.Sprintf("%s%s/runs/%d/cancel", serverURL, server.APIPrefix, id), token, nil)
+		if err != nil {
+			fmt.Printf("Error cancelling run: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+
+	scanner := bufio.NewScanner(events.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev models.ProgressEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			continue
+		}
+		if runID == 0 {
+			runID = ev.RunID
+		}
+		if ev.RunID != runID {
+			continue
+		}
+		select {
+		case cancelled <- runID:
+		default:
+		}
+		printProgress(ev)
+		if ev.Type == models.ProgressRunFinished {
+			return ev.Failed + ev.Cancelled, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("event stream failed: %w", err)
+	}
+	return 0, errors.New("the server closed the event stream before the run finished")
+}
+
+// setRetry applies the --retries and --retry-delay flags to a backup service.
+func setRetry(cmd *cobra.Command, svc *core.BackupService) {
+	retries, _ := cmd.Flags().GetInt("retries")
+	delaySeconds, _ := cmd.Flags().GetInt("retry-delay")
+	svc.SetRetry(retries, time.Duration(delaySeconds)*time.Second, core.DefaultMaxRetryDelay)
+}
+
+// setLimits applies the --limits file and the --workers flag to a backup
+// service. An explicit --workers wins over the workers of the file.
+func setLimits(cmd *cobra.Command, svc *core.BackupService) error {
+	file, _ := cmd.Flags().GetString("limits")
+	if _, err := os.Stat(file); err == nil {
+		cfg, err := core.LoadLimits(file)
+		if err != nil {
+			return err
+		}
+		if err := svc.SetLimits(cfg); err != nil {
+			return fmt.Errorf("invalid limits config %s: %w", file, err)
+		}
+	}
+	if cmd.Flags().Changed("workers") {
+		workers, _ := cmd.Flags().GetInt("workers")
+		svc.SetWorkers(workers)
+	}
+	return nil
+}
+
+// addLimitFlags defines the flags read by setLimits.
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("workers", numWorkers, "Number of devices backed up at the same time")
+	cmd.Flags().String("limits", "limits.yaml", "Concurrency config with per-group limits, AAA rate limits and priorities")
+}
+
+// addRetryFlags defines the flags read by setRetry.
+func addRetryFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("retries", core.DefaultRetries, "Times to retry a device after a timeout or refused connection")
+	cmd.Flags().Int("retry-delay", int(core.DefaultRetryDelay/time.Second), "Seconds before the first retry; doubles with every retry")
+}
+
+// printProgress prints one progress event as a line.
+func printProgress(ev models.ProgressEvent) {
+	counter := fmt.Sprintf("[%d/%d]", ev.Done, ev.Total)
+	switch ev.Type {
+	case models.ProgressConnecting:
+		fmt.Printf("%s %s: connecting\n", counter, ev.Host)
+	case models.ProgressCommand:
+		fmt.Printf("%s %s: running '%s'\n", counter, ev.Host, ev.Command)
+	case models.ProgressRetrying:
+		fmt.Printf("%s %s: %s; retrying (attempt %d)\n", counter, ev.Host, ev.Error, ev.Attempt)
+	case models.ProgressSaved:
+		fmt.Printf("%s ✅ %s: saved %s\n", counter, ev.Host, ev.BackupFile)
+	case models.ProgressUnchanged:
+		fmt.Printf("%s ✅ %s: unchanged\n", counter, ev.Host)
+	case models.ProgressFailed:
+		fmt.Printf("%s ❌ %s: %s\n", counter, ev.Host, ev.Error)
+	case models.ProgressCancelled:
+		fmt.Printf("%s ⏹ %s: cancelled\n", counter, ev.Host)
+	case models.ProgressRunFinished:
+		fmt.Printf("Run %d finished: %d succeeded, %d failed, %d cancelled.\n",
+			ev.RunID, ev.Done-ev.Failed-ev.Cancelled, ev.Failed, ev.Cancelled)
+	}
+}
+
+// apiStatusError is an error response from the server.
+type apiStatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiStatusError) Error() string {
+	return fmt.Sprintf("server answered %d: %s", e.Status, e.Message)
+}
+
+// apiRequest sends an authenticated request to the server and returns the
+// response of a successful one.
+func apiRequest(method, url, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the server: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &apiStatusError{Status: resp.StatusCode, Message: apiErr.Error}
+	}
+	return resp, nil
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
 	// Here we can define flags specific to the 'run' command
 	// For example, the same --backup-path
 	runCmd.Flags().StringP("backup-path", "p", "backups", "Path to the backup directory")
+	runCmd.Flags().Bool("facts", false, "Also collect device facts (model, serial, OS version, uptime)")
+	runCmd.Flags().String("policies", "policies", "Directory with YAML compliance policy files")
+	addRetryFlags(runCmd)
+	addLimitFlags(runCmd)
+	runCmd.Flags().Bool("follow", false, "Start the run on a running server and print its live progress")
+	runCmd.Flags().String("server", "http://localhost:8080", "URL of the server for --follow")
+	runCmd.Flags().String("token", "", "API token for --follow (default $NETCFG_TOKEN)")
 }
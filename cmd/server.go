@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
+	"time"
 
+	"github.com/cobrich/netcfg-backup/auth"
 	"github.com/cobrich/netcfg-backup/backups"
 	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/golden"
+	"github.com/cobrich/netcfg-backup/monitoring"
 	"github.com/cobrich/netcfg-backup/server"
 	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/syslog"
+	"github.com/cobrich/netcfg-backup/tftp"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +23,11 @@ import (
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Starts the web interface",
+	Long: `Starts the web interface and the REST API.
+
+By default the server only listens on localhost:8080. Remote agents and
+pipelines calling the webhook from other hosts need an address they can
+reach, such as --listen :8080 behind a TLS reverse proxy.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		dbPath, err := storage.GetDefaultDBPath()
 		if err != nil {
@@ -29,13 +42,183 @@ var serverCmd = &cobra.Command{
 
 		backupPath := "backups"
 		backupSvc := backups.NewService(backupPath)
-		coreSvc := core.NewBackupService(deviceStore, backupPath, 10)
+		coreSvc := core.NewBackupService(deviceStore, backupPath, numWorkers)
+		collectFacts, _ := cmd.Flags().GetBool("facts")
+		coreSvc.SetCollectFacts(collectFacts)
+		setRetry(cmd, coreSvc)
+		if err := setLimits(cmd, coreSvc); err != nil {
+			fmt.Printf("Error loading limits: %v\n", err)
+			os.Exit(1)
+		}
+		if secret := os.Getenv("WEBHOOK_CALLBACK_SECRET"); secret != "" {
+			coreSvc.SetCallbackKey([]byte(secret))
+		}
+
+		policiesDir, _ := cmd.Flags().GetString("policies")
+		engine, err := loadComplianceEngine(policiesDir)
+		if err != nil {
+			fmt.Printf("Error loading compliance policies: %v\n", err)
+			os.Exit(1)
+		}
+		if engine != nil {
+			coreSvc.SetCompliance(engine)
+		}
+
+		notificationsFile, _ := cmd.Flags().GetString("notifications")
+		dispatcher, err := loadNotifications(notificationsFile)
+		if err != nil {
+			fmt.Printf("Error loading notification config: %v\n", err)
+			os.Exit(1)
+		}
+		if dispatcher != nil {
+			coreSvc.SetNotifications(dispatcher)
+		}
+
+		// Pick up the runs that were in progress when the server last stopped.
+		if err := coreSvc.ResumeRuns(); err != nil {
+			fmt.Printf("Error resuming unfinished runs: %v\n", err)
+			os.Exit(1)
+		}
 
-		srv := server.New(deviceStore, backupSvc, coreSvc)
-		srv.Start("localhost:8080")
+		// Export the facts collected so far so the info metrics survive restarts.
+		if latest, err := deviceStore.GetLatestFacts(); err == nil {
+			for _, f := range latest {
+				monitoring.SetDeviceFacts(f)
+			}
+		}
+
+		dev, _ := cmd.Flags().GetBool("dev")
+		srv, err := server.New(deviceStore, backupSvc, coreSvc, server.Options{Dev: dev})
+		if err != nil {
+			fmt.Printf("Error starting web server: %v\n", err)
+			os.Exit(1)
+		}
+		goldenDir, _ := cmd.Flags().GetString("golden")
+		srv.SetGolden(golden.NewRenderer(goldenDir))
+
+		if issuer, _ := cmd.Flags().GetString("oidc-issuer"); issuer != "" {
+			provider, err := newOIDCProvider(cmd, issuer)
+			if err != nil {
+				fmt.Printf("Error setting up single sign-on: %v\n", err)
+				os.Exit(1)
+			}
+			srv.SetOIDC(provider)
+		}
+
+		if err := startSyslog(cmd, coreSvc); err != nil {
+			fmt.Printf("Error starting syslog listener: %v\n", err)
+			os.Exit(1)
+		}
+		if err := startTFTP(cmd, coreSvc); err != nil {
+			fmt.Printf("Error starting TFTP server: %v\n", err)
+			os.Exit(1)
+		}
+		listen, _ := cmd.Flags().GetString("listen")
+		srv.Start(listen)
 	},
 }
 
+// newOIDCProvider configures single sign-on from the server flags. The client
+// secret is read from OIDC_CLIENT_SECRET so that it does not show up in the process list.
+func newOIDCProvider(cmd *cobra.Command, issuer string) (*auth.OIDCProvider, error) {
+	clientID, _ := cmd.Flags().GetString("oidc-client-id")
+	redirectURL, _ := cmd.Flags().GetString("oidc-redirect-url")
+	groupsClaim, _ := cmd.Flags().GetString("oidc-groups-claim")
+	roleMap, _ := cmd.Flags().GetString("oidc-role-map")
+
+	roles, err := auth.ParseRoleMap(roleMap)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("--oidc-role-map is required, e.g. 'netops-admins=admin,netops=operator'")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return auth.NewOIDCProvider(ctx, auth.OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		GroupsClaim:  groupsClaim,
+		RoleMap:      roles,
+	})
+}
+
+// startSyslog starts the syslog listeners requested by the server flags.
+// Devices reporting a configuration change are backed up after the debounce interval.
+func startSyslog(cmd *cobra.Command, coreSvc *core.BackupService) error {
+	udpAddr, _ := cmd.Flags().GetString("syslog-udp")
+	tcpAddr, _ := cmd.Flags().GetString("syslog-tcp")
+	if udpAddr == "" && tcpAddr == "" {
+		return nil
+	}
+	debounceSeconds, _ := cmd.Flags().GetInt("syslog-debounce")
+
+	trigger := core.NewChangeTrigger(coreSvc, time.Duration(debounceSeconds)*time.Second)
+	listener := syslog.NewListener(trigger.HandleSyslog)
+	if udpAddr != "" {
+		if err := listener.ListenUDP(context.Background(), udpAddr); err != nil {
+			return err
+		}
+	}
+	if tcpAddr != "" {
+		if err := listener.ListenTCP(context.Background(), tcpAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startTFTP starts the TFTP server requested by the server flags, which
+// receives the files that export commands have devices push.
+func startTFTP(cmd *cobra.Command, coreSvc *core.BackupService) error {
+	addr, _ := cmd.Flags().GetString("tftp")
+	if addr == "" {
+		return nil
+	}
+	listenHost, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --tftp address %q: %w", addr, err)
+	}
+	host, _ := cmd.Flags().GetString("tftp-host")
+	if host == "" {
+		if ip := net.ParseIP(listenHost); listenHost == "" || ip != nil && ip.IsUnspecified() {
+			return fmt.Errorf("--tftp-host is required when the TFTP server listens on all addresses")
+		}
+		host = listenHost
+	}
+	timeoutSeconds, _ := cmd.Flags().GetInt("tftp-timeout")
+
+	server := tftp.NewServer()
+	if err := server.ListenUDP(context.Background(), addr); err != nil {
+		return err
+	}
+	coreSvc.SetExportReceiver(server, host, port, time.Duration(timeoutSeconds)*time.Second)
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
+
+	serverCmd.Flags().String("listen", "localhost:8080", "Address of the web interface and the REST API; ':8080' for clients on other hosts")
+	serverCmd.Flags().Bool("dev", false, "Dev mode: allow temporary session keys and cookies over plain HTTP")
+	serverCmd.Flags().Bool("facts", true, "Collect device facts during backup runs")
+	addRetryFlags(serverCmd)
+	addLimitFlags(serverCmd)
+	serverCmd.Flags().String("policies", "policies", "Directory with YAML compliance policy files")
+	serverCmd.Flags().String("golden", "golden", "Directory with golden config templates (<role>.tmpl)")
+	serverCmd.Flags().String("notifications", "notifications.yaml", "Notification configuration file; notifications are off without it")
+	serverCmd.Flags().String("oidc-issuer", "", "OpenID Connect issuer URL; enables single sign-on")
+	serverCmd.Flags().String("oidc-client-id", "", "OpenID Connect client ID (secret in OIDC_CLIENT_SECRET)")
+	serverCmd.Flags().String("oidc-redirect-url", "http://localhost:8080/auth/oidc/callback", "Callback URL registered with the provider")
+	serverCmd.Flags().String("oidc-groups-claim", "groups", "ID token claim holding the user's groups")
+	serverCmd.Flags().String("oidc-role-map", "", "Provider groups to roles, e.g. 'netops-admins=admin,netops=operator,noc=viewer'")
+	serverCmd.Flags().String("syslog-udp", "", "Receive device syslog on this UDP address, e.g. ':514'; configuration changes trigger a backup")
+	serverCmd.Flags().String("syslog-tcp", "", "Receive device syslog on this TCP address, e.g. ':514'")
+	serverCmd.Flags().Int("syslog-debounce", int(core.DefaultChangeDebounce/time.Second), "Seconds a device must stay quiet after a configuration change before it is backed up")
+	serverCmd.Flags().String("tftp", "", "Receive files that devices push on this UDP address, e.g. ':69'; enables commands with a {url} placeholder")
+	serverCmd.Flags().String("tftp-host", "", "Address devices reach the TFTP server at (default: the host of --tftp)")
+	serverCmd.Flags().Int("tftp-timeout", int(core.DefaultExportTimeout/time.Second), "Seconds a backup waits for the files its commands have the device upload")
 }
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/spf13/cobra"
+)
+
+// tokenCmd groups the API token subcommands.
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manages API tokens for automation clients",
+	Long: `Manages the bearer tokens that scripts and CI pipelines use to call the REST API:
+
+  curl -H "Authorization: Bearer ncb_..." http://localhost:8080/api/v1/devices
+
+Scopes: read-only (read everything), run-backup (also start backup runs and
+call the webhook /api/v1/webhooks/backup), admin (everything) and agent (the
+endpoints of remote agents only). A personal token acts for a user and never gets more
+rights than that user's role; a service token belongs to no user.
+
+The server only listens on localhost by default; clients on other hosts,
+such as CI pipelines calling the webhook, need "server --listen :8080".
+
+Only a hash of each token is stored, so the secret is printed once on creation.`,
+}
+
+// tokenCreateCmd creates a token.
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a token and prints its secret",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		scope, _ := cmd.Flags().GetString("scope")
+		owner, _ := cmd.Flags().GetString("user")
+		service, _ := cmd.Flags().GetBool("service")
+		days, _ := cmd.Flags().GetInt("days")
+
+		if service == (owner != "") {
+			fmt.Println("Error: give either --user for a personal token or --service")
+			os.Exit(1)
+		}
+		store := openSQLiteStore()
+
+		kind := models.TokenService
+		if !service {
+			kind = models.TokenPersonal
+			user, err := store.GetUser(owner)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !models.RoleAllows(user.Role, models.ScopeRole(scope)) {
+				fmt.Printf("Error: user '%s' is %s and cannot have a token with the %s scope\n", owner, user.Role, scope)
+				os.Exit(1)
+			}
+		}
+
+		token, secret, err := auth.NewAPIToken(name, kind, owner, scope, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		id, err := store.CreateAPIToken(token)
+		if err != nil {
+			fmt.Printf("Error creating token: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Token %d '%s' created with scope %s.\n", id, token.Name, scope)
+		fmt.Printf("Token: %s\n", secret)
+		fmt.Println("Store it now; it cannot be shown again.")
+	},
+}
+
+// tokenListCmd lists tokens.
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists tokens with their last use",
+	Run: func(cmd *cobra.Command, args []string) {
+		owner, _ := cmd.Flags().GetString("user")
+		tokens, err := openSQLiteStore().ListAPITokens(owner)
+		if err != nil {
+			fmt.Printf("Error loading tokens: %v\n", err)
+			os.Exit(1)
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No API tokens yet.")
+			return
+		}
+
+		now := time.Now()
+		fmt.Printf("%-5s %-20s %-9s %-15s %-11s %-11s %-16s %-16s %s\n",
+			"ID", "NAME", "KIND", "OWNER", "SCOPE", "TOKEN", "EXPIRES", "LAST USED", "STATUS")
+		for _, t := range tokens {
+			status := "active"
+			switch {
+			case t.RevokedAt != nil:
+				status = "revoked"
+			case !t.Active(now):
+				status = "expired"
+			}
+			fmt.Printf("%-5d %-20s %-9s %-15s %-11s %-11s %-16s %-16s %s\n",
+				t.ID, t.Name, t.Kind, t.Owner, t.Scope, t.Prefix, formatOptionalTime(t.ExpiresAt), formatOptionalTime(t.LastUsedAt), status)
+		}
+	},
+}
+
+// tokenRevokeCmd revokes a token.
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "Revokes a token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("Error: invalid token ID '%s'\n", args[0])
+			os.Exit(1)
+		}
+		if err := openSQLiteStore().RevokeAPIToken(id); err != nil {
+			fmt.Printf("Error revoking token: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Token %d revoked.\n", id)
+	},
+}
+
+// formatOptionalTime formats a time for token lists, or "never" for nil.
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	tokenCreateCmd.Flags().String("name", "", "Name of the token, e.g. the client using it")
+	tokenCreateCmd.Flags().String("scope", models.ScopeReadOnly, "Scope: "+strings.Join(models.TokenScopes, ", "))
+	tokenCreateCmd.Flags().String("user", "", "Owner of a personal token")
+	tokenCreateCmd.Flags().Bool("service", false, "Create a service token that belongs to no user")
+	tokenCreateCmd.Flags().Int("days", 0, "Days until the token expires (0 for never)")
+	tokenCreateCmd.MarkFlagRequired("name")
+	tokenListCmd.Flags().String("user", "", "Only list the tokens of this user")
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/spf13/cobra"
+)
+
+// userCmd groups the web user management subcommands.
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manages the user accounts of the web interface",
+	Long: `Manages the local accounts that log in to the web interface and API.
+
+Roles: viewer (browse devices and backups), operator (also run backups and push
+configurations) and admin (also change the inventory and manage users).
+
+Without --password-stdin a random password is generated and printed once.`,
+}
+
+// userAddCmd creates a user.
+var userAddCmd = &cobra.Command{
+	Use:   "add [username]",
+	Short: "Creates a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, _ := cmd.Flags().GetString("role")
+		if !models.ValidUserRole(role) {
+			fmt.Printf("Error: unknown role '%s' (%s)\n", role, strings.Join(models.UserRoles, ", "))
+			os.Exit(1)
+		}
+
+		password, generated := readNewPassword(cmd)
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		user := models.User{Username: args[0], PasswordHash: hash, Role: role}
+		if _, err := openSQLiteStore().CreateUser(user); err != nil {
+			fmt.Printf("Error creating user: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ User '%s' created with role %s.\n", user.Username, role)
+		if generated {
+			fmt.Printf("Password: %s\n", password)
+		}
+	},
+}
+
+// userPasswdCmd sets a new password.
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd [username]",
+	Short: "Sets a new password for a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, generated := readNewPassword(cmd)
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := openSQLiteStore().UpdateUserPassword(args[0], hash); err != nil {
+			fmt.Printf("Error updating password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Password of '%s' changed.\n", args[0])
+		if generated {
+			fmt.Printf("Password: %s\n", password)
+		}
+	},
+}
+
+// userRoleCmd changes the role of a user.
+var userRoleCmd = &cobra.Command{
+	Use:   "set-role [username] [role]",
+	Short: "Changes the role of a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !models.ValidUserRole(args[1]) {
+			fmt.Printf("Error: unknown role '%s' (%s)\n", args[1], strings.Join(models.UserRoles, ", "))
+			os.Exit(1)
+		}
+		if err := openSQLiteStore().UpdateUserRole(args[0], args[1]); err != nil {
+			fmt.Printf("Error updating role: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ '%s' is now %s.\n", args[0], args[1])
+	},
+}
+
+// userRemoveCmd deletes a user.
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove [username]",
+	Short: "Deletes a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := openSQLiteStore().DeleteUser(args[0]); err != nil {
+			fmt.Printf("Error removing user: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ User '%s' removed.\n", args[0])
+	},
+}
+
+// userListCmd lists the users.
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists users",
+	Run: func(cmd *cobra.Command, args []string) {
+		users, err := openSQLiteStore().ListUsers()
+		if err != nil {
+			fmt.Printf("Error loading users: %v\n", err)
+			os.Exit(1)
+		}
+		if len(users) == 0 {
+			fmt.Println("No users yet. Create the first admin with 'netcfg-backup user add <name> --role admin'.")
+			return
+		}
+		fmt.Printf("%-20s %-10s %-19s %s\n", "USERNAME", "ROLE", "CREATED", "LAST LOGIN")
+		for _, u := range users {
+			lastLogin := "never"
+			if u.LastLoginAt != nil {
+				lastLogin = u.LastLoginAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %-10s %-19s %s\n", u.Username, u.Role, u.CreatedAt.Format("2006-01-02 15:04:05"), lastLogin)
+		}
+	},
+}
+
+// readNewPassword reads a password from stdin with --password-stdin, or
+// generates one. It reports whether the password was generated.
+func readNewPassword(cmd *cobra.Command) (string, bool) {
+	fromStdin, _ := cmd.Flags().GetBool("password-stdin")
+	if !fromStdin {
+		password, err := auth.GeneratePassword()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return password, true
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Printf("Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+	return strings.TrimRight(line, "\r\n"), false
+}
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userRoleCmd)
+	userCmd.AddCommand(userRemoveCmd)
+	userCmd.AddCommand(userListCmd)
+
+	userAddCmd.Flags().String("role", models.RoleViewer, "Role of the user: viewer, operator or admin")
+	for _, c := range []*cobra.Command{userAddCmd, userPasswdCmd} {
+		c.Flags().Bool("password-stdin", false, "Read the password from stdin instead of generating one")
+	}
+}
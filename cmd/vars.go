@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/spf13/cobra"
+)
+
+// varsCmd groups the device variable subcommands.
+var varsCmd = &cobra.Command{
+	Use:   "vars",
+	Short: "Manages per-device variables used by golden config templates",
+}
+
+// varsListCmd prints the variables of a device.
+var varsListCmd = &cobra.Command{
+	Use:   "list [host]",
+	Short: "Lists the variables of a device",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceStore := openVarsStore(args[0])
+
+		vars, err := deviceStore.GetDeviceVars(args[0])
+		if err != nil {
+			fmt.Printf("Error loading variables: %v\n", err)
+			os.Exit(1)
+		}
+		if len(vars) == 0 {
+			fmt.Printf("No variables set for '%s'.\n", args[0])
+			return
+		}
+
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-25s %s\n", name, vars[name])
+		}
+	},
+}
+
+// varsSetCmd sets a variable of a device.
+var varsSetCmd = &cobra.Command{
+	Use:   "set [host] [name] [value]",
+	Short: "Sets a variable of a device",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceStore := openVarsStore(args[0])
+
+		if err := deviceStore.SetDeviceVar(args[0], args[1], args[2]); err != nil {
+			fmt.Printf("Error setting variable: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Set %s=%s on '%s'.\n", args[1], args[2], args[0])
+	},
+}
+
+// varsUnsetCmd removes a variable of a device.
+var varsUnsetCmd = &cobra.Command{
+	Use:   "unset [host] [name]",
+	Short: "Removes a variable of a device",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceStore := openVarsStore(args[0])
+
+		if err := deviceStore.DeleteDeviceVar(args[0], args[1]); err != nil {
+			fmt.Printf("Error removing variable: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Removed %s from '%s'.\n", args[1], args[0])
+	},
+}
+
+// openVarsStore opens the database and checks that the device exists.
+func openVarsStore(host string) *storage.SQLiteStore {
+	dbPath, err := storage.GetDefaultDBPath()
+	if err != nil {
+		fmt.Printf("Error determining database path: %v\n", err)
+		os.Exit(1)
+	}
+	deviceStore, err := storage.NewSQLiteStore(dbPath)
+	if err != nil {
+		fmt.Printf("Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := deviceStore.GetDeviceByHost(host); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return deviceStore
+}
+
+func init() {
+	rootCmd.AddCommand(varsCmd)
+	varsCmd.AddCommand(varsListCmd)
+	varsCmd.AddCommand(varsSetCmd)
+	varsCmd.AddCommand(varsUnsetCmd)
+}
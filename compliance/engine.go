@@ -0,0 +1,164 @@
+package compliance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Engine evaluates a set of policies.
+type Engine struct {
+	policies []Policy
+}
+
+// NewEngine creates an engine for the given policies.
+func NewEngine(policies []Policy) *Engine {
+	return &Engine{policies: policies}
+}
+
+// Policies returns the loaded policies.
+func (e *Engine) Policies() []Policy {
+	return e.policies
+}
+
+// section is a top-level configuration line with its indented child lines.
+type section struct {
+	header string
+	lines  []string
+}
+
+// Check evaluates every policy and rule in scope for the device against the
+// command results of a backup. It returns one result per rule, or one per
+// failing section for section rules.
+func (e *Engine) Check(dev models.Device, results []models.Result) []models.ComplianceResult {
+	now := time.Now()
+	var out []models.ComplianceResult
+
+	for _, p := range e.policies {
+		if !p.Scope.matches(dev) {
+			continue
+		}
+		for _, rule := range p.Rules {
+			if !rule.Scope.matches(dev) {
+				continue
+			}
+
+			base := models.ComplianceResult{
+				Host:        dev.Host,
+				Policy:      p.Name,
+				RuleID:      rule.ID,
+				Description: rule.Description,
+				Severity:    rule.Severity,
+				CheckedAt:   now,
+			}
+
+			lines := configLines(results, rule.Command)
+			if rule.section == nil {
+				res := base
+				res.Passed, res.Message = rule.evaluate(lines)
+				out = append(out, res)
+				continue
+			}
+
+			failed := false
+			for _, sec := range sections(lines) {
+				if !rule.section.MatchString(sec.header) {
+					continue
+				}
+				if ok, msg := rule.evaluate(sec.lines); !ok {
+					res := base
+					res.Message = fmt.Sprintf("%s: %s", sec.header, msg)
+					out = append(out, res)
+					failed = true
+				}
+			}
+			if !failed {
+				res := base
+				res.Passed = true
+				out = append(out, res)
+			}
+		}
+	}
+
+	return out
+}
+
+// evaluate applies the rule's matcher to a set of lines.
+func (r Rule) evaluate(lines []string) (bool, string) {
+	switch {
+	case r.MustContain != "":
+		for _, l := range lines {
+			if strings.HasPrefix(strings.TrimSpace(l), r.MustContain) {
+				return true, ""
+			}
+		}
+		return false, fmt.Sprintf("missing '%s'", r.MustContain)
+	case r.MustNotContain != "":
+		for _, l := range lines {
+			if strings.HasPrefix(strings.TrimSpace(l), r.MustNotContain) {
+				return false, fmt.Sprintf("found forbidden line '%s'", strings.TrimSpace(l))
+			}
+		}
+		return true, ""
+	case r.Regex != "":
+		for _, l := range lines {
+			if r.pattern.MatchString(l) {
+				return true, ""
+			}
+		}
+		return false, fmt.Sprintf("no line matches /%s/", r.Regex)
+	default: // NotRegex
+		for _, l := range lines {
+			if r.pattern.MatchString(l) {
+				return false, fmt.Sprintf("line '%s' matches forbidden /%s/", strings.TrimSpace(l), r.NotRegex)
+			}
+		}
+		return true, ""
+	}
+}
+
+// configLines returns the output lines of the given command, or of all commands when cmd is empty.
+func configLines(results []models.Result, cmd string) []string {
+	var lines []string
+	for _, r := range results {
+		if cmd != "" && r.Cmd != cmd {
+			continue
+		}
+		lines = append(lines, strings.Split(strings.ReplaceAll(r.Output, "\r\n", "\n"), "\n")...)
+	}
+	return lines
+}
+
+// sections groups lines into top-level lines and their indented children.
+func sections(lines []string) []section {
+	var out []section
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if l[0] == ' ' || l[0] == '\t' {
+			if len(out) > 0 {
+				out[len(out)-1].lines = append(out[len(out)-1].lines, strings.TrimSpace(l))
+			}
+			continue
+		}
+		out = append(out, section{header: strings.TrimSpace(l)})
+	}
+	return out
+}
+
+// CountViolations counts failed results per severity.
+func CountViolations(results []models.ComplianceResult) map[string]int {
+	counts := make(map[string]int, len(models.Severities))
+	for _, s := range models.Severities {
+		counts[s] = 0
+	}
+	for _, r := range results {
+		if !r.Passed {
+			counts[r.Severity]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,170 @@
+// Package compliance evaluates device configurations against YAML policy files.
+package compliance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"go.yaml.in/yaml/v2"
+)
+
+// Scope limits a policy or rule to devices with one of the platforms and one of the tags.
+// An empty list matches every device.
+type Scope struct {
+	Platforms []string `yaml:"platforms"`
+	Tags      []string `yaml:"tags"`
+}
+
+// Rule is a single check. Exactly one of MustContain, MustNotContain, Regex or NotRegex is set.
+//
+// MustContain and MustNotContain match configuration lines by prefix, ignoring indentation,
+// so "ntp server" matches "ntp server 10.0.0.1" and "ip http server" does not match
+// "ip http secure-server". Regex and NotRegex are matched against each line.
+//
+// When Section is set, the check is applied to the child lines of every top-level line
+// matching the Section regex, for example to every "interface" block.
+type Rule struct {
+	ID             string `yaml:"id"`
+	Description    string `yaml:"description"`
+	Severity       string `yaml:"severity"`
+	Command        string `yaml:"command"`
+	Section        string `yaml:"section"`
+	MustContain    string `yaml:"must_contain"`
+	MustNotContain string `yaml:"must_not_contain"`
+	Regex          string `yaml:"regex"`
+	NotRegex       string `yaml:"not_regex"`
+	Scope          Scope  `yaml:"scope"`
+
+	section *regexp.Regexp
+	pattern *regexp.Regexp
+}
+
+// Policy is a named set of rules loaded from one YAML file.
+type Policy struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Scope       Scope  `yaml:"scope"`
+	Rules       []Rule `yaml:"rules"`
+}
+
+// LoadPolicies reads every *.yaml and *.yml file in a directory.
+func LoadPolicies(dir string) ([]Policy, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var policies []Policy
+	for _, file := range files {
+		p, err := LoadPolicy(file)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	return policies, nil
+}
+
+// LoadPolicy reads and validates a single policy file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file %s: %w", file, err)
+	}
+
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing policy file %s: %w", file, err)
+	}
+	if p.Name == "" {
+		p.Name = filepath.Base(file)
+	}
+
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+	}
+	return &p, nil
+}
+
+// compile validates the rule and compiles its regular expressions.
+func (r *Rule) compile() error {
+	if r.ID == "" {
+		return fmt.Errorf("rule without id")
+	}
+	if r.Severity == "" {
+		r.Severity = models.SeverityMedium
+	}
+	validSeverity := false
+	for _, s := range models.Severities {
+		if r.Severity == s {
+			validSeverity = true
+		}
+	}
+	if !validSeverity {
+		return fmt.Errorf("rule %s: unknown severity '%s'", r.ID, r.Severity)
+	}
+
+	matchers := 0
+	for _, m := range []string{r.MustContain, r.MustNotContain, r.Regex, r.NotRegex} {
+		if m != "" {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		return fmt.Errorf("rule %s: exactly one of must_contain, must_not_contain, regex or not_regex is required", r.ID)
+	}
+
+	var err error
+	if r.Regex != "" {
+		if r.pattern, err = regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("rule %s: invalid regex: %w", r.ID, err)
+		}
+	}
+	if r.NotRegex != "" {
+		if r.pattern, err = regexp.Compile(r.NotRegex); err != nil {
+			return fmt.Errorf("rule %s: invalid not_regex: %w", r.ID, err)
+		}
+	}
+	if r.Section != "" {
+		if r.section, err = regexp.Compile(r.Section); err != nil {
+			return fmt.Errorf("rule %s: invalid section: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the scope includes the device.
+func (s Scope) matches(dev models.Device) bool {
+	if len(s.Platforms) > 0 {
+		found := false
+		for _, p := range s.Platforms {
+			if p == dev.Platform {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.Tags) > 0 {
+		for _, t := range s.Tags {
+			if dev.HasTag(t) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+// Package configdiff compares device configurations as indentation-based trees.
+package configdiff
+
+import "strings"
+
+// Node is a configuration line together with its indented child lines.
+type Node struct {
+	Line     string
+	Children []*Node
+}
+
+// Change is a line that is missing from or extra in a configuration. Path holds
+// the parent lines of the changed line, outermost first.
+type Change struct {
+	Path []string
+	Line string
+}
+
+// String formats the change as "parent > child > line".
+func (c Change) String() string {
+	return strings.Join(append(append([]string{}, c.Path...), c.Line), " > ")
+}
+
+// Diff is the result of comparing an intended configuration with a running one.
+type Diff struct {
+	// Missing lines are in the intent but not on the device.
+	Missing []Change `json:"missing"`
+	// Extra lines are on the device but not in the intent.
+	Extra []Change `json:"extra"`
+}
+
+// Empty reports whether both configurations match.
+func (d Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0
+}
+
+// Options controls how configurations are compared.
+type Options struct {
+	// Strict also reports top-level lines of the device configuration that the
+	// intent does not mention. By default the intent only owns the sections it
+	// declares, so extra lines are reported inside those sections only.
+	Strict bool
+}
+
+// ignoredPrefixes are lines that carry no configuration, such as comments and
+// the banners devices print in front of their configuration.
+var ignoredPrefixes = []string{
+	"!",
+	"#",
+	"Building configuration",
+	"Current configuration",
+	"Last configuration change",
+	"NVRAM config last updated",
+	"## Last commit",
+}
+
+// Parse builds a tree from a configuration, nesting lines under the closest
+// preceding line with a smaller indentation. Blank lines, comments and lone
+// closing braces are skipped.
+func Parse(config string) []*Node {
+	type frame struct {
+		indent int
+		node   *Node
+	}
+
+	var roots []*Node
+	var stack []frame
+
+	for _, raw := range strings.Split(strings.ReplaceAll(config, "\r\n", "\n"), "\n") {
+		line := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "}" || ignored(trimmed) {
+			continue
+		}
+
+		indent := indentation(line)
+		node := &Node{Line: normalize(trimmed)}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := stack[len(stack)-1].node
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, frame{indent: indent, node: node})
+	}
+
+	return roots
+}
+
+// Compare parses both configurations and compares them.
+func Compare(intent, running string, opts Options) Diff {
+	var d Diff
+	compareNodes(Parse(intent), Parse(running), nil, opts.Strict, &d)
+	return d
+}
+
+// compareNodes matches intent nodes with running nodes on the same level.
+// Extra running nodes are reported when reportExtra is set.
+func compareNodes(intent, running []*Node, path []string, reportExtra bool, d *Diff) {
+	index := make(map[string]*Node, len(running))
+	for _, n := range running {
+		if _, ok := index[n.Line]; !ok {
+			index[n.Line] = n
+		}
+	}
+
+	wanted := make(map[string]bool, len(intent))
+	for _, n := range intent {
+		wanted[n.Line] = true
+		match, ok := index[n.Line]
+		if !ok {
+			addAll(&d.Missing, n, path)
+			continue
+		}
+		if len(n.Children) > 0 {
+			compareNodes(n.Children, match.Children, childPath(path, n.Line), true, d)
+		}
+	}
+
+	if !reportExtra {
+		return
+	}
+	for _, n := range running {
+		if !wanted[n.Line] {
+			addAll(&d.Extra, n, path)
+		}
+	}
+}
+
+// addAll records a node and all of its descendants as changes.
+func addAll(changes *[]Change, n *Node, path []string) {
+	*changes = append(*changes, Change{Path: path, Line: n.Line})
+	for _, c := range n.Children {
+		addAll(changes, c, childPath(path, n.Line))
+	}
+}
+
+func childPath(path []string, line string) []string {
+	return append(append([]string{}, path...), line)
+}
+
+func ignored(line string) bool {
+	for _, p := range ignoredPrefixes {
+		if strings.HasPrefix(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// indentation counts leading whitespace, with tabs counting as one column.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// normalize collapses runs of whitespace inside a line and drops a trailing "{" or ";"
+// so that brace-style and flat configurations compare equal.
+func normalize(line string) string {
+	line = strings.Join(strings.Fields(line), " ")
+	line = strings.TrimSuffix(line, " {")
+	return strings.TrimSuffix(line, ";")
+}
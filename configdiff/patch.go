@@ -0,0 +1,71 @@
+package configdiff
+
+import "strings"
+
+// Lines parses a configuration and renders it back without comments and
+// banners, indenting child lines by one space per level.
+func Lines(config string) []string {
+	var out []string
+	for _, n := range Parse(config) {
+		out = append(out, render(n, 0)...)
+	}
+	return out
+}
+
+// Patch returns the commands that turn the running configuration into the
+// intended one. Lines missing from the running configuration are added under
+// their parent lines and extra lines are removed with the command returned by
+// negate; an empty command leaves the line in place. Unlike Compare, extra
+// top-level lines are removed too, so intent must be a complete configuration.
+func Patch(intent, running string, negate func(line string) string) []string {
+	return patchNodes(Parse(intent), Parse(running), 0, negate)
+}
+
+func patchNodes(intent, running []*Node, depth int, negate func(string) string) []string {
+	index := make(map[string]*Node, len(running))
+	for _, n := range running {
+		if _, ok := index[n.Line]; !ok {
+			index[n.Line] = n
+		}
+	}
+	wanted := make(map[string]bool, len(intent))
+	for _, n := range intent {
+		wanted[n.Line] = true
+	}
+
+	var out []string
+	// Remove first, so that replaced values (e.g. a new address) do not clash.
+	for _, n := range running {
+		if wanted[n.Line] {
+			continue
+		}
+		if cmd := negate(n.Line); cmd != "" {
+			out = append(out, indent(depth)+cmd)
+		}
+	}
+	for _, n := range intent {
+		match, ok := index[n.Line]
+		if !ok {
+			out = append(out, render(n, depth)...)
+			continue
+		}
+		if sub := patchNodes(n.Children, match.Children, depth+1, negate); len(sub) > 0 {
+			out = append(out, indent(depth)+n.Line)
+			out = append(out, sub...)
+		}
+	}
+	return out
+}
+
+// render returns a node and its descendants as indented lines.
+func render(n *Node, depth int) []string {
+	out := []string{indent(depth) + n.Line}
+	for _, c := range n.Children {
+		out = append(out, render(c, depth+1)...)
+	}
+	return out
+}
+
+func indent(depth int) string {
+	return strings.Repeat(" ", depth)
+}
@@ -0,0 +1,81 @@
+package configdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// negateNo removes a line by prefixing it with "no", the IOS way.
+func negateNo(line string) string {
+	if strings.HasPrefix(line, "no ") {
+		return strings.TrimPrefix(line, "no ")
+	}
+	return "no " + line
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		intent  string
+		running string
+		negate  func(string) string
+		want    []string
+	}{
+		{
+			name:    "nested change",
+			intent:  "interface Gi0/1\n ip address 10.0.0.2 255.255.255.0\n no shutdown\ninterface Gi0/2\n shutdown",
+			running: "interface Gi0/1\n ip address 10.0.0.1 255.255.255.0\n no shutdown\ninterface Gi0/2\n shutdown",
+			negate:  negateNo,
+			want:    []string{"interface Gi0/1", " no ip address 10.0.0.1 255.255.255.0", " ip address 10.0.0.2 255.255.255.0"},
+		},
+		{
+			name:    "removed no line",
+			intent:  "hostname r1",
+			running: "hostname r1\nno ip domain-lookup",
+			negate:  negateNo,
+			want:    []string{"ip domain-lookup"},
+		},
+		{
+			name:    "new section",
+			intent:  "hostname r1\nrouter ospf 1\n network 10.0.0.0 0.0.0.255 area 0",
+			running: "hostname r1",
+			negate:  negateNo,
+			want:    []string{"router ospf 1", " network 10.0.0.0 0.0.0.255 area 0"},
+		},
+		{
+			name:    "removed section",
+			intent:  "hostname r1",
+			running: "hostname r1\nrouter ospf 1\n network 10.0.0.0 0.0.0.255 area 0",
+			negate:  negateNo,
+			want:    []string{"no router ospf 1"},
+		},
+		{
+			name:    "same configuration",
+			intent:  "!\nhostname r1\ninterface Gi0/1\n  description  uplink\n",
+			running: "Building configuration...\nhostname r1\ninterface Gi0/1\n description uplink",
+			negate:  negateNo,
+			want:    nil,
+		},
+		{
+			name:    "lines left in place",
+			intent:  "hostname r1\nntp server 10.0.0.2",
+			running: "hostname r1\nntp server 10.0.0.1",
+			negate:  func(string) string { return "" },
+			want:    []string{"ntp server 10.0.0.2"},
+		},
+	}
+	for _, tt := range tests {
+		if got := Patch(tt.intent, tt.running, tt.negate); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	got := Lines("! comment\nsystem {\n    host-name r1;\n}\ninterface Gi0/1\n\tdescription uplink\n")
+	want := []string{"system", " host-name r1", "interface Gi0/1", " description uplink"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,10 +1,30 @@
 // Package connectors defines the interface for connecting to network devices and executing commands.
 package connectors
 
-import "github.com/cobrich/netcfg-backup/models"
+import (
+	"context"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
 
 // Connector is the interface that defines the contract for different connection methods (e.g., SSH, Telnet).
 type Connector interface {
-	// RunCommands executes a list of commands on the device and returns their output.
-	RunCommands([]string) ([]models.Result, error)
+	// RunCommands executes a list of commands on the device and returns their
+	// output. Cancelling ctx closes the connection and returns ctx.Err().
+	RunCommands(ctx context.Context, cmds []string) ([]models.Result, error)
+}
+
+// ConfigPusher is implemented by connectors that can send configuration commands.
+// Unlike RunCommands, all lines are sent in one interactive session, so that
+// mode changes such as "configure terminal" apply to the lines that follow.
+type ConfigPusher interface {
+	// PushConfig sends the lines and returns the session transcript.
+	PushConfig(lines []string) (string, error)
+}
+
+// CommandNotifier is implemented by connectors that report each command as
+// they start it, for live progress.
+type CommandNotifier interface {
+	// OnCommand sets a function that is called before each command is sent.
+	OnCommand(func(cmd string))
 }
@@ -0,0 +1,81 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Error is a connector error together with its failure category, one of the
+// models.Failure* constants.
+type Error struct {
+	Category string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// classify wraps an error with a failure category.
+func classify(category string, err error) error {
+	return &Error{Category: category, Err: err}
+}
+
+// Category returns the failure category of an error returned by a connector.
+// Errors the connectors did not classify are command errors.
+func Category(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+	return models.FailureCommand
+}
+
+// Transient reports whether a failure of the category may go away on its own,
+// so that retrying the job can help.
+func Transient(category string) bool {
+	switch category {
+	case models.FailureDialTimeout, models.FailureConnectionRefused, models.FailurePromptTimeout, models.FailureNoAgent, models.FailureUploadTimeout:
+		return true
+	}
+	return false
+}
+
+// dialCategory returns the failure category of a failed TCP connection.
+func dialCategory(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return models.FailureConnectionRefused
+	}
+	return models.FailureDialTimeout
+}
+
+// handshakeCategory returns the failure category of a failed SSH handshake.
+func handshakeCategory(err error) string {
+	var keyErr *knownhosts.KeyError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &keyErr):
+		return models.FailureHostKey
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return models.FailurePromptTimeout
+	case isAuthError(err):
+		return models.FailureAuth
+	}
+	return models.FailurePromptTimeout
+}
+
+// isAuthError reports whether an SSH handshake failed because the device
+// rejected every authentication method. The ssh package has no typed error for it.
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
@@ -0,0 +1,61 @@
+package connectors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// New creates the connector matching the device's protocol.
+// The device password must already be resolved from its environment variable.
+func New(dev models.Device, timeout time.Duration) (Connector, error) {
+	switch dev.Protocol {
+	case "ssh":
+		return &SSHConnector{
+			Host:               dev.Host,
+			Username:           dev.Username,
+			Password:           dev.Password,
+			KeyPath:            dev.KeyPath,
+			Timeout:            timeout,
+			AllowInsecureAlgos: dev.AllowInsecureAlgos,
+		}, nil
+	case "netconf":
+		return &NetconfConnector{
+			Host:               dev.Host,
+			Username:           dev.Username,
+			Password:           dev.Password,
+			KeyPath:            dev.KeyPath,
+			Timeout:            timeout,
+			AllowInsecureAlgos: dev.AllowInsecureAlgos,
+		}, nil
+	case "http":
+		var settings models.HTTPSettings
+		if dev.HTTP != nil {
+			settings = *dev.HTTP
+		}
+		return &HTTPConnector{
+			Host:     dev.Host,
+			Username: dev.Username,
+			Password: dev.Password,
+			Settings: settings,
+			Timeout:  timeout,
+		}, nil
+	case "telnet":
+		return &TelnetConnector{
+			Host:     dev.Host,
+			Username: dev.Username,
+			Password: dev.Password,
+			Prompt:   dev.Prompt,
+			Timeout:  timeout,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol: %s", dev.Protocol)
+	}
+}
+
+// CLI reports whether the connector of a protocol runs CLI commands, as
+// opposed to protocols whose commands name the data to fetch.
+func CLI(protocol string) bool {
+	return protocol == "ssh" || protocol == "telnet"
+}
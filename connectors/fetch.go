@@ -0,0 +1,319 @@
+package connectors
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cobrich/netcfg-backup/models"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Fetch methods of the "fetch" command of SSH devices.
+const (
+	FetchSFTP = "sftp"
+	FetchSCP  = "scp"
+)
+
+// maxFetchSize is the largest file a fetch command copies.
+var maxFetchSize = 64 << 20
+
+// parseFetch reports whether a command is a fetch command, "fetch [sftp|scp]
+// PATH", and returns its method and path. The method defaults to SFTP.
+func parseFetch(cmd string) (method, path string, ok bool) {
+	fields := strings.Fields(cmd)
+	if len(fields) < 2 || fields[0] != "fetch" {
+		return "", "", false
+	}
+	method = FetchSFTP
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), "fetch"))
+	if len(fields) > 2 && (fields[1] == FetchSFTP || fields[1] == FetchSCP) {
+		method = fields[1]
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+	}
+	return method, rest, true
+}
+
+// fetchFile copies a file from the device over the SSH connection.
+func fetchFile(client *ssh.Client, method, path string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if method == FetchSCP {
+		if err := session.Start("scp -f " + shellQuote(path)); err != nil {
+			return nil, fmt.Errorf("failed to start scp: %v", err)
+		}
+		data, err = scpReceive(bufio.NewReader(stdout), stdin)
+	} else {
+		if err := session.RequestSubsystem("sftp"); err != nil {
+			return nil, fmt.Errorf("failed to start the sftp subsystem: %v", err)
+		}
+		data, err = newSFTPClient(stdout, stdin).readFile(path)
+	}
+	return data, err
+}
+
+// FileResult returns the result of a command that copied a file from the
+// device. Its output is the content of a text file, so that text files diff
+// like command output, or a description of a binary file, which changes with
+// its checksum.
+func FileResult(cmd, path string, data []byte) models.Result {
+	sum := sha256.Sum256(data)
+	file := &models.FetchedFile{Path: path, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), Data: data}
+	output := string(data)
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		output = fmt.Sprintf("binary file %s, %d bytes, sha256 %s", file.Path, file.Size, file.SHA256)
+	}
+	return models.Result{Cmd: cmd, Output: strings.TrimRight(output, "\r\n"), File: file}
+}
+
+// shellQuote quotes a path for the remote shell unless it only has
+// characters that need no quoting, as devices without a shell do not
+// understand quotes.
+func shellQuote(path string) string {
+	for _, r := range path {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-:+@,=", r)) {
+			return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+		}
+	}
+	return path
+}
+
+// scpReceive copies one file in the sink mode of the SCP protocol, as the
+// remote "scp -f" sends it.
+func scpReceive(r *bufio.Reader, w io.Writer) ([]byte, error) {
+	ack := func() error {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	if err := ack(); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("scp: %w", err)
+		}
+		switch line[0] {
+		case 1, 2:
+			// The remote scp prefixes its own messages with "scp: ".
+			return nil, fmt.Errorf("scp: %s", strings.TrimPrefix(strings.TrimSpace(line[1:]), "scp: "))
+		case 'T':
+			// Times of the file, sent when the source preserves them.
+			if err := ack(); err != nil {
+				return nil, err
+			}
+			continue
+		case 'C':
+		default:
+			return nil, fmt.Errorf("scp: unexpected message %q", strings.TrimSpace(line))
+		}
+
+		// "C<mode> <size> <name>"
+		fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("scp: invalid file header %q", strings.TrimSpace(line))
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("scp: invalid file size %q", fields[1])
+		}
+		if size > int64(maxFetchSize) {
+			return nil, fmt.Errorf("scp: file of %d bytes is larger than %d bytes", size, maxFetchSize)
+		}
+		if err := ack(); err != nil {
+			return nil, err
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("scp: %w", err)
+		}
+		status, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("scp: %w", err)
+		}
+		if status != 0 {
+			msg, _ := r.ReadString('\n')
+			return nil, fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+		}
+		return data, ack()
+	}
+}
+
+// SFTP version 3 packet types and status codes used by the client
+// (draft-ietf-secsh-filexfer-02).
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+
+	sftpReadFlag = 1
+	sftpEOF      = 1
+
+	sftpChunkSize = 32 << 10
+)
+
+// errSFTPEOF is the status of a read past the end of a file.
+var errSFTPEOF = errors.New("sftp: end of file")
+
+// sftpClient is a minimal SFTP client that reads whole files.
+type sftpClient struct {
+	r  io.Reader
+	w  io.Writer
+	id uint32
+}
+
+func newSFTPClient(r io.Reader, w io.Writer) *sftpClient {
+	return &sftpClient{r: r, w: w}
+}
+
+// readFile negotiates the protocol version and reads a file.
+func (c *sftpClient) readFile(path string) ([]byte, error) {
+	if err := c.send(sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	typ, _, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sftpVersion {
+		return nil, fmt.Errorf("sftp: unexpected packet %d instead of the version", typ)
+	}
+
+	open := appendString(nil, path)
+	open = binary.BigEndian.AppendUint32(open, sftpReadFlag)
+	open = binary.BigEndian.AppendUint32(open, 0) // no attributes
+	payload, err := c.request(sftpOpen, open, sftpHandle)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, ok := readString(payload)
+	if !ok {
+		return nil, errors.New("sftp: invalid handle")
+	}
+	defer c.request(sftpClose, appendString(nil, handle), sftpStatus)
+
+	var data []byte
+	for {
+		read := appendString(nil, handle)
+		read = binary.BigEndian.AppendUint64(read, uint64(len(data)))
+		read = binary.BigEndian.AppendUint32(read, sftpChunkSize)
+		payload, err := c.request(sftpRead, read, sftpData)
+		if err == errSFTPEOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunk, _, ok := readString(payload)
+		if !ok {
+			return nil, errors.New("sftp: invalid data packet")
+		}
+		if len(data)+len(chunk) > maxFetchSize {
+			return nil, fmt.Errorf("sftp: file is larger than %d bytes", maxFetchSize)
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// request sends a request and returns the payload after the request ID of
+// the reply, which must have the wanted type or be a status. A status of
+// end of file is returned as errSFTPEOF, other failures as errors.
+func (c *sftpClient) request(typ byte, body []byte, want byte) ([]byte, error) {
+	c.id++
+	if err := c.send(typ, append(binary.BigEndian.AppendUint32(nil, c.id), body...)); err != nil {
+		return nil, err
+	}
+	replyType, payload, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 4 || binary.BigEndian.Uint32(payload) != c.id {
+		return nil, errors.New("sftp: reply to another request")
+	}
+	payload = payload[4:]
+	if replyType == sftpStatus && want != sftpStatus {
+		if len(payload) < 4 {
+			return nil, errors.New("sftp: invalid status")
+		}
+		code := binary.BigEndian.Uint32(payload)
+		if code == sftpEOF {
+			return nil, errSFTPEOF
+		}
+		msg, _, _ := readString(payload[4:])
+		if msg == "" {
+			msg = fmt.Sprintf("status %d", code)
+		}
+		return nil, fmt.Errorf("sftp: %s", msg)
+	}
+	if replyType != want {
+		return nil, fmt.Errorf("sftp: unexpected packet %d", replyType)
+	}
+	return payload, nil
+}
+
+func (c *sftpClient) send(typ byte, body []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(body)+1))
+	packet = append(packet, typ)
+	_, err := c.w.Write(append(packet, body...))
+	return err
+}
+
+func (c *sftpClient) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpChunkSize+1024 {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	return header[4], payload, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// readString reads an SFTP string and returns it with the rest of b.
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 4 {
+		return "", nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return "", nil, false
+	}
+	return string(b[4 : 4+n]), b[4+n:], true
+}
@@ -0,0 +1,309 @@
+package connectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshStub is an in-process SSH server of a device with files. It serves the
+// files over SFTP and "scp -f", and answers other commands with their name.
+type sshStub struct {
+	files map[string][]byte
+	// scpHeader, if set, replaces the "C" header of SCP transfers.
+	scpHeader string
+	// hangUp ends SCP transfers after the file data, before its status byte.
+	hangUp bool
+}
+
+// startSSHStub serves the stub on a local port and trusts its host key in
+// the known_hosts file of a temporary home directory.
+func startSSHStub(t *testing.T, stub *sshStub) *SSHConnector {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "backup" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn, config)
+		}
+	}()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.Mkdir(filepath.Join(home, ".ssh"), 0o700)
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, signer.PublicKey())
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &SSHConnector{Host: ln.Addr().String(), Username: "backup", Password: "secret", Timeout: 5 * time.Second}
+}
+
+func (s *sshStub) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(ch, requests)
+	}
+}
+
+// session runs the exec or subsystem request of a session channel.
+func (s *sshStub) session(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range requests {
+		var arg struct{ Value string }
+		ssh.Unmarshal(req.Payload, &arg)
+		switch {
+		case req.Type == "subsystem" && arg.Value == "sftp":
+			req.Reply(true, nil)
+			s.sftp(ch)
+		case req.Type == "exec" && strings.HasPrefix(arg.Value, "scp -f "):
+			req.Reply(true, nil)
+			s.scp(ch, strings.TrimPrefix(arg.Value, "scp -f "))
+		case req.Type == "exec":
+			req.Reply(true, nil)
+			io.WriteString(ch, arg.Value+"\n")
+		default:
+			req.Reply(false, nil)
+			continue
+		}
+		ch.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, 0))
+		return
+	}
+}
+
+// scp sends a file in the source mode of the SCP protocol.
+func (s *sshStub) scp(ch ssh.Channel, path string) {
+	r := bufio.NewReader(ch)
+	if b, err := r.ReadByte(); err != nil || b != 0 {
+		return
+	}
+	data, ok := s.files[strings.Trim(path, "'")]
+	if !ok {
+		fmt.Fprintf(ch, "\x01scp: %s: No such file or directory\n", path)
+		return
+	}
+	header := s.scpHeader
+	if header == "" {
+		header = fmt.Sprintf("C0644 %d %s\n", len(data), filepath.Base(path))
+	}
+	for _, msg := range []string{"T1792382400 0 1792382400 0\n", header} {
+		io.WriteString(ch, msg)
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return
+		}
+	}
+	if s.hangUp {
+		ch.Write(data)
+		return
+	}
+	ch.Write(append(data, 0))
+	r.ReadByte()
+}
+
+// sftp serves read-only SFTP version 3.
+func (s *sshStub) sftp(ch ssh.Channel) {
+	open := map[string][]byte{}
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(ch, header[:]); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+		if _, err := io.ReadFull(ch, payload); err != nil {
+			return
+		}
+		reply := func(typ byte, body []byte) {
+			packet := binary.BigEndian.AppendUint32(nil, uint32(len(body)+1))
+			ch.Write(append(append(packet, typ), body...))
+		}
+		if header[4] == sftpInit {
+			reply(sftpVersion, binary.BigEndian.AppendUint32(nil, 3))
+			continue
+		}
+		id := payload[:4]
+		status := func(code uint32, msg string) {
+			body := binary.BigEndian.AppendUint32(append([]byte{}, id...), code)
+			reply(sftpStatus, appendString(appendString(body, msg), "en"))
+		}
+		handle, rest, _ := readString(payload[4:])
+		switch header[4] {
+		case sftpOpen:
+			data, ok := s.files[handle]
+			if !ok {
+				status(2, "No such file")
+				continue
+			}
+			open[handle] = data
+			reply(sftpHandle, appendString(append([]byte{}, id...), handle))
+		case sftpRead:
+			data := open[handle]
+			offset, length := binary.BigEndian.Uint64(rest), binary.BigEndian.Uint32(rest[8:])
+			if offset >= uint64(len(data)) {
+				status(sftpEOF, "End of file")
+				continue
+			}
+			chunk := data[offset:min(offset+uint64(length), uint64(len(data)))]
+			reply(sftpData, appendString(append([]byte{}, id...), string(chunk)))
+		case sftpClose:
+			delete(open, handle)
+			status(0, "Success")
+		default:
+			status(8, "Operation unsupported")
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 5000) // several SFTP reads
+	binaryFile := []byte{0x00, 0x01, 0xfe, 0xff}
+	c := startSSHStub(t, &sshStub{files: map[string][]byte{
+		"/config/config.boot": []byte("system {\n    host-name r1\n}\n"),
+		"flash:vlan.dat":      binaryFile,
+		"/var/large.txt":      large,
+		"/var/empty.txt":      {},
+		"my file.txt":         []byte("quoted\n"),
+	}})
+
+	results, err := c.RunCommands(context.Background(), []string{
+		"show version",
+		"fetch /config/config.boot",
+		"fetch scp flash:vlan.dat",
+		"fetch sftp /var/large.txt",
+		"fetch /var/empty.txt",
+		"fetch scp my file.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if results[0].Output != "show version\n" || results[0].File != nil {
+		t.Errorf("command result %+v", results[0])
+	}
+	if r := results[1]; r.Output != "system {\n    host-name r1\n}" || r.File == nil || r.File.Path != "/config/config.boot" {
+		t.Errorf("sftp text file: %+v", r)
+	}
+	if r := results[2]; r.File == nil || !bytes.Equal(r.File.Data, binaryFile) || !strings.HasPrefix(r.Output, "binary file flash:vlan.dat, 4 bytes, sha256 ") {
+		t.Errorf("scp binary file: %+v", r)
+	}
+	if r := results[3]; r.File == nil || !bytes.Equal(r.File.Data, large) {
+		t.Errorf("large file: got %d bytes, want %d", len(r.File.Data), len(large))
+	}
+	if r := results[4]; r.File == nil || r.File.Size != 0 || r.Output != "" {
+		t.Errorf("empty file: %+v", r)
+	}
+	if r := results[5]; r.Output != "quoted" {
+		t.Errorf("quoted scp path: %+v", r)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	defer func(size int) { maxFetchSize = size }(maxFetchSize)
+	maxFetchSize = 1000
+	files := map[string][]byte{"big.bin": make([]byte, 1001), "ok.txt": []byte("ok")}
+
+	tests := []struct {
+		name      string
+		stub      *sshStub
+		cmd       string
+		wantError string
+	}{
+		{"sftp status", &sshStub{files: files}, "fetch /missing.txt", "No such file"},
+		{"scp error message", &sshStub{files: files}, "fetch scp /missing.txt", "scp: /missing.txt: No such file or directory"},
+		{"sftp size limit", &sshStub{files: files}, "fetch big.bin", "larger than 1000 bytes"},
+		{"scp size limit", &sshStub{files: files}, "fetch scp big.bin", "file of 1001 bytes is larger than 1000 bytes"},
+		{"scp invalid header", &sshStub{files: files, scpHeader: "C0644 two ok.txt\n"}, "fetch scp ok.txt", "invalid file size"},
+		{"scp unexpected message", &sshStub{files: files, scpHeader: "D0755 0 dir\n"}, "fetch scp ok.txt", "unexpected message"},
+		{"scp end of stream", &sshStub{files: files, scpHeader: "C0644 10 ok.txt\n", hangUp: true}, "fetch scp ok.txt", "scp: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		c := startSSHStub(t, tt.stub)
+		results, err := c.RunCommands(context.Background(), []string{"show version", tt.cmd, "show clock"})
+		if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+			t.Errorf("%s: got %v, want an error with %q", tt.name, err, tt.wantError)
+			continue
+		}
+		if Category(err) != models.FailureCommand {
+			t.Errorf("%s: category %s, want %s", tt.name, Category(err), models.FailureCommand)
+		}
+		// The commands before the failed fetch keep their output.
+		if len(results) != 1 || results[0].Cmd != "show version" {
+			t.Errorf("%s: results %+v", tt.name, results)
+		}
+	}
+}
+
+func TestParseFetch(t *testing.T) {
+	tests := []struct {
+		cmd          string
+		method, path string
+		ok           bool
+	}{
+		{"fetch /config/config.boot", FetchSFTP, "/config/config.boot", true},
+		{"fetch scp flash:vlan.dat", FetchSCP, "flash:vlan.dat", true},
+		{"fetch sftp my file.txt", FetchSFTP, "my file.txt", true},
+		{"fetch scp", FetchSFTP, "scp", true},
+		{"fetch", "", "", false},
+		{"show fetch status", "", "", false},
+	}
+	for _, tt := range tests {
+		method, path, ok := parseFetch(tt.cmd)
+		if method != tt.method || path != tt.path || ok != tt.ok {
+			t.Errorf("parseFetch(%q) = %q, %q, %v", tt.cmd, method, path, ok)
+		}
+	}
+}
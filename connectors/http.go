@@ -0,0 +1,352 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// HTTPConnector implements the Connector interface for devices that are
+// managed through an HTTP(S) API, such as RESTCONF, firewalls and SD-WAN
+// controllers. Each command is a request, "[METHOD] PATH [| JSONPATH]",
+// e.g. "GET /api/v2/cmdb/system/global | $.results". The method defaults to
+// GET. The output of a command is the response body, indented when it is
+// JSON or XML, or the values the JSONPath selects from it.
+type HTTPConnector struct {
+	Host     string
+	Username string
+	Password string // the password, or the token of the token scheme
+	Settings models.HTTPSettings
+	Timeout  time.Duration
+
+	onCommand func(cmd string)
+}
+
+// OnCommand sets a function that is called before each command is sent.
+func (h *HTTPConnector) OnCommand(fn func(cmd string)) {
+	h.onCommand = fn
+}
+
+// httpStatusError is a response with an error status.
+type httpStatusError struct {
+	status int
+	body   string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("HTTP %d", e.status)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+// RunCommands logs in if the device uses the login scheme and sends the
+// requests of the commands. The connector timeout applies to all of them.
+func (h *HTTPConnector) RunCommands(ctx context.Context, cmds []string) ([]models.Result, error) {
+	logger := utils.Log.WithField("host", h.Host)
+	logger.Infof("HTTP: connecting to %s...", h.baseURL())
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	client, err := h.client()
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	if h.auth() == models.HTTPAuthLogin {
+		if err := h.login(timeoutCtx, client); err != nil {
+			logger.Errorf("HTTP: login failed: %v", err)
+			return nil, h.failed(ctx, timeoutCtx, "login", err)
+		}
+		logger.Info("HTTP: logged in")
+		defer h.logout(timeoutCtx, client)
+	}
+
+	results := []models.Result{}
+	for _, cmd := range cmds {
+		logger.Infof("HTTP: executing request: %s", cmd)
+		if h.onCommand != nil {
+			h.onCommand(cmd)
+		}
+
+		output, err := h.run(timeoutCtx, client, cmd)
+		var statusErr *httpStatusError
+		switch {
+		case err == nil:
+			logger.Infof("HTTP: request '%s' executed successfully", cmd)
+			results = append(results, models.Result{Cmd: cmd, Output: output})
+		case errors.As(err, &statusErr) && statusErr.status != http.StatusUnauthorized && statusErr.status != http.StatusForbidden,
+			errors.Is(err, errInvalidRequest):
+			// The device refused this request; the others may still work.
+			logger.Errorf("HTTP: error executing request '%s': %v", cmd, err)
+			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
+		default:
+			logger.Errorf("HTTP: request '%s' failed: %v", cmd, err)
+			return results, h.failed(ctx, timeoutCtx, fmt.Sprintf("request '%s'", cmd), err)
+		}
+	}
+	return results, nil
+}
+
+// errInvalidRequest is returned for commands that are not valid requests,
+// or whose response cannot be read as asked.
+var errInvalidRequest = errors.New("invalid request")
+
+// run sends the request of a command and formats its response.
+func (h *HTTPConnector) run(ctx context.Context, client *http.Client, cmd string) (string, error) {
+	request, extract, _ := strings.Cut(cmd, "|")
+	fields := strings.Fields(request)
+	method, path := http.MethodGet, ""
+	switch len(fields) {
+	case 1:
+		path = fields[0]
+	case 2:
+		method, path = strings.ToUpper(fields[0]), fields[1]
+	default:
+		return "", fmt.Errorf("%w: expected '[METHOD] PATH [| JSONPATH]'", errInvalidRequest)
+	}
+
+	body, err := h.do(ctx, client, method, path, nil)
+	if err != nil {
+		return "", err
+	}
+	output, err := formatBody(body, strings.TrimSpace(extract))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	return output, nil
+}
+
+// do sends a request with the device's headers and credentials and returns
+// the response body.
+func (h *HTTPConnector) do(ctx context.Context, client *http.Client, method, path string, form url.Values) ([]byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL()+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range h.Settings.Headers {
+		req.Header.Set(name, value)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	switch h.auth() {
+	case models.HTTPAuthBasic:
+		req.SetBasicAuth(h.Username, h.Password)
+	case models.HTTPAuthToken:
+		if header := h.Settings.TokenHeader; header != "" && !strings.EqualFold(header, "Authorization") {
+			req.Header.Set(header, h.Password)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+h.Password)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		return nil, &httpStatusError{status: resp.StatusCode, body: msg}
+	}
+	return data, nil
+}
+
+// login posts the credentials to the login path. The session cookie it
+// returns is kept in the client's cookie jar.
+func (h *HTTPConnector) login(ctx context.Context, client *http.Client) error {
+	if h.Settings.LoginPath == "" {
+		return classify(models.FailureAuth, errors.New("the login scheme needs a login_path"))
+	}
+	userField, passwordField := h.Settings.LoginUserField, h.Settings.LoginPasswordField
+	if userField == "" {
+		userField = "username"
+	}
+	if passwordField == "" {
+		passwordField = "password"
+	}
+	form := url.Values{userField: {h.Username}, passwordField: {h.Password}}
+	if _, err := h.do(ctx, client, http.MethodPost, h.Settings.LoginPath, form); err != nil {
+		return err
+	}
+	// Some devices answer a failed login with 200 and no session.
+	u, _ := url.Parse(h.baseURL() + "/")
+	if len(client.Jar.Cookies(u)) == 0 {
+		return classify(models.FailureAuth, errors.New("the login returned no session cookie"))
+	}
+	return nil
+}
+
+// logout ends the session of the login scheme, if the device has a logout
+// path. Errors are only logged.
+func (h *HTTPConnector) logout(ctx context.Context, client *http.Client) {
+	if h.Settings.LogoutPath == "" || ctx.Err() != nil {
+		return
+	}
+	if _, err := h.do(ctx, client, http.MethodPost, h.Settings.LogoutPath, url.Values{}); err != nil {
+		utils.Log.WithField("host", h.Host).Warnf("HTTP: logout failed: %v", err)
+	}
+}
+
+// failed turns an error of a request into the error of the run, with its
+// failure category.
+func (h *HTTPConnector) failed(ctx, timeoutCtx context.Context, what string, err error) error {
+	var connErr *Error
+	var statusErr *httpStatusError
+	var certErr *tls.CertificateVerificationError
+	var opErr *net.OpError
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case timeoutCtx.Err() != nil:
+		return classify(models.FailurePromptTimeout, fmt.Errorf("HTTP: %s timed out", what))
+	case errors.As(err, &connErr):
+		return err
+	case errors.As(err, &statusErr) && (statusErr.status == http.StatusUnauthorized || statusErr.status == http.StatusForbidden):
+		return classify(models.FailureAuth, fmt.Errorf("HTTP: %s was rejected: %w", what, err))
+	case errors.As(err, &certErr):
+		return classify(models.FailureHostKey, fmt.Errorf("HTTP: certificate of %s not trusted: %w", h.Host, err))
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return classify(dialCategory(err), fmt.Errorf("HTTP: failed to connect to %s: %w", h.Host, err))
+	}
+	return fmt.Errorf("HTTP: %s failed: %w", what, err)
+}
+
+// client returns an HTTP client with the device's TLS settings and a cookie
+// jar for the login scheme.
+func (h *HTTPConnector) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if h.Settings.CAFile != "" {
+		pem, err := os.ReadFile(h.Settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", h.Settings.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", h.Settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if h.Settings.InsecureSkipVerify {
+		utils.Log.WithField("host", h.Host).Warn("Skipping TLS certificate verification for this host")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Jar: jar}, nil
+}
+
+func (h *HTTPConnector) auth() string {
+	if h.Settings.Auth == "" {
+		return models.HTTPAuthBasic
+	}
+	return h.Settings.Auth
+}
+
+func (h *HTTPConnector) baseURL() string {
+	scheme := h.Settings.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + h.Host
+}
+
+// formatBody returns a response body indented if it is JSON or XML. With a
+// JSONPath, it returns the selected value, or an array of the values if the
+// path selects several.
+func formatBody(body []byte, extract string) (string, error) {
+	trimmed := bytes.TrimSpace(body)
+	if extract != "" {
+		doc, err := decodeJSON(trimmed)
+		if err != nil {
+			return "", fmt.Errorf("the response is not JSON: %v", err)
+		}
+		values, err := jsonPath(doc, extract)
+		if err != nil {
+			return "", err
+		}
+		switch len(values) {
+		case 0:
+			return "", fmt.Errorf("JSONPath '%s' matches nothing", extract)
+		case 1:
+			return encodeJSON(values[0])
+		default:
+			return encodeJSON(values)
+		}
+	}
+
+	switch {
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		if doc, err := decodeJSON(trimmed); err == nil {
+			return encodeJSON(doc)
+		}
+	case len(trimmed) > 0 && trimmed[0] == '<':
+		if root, err := parseXML(trimmed); err == nil {
+			var b strings.Builder
+			for _, c := range root.children {
+				writeXML(&b, c, 0)
+			}
+			return strings.TrimRight(b.String(), "\n"), nil
+		}
+	}
+	return string(body), nil
+}
+
+// decodeJSON decodes a JSON document, keeping numbers as written.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// encodeJSON encodes a value indented by two spaces, with object members
+// sorted by name so that backups of the same configuration are identical.
+func encodeJSON(v interface{}) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
@@ -0,0 +1,284 @@
+package connectors
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+const httpTestConfig = `{"system": {"hostname": "fw1", "banner": "<b>authorized</b> only"}, "interfaces": [{"name": "port1", "ip": "10.0.0.1"}, {"name": "port2", "ip": "10.0.0.2"}], "count": 2}`
+
+// newHTTPDevice returns a connector for a test server.
+func newHTTPDevice(srv *httptest.Server, settings models.HTTPSettings) *HTTPConnector {
+	if settings.Scheme == "" {
+		settings.Scheme = strings.SplitN(srv.URL, ":", 2)[0]
+	}
+	return &HTTPConnector{
+		Host:     strings.SplitN(srv.URL, "://", 2)[1],
+		Username: "backup",
+		Password: "secret",
+		Settings: settings,
+		Timeout:  5 * time.Second,
+	}
+}
+
+// configHandler serves the test configuration to authorized requests.
+func configHandler(authorized func(r *http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/config":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(httpTestConfig))
+		case "/restconf/data":
+			w.Write([]byte(`<data xmlns="urn:example"><hostname>fw1</hostname></data>`))
+		case "/forbidden":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestHTTPBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(configHandler(func(r *http.Request) bool {
+		user, password, ok := r.BasicAuth()
+		return ok && user == "backup" && password == "secret"
+	}))
+	defer srv.Close()
+
+	results, err := newHTTPDevice(srv, models.HTTPSettings{}).RunCommands(context.Background(), []string{
+		"/api/config",
+		"GET /api/config | $.system.hostname",
+		"/api/config | $.interfaces[*].ip",
+		"/restconf/data",
+		"/missing",
+		"/api/config | $.nothing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{
+  "count": 2,
+  "interfaces": [
+    {
+      "ip": "10.0.0.1",
+      "name": "port1"
+    },
+    {
+      "ip": "10.0.0.2",
+      "name": "port2"
+    }
+  ],
+  "system": {
+    "banner": "<b>authorized</b> only",
+    "hostname": "fw1"
+  }
+}`,
+		`"fw1"`,
+		"[\n  \"10.0.0.1\",\n  \"10.0.0.2\"\n]",
+		"<data xmlns=\"urn:example\">\n  <hostname>fw1</hostname>\n</data>",
+		"error during execution: HTTP 404: 404 page not found",
+		"error during execution: invalid request: JSONPath '$.nothing' matches nothing",
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, r := range results {
+		if r.Output != want[i] {
+			t.Errorf("%s:\n%s\nwant:\n%s", r.Cmd, r.Output, want[i])
+		}
+	}
+}
+
+func TestHTTPTokenAuth(t *testing.T) {
+	tests := []struct {
+		header string
+		check  func(r *http.Request) bool
+	}{
+		{"", func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer secret" }},
+		{"X-Auth-Token", func(r *http.Request) bool {
+			return r.Header.Get("X-Auth-Token") == "secret" && r.Header.Get("Authorization") == ""
+		}},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(configHandler(tt.check))
+		settings := models.HTTPSettings{Auth: models.HTTPAuthToken, TokenHeader: tt.header, Headers: map[string]string{"Accept": "application/yang-data+json"}}
+		results, err := newHTTPDevice(srv, settings).RunCommands(context.Background(), []string{"/api/config | $.count"})
+		srv.Close()
+		if err != nil {
+			t.Errorf("token header %q: %v", tt.header, err)
+			continue
+		}
+		if results[0].Output != "2" {
+			t.Errorf("token header %q: output %q", tt.header, results[0].Output)
+		}
+	}
+}
+
+func TestHTTPLoginAuth(t *testing.T) {
+	var loggedOut bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logincheck", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.PostFormValue("user") != "backup" || r.PostFormValue("pass") != "secret" {
+			w.Write([]byte("login failed")) // no cookie, as some devices do
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		loggedOut = true
+	})
+	mux.Handle("/", configHandler(func(r *http.Request) bool {
+		c, err := r.Cookie("session")
+		return err == nil && c.Value == "s1"
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	settings := models.HTTPSettings{
+		Auth:               models.HTTPAuthLogin,
+		LoginPath:          "/logincheck",
+		LoginUserField:     "user",
+		LoginPasswordField: "pass",
+		LogoutPath:         "/logout",
+	}
+	device := newHTTPDevice(srv, settings)
+	results, err := device.RunCommands(context.Background(), []string{"/api/config | $..hostname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Output != `"fw1"` {
+		t.Errorf("output %q", results[0].Output)
+	}
+	if !loggedOut {
+		t.Error("the session was not logged out")
+	}
+
+	device.Password = "wrong"
+	if _, err := device.RunCommands(context.Background(), []string{"/api/config"}); Category(err) != models.FailureAuth {
+		t.Errorf("wrong password: got %v (%s), want an auth failure", err, Category(err))
+	}
+}
+
+func TestHTTPAuthFailures(t *testing.T) {
+	srv := httptest.NewServer(configHandler(func(r *http.Request) bool {
+		_, password, _ := r.BasicAuth()
+		return password == "secret"
+	}))
+	defer srv.Close()
+
+	device := newHTTPDevice(srv, models.HTTPSettings{})
+	if _, err := device.RunCommands(context.Background(), []string{"/forbidden"}); Category(err) != models.FailureAuth {
+		t.Errorf("403: got %v (%s), want an auth failure", err, Category(err))
+	}
+	device.Password = "wrong"
+	if _, err := device.RunCommands(context.Background(), []string{"/api/config"}); Category(err) != models.FailureAuth {
+		t.Errorf("401: got %v (%s), want an auth failure", err, Category(err))
+	}
+}
+
+func TestHTTPTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(configHandler(func(*http.Request) bool { return true }))
+	defer srv.Close()
+	cmds := []string{"/api/config | $.count"}
+
+	// The test server's certificate is not trusted by default.
+	if _, err := newHTTPDevice(srv, models.HTTPSettings{}).RunCommands(context.Background(), cmds); Category(err) != models.FailureHostKey {
+		t.Errorf("untrusted certificate: got %v (%s), want %s", err, Category(err), models.FailureHostKey)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, settings := range []models.HTTPSettings{{CAFile: caFile}, {InsecureSkipVerify: true}} {
+		results, err := newHTTPDevice(srv, settings).RunCommands(context.Background(), cmds)
+		if err != nil {
+			t.Errorf("%+v: %v", settings, err)
+			continue
+		}
+		if results[0].Output != "2" {
+			t.Errorf("%+v: output %q", settings, results[0].Output)
+		}
+	}
+
+	if _, err := newHTTPDevice(srv, models.HTTPSettings{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).RunCommands(context.Background(), cmds); err == nil {
+		t.Error("a missing CA file was accepted")
+	}
+}
+
+func TestHTTPConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	device := &HTTPConnector{Host: addr, Settings: models.HTTPSettings{Scheme: "http"}, Timeout: 5 * time.Second}
+	if _, err := device.RunCommands(context.Background(), []string{"/"}); Category(err) != models.FailureConnectionRefused {
+		t.Errorf("got %v (%s), want %s", err, Category(err), models.FailureConnectionRefused)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc, err := decodeJSON([]byte(`{"a": {"b": [1, 2, 3], "name": "x"}, "c": [{"name": "y"}, {"name": "z", "d": {"name": "w"}}], "e f": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$", ""},
+		{"$.a.name", `["x"]`},
+		{"$['e f']", `[true]`},
+		{`$["a"].b[0]`, `[1]`},
+		{"$.a.b[-1]", `[3]`},
+		{"$.a.b[5]", `null`},
+		{"$.a.b[*]", `[1,2,3]`},
+		{"$.c[*].name", `["y","z"]`},
+		{"$.a.*", `[[1,2,3],"x"]`},
+		{"$..name", `["x","y","z","w"]`},
+		{"$.missing.name", `null`},
+	}
+	for _, tt := range tests {
+		values, err := jsonPath(doc, tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if tt.want == "" {
+			if len(values) != 1 {
+				t.Errorf("%s: got %d values, want the document", tt.expr, len(values))
+			}
+			continue
+		}
+		got, _ := encodeJSON(values)
+		got = strings.Join(strings.Fields(got), "")
+		if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"a.b", "$.", "$..", "$[0", "$[x]", "$a"} {
+		if _, err := jsonPath(doc, expr); err == nil {
+			t.Errorf("%s: invalid expression accepted", expr)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package connectors
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath evaluates a JSONPath expression on a document decoded by
+// encoding/json and returns the matched values. It supports the root $,
+// members (.name and ['name']), array indexes ([0], negative ones count from
+// the end), wildcards (.* and [*]) and recursive descent (..name).
+func jsonPath(doc interface{}, expr string) ([]interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath '%s' does not start with $", expr)
+	}
+
+	nodes := []interface{}{doc}
+	rest := expr[1:]
+	for rest != "" {
+		var step func(v interface{}) []interface{}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			name, n := jsonPathName(rest[2:])
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath '%s': missing name after '..'", expr)
+			}
+			rest = rest[2+n:]
+			step = func(v interface{}) []interface{} { return jsonDescendants(v, name) }
+		case rest[0] == '.':
+			name, n := jsonPathName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath '%s': missing name after '.'", expr)
+			}
+			rest = rest[1+n:]
+			step = jsonMemberStep(name)
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath '%s': missing ']'", expr)
+			}
+			sel := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				name := sel[1 : len(sel)-1]
+				step = func(v interface{}) []interface{} { return jsonMember(v, name) }
+			case sel == "*":
+				step = jsonChildren
+			default:
+				index, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("JSONPath '%s': invalid selector [%s]", expr, sel)
+				}
+				step = func(v interface{}) []interface{} { return jsonIndex(v, index) }
+			}
+		default:
+			return nil, fmt.Errorf("JSONPath '%s': unexpected '%c'", expr, rest[0])
+		}
+
+		var next []interface{}
+		for _, v := range nodes {
+			next = append(next, step(v)...)
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// jsonPathName reads a member name up to the next '.' or '[' and returns it
+// with its length.
+func jsonPathName(s string) (string, int) {
+	n := strings.IndexAny(s, ".[")
+	if n < 0 {
+		n = len(s)
+	}
+	return strings.TrimSpace(s[:n]), n
+}
+
+func jsonMemberStep(name string) func(v interface{}) []interface{} {
+	if name == "*" {
+		return jsonChildren
+	}
+	return func(v interface{}) []interface{} { return jsonMember(v, name) }
+}
+
+func jsonMember(v interface{}, name string) []interface{} {
+	if obj, ok := v.(map[string]interface{}); ok {
+		if member, ok := obj[name]; ok {
+			return []interface{}{member}
+		}
+	}
+	return nil
+}
+
+func jsonIndex(v interface{}, index int) []interface{} {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	if index < 0 {
+		index += len(arr)
+	}
+	if index < 0 || index >= len(arr) {
+		return nil
+	}
+	return []interface{}{arr[index]}
+}
+
+// jsonChildren returns the elements of an array or the members of an object,
+// the latter sorted by name so that backups are stable.
+func jsonChildren(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		return t
+	case map[string]interface{}:
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		children := make([]interface{}, 0, len(t))
+		for _, name := range names {
+			children = append(children, t[name])
+		}
+		return children
+	}
+	return nil
+}
+
+// jsonDescendants returns the members with the given name of v and of all
+// values nested in it, depth first, visiting the members of objects in name
+// order as jsonChildren does.
+func jsonDescendants(v interface{}, name string) []interface{} {
+	found := jsonMember(v, name)
+	for _, child := range jsonChildren(v) {
+		found = append(found, jsonDescendants(child, name)...)
+	}
+	return found
+}
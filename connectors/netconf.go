@@ -0,0 +1,547 @@
+package connectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+const (
+	netconfNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	netconfBase10    = "urn:ietf:params:netconf:base:1.0"
+	netconfBase11    = "urn:ietf:params:netconf:base:1.1"
+	netconfCandidate = "urn:ietf:params:netconf:capability:candidate:1.0"
+
+	// netconfEOM ends a message in NETCONF 1.0 framing.
+	netconfEOM = "]]>]]>"
+	// netconfMaxChunk is the largest chunk allowed in NETCONF 1.1 framing.
+	netconfMaxChunk = 4294967295
+	// netconfMaxMessage is the largest message read from a device.
+	netconfMaxMessage = 64 << 20
+)
+
+// NetconfConnector implements the Connector interface for NETCONF over SSH
+// (RFC 6241, RFC 6242), on port 830 unless the host has a port. Each command
+// names the datastore to read, running or candidate, optionally followed by a
+// subtree filter, e.g. "running <configuration><system/></configuration>".
+// The output of a command is the configuration as indented XML.
+type NetconfConnector struct {
+	Host               string
+	Username           string
+	Password           string
+	KeyPath            string
+	Timeout            time.Duration
+	AllowInsecureAlgos bool
+
+	onCommand func(cmd string)
+}
+
+// OnCommand sets a function that is called before each command is sent.
+func (n *NetconfConnector) OnCommand(fn func(cmd string)) {
+	n.onCommand = fn
+}
+
+// RunCommands opens a NETCONF session and runs a <get-config> for each
+// command. The connector timeout applies to the whole session.
+func (n *NetconfConnector) RunCommands(ctx context.Context, cmds []string) ([]models.Result, error) {
+	logger := utils.Log.WithField("host", n.Host)
+	logger.Infof("NETCONF: connecting to %s...", n.Host)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	transport := &SSHConnector{
+		Host:               n.Host,
+		Username:           n.Username,
+		Password:           n.Password,
+		KeyPath:            n.KeyPath,
+		Timeout:            n.Timeout,
+		AllowInsecureAlgos: n.AllowInsecureAlgos,
+	}
+	client, err := transport.dialPort(timeoutCtx, "830")
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer client.Close()
+	// Closing the client ends a pending read at once.
+	stop := context.AfterFunc(timeoutCtx, func() { client.Close() })
+	defer stop()
+
+	// failed turns an error of the session into the error of the run.
+	failed := func(what string, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if timeoutCtx.Err() != nil {
+			return classify(models.FailurePromptTimeout, fmt.Errorf("NETCONF: %s timed out", what))
+		}
+		return fmt.Errorf("NETCONF: %s failed: %w", what, err)
+	}
+
+	sshSession, err := client.NewSession()
+	if err != nil {
+		return nil, failed("opening a session", err)
+	}
+	defer sshSession.Close()
+	stdin, err := sshSession.StdinPipe()
+	if err != nil {
+		return nil, failed("opening stdin", err)
+	}
+	stdout, err := sshSession.StdoutPipe()
+	if err != nil {
+		return nil, failed("opening stdout", err)
+	}
+	if err := sshSession.RequestSubsystem("netconf"); err != nil {
+		return nil, failed("starting the netconf subsystem", err)
+	}
+
+	session := newNetconfSession(stdout, stdin)
+	if err := session.hello(); err != nil {
+		return nil, failed("hello", err)
+	}
+	logger.Infof("NETCONF: session established (base %s)", session.version())
+
+	results := []models.Result{}
+	for _, cmd := range cmds {
+		logger.Infof("NETCONF: get-config %s", cmd)
+		if n.onCommand != nil {
+			n.onCommand(cmd)
+		}
+
+		output, err := session.getConfig(cmd)
+		var rpcErr *netconfRPCError
+		switch {
+		case errors.As(err, &rpcErr):
+			// The device refused this request; the session is still usable.
+			logger.Errorf("NETCONF: error executing '%s': %v", cmd, err)
+			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
+		case err != nil:
+			return results, failed(fmt.Sprintf("get-config '%s'", cmd), err)
+		default:
+			logger.Infof("NETCONF: get-config '%s' executed successfully", cmd)
+			results = append(results, models.Result{Cmd: cmd, Output: output})
+		}
+	}
+
+	session.close()
+	return results, nil
+}
+
+// netconfRPCError is a request the device answered with an error, or one
+// that was not sent because it is invalid.
+type netconfRPCError struct {
+	msg string
+}
+
+func (e *netconfRPCError) Error() string {
+	return e.msg
+}
+
+// netconfSession speaks NETCONF over a reader and writer, such as the pipes
+// of the netconf SSH subsystem or an in-process server.
+type netconfSession struct {
+	r            *bufio.Reader
+	w            io.Writer
+	chunked      bool // NETCONF 1.1 framing, after both peers announced base:1.1
+	capabilities []string
+	messageID    int
+}
+
+func newNetconfSession(r io.Reader, w io.Writer) *netconfSession {
+	return &netconfSession{r: bufio.NewReader(r), w: w}
+}
+
+// hello exchanges the hello messages and picks the framing.
+func (s *netconfSession) hello() error {
+	hello := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<hello xmlns="` + netconfNamespace + `"><capabilities>` +
+		`<capability>` + netconfBase10 + `</capability>` +
+		`<capability>` + netconfBase11 + `</capability>` +
+		`</capabilities></hello>`
+	if err := s.send(hello); err != nil {
+		return err
+	}
+	data, err := s.receive()
+	if err != nil {
+		return err
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return fmt.Errorf("invalid hello: %w", err)
+	}
+	doc := root.child("hello")
+	if doc == nil {
+		return errors.New("invalid hello: no <hello> element")
+	}
+	if caps := doc.child("capabilities"); caps != nil {
+		for _, c := range caps.children {
+			if c.local() == "capability" {
+				s.capabilities = append(s.capabilities, strings.TrimSpace(c.text))
+			}
+		}
+	}
+	switch {
+	case s.supports(netconfBase11):
+		s.chunked = true
+	case !s.supports(netconfBase10):
+		return errors.New("the device supports neither NETCONF base 1.0 nor 1.1")
+	}
+	return nil
+}
+
+// supports reports whether the device announced a capability, ignoring its
+// parameters.
+func (s *netconfSession) supports(capability string) bool {
+	for _, c := range s.capabilities {
+		if c == capability || strings.HasPrefix(c, capability+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *netconfSession) version() string {
+	if s.chunked {
+		return "1.1"
+	}
+	return "1.0"
+}
+
+// getConfig reads the datastore named by a command, with the command's
+// subtree filter if it has one, and returns the data as indented XML.
+func (s *netconfSession) getConfig(cmd string) (string, error) {
+	datastore, filter, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+	switch datastore {
+	case "running":
+	case "candidate":
+		if !s.supports(netconfCandidate) {
+			return "", &netconfRPCError{"the device has no candidate datastore"}
+		}
+	default:
+		return "", &netconfRPCError{fmt.Sprintf("unknown datastore '%s' (running or candidate)", datastore)}
+	}
+
+	body := "<get-config><source><" + datastore + "/></source>"
+	if filter = strings.TrimSpace(filter); filter != "" {
+		if _, err := parseXML([]byte(filter)); err != nil {
+			return "", &netconfRPCError{fmt.Sprintf("invalid subtree filter: %v", err)}
+		}
+		body += `<filter type="subtree">` + filter + `</filter>`
+	}
+	body += "</get-config>"
+
+	reply, err := s.rpc(body)
+	if err != nil {
+		return "", err
+	}
+	data := reply.child("data")
+	if data == nil {
+		return "", nil
+	}
+	// The namespace prefixes of the data may be declared on <rpc-reply> or
+	// <data>, which are not written, so their declarations move down to the
+	// top-level elements.
+	namespaces := namespaceDeclarations(reply, data)
+	var b strings.Builder
+	for _, c := range data.children {
+		if !c.comment {
+			c = withNamespaces(c, namespaces)
+		}
+		writeXML(&b, c, 0)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// namespaceDeclarations returns the namespace declarations in scope inside
+// the last of nested elements, outermost first.
+func namespaceDeclarations(elements ...*xmlNode) []xml.Attr {
+	var decls []xml.Attr
+	for _, n := range elements {
+		for _, a := range n.attrs {
+			if !isNamespaceDeclaration(a) {
+				continue
+			}
+			decls = removeAttr(decls, a.Name)
+			decls = append(decls, a)
+		}
+	}
+	return decls
+}
+
+// withNamespaces returns a copy of an element that declares the namespaces
+// it does not declare itself.
+func withNamespaces(n *xmlNode, decls []xml.Attr) *xmlNode {
+	var attrs []xml.Attr
+	for _, d := range decls {
+		if !hasAttr(n.attrs, d.Name) {
+			attrs = append(attrs, d)
+		}
+	}
+	c := *n
+	c.attrs = append(attrs, n.attrs...)
+	return &c
+}
+
+// isNamespaceDeclaration reports whether an attribute is xmlns or xmlns:prefix.
+func isNamespaceDeclaration(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns"
+}
+
+func hasAttr(attrs []xml.Attr, name xml.Name) bool {
+	for _, a := range attrs {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func removeAttr(attrs []xml.Attr, name xml.Name) []xml.Attr {
+	var kept []xml.Attr
+	for _, a := range attrs {
+		if a.Name != name {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// rpc sends a request and returns its <rpc-reply>. A reply with errors is
+// returned as a *netconfRPCError.
+func (s *netconfSession) rpc(body string) (*xmlNode, error) {
+	s.messageID++
+	id := strconv.Itoa(s.messageID)
+	if err := s.send(`<rpc message-id="` + id + `" xmlns="` + netconfNamespace + `">` + body + `</rpc>`); err != nil {
+		return nil, err
+	}
+	data, err := s.receive()
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reply: %w", err)
+	}
+	reply := root.child("rpc-reply")
+	if reply == nil {
+		return nil, errors.New("invalid reply: no <rpc-reply> element")
+	}
+
+	var msgs []string
+	for _, c := range reply.children {
+		if c.local() != "rpc-error" {
+			continue
+		}
+		if severity := c.child("error-severity"); severity != nil && strings.TrimSpace(severity.text) == "warning" {
+			continue
+		}
+		msg := "rpc error"
+		if tag := c.child("error-tag"); tag != nil {
+			msg = strings.TrimSpace(tag.text)
+		}
+		if m := c.child("error-message"); m != nil {
+			msg += ": " + strings.TrimSpace(m.text)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) > 0 {
+		return nil, &netconfRPCError{strings.Join(msgs, "; ")}
+	}
+	return reply, nil
+}
+
+// close ends the session. The reply is not awaited, as the connection is
+// closed next.
+func (s *netconfSession) close() {
+	s.messageID++
+	s.send(`<rpc message-id="` + strconv.Itoa(s.messageID) + `" xmlns="` + netconfNamespace + `"><close-session/></rpc>`)
+}
+
+// send writes a message in the framing of the session.
+func (s *netconfSession) send(msg string) error {
+	var err error
+	if s.chunked {
+		_, err = fmt.Fprintf(s.w, "\n#%d\n%s\n##\n", len(msg), msg)
+	} else {
+		_, err = io.WriteString(s.w, msg+netconfEOM)
+	}
+	return err
+}
+
+// receive reads a message in the framing of the session.
+func (s *netconfSession) receive() ([]byte, error) {
+	if s.chunked {
+		return s.receiveChunked()
+	}
+	var msg []byte
+	for !bytes.HasSuffix(msg, []byte(netconfEOM)) {
+		part, err := s.r.ReadBytes('>')
+		if err != nil {
+			return nil, err
+		}
+		if len(msg)+len(part) > netconfMaxMessage {
+			return nil, fmt.Errorf("message larger than %d bytes", netconfMaxMessage)
+		}
+		msg = append(msg, part...)
+	}
+	return msg[:len(msg)-len(netconfEOM)], nil
+}
+
+// receiveChunked reads a message in NETCONF 1.1 chunked framing: chunks of
+// "\n#<size>\n<data>" ended by "\n##\n". Chunks are read as they arrive, so
+// that a chunk size only allocates memory for the data actually sent.
+func (s *netconfSession) receiveChunked() ([]byte, error) {
+	var msg bytes.Buffer
+	for {
+		var start [2]byte
+		if _, err := io.ReadFull(s.r, start[:]); err != nil {
+			return nil, err
+		}
+		if start != [2]byte{'\n', '#'} {
+			return nil, fmt.Errorf("invalid chunk header %q", start[:])
+		}
+		header, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		header = strings.TrimSuffix(header, "\n")
+		if header == "#" {
+			return msg.Bytes(), nil
+		}
+		size, err := strconv.ParseUint(header, 10, 64)
+		if err != nil || size == 0 || size > netconfMaxChunk {
+			return nil, fmt.Errorf("invalid chunk size %q", header)
+		}
+		if uint64(msg.Len())+size > netconfMaxMessage {
+			return nil, fmt.Errorf("message larger than %d bytes", netconfMaxMessage)
+		}
+		if _, err := io.CopyN(&msg, s.r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// xmlNode is an element of a parsed XML document. Names keep the prefix
+// they were written with, so that the document is written back as received.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+	comment  bool
+}
+
+// local returns the name of the element without its prefix.
+func (n *xmlNode) local() string {
+	if _, local, ok := strings.Cut(n.name, ":"); ok {
+		return local
+	}
+	return n.name
+}
+
+// child returns the first child element with the given local name.
+func (n *xmlNode) child(local string) *xmlNode {
+	for _, c := range n.children {
+		if !c.comment && c.local() == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseXML parses a document into a tree under an unnamed root node.
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: prefixedName(t.Name), attrs: t.Attr}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 1 || prefixedName(t.Name) != top.name {
+				return nil, fmt.Errorf("unexpected </%s>", prefixedName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(t)
+		case xml.Comment:
+			top.children = append(top.children, &xmlNode{text: string(t), comment: true})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("<%s> is not closed", stack[len(stack)-1].name)
+	}
+	return root, nil
+}
+
+func prefixedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// writeXML writes an element indented by two spaces per level. Text of
+// elements that also have child elements is written before the children.
+func writeXML(b *strings.Builder, n *xmlNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if n.comment {
+		b.WriteString(indent + "<!--" + n.text + "-->\n")
+		return
+	}
+	b.WriteString(indent + "<" + n.name)
+	for _, a := range n.attrs {
+		b.WriteString(" " + prefixedName(a.Name) + `="` + xmlAttrEscaper.Replace(a.Value) + `"`)
+	}
+	text := n.text
+	if strings.TrimSpace(text) == "" {
+		text = ""
+	}
+	switch {
+	case len(n.children) == 0 && text == "":
+		b.WriteString("/>\n")
+	case len(n.children) == 0:
+		b.WriteString(">" + xmlTextEscaper.Replace(text) + "</" + n.name + ">\n")
+	default:
+		b.WriteString(">\n")
+		if text != "" {
+			b.WriteString(indent + "  " + xmlTextEscaper.Replace(strings.TrimSpace(text)) + "\n")
+		}
+		for _, c := range n.children {
+			writeXML(b, c, depth+1)
+		}
+		b.WriteString(indent + "</" + n.name + ">\n")
+	}
+}
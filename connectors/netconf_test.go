@@ -0,0 +1,262 @@
+package connectors
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// netconfStub is an in-process NETCONF server. It answers each request with
+// the reply its handler returns for the request body.
+type netconfStub struct {
+	r        *bufio.Reader
+	w        io.Writer
+	chunked  bool
+	requests []string
+}
+
+var messageIDPattern = regexp.MustCompile(`message-id="(\d+)"`)
+
+// startNetconfStub connects a client session to a stub that announces the
+// given capabilities. The handler returns the content of the <rpc-reply>.
+func startNetconfStub(t *testing.T, capabilities []string, handle func(req string) string) (*netconfSession, *netconfStub) {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	t.Cleanup(func() {
+		clientR.Close()
+		serverR.Close()
+	})
+
+	stub := &netconfStub{r: bufio.NewReader(serverR), w: serverW}
+	var caps strings.Builder
+	for _, c := range capabilities {
+		caps.WriteString("<capability>" + c + "</capability>")
+	}
+	go func() {
+		// Both peers send their hello first; the pipes are unbuffered.
+		go io.WriteString(serverW, `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="`+netconfNamespace+`"><capabilities>`+caps.String()+`</capabilities><session-id>1</session-id></hello>`+netconfEOM)
+		if _, err := stub.readEOM(); err != nil {
+			return
+		}
+		stub.chunked = contains(capabilities, netconfBase11)
+		for {
+			req, err := stub.read()
+			if err != nil {
+				return
+			}
+			stub.requests = append(stub.requests, req)
+			if strings.Contains(req, "<close-session/>") {
+				return
+			}
+			id := messageIDPattern.FindStringSubmatch(req)[1]
+			stub.write(`<rpc-reply message-id="` + id + `" xmlns="` + netconfNamespace + `">` + handle(req) + `</rpc-reply>`)
+		}
+	}()
+	return newNetconfSession(clientR, clientW), stub
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *netconfStub) read() (string, error) {
+	if s.chunked {
+		return s.readChunked()
+	}
+	return s.readEOM()
+}
+
+func (s *netconfStub) readEOM() (string, error) {
+	var msg strings.Builder
+	for !strings.HasSuffix(msg.String(), netconfEOM) {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		msg.WriteByte(b)
+	}
+	return strings.TrimSuffix(msg.String(), netconfEOM), nil
+}
+
+func (s *netconfStub) readChunked() (string, error) {
+	var msg strings.Builder
+	for {
+		if _, err := s.r.Discard(2); err != nil { // "\n#"
+			return "", err
+		}
+		header, err := s.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if header == "#\n" {
+			return msg.String(), nil
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header))
+		if err != nil {
+			return "", err
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(s.r, chunk); err != nil {
+			return "", err
+		}
+		msg.Write(chunk)
+	}
+}
+
+// write sends a message; chunked messages are split into chunks of 16 bytes.
+func (s *netconfStub) write(msg string) {
+	if !s.chunked {
+		io.WriteString(s.w, msg+netconfEOM)
+		return
+	}
+	var framed strings.Builder
+	for len(msg) > 0 {
+		n := min(16, len(msg))
+		fmt.Fprintf(&framed, "\n#%d\n%s", n, msg[:n])
+		msg = msg[n:]
+	}
+	framed.WriteString("\n##\n")
+	io.WriteString(s.w, framed.String())
+}
+
+func netconfHandler(req string) string {
+	switch {
+	case strings.Contains(req, "<nonexistent/>"):
+		return `<rpc-error><error-type>application</error-type><error-tag>unknown-element</error-tag>` +
+			`<error-severity>error</error-severity><error-message>nonexistent is not known</error-message></rpc-error>`
+	case strings.Contains(req, "<candidate/>"):
+		return `<data><system><host-name>r1-candidate</host-name></system></data>`
+	default:
+		return `<data><system xmlns="urn:example:system"><host-name>r1</host-name><!-- managed --><ntp><server>10.0.0.1</server>` +
+			`<server>10.0.0.2</server></ntp><motd>a &lt; b</motd></system></data>`
+	}
+}
+
+const wantRunning = `<system xmlns="urn:example:system">
+  <host-name>r1</host-name>
+  <!-- managed -->
+  <ntp>
+    <server>10.0.0.1</server>
+    <server>10.0.0.2</server>
+  </ntp>
+  <motd>a &lt; b</motd>
+</system>`
+
+func TestNetconfSession(t *testing.T) {
+	for _, version := range []string{"1.0", "1.1"} {
+		t.Run(version, func(t *testing.T) {
+			caps := []string{netconfBase10, netconfCandidate}
+			if version == "1.1" {
+				caps = append(caps, netconfBase11)
+			}
+			session, stub := startNetconfStub(t, caps, netconfHandler)
+			if err := session.hello(); err != nil {
+				t.Fatalf("hello: %v", err)
+			}
+			if session.version() != version {
+				t.Fatalf("version %s, want %s", session.version(), version)
+			}
+
+			got, err := session.getConfig("running")
+			if err != nil {
+				t.Fatalf("get-config running: %v", err)
+			}
+			if got != wantRunning {
+				t.Errorf("running config:\n%s\nwant:\n%s", got, wantRunning)
+			}
+
+			// An rpc-error fails the command, not the session.
+			_, err = session.getConfig("running <nonexistent/>")
+			var rpcErr *netconfRPCError
+			if !errors.As(err, &rpcErr) || rpcErr.Error() != "unknown-element: nonexistent is not known" {
+				t.Errorf("rpc-error: got %v", err)
+			}
+			if !strings.Contains(stub.requests[len(stub.requests)-1], `<filter type="subtree"><nonexistent/></filter>`) {
+				t.Errorf("request without the subtree filter: %s", stub.requests[len(stub.requests)-1])
+			}
+
+			got, err = session.getConfig("candidate")
+			if err != nil || !strings.Contains(got, "r1-candidate") {
+				t.Errorf("get-config candidate: %q, %v", got, err)
+			}
+			session.close()
+		})
+	}
+}
+
+func TestNetconfInvalidCommands(t *testing.T) {
+	session, stub := startNetconfStub(t, []string{netconfBase10}, netconfHandler)
+	if err := session.hello(); err != nil {
+		t.Fatalf("hello: %v", err)
+	}
+	for _, cmd := range []string{"candidate", "startup", "running <unclosed>"} {
+		var rpcErr *netconfRPCError
+		if _, err := session.getConfig(cmd); !errors.As(err, &rpcErr) {
+			t.Errorf("%q: got %v, want an rpc error", cmd, err)
+		}
+	}
+	if len(stub.requests) != 0 {
+		t.Errorf("invalid commands were sent: %v", stub.requests)
+	}
+}
+
+func TestNetconfHelloWithoutBase(t *testing.T) {
+	session, _ := startNetconfStub(t, []string{"urn:example:other"}, netconfHandler)
+	if err := session.hello(); err == nil {
+		t.Fatal("hello without a base capability succeeded")
+	}
+}
+
+// Prefixes declared on <rpc-reply> and <data> are declared again on the
+// written elements, so that the backup is well-formed XML.
+func TestNetconfNamespaces(t *testing.T) {
+	session, _ := startNetconfStub(t, []string{netconfBase11}, func(string) string {
+		return `<data xmlns:junos="http://xml.juniper.net/junos/23.4R1/junos">` +
+			`<configuration xmlns="http://xml.juniper.net/xnm/1.1/xnm" junos:changed-seconds="1700000000">` +
+			`<system><host-name>r1</host-name></system></configuration></data>`
+	})
+	if err := session.hello(); err != nil {
+		t.Fatalf("hello: %v", err)
+	}
+	got, err := session.getConfig("running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<configuration xmlns:junos="http://xml.juniper.net/junos/23.4R1/junos" xmlns="http://xml.juniper.net/xnm/1.1/xnm" junos:changed-seconds="1700000000">`
+	if first, _, _ := strings.Cut(got, "\n"); first != want {
+		t.Errorf("first line %s, want %s", first, want)
+	}
+}
+
+func TestNetconfChunkLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"huge chunk", "\n#4000000000\n<rpc-reply/>"},
+		{"message over the limit", fmt.Sprintf("\n#%d\n", netconfMaxMessage+1)},
+		{"truncated chunk", "\n#100\n<rpc-reply/>"},
+		{"zero size", "\n#0\n"},
+		{"bad header", "#5\n<a/>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNetconfSession(strings.NewReader(tt.input), io.Discard)
+			s.chunked = true
+			if _, err := s.receive(); err == nil {
+				t.Error("invalid framing was accepted")
+			}
+		})
+	}
+}
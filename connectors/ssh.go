@@ -1,12 +1,15 @@
 package connectors
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cobrich/netcfg-backup/models"
@@ -25,6 +28,13 @@ type SSHConnector struct {
 	KeyPath            string
 	Timeout            time.Duration
 	AllowInsecureAlgos bool // For use nonsecure lgorithms
+
+	onCommand func(cmd string)
+}
+
+// OnCommand sets a function that is called before each command is sent.
+func (s *SSHConnector) OnCommand(fn func(cmd string)) {
+	s.onCommand = fn
 }
 
 // createAuthMethod creates an SSH authentication method from a private key file or a password.
@@ -48,33 +58,229 @@ func createAuthMethod(keyPath, password string) (ssh.AuthMethod, error) {
 }
 
 // RunCommands connects to a device via SSH and executes a list of commands.
-func (s *SSHConnector) RunCommands(cmds []string) ([]models.Result, error) {
+// The connector timeout applies to the whole session.
+func (s *SSHConnector) RunCommands(ctx context.Context, cmds []string) ([]models.Result, error) {
 	logger := utils.Log.WithField("host", s.Host)
 	logger.Infof("SSH: connecting to %s...", s.Host)
 
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	client, err := s.dial(timeoutCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer client.Close()
+	// Closing the client ends a running command at once.
+	stop := context.AfterFunc(timeoutCtx, func() { client.Close() })
+	defer stop()
+
+	results := []models.Result{}
+
+	for _, cmd := range cmds {
+		logger.Infof("SSH: executing command: %s", cmd)
+		if s.onCommand != nil {
+			s.onCommand(cmd)
+		}
+
+		outputCh := make(chan models.Result, 1)
+		errCh := make(chan error, 1)
+
+		go func(c string) {
+			if method, path, ok := parseFetch(c); ok {
+				data, err := fetchFile(client, method, path)
+				if err != nil {
+					errCh <- classify(models.FailureCommand, fmt.Errorf("failed to fetch %s: %w", path, err))
+					return
+				}
+				outputCh <- FileResult(c, path, data)
+				return
+			}
+
+			session, err := client.NewSession()
+			if err != nil {
+				errCh <- fmt.Errorf("failed to create session: %v", err)
+				return
+			}
+			defer session.Close()
+
+			output, err := session.CombinedOutput(c)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			outputCh <- models.Result{Cmd: c, Output: string(output)}
+		}(cmd)
+
+		// Use a select statement to wait for one of three outcomes:
+		// 1. The context is cancelled or times out (overall command timeout).
+		// 2. An error occurs during execution.
+		// 3. The command successfully returns output.
+		select {
+		case <-timeoutCtx.Done():
+			if ctx.Err() != nil {
+				logger.Warnf("SSH: cancelled while executing '%s'", cmd)
+				return results, ctx.Err()
+			}
+			logger.Errorf("SSH: command execution timed out '%s'", cmd)
+			return results, classify(models.FailurePromptTimeout, fmt.Errorf("command '%s' timed out", cmd))
+		case err := <-errCh:
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			logger.Errorf("SSH: error executing command '%s': %v", cmd, err)
+			// A file that could not be copied is missing from the backup,
+			// unlike a command that printed an error.
+			if _, _, ok := parseFetch(cmd); ok {
+				return results, err
+			}
+			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
+		case result := <-outputCh:
+			logger.Infof("SSH: command '%s' executed successfully", cmd)
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// PushConfig opens an interactive shell and sends the lines one at a time,
+// waiting for the device to finish its output after each of them.
+func (s *SSHConnector) PushConfig(lines []string) (string, error) {
+	logger := utils.Log.WithField("host", s.Host)
+	logger.Infof("SSH: connecting to %s to push %d config lines...", s.Host, len(lines))
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
 	defer cancel()
 
+	client, err := s.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("vt100", 0, 512, modes); err != nil {
+		return "", fmt.Errorf("failed to request a terminal: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to open stdin: %v", err)
+	}
+	out := &syncBuffer{}
+	session.Stdout = out
+	session.Stderr = out
+	if err := session.Shell(); err != nil {
+		return "", fmt.Errorf("failed to start shell: %v", err)
+	}
+
+	// Wait for the login banner and the first prompt.
+	waitIdle(out, pushIdleTime, s.Timeout)
+	for _, line := range lines {
+		logger.Debugf("SSH: sending config line: %s", line)
+		if _, err := io.WriteString(stdin, line+"\n"); err != nil {
+			return out.String(), fmt.Errorf("failed to send '%s': %v", line, err)
+		}
+		waitIdle(out, pushIdleTime, s.Timeout)
+	}
+	// Commits can take a while before they print anything.
+	waitIdle(out, 4*pushIdleTime, s.Timeout)
+
+	logger.Info("SSH: config lines sent")
+	return out.String(), nil
+}
+
+// pushIdleTime is how long the output must stay unchanged before the next config line is sent.
+const pushIdleTime = 500 * time.Millisecond
+
+// syncBuffer is a bytes.Buffer that can be written by the SSH session while it is read.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// waitIdle returns once the buffer has not grown for idle, or after max.
+func waitIdle(b *syncBuffer, idle, max time.Duration) {
+	deadline := time.Now().Add(max)
+	last := b.Len()
+	lastChange := time.Now()
+	for time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		if n := b.Len(); n != last {
+			last = n
+			lastChange = time.Now()
+			continue
+		}
+		if time.Since(lastChange) >= idle {
+			return
+		}
+	}
+}
+
+// dial connects to the device and completes the SSH handshake.
+func (s *SSHConnector) dial(ctx context.Context) (*ssh.Client, error) {
+	return s.dialPort(ctx, "22")
+}
+
+// dialPort is dial with the port used when the host has none.
+func (s *SSHConnector) dialPort(ctx context.Context, defaultPort string) (*ssh.Client, error) {
+	logger := utils.Log.WithField("host", s.Host)
+
 	d := net.Dialer{}
 	addr := s.Host
 	if !strings.Contains(addr, ":") {
-		addr = addr + ":22"
+		addr = addr + ":" + defaultPort
 	}
 	conn, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		logger.Errorf("SSH: failed to connect: %v", err)
-		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+		return nil, classify(dialCategory(err), fmt.Errorf("failed to connect to %s: %w", addr, err))
 	}
-	defer conn.Close()
 	logger.Infof("SSH: connection to %s established", addr)
+	// The handshake does not take a context, so close the connection to abort it.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	hostKeyCallback, err := createHostKeyCallback()
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to create HostKeyCallback: %v", err)
 	}
 
 	authMethod, err := createAuthMethod(s.KeyPath, s.Password) // <-- s.KeyPath needs to be added to the structure
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
@@ -104,55 +310,11 @@ func (s *SSHConnector) RunCommands(cmds []string) ([]models.Result, error) {
 
 	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
+		conn.Close()
 		logger.Errorf("SSH: failed to create SSH session: %v", err)
-		return nil, fmt.Errorf("failed to establish SSH session: %v", err)
-	}
-	client := ssh.NewClient(c, chans, reqs)
-	defer client.Close()
-
-	results := []models.Result{}
-
-	for _, cmd := range cmds {
-		logger.Infof("SSH: executing command: %s", cmd)
-
-		outputCh := make(chan []byte)
-		errCh := make(chan error)
-
-		go func(c string) {
-			session, err := client.NewSession()
-			if err != nil {
-				errCh <- fmt.Errorf("failed to create session: %v", err)
-				return
-			}
-			defer session.Close()
-
-			output, err := session.CombinedOutput(c)
-			if err != nil {
-				errCh <- err
-				return
-			}
-			outputCh <- output
-		}(cmd)
-
-		// Use a select statement to wait for one of three outcomes:
-		// 1. The context times out (overall command timeout).
-		// 2. An error occurs during execution.
-		// 3. The command successfully returns output.
-		select {
-		case <-ctx.Done():
-			logger.Errorf("SSH: command execution timed out '%s'", cmd)
-			// results = append(results, models.Result{Cmd: cmd, Output: "timeout"})
-			return results, fmt.Errorf("command '%s' timed out", cmd) 
-		case err := <-errCh:
-			logger.Errorf("SSH: error executing command '%s': %v", cmd, err)
-			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
-		case output := <-outputCh:
-			logger.Infof("SSH: command '%s' executed successfully", cmd)
-			results = append(results, models.Result{Cmd: cmd, Output: string(output)})
-		}
+		return nil, classify(handshakeCategory(err), fmt.Errorf("failed to establish SSH session: %w", err))
 	}
-
-	return results, nil
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 // createHostKeyCallback creates a host key callback that verifies server keys against the user's known_hosts file.
@@ -1,8 +1,9 @@
 package connectors
 
 import (
+	"context"
 	"fmt"
-	"net" // CHANGE: needed for DialTimeout
+	"net" // CHANGE: needed for Dialer
 	"strings"
 	"time"
 
@@ -20,25 +21,83 @@ type TelnetConnector struct {
 	Password string
 	Prompt   string
 	Timeout  time.Duration // This timeout will now be for every operation
+
+	onCommand func(cmd string)
+}
+
+// OnCommand sets a function that is called before each command is sent.
+func (t *TelnetConnector) OnCommand(fn func(cmd string)) {
+	t.onCommand = fn
 }
 
 // Set reasonable default timeouts
 const defaultTelnetTimeout = 15 * time.Second
 
 // RunCommands connects to a device via Telnet and executes a list of commands.
-func (t *TelnetConnector) RunCommands(cmds []string) ([]models.Result, error) {
+func (t *TelnetConnector) RunCommands(ctx context.Context, cmds []string) ([]models.Result, error) {
 	logger := utils.Log.WithField("host", t.Host)
 	logger.Infof("Telnet: connecting to %s...", t.Host)
 
-	// CHANGE: Use net.DialTimeout to connect with a timeout
+	conn, err := t.login(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer conn.Close()
+	// Closing the connection interrupts a read that waits for the prompt.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	results := []models.Result{}
+
+	for _, cmd := range cmds {
+		if ctx.Err() != nil {
+			logger.Warn("Telnet: cancelled")
+			return results, ctx.Err()
+		}
+		logger.Infof("Telnet: executing command: %s", cmd)
+		if t.onCommand != nil {
+			t.onCommand(cmd)
+		}
+
+		if err := send(conn, t.getTimeout(), cmd); err != nil {
+			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error sending: %v", err)})
+			continue // Go to the next command
+		}
+
+		output, err := readUntil(conn, t.getTimeout(), t.Prompt)
+		if err != nil {
+			logger.Errorf("Telnet: error executing command '%s': %v", cmd, err)
+			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
+		} else {
+			// Telnet output often includes the command that was just typed and the prompt that follows the output.
+			// This function cleans up the raw output to return only the actual command response.
+			cleanOutput := cleanTelnetOutput(output, cmd, t.Prompt)
+			logger.Infof("Telnet: command '%s' executed successfully", cmd)
+			results = append(results, models.Result{Cmd: cmd, Output: cleanOutput})
+		}
+	}
+
+	return results, nil
+}
+
+// login connects to the device and logs in, returning the connection at the
+// first prompt. Cancelling ctx aborts the login.
+func (t *TelnetConnector) login(ctx context.Context) (*telnet.Conn, error) {
+	logger := utils.Log.WithField("host", t.Host)
+
+	// Connect with a timeout; cancelling ctx aborts the attempt
 	addr := t.Host
 	if !strings.Contains(addr, ":") {
 		addr = addr + ":23"
 	}
-	connDialer, err := net.DialTimeout("tcp", addr, t.getTimeout())
+	dialer := net.Dialer{Timeout: t.getTimeout()}
+	connDialer, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		logger.Errorf("Telnet: failed to connect: %v", err)
-		return nil, fmt.Errorf("telnet: failed to connect: %v", err)
+		return nil, classify(dialCategory(err), fmt.Errorf("telnet: failed to connect: %w", err))
 	}
 
 	// Wrap the connection in telnet.Conn
@@ -47,61 +106,90 @@ func (t *TelnetConnector) RunCommands(cmds []string) ([]models.Result, error) {
 		// This error can occur if the Telnet handshake (option exchange) fails
 		logger.Errorf("Telnet: failed to create Telnet session: %v", err)
 		connDialer.Close() // Close the base TCP connection
-		return nil, fmt.Errorf("telnet: failed to create Telnet session: %v", err)
+		return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: failed to create Telnet session: %w", err))
 	}
 
-	defer conn.Close()
-
 	// Set a deadline for the entire connection. It will be shifted for each operation
 	conn.SetUnixWriteMode(true)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// --- Authorization with deadlines ---
 	if err := expect(conn, t.getTimeout(), "Username:", "login:"); err != nil {
-		return nil, fmt.Errorf("telnet: did not wait for username prompt: %v", err)
+		conn.Close()
+		return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: did not wait for username prompt: %w", err))
 	}
 	if err := send(conn, t.getTimeout(), t.Username); err != nil {
-		return nil, fmt.Errorf("telnet: failed to send username: %v", err)
+		conn.Close()
+		return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: failed to send username: %w", err))
 	}
 
 	if err := expect(conn, t.getTimeout(), "Password:", "password:"); err != nil {
-		return nil, fmt.Errorf("telnet: did not wait for password prompt: %v", err)
+		conn.Close()
+		return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: did not wait for password prompt: %w", err))
 	}
 	if err := send(conn, t.getTimeout(), t.Password); err != nil {
-		return nil, fmt.Errorf("telnet: failed to send password: %v", err)
+		conn.Close()
+		return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: failed to send password: %w", err))
 	}
 
 	if t.Prompt == "" {
 		t.Prompt = ">"
 	}
-	// Wait for the prompt after login
-	if err := expect(conn, t.getTimeout(), t.Prompt, "$", "#", ">"); err != nil {
-		return nil, fmt.Errorf("telnet: did not find a prompt after login: %w", err)
+	// Wait for the prompt after login. Devices that reject the login say so
+	// or ask for the username again. "login:" also ends banners such as
+	// "Last login: ...", which are read past.
+	deadline := time.Now().Add(t.getTimeout())
+	delimiters := append(append([]string{t.Prompt, "$", "#", ">"}, loginRejections...), loginPrompts...)
+	var output strings.Builder
+	for {
+		conn.SetReadDeadline(deadline)
+		data, err := conn.ReadUntil(delimiters...)
+		output.Write(data)
+		if err != nil {
+			conn.Close()
+			return nil, classify(models.FailurePromptTimeout, fmt.Errorf("telnet: did not find a prompt after login: %w", err))
+		}
+		state := loginState(output.String())
+		if state == loginRejected {
+			conn.Close()
+			return nil, classify(models.FailureAuth, fmt.Errorf("telnet: login rejected: %s", strings.TrimSpace(output.String())))
+		}
+		if state == loginAccepted {
+			break
+		}
 	}
 
-	results := []models.Result{}
+	return conn, nil
+}
 
-	for _, cmd := range cmds {
-		logger.Infof("Telnet: executing command: %s", cmd)
+// PushConfig logs in and sends the lines one at a time, waiting for a prompt after each of them.
+func (t *TelnetConnector) PushConfig(lines []string) (string, error) {
+	logger := utils.Log.WithField("host", t.Host)
+	logger.Infof("Telnet: connecting to %s to push %d config lines...", t.Host, len(lines))
 
-		if err := send(conn, t.getTimeout(), cmd); err != nil {
-			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error sending: %v", err)})
-			continue // Go to the next command
-		}
+	conn, err := t.login(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
 
-		output, err := readUntil(conn, t.getTimeout(), t.Prompt)
+	var transcript strings.Builder
+	for _, line := range lines {
+		logger.Debugf("Telnet: sending config line: %s", line)
+		if err := send(conn, t.getTimeout(), line); err != nil {
+			return transcript.String(), fmt.Errorf("telnet: failed to send '%s': %v", line, err)
+		}
+		// Configuration modes change the prompt, e.g. "router(config)#".
+		output, err := readUntil(conn, t.getTimeout(), t.Prompt, "#", ">")
+		transcript.WriteString(output)
 		if err != nil {
-			logger.Errorf("Telnet: error executing command '%s': %v", cmd, err)
-			results = append(results, models.Result{Cmd: cmd, Output: fmt.Sprintf("error during execution: %v", err)})
-		} else {
-			// Telnet output often includes the command that was just typed and the prompt that follows the output.
-			// This function cleans up the raw output to return only the actual command response.
-			cleanOutput := cleanTelnetOutput(output, cmd, t.Prompt)
-			logger.Infof("Telnet: command '%s' executed successfully", cmd)
-			results = append(results, models.Result{Cmd: cmd, Output: cleanOutput})
+			return transcript.String(), fmt.Errorf("telnet: no prompt after '%s': %v", line, err)
 		}
 	}
 
-	return results, nil
+	logger.Info("Telnet: config lines sent")
+	return transcript.String(), nil
 }
 
 // getTimeout returns the configured timeout or a default value.
@@ -112,6 +200,43 @@ func (t *TelnetConnector) getTimeout() time.Duration {
 	return defaultTelnetTimeout
 }
 
+// loginRejections are device answers to a rejected login.
+var loginRejections = []string{"Login invalid", "Login incorrect", "% Authentication failed", "Access denied"}
+
+// loginPrompts ask for the username again after a rejected login, when they
+// start a line.
+var loginPrompts = []string{"Username:", "login:"}
+
+// States of the output read after the password was sent.
+const (
+	loginPending  = iota // more output must be read
+	loginAccepted        // a prompt ends the output
+	loginRejected        // the device rejected the login
+)
+
+// loginState tells from the output read so far after the password whether
+// the device accepted the login. The output ends with one of the delimiters
+// of the login, and only its last line matters: a username prompt there is
+// a re-prompt only at the start of a line, since "login:" also ends
+// "Last login: ..." banners.
+func loginState(output string) int {
+	for _, marker := range loginRejections {
+		if strings.HasSuffix(output, marker) {
+			return loginRejected
+		}
+	}
+	for _, prompt := range loginPrompts {
+		if strings.HasSuffix(output, prompt) {
+			line := output[strings.LastIndex(output, "\n")+1:]
+			if strings.TrimSpace(strings.TrimSuffix(line, prompt)) == "" {
+				return loginRejected
+			}
+			return loginPending
+		}
+	}
+	return loginAccepted
+}
+
 // expect reads from the connection until one of the delimiters is found.
 func expect(conn *telnet.Conn, timeout time.Duration, delimiters ...string) error {
 	conn.SetReadDeadline(time.Now().Add(timeout))
@@ -125,10 +250,10 @@ func send(conn *telnet.Conn, timeout time.Duration, s string) error {
 	return err
 }
 
-// readUntil reads from the connection until the prompt is found.
-func readUntil(conn *telnet.Conn, timeout time.Duration, prompt string) (string, error) {
+// readUntil reads from the connection until one of the prompts is found.
+func readUntil(conn *telnet.Conn, timeout time.Duration, prompts ...string) (string, error) {
 	conn.SetReadDeadline(time.Now().Add(timeout))
-	data, err := conn.ReadUntil(prompt)
+	data, err := conn.ReadUntil(prompts...)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,81 @@
+package connectors
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+func TestLoginState(t *testing.T) {
+	tests := []struct {
+		output string
+		want   int
+	}{
+		{"\r\nR1#", loginAccepted},
+		{"\r\nLast login:", loginPending},
+		{"\r\nLast login: Mon Oct 19 04:00:00 from 10.0.0.1\r\nR1#", loginAccepted},
+		{"\r\n% Login invalid", loginRejected},
+		{"\r\nLogin incorrect", loginRejected},
+		{"\r\n% Authentication failed", loginRejected},
+		{"\r\nAccess denied", loginRejected},
+		{"\r\n\r\nUsername:", loginRejected},
+		{"\r\nrouter login:", loginPending},
+		{"login:", loginRejected},
+	}
+	for _, tt := range tests {
+		if got := loginState(tt.output); got != tt.want {
+			t.Errorf("loginState(%q) = %d, want %d", tt.output, got, tt.want)
+		}
+	}
+}
+
+// serveTelnetLogin answers one telnet login with the given text after the
+// password.
+func serveTelnetLogin(t *testing.T, afterPassword string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("Username: "))
+		r.ReadString('\n')
+		conn.Write([]byte("Password: "))
+		r.ReadString('\n')
+		conn.Write([]byte(afterPassword))
+		r.ReadString('\n')
+	}()
+	return ln.Addr().String()
+}
+
+func TestTelnetLoginBanner(t *testing.T) {
+	addr := serveTelnetLogin(t, "\r\nLast login: Mon Oct 19 04:00:00 2026 from 10.0.0.1\r\nR1#")
+	c := &TelnetConnector{Host: addr, Username: "u", Password: "p", Prompt: "R1#", Timeout: 2 * time.Second}
+	conn, err := c.login(context.Background())
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestTelnetLoginRejected(t *testing.T) {
+	for _, answer := range []string{"\r\nLogin incorrect\r\n", "\r\n\r\nUsername: "} {
+		addr := serveTelnetLogin(t, answer)
+		c := &TelnetConnector{Host: addr, Username: "u", Password: "p", Prompt: "R1#", Timeout: 2 * time.Second}
+		_, err := c.login(context.Background())
+		if Category(err) != models.FailureAuth {
+			t.Errorf("answer %q: got %v (%s), want an auth failure", answer, err, Category(err))
+		}
+	}
+}
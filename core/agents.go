@@ -0,0 +1,338 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// Agent timings. An agent sends a heartbeat every AgentHeartbeatInterval and
+// is considered gone after AgentTimeout without contact; its jobs then go to
+// another agent of the site. A job fails when no agent of its site has been
+// connected for AgentTimeout.
+const (
+	AgentHeartbeatInterval = 10 * time.Second
+	AgentTimeout           = 30 * time.Second
+)
+
+// Agent errors.
+var (
+	ErrInvalidAgent    = errors.New("an agent needs a name and at least one site")
+	ErrUnknownAgent    = errors.New("unknown agent; register first")
+	ErrUnknownAgentJob = errors.New("the job was cancelled or given to another agent")
+)
+
+// agentHub hands the backup jobs of devices at agent sites to the agents.
+type agentHub struct {
+	mu      sync.Mutex
+	agents  map[string]*agentState
+	sites   map[string]bool // every site an agent has registered
+	jobs    map[int64]*agentJob
+	nextID  int64
+	queued  chan struct{} // closed when a job is queued
+	monitor sync.Once
+}
+
+type agentState struct {
+	name        string
+	sites       []string
+	healthy     bool
+	connectedAt time.Time
+	lastSeen    time.Time
+	cancel      []int64 // jobs the agent should stop, sent with the next heartbeat
+}
+
+type agentJob struct {
+	id       int64
+	dev      models.Device
+	commands []string
+	agent    string // empty while the job waits for an agent
+	queuedAt time.Time
+	leased   func(agent string)
+	done     chan models.AgentResult
+}
+
+func newAgentHub() *agentHub {
+	return &agentHub{
+		agents: make(map[string]*agentState),
+		sites:  make(map[string]bool),
+		jobs:   make(map[int64]*agentJob),
+		queued: make(chan struct{}),
+	}
+}
+
+// RegisterAgent connects an agent serving the given sites. An agent that
+// registers again, e.g. after a restart, gives up the jobs it had.
+func (s *BackupService) RegisterAgent(name string, sites []string) (models.Agent, error) {
+	if name == "" || len(sites) == 0 {
+		return models.Agent{}, ErrInvalidAgent
+	}
+	h := s.agents
+	h.monitor.Do(func() { go h.watch() })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.agents[name]; ok {
+		h.requeue(name)
+	}
+	now := time.Now()
+	a := &agentState{name: name, sites: sites, healthy: true, connectedAt: now, lastSeen: now}
+	h.agents[name] = a
+	for _, site := range sites {
+		h.sites[site] = true
+	}
+	utils.Log.WithFields(map[string]interface{}{"agent": name, "sites": sites}).Info("Agent registered")
+	return h.describe(a), nil
+}
+
+// AgentHeartbeat records that an agent is alive and returns the jobs it should stop.
+func (s *BackupService) AgentHeartbeat(name string) (models.AgentHeartbeat, error) {
+	h := s.agents
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, err := h.touch(name)
+	if err != nil {
+		return models.AgentHeartbeat{}, err
+	}
+	beat := models.AgentHeartbeat{Cancel: a.cancel}
+	if beat.Cancel == nil {
+		beat.Cancel = []int64{}
+	}
+	a.cancel = nil
+	return beat, nil
+}
+
+// NextAgentJob hands an agent the oldest waiting job of its sites. It waits
+// for one until ctx is done and then returns nil.
+func (s *BackupService) NextAgentJob(ctx context.Context, name string) (*models.AgentJob, error) {
+	h := s.agents
+	for {
+		h.mu.Lock()
+		a, err := h.touch(name)
+		if err != nil {
+			h.mu.Unlock()
+			return nil, err
+		}
+		if job := h.waitingFor(a); job != nil {
+			job.agent = name
+			h.mu.Unlock()
+			job.leased(name)
+			return &models.AgentJob{ID: job.id, Device: job.dev, Commands: job.commands}, nil
+		}
+		queued := h.queued
+		h.mu.Unlock()
+
+		select {
+		case <-queued:
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// CompleteAgentJob records the result of a job an agent ran.
+func (s *BackupService) CompleteAgentJob(name string, id int64, result models.AgentResult) error {
+	h := s.agents
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.touch(name); err != nil {
+		return err
+	}
+	job, ok := h.jobs[id]
+	if !ok || job.agent != name {
+		return ErrUnknownAgentJob
+	}
+	delete(h.jobs, id)
+	job.done <- result
+	return nil
+}
+
+// Agents lists the agents that registered since the server started.
+func (s *BackupService) Agents() []models.Agent {
+	h := s.agents
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	agents := make([]models.Agent, 0, len(h.agents))
+	for _, a := range h.agents {
+		agents = append(agents, h.describe(a))
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// remote reports whether a device is backed up by an agent, because it is
+// tagged with a site an agent registered.
+func (h *agentHub) remote(dev models.Device) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, tag := range dev.Tags {
+		if h.sites[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// run queues a job for the agents of a device's sites and waits for its
+// result. leased is called when an agent takes the job.
+func (h *agentHub) run(ctx context.Context, dev models.Device, cmds []string, leased func(agent string)) ([]models.Result, error) {
+	h.mu.Lock()
+	h.nextID++
+	job := &agentJob{
+		id:       h.nextID,
+		dev:      dev,
+		commands: cmds,
+		queuedAt: time.Now(),
+		leased:   leased,
+		done:     make(chan models.AgentResult, 1),
+	}
+	h.jobs[job.id] = job
+	h.wake()
+	h.mu.Unlock()
+
+	select {
+	case result := <-job.done:
+		if result.Error == "" {
+			return result.Results, nil
+		}
+		category := result.Category
+		if category == "" {
+			category = models.FailureCommand
+		}
+		return nil, &connectors.Error{Category: category, Err: errors.New(result.Error)}
+	case <-ctx.Done():
+		h.mu.Lock()
+		if _, ok := h.jobs[job.id]; ok {
+			delete(h.jobs, job.id)
+			if a, ok := h.agents[job.agent]; ok {
+				a.cancel = append(a.cancel, job.id)
+			}
+		}
+		h.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// watch checks the agents' heartbeats. The jobs of an agent that went quiet
+// go back to the queue for another agent of the site, and jobs no agent can
+// take fail.
+func (h *agentHub) watch() {
+	ticker := time.NewTicker(AgentTimeout / 3)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		h.check(now)
+	}
+}
+
+// check marks the agents that were silent for AgentTimeout at now as gone and
+// fails the jobs that waited that long while no agent serves their device.
+func (h *agentHub) check(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, a := range h.agents {
+		if a.healthy && now.Sub(a.lastSeen) > AgentTimeout {
+			a.healthy = false
+			utils.Log.WithField("agent", a.name).Warn("Agent stopped responding, reassigning its jobs")
+			h.requeue(a.name)
+		}
+	}
+	for id, job := range h.jobs {
+		if job.agent != "" || now.Sub(job.queuedAt) <= AgentTimeout || h.served(job.dev) {
+			continue
+		}
+		delete(h.jobs, id)
+		job.done <- models.AgentResult{
+			Error:    "no agent of the device's site is connected",
+			Category: models.FailureNoAgent,
+		}
+	}
+}
+
+// requeue puts the jobs of an agent back in the queue. The caller holds h.mu.
+func (h *agentHub) requeue(name string) {
+	a := h.agents[name]
+	for _, job := range h.jobs {
+		if job.agent == name {
+			job.agent = ""
+			job.queuedAt = time.Now()
+			a.cancel = append(a.cancel, job.id)
+		}
+	}
+	h.wake()
+}
+
+// wake tells the agents waiting for jobs to look again. The caller holds h.mu.
+func (h *agentHub) wake() {
+	close(h.queued)
+	h.queued = make(chan struct{})
+}
+
+// touch records contact with an agent. The caller holds h.mu.
+func (h *agentHub) touch(name string) (*agentState, error) {
+	a, ok := h.agents[name]
+	if !ok {
+		return nil, ErrUnknownAgent
+	}
+	if !a.healthy {
+		utils.Log.WithField("agent", name).Info("Agent is responding again")
+	}
+	a.healthy = true
+	a.lastSeen = time.Now()
+	return a, nil
+}
+
+// waitingFor returns the oldest waiting job an agent can take. The caller holds h.mu.
+func (h *agentHub) waitingFor(a *agentState) *agentJob {
+	var oldest *agentJob
+	for _, job := range h.jobs {
+		if job.agent == "" && serves(a, job.dev) && (oldest == nil || job.id < oldest.id) {
+			oldest = job
+		}
+	}
+	return oldest
+}
+
+// served reports whether a healthy agent serves a device. The caller holds h.mu.
+func (h *agentHub) served(dev models.Device) bool {
+	for _, a := range h.agents {
+		if a.healthy && serves(a, dev) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the public view of an agent. The caller holds h.mu.
+func (h *agentHub) describe(a *agentState) models.Agent {
+	agent := models.Agent{
+		Name:        a.name,
+		Sites:       a.sites,
+		Healthy:     a.healthy,
+		Jobs:        []string{},
+		ConnectedAt: a.connectedAt,
+		LastSeen:    a.lastSeen,
+	}
+	for _, job := range h.jobs {
+		if job.agent == a.name {
+			agent.Jobs = append(agent.Jobs, job.dev.Host)
+		}
+	}
+	sort.Strings(agent.Jobs)
+	return agent
+}
+
+// serves reports whether a device is tagged with one of an agent's sites.
+func serves(a *agentState, dev models.Device) bool {
+	for _, site := range a.sites {
+		if dev.HasTag(site) {
+			return true
+		}
+	}
+	return false
+}
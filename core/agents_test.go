@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// agentRun is the outcome of a job queued with agentHub.run.
+type agentRun struct {
+	results []models.Result
+	err     error
+}
+
+// queueAgentJob queues a backup of dev for the agents and returns where its
+// outcome and the names of the agents that leased it arrive.
+func queueAgentJob(s *BackupService, dev models.Device) (<-chan agentRun, <-chan string) {
+	done := make(chan agentRun, 1)
+	leases := make(chan string, 4)
+	go func() {
+		results, err := s.agents.run(context.Background(), dev, []string{"show running-config"}, func(agent string) { leases <- agent })
+		done <- agentRun{results, err}
+	}()
+	return done, leases
+}
+
+// nextJob waits for the next job of an agent, failing the test after a second.
+func nextJob(t *testing.T, s *BackupService, agent string) *models.AgentJob {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := s.NextAgentJob(ctx, agent)
+	if err != nil || job == nil {
+		t.Fatalf("agent %s got no job: %v", agent, err)
+	}
+	return job
+}
+
+// silence makes an agent look like it stopped sending heartbeats.
+func silence(s *BackupService, agent string) {
+	s.agents.mu.Lock()
+	s.agents.agents[agent].lastSeen = time.Now().Add(-AgentTimeout - time.Second)
+	s.agents.mu.Unlock()
+}
+
+func TestAgentHub(t *testing.T) {
+	s := NewBackupService(nil, "", 1)
+	s.agents.monitor.Do(func() {}) // the test runs the checks itself
+	for name, sites := range map[string][]string{"dc1-a": {"dc1"}, "dc1-b": {"dc1"}, "dc2-a": {"dc2", "dc2-oob"}} {
+		if _, err := s.RegisterAgent(name, sites); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.RegisterAgent("nosites", nil); !errors.Is(err, ErrInvalidAgent) {
+		t.Errorf("registering without sites: %v", err)
+	}
+	if _, err := s.AgentHeartbeat("unknown"); !errors.Is(err, ErrUnknownAgent) {
+		t.Errorf("heartbeat of an unknown agent: %v", err)
+	}
+
+	r1 := models.Device{Host: "r1", Tags: []string{"core", "dc1"}}
+	if !s.agents.remote(r1) || s.agents.remote(models.Device{Host: "r9", Tags: []string{"dc9"}}) {
+		t.Error("devices are not assigned to the sites agents registered")
+	}
+
+	// One agent of the site leases the job; the other one gets nothing.
+	done, leases := queueAgentJob(s, r1)
+	job := nextJob(t, s, "dc1-a")
+	if job.Device.Host != "r1" || len(job.Commands) != 1 {
+		t.Errorf("job %+v", job)
+	}
+	if agent := <-leases; agent != "dc1-a" {
+		t.Errorf("leased by %s", agent)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if other, _ := s.NextAgentJob(ctx, "dc1-b"); other != nil {
+		t.Errorf("a leased job was handed out again: %+v", other)
+	}
+	cancel()
+	for _, a := range s.Agents() {
+		if a.Name == "dc1-a" && (len(a.Jobs) != 1 || a.Jobs[0] != "r1") {
+			t.Errorf("agent dc1-a lists jobs %v", a.Jobs)
+		}
+	}
+
+	// The agent goes quiet: its job goes to the other agent of the site, and
+	// the first one is told to stop it when it comes back.
+	silence(s, "dc1-a")
+	s.agents.check(time.Now())
+	if again := nextJob(t, s, "dc1-b"); again.ID != job.ID {
+		t.Errorf("agent dc1-b got job %d, want the requeued job %d", again.ID, job.ID)
+	}
+	if agent := <-leases; agent != "dc1-b" {
+		t.Errorf("requeued job leased by %s", agent)
+	}
+	if err := s.CompleteAgentJob("dc1-a", job.ID, models.AgentResult{}); !errors.Is(err, ErrUnknownAgentJob) {
+		t.Errorf("late result of the silent agent: %v", err)
+	}
+	beat, err := s.AgentHeartbeat("dc1-a")
+	if err != nil || len(beat.Cancel) != 1 || beat.Cancel[0] != job.ID {
+		t.Errorf("heartbeat of the returning agent: %+v, %v", beat, err)
+	}
+	output := []models.Result{{Cmd: "show running-config", Output: "hostname r1"}}
+	if err := s.CompleteAgentJob("dc1-b", job.ID, models.AgentResult{Results: output}); err != nil {
+		t.Fatal(err)
+	}
+	if run := <-done; run.err != nil || len(run.results) != 1 || run.results[0].Output != "hostname r1" {
+		t.Errorf("job outcome %+v", run)
+	}
+
+	// A failure reported by an agent keeps its category.
+	done, _ = queueAgentJob(s, models.Device{Host: "r2", Tags: []string{"dc2-oob"}})
+	job = nextJob(t, s, "dc2-a")
+	s.CompleteAgentJob("dc2-a", job.ID, models.AgentResult{Error: "authentication failed", Category: models.FailureAuth})
+	if run := <-done; connectors.Category(run.err) != models.FailureAuth {
+		t.Errorf("agent failure: %v (%s)", run.err, connectors.Category(run.err))
+	}
+
+	// The only agent of dc2 goes away: the job waits for AgentTimeout in case
+	// it comes back, then fails.
+	silence(s, "dc2-a")
+	done, _ = queueAgentJob(s, models.Device{Host: "r3", Tags: []string{"dc2"}})
+	for queued := false; !queued; {
+		s.agents.mu.Lock()
+		queued = len(s.agents.jobs) == 1
+		s.agents.mu.Unlock()
+	}
+	s.agents.check(time.Now())
+	select {
+	case run := <-done:
+		t.Fatalf("job failed before AgentTimeout: %v", run.err)
+	default:
+	}
+	s.agents.check(time.Now().Add(AgentTimeout + time.Second))
+	select {
+	case run := <-done:
+		if connectors.Category(run.err) != models.FailureNoAgent {
+			t.Errorf("job without agent: %v (%s)", run.err, connectors.Category(run.err))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the job of a site without agents did not fail")
+	}
+}
@@ -2,25 +2,51 @@
 package core
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"errors"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cobrich/netcfg-backup/compliance"
 	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/facts"
 	"github.com/cobrich/netcfg-backup/models"
 	"github.com/cobrich/netcfg-backup/monitoring"
+	"github.com/cobrich/netcfg-backup/notify"
+	"github.com/cobrich/netcfg-backup/parser"
 	"github.com/cobrich/netcfg-backup/storage"
 	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/sirupsen/logrus"
 )
 
 const defaultTimeout = 10 * time.Second
 
 // BackupService orchestrates the backup process.
 type BackupService struct {
-	store      storage.Store
-	basePath   string
-	numWorkers int
+	store        storage.Store
+	basePath     string
+	numWorkers   int
+	collectFacts bool
+	compliance   *compliance.Engine
+	pushes       *pushState
+	running      atomic.Bool
+	activeMu     sync.Mutex
+	active       *activeRun
+	next         *queuedRun
+	watchers     map[int64][]runWatcher
+	requestMu    sync.Mutex // serializes backup requests with the same idempotency key
+	progress     *progressHub
+	callbackKey  []byte
+	notifier     *notify.Dispatcher
+	failMu       sync.Mutex
+	failures     map[string]int // consecutive failed backups by host
+	retry        retryPolicy
+	limits       *limiter
+	agents       *agentHub
+	exports      *exportReceiver
+	owner        string // leases the jobs of this process in the job queue
 }
 
 // NewBackupService creates a new backup service.
@@ -29,124 +55,276 @@ func NewBackupService(store storage.Store, basePath string, numWorkers int) *Bac
 		store:      store,
 		basePath:   basePath,
 		numWorkers: numWorkers,
+		pushes: &pushState{
+			results: make(map[int64]*PushResult),
+			pending: make(map[int64]*pendingPush),
+		},
+		watchers: make(map[int64][]runWatcher),
+		progress: newProgressHub(),
+		retry:    defaultRetryPolicy,
+		limits:   newLimiter(LimitsConfig{}),
+		agents:   newAgentHub(),
+		owner:    newQueueOwner(),
 	}
 }
 
+// SetCollectFacts enables running the platform fact commands alongside the backup commands.
+func (s *BackupService) SetCollectFacts(enabled bool) {
+	s.collectFacts = enabled
+}
+
 // Run executes the backup process for all devices.
-// It runs in the foreground and returns when all jobs are complete.
-func (s *BackupService) Run() error {
+// It runs in the foreground and returns when all jobs are complete or, after
+// ctx is cancelled, as soon as the running jobs have disconnected.
+func (s *BackupService) Run(ctx context.Context) error {
 	utils.Log.Info("Starting backup run...")
 
-	devices, err := s.store.GetAllDevices()
-	if err != nil {
-		return fmt.Errorf("failed to get devices: %w", err)
-	}
-
-	if len(devices) == 0 {
+	_, err := s.RunSelected(ctx, models.DeviceSelector{}, TriggerCLI)
+	if errors.Is(err, ErrNoDevices) {
 		utils.Log.Warn("Device list is empty. Nothing to do.")
 		return nil
 	}
-	utils.Log.Infof("Loaded %d devices from configuration", len(devices))
+	return err
+}
 
-	jobs := make(chan models.Device, len(devices))
+// runPool hands the devices to numWorkers workers, highest priority first,
+// and returns when all are handled. A device waits while one of its groups
+// is at its concurrency limit, and the workers go on with other devices.
+func (s *BackupService) runPool(devices []models.Device, handle func(workerID int, dev models.Device)) {
+	queue := s.limits.order(devices)
 	var wg sync.WaitGroup
 
 	utils.Log.Infof("Starting %d workers", s.numWorkers)
 	for w := 1; w <= s.numWorkers; w++ {
 		wg.Add(1)
-		// Мы передаем s.basePath в воркера
-		go s.worker(&wg, w, jobs)
-	}
-
-	for _, dev := range devices {
-		jobs <- dev
+		go func(id int) {
+			defer wg.Done()
+			for {
+				dev, ok := s.limits.take(&queue)
+				if !ok {
+					return
+				}
+				handle(id, dev)
+				s.limits.done(dev)
+			}
+		}(w)
 	}
-	close(jobs)
 
 	wg.Wait()
-	utils.Log.Info("All backup tasks completed.")
-	return nil
 }
 
-// worker function is now a method of BackupService
-func (s *BackupService) worker(wg *sync.WaitGroup, id int, jobs <-chan models.Device) {
-	defer wg.Done()
+// backupJob backs up one device, records the job metrics and returns the
+// result. Transient failures are retried according to the retry policy. A job
+// whose context is cancelled before or while it runs is recorded as cancelled.
+func (s *BackupService) backupJob(ctx context.Context, id int, dev models.Device) models.RunResult {
+	// Set starting time
+	startTime := time.Now()
 
-	for dev := range jobs {
-		// Set starting time
-		startTime := time.Now()
+	entry := utils.Log.WithFields(map[string]interface{}{
+		"worker_id": id,
+		"host":      dev.Host,
+		"protocol":  dev.Protocol,
+	})
+	entry.Info("Worker picked up the task")
 
-		entry := utils.Log.WithFields(map[string]interface{}{
-			"worker_id": id,
-			"host":      dev.Host,
-			"protocol":  dev.Protocol,
+	status := models.RunResultSuccess
+	previous, _ := utils.LatestBackupFile(s.basePath, dev.Host)
+	var backupFile string
+	attempts := 0
+	finalErr := ctx.Err()
+	for finalErr == nil {
+		attempts++
+		backupFile, _, finalErr = s.backupDevice(ctx, dev, entry, s.reportProgress)
+		if finalErr == nil || ctx.Err() != nil || !s.retry.shouldRetry(attempts, finalErr) {
+			break
+		}
+		delay := s.retry.delay(attempts)
+		entry.WithFields(map[string]interface{}{
+			"attempt":  attempts,
+			"category": connectors.Category(finalErr),
+			"delay":    delay.Round(time.Millisecond).String(),
+		}).Warn("Backup failed, retrying")
+		s.reportProgress(models.ProgressEvent{
+			Type:    models.ProgressRetrying,
+			Host:    dev.Host,
+			Error:   finalErr.Error(),
+			Attempt: attempts + 1,
 		})
-		entry.Info("Worker picked up the task")
+		if !sleep(ctx, delay) {
+			break
+		}
+		finalErr = nil
+	}
 
-		status := "success"
-		var finalErr error
+	duration := time.Since(startTime).Seconds()
+	result := models.RunResult{
+		Host:            dev.Host,
+		BackupFile:      backupFile,
+		DurationSeconds: duration,
+		FinishedAt:      time.Now(),
+		Attempts:        attempts,
+	}
+	switch {
+	case finalErr != nil && ctx.Err() != nil:
+		status = models.RunResultCancelled
+		result.Error = "cancelled"
+	case finalErr != nil:
+		status = models.RunResultFailed
+		result.Error = finalErr.Error()
+		result.Category = connectors.Category(finalErr)
+	}
+	result.Status = status
 
-		func() {
-			if dev.PasswordEnv != "" {
-				dev.Password = os.Getenv(dev.PasswordEnv)
-				if dev.Password == "" {
-					entry.Warnf("Environment variable '%s' is not set or empty", dev.PasswordEnv)
-				}
-			}
+	monitoring.JobsTotal.WithLabelValues(dev.Host, status, result.Category).Inc()
+	monitoring.JobDuration.WithLabelValues(dev.Host).Observe(duration)
 
-			timeout := defaultTimeout
-			if dev.TimeoutSeconds > 0 {
-				timeout = time.Duration(dev.TimeoutSeconds) * time.Second
-			}
+	event := models.ProgressEvent{Type: models.ProgressSaved, Host: dev.Host, BackupFile: filepath.Base(backupFile)}
+	switch {
+	case status == models.RunResultCancelled:
+		event.Type = models.ProgressCancelled
+		event.BackupFile = ""
+	case finalErr != nil:
+		event.Type = models.ProgressFailed
+		event.Error = result.Error
+		event.BackupFile = ""
+	case previous != "" && previous != backupFile && sameBackup(previous, backupFile):
+		event.Type = models.ProgressUnchanged
+	}
+	s.reportProgress(event)
+	s.notifyJob(dev, result, previous)
 
-			var connector connectors.Connector
-			switch dev.Protocol {
-			case "ssh":
-				connector = &connectors.SSHConnector{
-					Host:               dev.Host,
-					Username:           dev.Username,
-					Password:           dev.Password,
-					KeyPath:            dev.KeyPath,
-					Timeout:            timeout,
-					AllowInsecureAlgos: dev.AllowInsecureAlgos,
-				}
-			case "telnet":
-				connector = &connectors.TelnetConnector{
-					Host:     dev.Host,
-					Username: dev.Username,
-					Password: dev.Password,
-					Prompt:   dev.Prompt,
-					Timeout:  timeout,
-				}
-			default:
-				finalErr = fmt.Errorf("unknown protocol: %s", dev.Protocol)
-				entry.Error("Unknown protocol")
-				return
-			}
+	entry.Infof("Job finished with status '%s' in %.2f seconds", status, duration)
+	return result
+}
 
-			results, err := connector.RunCommands(dev.Commands)
-			if err != nil {
-				finalErr = err
-				entry.WithField("error", finalErr).Error("Error executing commands")
-				return
-			}
+// sameBackup reports whether two backup files hold the same command output.
+func sameBackup(a, b string) bool {
+	resultsA, err := utils.ReadBackupFile(a)
+	if err != nil {
+		return false
+	}
+	resultsB, err := utils.ReadBackupFile(b)
+	if err != nil || len(resultsA) != len(resultsB) {
+		return false
+	}
+	for i := range resultsA {
+		if resultsA[i].Cmd != resultsB[i].Cmd || resultsA[i].Output != resultsB[i].Output {
+			return false
+		}
+	}
+	return true
+}
 
-			if err := utils.WriteResultsToFile(s.basePath, dev, results); err != nil {
-				finalErr = err
-				entry.WithField("error", finalErr).Error("Error saving results")
-			} else {
-				entry.Info("Results saved successfully")
-			}
-		}()
+// backupDevice connects to a device, or has an agent of its site connect to
+// it, runs its commands and saves the results. It returns the backup file and
+// the saved results. When report is set, it receives the connecting and
+// command progress events of the device.
+func (s *BackupService) backupDevice(ctx context.Context, dev models.Device, entry *logrus.Entry, report func(models.ProgressEvent)) (string, []models.Result, error) {
+	if err := s.limits.wait(ctx, dev); err != nil {
+		return "", nil, err
+	}
+
+	cmds := dev.Commands
+	// Facts are parsed from CLI output.
+	if s.collectFacts && connectors.CLI(dev.Protocol) {
+		cmds = append(append([]string{}, dev.Commands...), facts.Commands(dev.Platform)...)
+	}
+
+	cmds, exports, err := s.prepareExports(cmds)
+	if err != nil {
+		entry.WithField("error", err).Error("Error preparing export commands")
+		return "", nil, err
+	}
+	if exports != nil {
+		defer s.forgetExports(exports)
+	}
 
-		duration := time.Since(startTime).Seconds()
-		if finalErr != nil {
-			status = "failed"
+	var results []models.Result
+	if s.agents.remote(dev) {
+		entry.Info("Waiting for an agent of the device's site")
+		results, err = s.agents.run(ctx, dev, cmds, func(agent string) {
+			entry.WithField("agent", agent).Info("Agent picked up the task")
+			if report != nil {
+				report(models.ProgressEvent{Type: models.ProgressConnecting, Host: dev.Host})
+			}
+		})
+	} else {
+		var onCommand func(string)
+		if report != nil {
+			report(models.ProgressEvent{Type: models.ProgressConnecting, Host: dev.Host})
+			onCommand = func(cmd string) {
+				report(models.ProgressEvent{Type: models.ProgressCommand, Host: dev.Host, Command: cmd})
+			}
 		}
+		results, err = RunDeviceCommands(ctx, dev, cmds, entry, onCommand)
+	}
+	if err != nil {
+		entry.WithField("error", err).Error("Error executing commands")
+		return "", nil, err
+	}
+	if err := s.awaitExports(ctx, exports, results, entry); err != nil {
+		entry.WithField("error", err).Error("Error receiving exported files")
+		return "", nil, err
+	}
+
+	// Fact command output is parsed, not written to the backup file.
+	if s.collectFacts && len(results) > len(dev.Commands) {
+		s.saveFacts(facts.Parse(dev.Host, dev.Platform, results[len(dev.Commands):]))
+		results = results[:len(dev.Commands)]
+	}
 
-		monitoring.JobsTotal.WithLabelValues(dev.Host, status).Inc()
-		monitoring.JobDuration.WithLabelValues(dev.Host).Observe(duration)
+	backupFile, err := utils.WriteResultsToFile(s.basePath, dev, results)
+	if err != nil {
+		entry.WithField("error", err).Error("Error saving results")
+		return "", nil, err
+	}
+	entry.Info("Results saved successfully")
 
-		entry.Infof("Job finished with status '%s' in %.2f seconds", status, duration)
+	if err := utils.WriteFetchedFiles(backupFile, results); err != nil {
+		entry.WithField("error", err).Error("Error saving fetched files")
+		return "", nil, err
 	}
-}
\ No newline at end of file
+
+	// Structured records are a by-product; failing to write them does not fail the job.
+	doc := parser.NewDocument(dev, backupFile, results)
+	if err := parser.WriteDocument(backupFile, doc); err != nil {
+		entry.WithField("error", err).Warn("Error saving parsed records")
+	}
+
+	if s.compliance != nil {
+		s.recordCompliance(dev, results)
+	}
+	return backupFile, results, nil
+}
+
+// RunDeviceCommands connects to a device and runs commands on it, reading the
+// password from the device's password_env if it has one. onCommand, when set,
+// is called before each command. Agents run their jobs with it.
+func RunDeviceCommands(ctx context.Context, dev models.Device, cmds []string, entry *logrus.Entry, onCommand func(cmd string)) ([]models.Result, error) {
+	resolvePassword(&dev, entry)
+
+	connector, err := connectors.New(dev, deviceTimeout(dev))
+	if err != nil {
+		entry.Error("Unknown protocol")
+		return nil, err
+	}
+	if onCommand != nil {
+		if notifier, ok := connector.(connectors.CommandNotifier); ok {
+			notifier.OnCommand(onCommand)
+		}
+	}
+	return connector.RunCommands(ctx, cmds)
+}
+
+// deviceTimeout returns the connection timeout of a device.
+func deviceTimeout(dev models.Device) time.Duration {
+	if dev.TimeoutSeconds > 0 {
+		return time.Duration(dev.TimeoutSeconds) * time.Second
+	}
+	return defaultTimeout
+}
+
+// BasePath returns the directory where backups are stored.
+func (s *BackupService) BasePath() string {
+	return s.basePath
+}
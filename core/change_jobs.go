@@ -0,0 +1,257 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cobrich/netcfg-backup/golden"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// ChangePreview is the dry run of a change job on one device.
+type ChangePreview struct {
+	Host    string
+	Lines   []string
+	Preview *PushPreview
+	Error   string
+}
+
+// SelectDevices returns the active devices matched by a selector, sorted by host.
+func (s *BackupService) SelectDevices(sel models.DeviceSelector) ([]models.Device, error) {
+	all, err := s.store.GetAllDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+	var devices []models.Device
+	for _, dev := range all {
+		if !dev.IsPending() && sel.Matches(dev) {
+			devices = append(devices, dev)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Host < devices[j].Host })
+	return devices, nil
+}
+
+// PreviewChangeJob renders the job for every selected device and compares the
+// result with the device's latest backup, without connecting to any device.
+func (s *BackupService) PreviewChangeJob(job *models.ChangeJob) ([]ChangePreview, error) {
+	devices, err := s.SelectDevices(job.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := make([]ChangePreview, 0, len(devices))
+	for _, dev := range devices {
+		p := ChangePreview{Host: dev.Host}
+		lines, err := s.renderChange(job, dev)
+		if err == nil {
+			p.Lines = lines
+			p.Preview, err = s.PreviewPush(dev, PushOptions{Lines: lines, ConfirmTimeout: job.ConfirmTimeout})
+		}
+		if err != nil {
+			p.Error = err.Error()
+		}
+		previews = append(previews, p)
+	}
+	return previews, nil
+}
+
+// RunChangeJob starts a pending job. With canary devices, only those are
+// changed and the job then waits for ApproveChangeJob; otherwise all selected
+// devices are changed.
+func (s *BackupService) RunChangeJob(job *models.ChangeJob) error {
+	if job.Status != models.JobPending {
+		return fmt.Errorf("change job %d is %s, only pending jobs can be started", job.ID, job.Status)
+	}
+	devices, err := s.SelectDevices(job.Selector)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("the selector matches no devices")
+	}
+
+	if job.Canary > 0 && job.Canary < len(devices) {
+		return s.runChangeStage(job, models.StageCanary, devices[:job.Canary], models.JobAwaitingApproval)
+	}
+	return s.runChangeStage(job, models.StageRollout, devices, models.JobCompleted)
+}
+
+// ApproveChangeJob rolls a job out to the selected devices that were not part of the canary stage.
+func (s *BackupService) ApproveChangeJob(job *models.ChangeJob) error {
+	if job.Status != models.JobAwaitingApproval {
+		return fmt.Errorf("change job %d is %s, not awaiting approval", job.ID, job.Status)
+	}
+	jobStore, err := s.changeJobStore()
+	if err != nil {
+		return err
+	}
+
+	done, err := jobStore.GetChangeJobResults(job.ID)
+	if err != nil {
+		return err
+	}
+	handled := make(map[string]bool, len(done))
+	for _, r := range done {
+		handled[r.Host] = true
+	}
+
+	// The selector is evaluated again, so devices added since the canary stage are included.
+	devices, err := s.SelectDevices(job.Selector)
+	if err != nil {
+		return err
+	}
+	remaining := devices[:0]
+	for _, dev := range devices {
+		if !handled[dev.Host] {
+			remaining = append(remaining, dev)
+		}
+	}
+	return s.runChangeStage(job, models.StageRollout, remaining, models.JobCompleted)
+}
+
+// runChangeStage pushes the job to the devices through the worker pool. Once
+// more than MaxFailures devices of the job have failed, the remaining ones are
+// skipped and the job is aborted.
+func (s *BackupService) runChangeStage(job *models.ChangeJob, stage string, devices []models.Device, nextStatus string) error {
+	jobStore, err := s.changeJobStore()
+	if err != nil {
+		return err
+	}
+	previous, err := jobStore.GetChangeJobResults(job.ID)
+	if err != nil {
+		return err
+	}
+	var failures int32
+	for _, r := range previous {
+		if r.Status == models.ChangeFailed {
+			failures++
+		}
+	}
+
+	if err := s.setJobStatus(jobStore, job, models.JobRunning); err != nil {
+		return err
+	}
+	utils.Log.WithField("job_id", job.ID).Infof("Starting %s stage of change job '%s' on %d devices", stage, job.Name, len(devices))
+
+	s.runPool(devices, func(workerID int, dev models.Device) {
+		entry := utils.Log.WithFields(map[string]interface{}{"job_id": job.ID, "worker_id": workerID, "host": dev.Host})
+		result := models.ChangeJobResult{JobID: job.ID, Host: dev.Host, Stage: stage}
+
+		if atomic.LoadInt32(&failures) > int32(job.MaxFailures) {
+			result.Status = models.ChangeSkipped
+			result.Message = "failure threshold reached"
+		} else {
+			s.applyChange(job, dev, &result)
+			if result.Status == models.ChangeFailed {
+				atomic.AddInt32(&failures, 1)
+				entry.Errorf("Change failed: %s", result.Message)
+			} else {
+				entry.Infof("Change %s", result.Status)
+			}
+		}
+
+		if err := jobStore.SaveChangeJobResult(result); err != nil {
+			entry.Errorf("Failed to save change result: %v", err)
+		}
+	})
+
+	if failures > int32(job.MaxFailures) {
+		nextStatus = models.JobAborted
+	}
+	if err := s.setJobStatus(jobStore, job, nextStatus); err != nil {
+		return err
+	}
+	utils.Log.WithField("job_id", job.ID).Infof("Change job '%s' is %s (%d failures)", job.Name, nextStatus, failures)
+	if nextStatus == models.JobAborted {
+		return fmt.Errorf("change job %d aborted after %d failures", job.ID, failures)
+	}
+	return nil
+}
+
+// applyChange pushes the rendered job to one device and confirms it once the
+// post-change backup succeeded.
+func (s *BackupService) applyChange(job *models.ChangeJob, dev models.Device, result *models.ChangeJobResult) {
+	lines, err := s.renderChange(job, dev)
+	if err != nil {
+		result.Status = models.ChangeFailed
+		result.Message = err.Error()
+		return
+	}
+
+	pushed, err := s.Push(dev, PushOptions{
+		Lines:          lines,
+		ConfirmTimeout: job.ConfirmTimeout,
+		Force:          job.Force,
+		User:           job.User,
+		Source:         fmt.Sprintf("job:%d", job.ID),
+	})
+	if pushed != nil {
+		result.PushID = pushed.ID
+		result.PreBackup = pushed.PreBackup
+		result.PostBackup = pushed.PostBackup
+		result.Added = len(pushed.Diff.Missing)
+		result.Removed = len(pushed.Diff.Extra)
+	}
+	if errors.Is(err, ErrNoChanges) {
+		result.Status = models.ChangeUnchanged
+		return
+	}
+	if err == nil {
+		err = s.ConfirmPush(pushed.ID, job.User)
+	}
+	if err != nil {
+		result.Status = models.ChangeFailed
+		result.Message = err.Error()
+		return
+	}
+	result.Status = models.ChangeSuccess
+}
+
+// renderChange renders the job template with the device's variables into configuration lines.
+func (s *BackupService) renderChange(job *models.ChangeJob, dev models.Device) ([]string, error) {
+	var vars map[string]string
+	if varStore, ok := s.store.(storage.VariableStore); ok {
+		v, err := varStore.GetDeviceVars(dev.Host)
+		if err != nil {
+			return nil, err
+		}
+		vars = v
+	}
+
+	text, err := golden.RenderText(job.Template, dev, vars)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, strings.TrimRight(l, " \t\r"))
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("the template renders to no configuration lines")
+	}
+	return lines, nil
+}
+
+func (s *BackupService) setJobStatus(jobStore storage.ChangeJobStore, job *models.ChangeJob, status string) error {
+	if err := jobStore.UpdateChangeJobStatus(job.ID, status); err != nil {
+		return err
+	}
+	job.Status = status
+	return nil
+}
+
+func (s *BackupService) changeJobStore() (storage.ChangeJobStore, error) {
+	jobStore, ok := s.store.(storage.ChangeJobStore)
+	if !ok {
+		return nil, errors.New("change jobs are not supported by this store")
+	}
+	return jobStore, nil
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// countConnections accepts and closes connections, counting them.
+func countConnections(t *testing.T) (string, *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var count int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&count, 1)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), &count
+}
+
+// A device whose running configuration already has the rendered lines is
+// recorded as unchanged without a push. Its backups are taken by an agent,
+// so that any connection to the device is a push.
+func TestApplyChangeUnchanged(t *testing.T) {
+	s := NewBackupService(nil, t.TempDir(), 1)
+	s.agents.monitor.Do(func() {})
+	if _, err := s.RegisterAgent("lab-a", []string{"lab"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			job, err := s.NextAgentJob(ctx, "lab-a")
+			if err != nil || job == nil {
+				continue
+			}
+			output := "hostname r1\nntp server 10.0.0.1\ninterface Gi0/1\n description uplink"
+			s.CompleteAgentJob("lab-a", job.ID, models.AgentResult{Results: []models.Result{{Cmd: "show running-config", Output: output}}})
+		}
+	}()
+
+	addr, connections := countConnections(t)
+	dev := models.Device{Host: addr, Protocol: "telnet", Platform: models.PlatformCiscoIOS, Tags: []string{"lab"},
+		Commands: []string{"show running-config"}, TimeoutSeconds: 1}
+
+	job := &models.ChangeJob{ID: 1, User: "test", Template: "ntp server 10.0.0.1\ninterface Gi0/1\n description uplink", ConfirmTimeout: time.Minute}
+	result := models.ChangeJobResult{Host: dev.Host}
+	s.applyChange(job, dev, &result)
+	if result.Status != models.ChangeUnchanged || result.PushID != 0 {
+		t.Errorf("compliant device: %+v", result)
+	}
+	if n := atomic.LoadInt32(connections); n != 0 {
+		t.Errorf("the compliant device was connected to %d times", n)
+	}
+
+	// A missing line is pushed, which reaches the device.
+	job.Template = "ntp server 10.0.0.2"
+	result = models.ChangeJobResult{Host: dev.Host}
+	s.applyChange(job, dev, &result)
+	if result.Status != models.ChangeFailed || atomic.LoadInt32(connections) == 0 {
+		t.Errorf("non-compliant device: %+v after %d connections", result, atomic.LoadInt32(connections))
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/syslog"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// DefaultChangeDebounce is how long a device must stay quiet after reporting
+// a configuration change before it is backed up.
+const DefaultChangeDebounce = 30 * time.Second
+
+// resolveTimeout bounds the DNS lookups that map a syslog sender to a device.
+const resolveTimeout = 2 * time.Second
+
+// ChangeTrigger backs up a device shortly after it reports a configuration
+// change in a syslog message. Changes that follow each other within the
+// debounce interval lead to a single backup.
+type ChangeTrigger struct {
+	svc      *BackupService
+	debounce time.Duration
+	mu       sync.Mutex
+	pending  map[string]*pendingChange // by device host
+}
+
+// pendingChange is a device backup waiting for the debounce interval to pass.
+type pendingChange struct {
+	timer *time.Timer
+	users []string
+}
+
+// NewChangeTrigger creates a change trigger that backs up devices through svc.
+func NewChangeTrigger(svc *BackupService, debounce time.Duration) *ChangeTrigger {
+	return &ChangeTrigger{
+		svc:      svc,
+		debounce: debounce,
+		pending:  make(map[string]*pendingChange),
+	}
+}
+
+// HandleSyslog is a syslog.Handler. Configuration change messages from
+// inventory devices schedule a backup of the device; all other messages are ignored.
+func (t *ChangeTrigger) HandleSyslog(source net.IP, msg syslog.Message) {
+	// Most messages are not about changes; skip the inventory lookup for them.
+	if _, ok := syslog.MatchChange(models.PlatformGeneric, msg); !ok {
+		return
+	}
+
+	entry := utils.Log.WithFields(map[string]interface{}{"source": source.String(), "hostname": msg.Hostname})
+	dev, err := t.findDevice(source, msg.Hostname)
+	if err != nil {
+		entry.WithField("error", err).Warn("Ignoring configuration change of unknown device")
+		return
+	}
+	user, ok := syslog.MatchChange(dev.Platform, msg)
+	if !ok {
+		return
+	}
+
+	entry.WithFields(map[string]interface{}{"host": dev.Host, "user": user}).Info("Device reported a configuration change")
+	t.schedule(dev.Host, user)
+}
+
+// schedule (re)starts the debounce timer of a device and remembers the user.
+func (t *ChangeTrigger) schedule(host, user string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.pending[host]
+	if !ok {
+		p = &pendingChange{}
+		p.timer = time.AfterFunc(t.debounce, func() { t.fire(host) })
+		t.pending[host] = p
+	} else {
+		p.timer.Reset(t.debounce)
+	}
+	if user != "" && !containsString(p.users, user) {
+		p.users = append(p.users, user)
+	}
+}
+
+// fire starts the backup of a device whose debounce interval has passed. While
+// another run is in progress the backup is scheduled again. Changes reported
+// after this point schedule a new backup.
+func (t *ChangeTrigger) fire(host string) {
+	t.mu.Lock()
+	p, ok := t.pending[host]
+	delete(t.pending, host)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	changedBy := strings.Join(p.users, ", ")
+	entry := utils.Log.WithFields(map[string]interface{}{"host": host, "changed_by": changedBy})
+	run, err := t.svc.StartChangeRun(host, changedBy)
+	switch {
+	case errors.Is(err, ErrRunInProgress):
+		entry.Info("Backup run in progress; postponing change backup")
+		t.schedule(host, "")
+		for _, user := range p.users {
+			t.schedule(host, user)
+		}
+	case err != nil:
+		entry.WithField("error", err).Error("Failed to start change backup")
+	default:
+		entry.WithField("run_id", run.ID).Info("Started change backup")
+	}
+}
+
+// findDevice maps the sender of a message to an active inventory device, by
+// address first, then by the hostname in the message and finally by
+// resolving the device hosts that are names.
+func (t *ChangeTrigger) findDevice(source net.IP, hostname string) (*models.Device, error) {
+	devices, err := t.svc.SelectDevices(models.DeviceSelector{})
+	if err != nil {
+		return nil, err
+	}
+	for i, dev := range devices {
+		if ip := net.ParseIP(hostOnly(dev.Host)); ip != nil && ip.Equal(source) {
+			return &devices[i], nil
+		}
+	}
+	if hostname != "" {
+		for i, dev := range devices {
+			if strings.EqualFold(hostOnly(dev.Host), hostname) {
+				return &devices[i], nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	for i, dev := range devices {
+		name := hostOnly(dev.Host)
+		if net.ParseIP(name) != nil {
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(source) {
+				return &devices[i], nil
+			}
+		}
+	}
+	return nil, errors.New("no device with this address")
+}
+
+// hostOnly strips the port from a device host such as "10.0.0.1:2222".
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
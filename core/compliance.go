@@ -0,0 +1,61 @@
+package core
+
+import (
+	"github.com/cobrich/netcfg-backup/compliance"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/monitoring"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// SetCompliance enables evaluating the compliance policies after every backup.
+func (s *BackupService) SetCompliance(engine *compliance.Engine) {
+	s.compliance = engine
+}
+
+// CheckCompliance evaluates the latest backup of a device against the policies
+// and records the results.
+func (s *BackupService) CheckCompliance(engine *compliance.Engine, dev models.Device) ([]models.ComplianceResult, error) {
+	backupFile, err := utils.LatestBackupFile(s.basePath, dev.Host)
+	if err != nil {
+		return nil, err
+	}
+	results, err := utils.ReadBackupFile(backupFile)
+	if err != nil {
+		return nil, err
+	}
+
+	checked := engine.Check(dev, results)
+	s.saveCompliance(dev.Host, checked)
+	return checked, nil
+}
+
+// recordCompliance evaluates freshly collected results against the configured policies.
+func (s *BackupService) recordCompliance(dev models.Device, results []models.Result) {
+	checked := s.compliance.Check(dev, results)
+	s.saveCompliance(dev.Host, checked)
+	s.notifyCompliance(dev, checked)
+
+	violations := 0
+	for _, r := range checked {
+		if !r.Passed {
+			violations++
+		}
+	}
+	if violations > 0 {
+		utils.Log.WithField("host", dev.Host).Warnf("Compliance check found %d violations", violations)
+	}
+}
+
+// saveCompliance exports violation counts and stores the results when the store supports it.
+func (s *BackupService) saveCompliance(host string, checked []models.ComplianceResult) {
+	monitoring.SetComplianceViolations(host, compliance.CountViolations(checked))
+
+	complianceStore, ok := s.store.(storage.ComplianceStore)
+	if !ok {
+		return
+	}
+	if err := complianceStore.ReplaceComplianceResults(host, checked); err != nil {
+		utils.Log.WithField("host", host).Errorf("Failed to save compliance results: %v", err)
+	}
+}
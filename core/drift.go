@@ -0,0 +1,132 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/golden"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// DriftReport describes how the latest backup of a device differs from its golden config.
+type DriftReport struct {
+	Host      string          `json:"host"`
+	Role      string          `json:"role"`
+	Backup    string          `json:"backup"`
+	Intent    string          `json:"intent"`
+	Diff      configdiff.Diff `json:"diff"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// DetectDrift renders the golden config of a device and compares it with the
+// configuration in its latest backup.
+func (s *BackupService) DetectDrift(renderer *golden.Renderer, dev models.Device, opts configdiff.Options) (*DriftReport, error) {
+	var vars map[string]string
+	if varStore, ok := s.store.(storage.VariableStore); ok {
+		v, err := varStore.GetDeviceVars(dev.Host)
+		if err != nil {
+			return nil, err
+		}
+		vars = v
+	}
+
+	intent, err := renderer.Render(dev, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	backupFile, err := utils.LatestBackupFile(s.basePath, dev.Host)
+	if err != nil {
+		return nil, err
+	}
+	results, err := utils.ReadBackupFile(backupFile)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := RunningConfig(dev.Platform, results)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(backupFile), err)
+	}
+
+	report := &DriftReport{
+		Host:      dev.Host,
+		Role:      dev.Role,
+		Backup:    backupFile,
+		Intent:    intent,
+		Diff:      configdiff.Compare(intent, running, opts),
+		CheckedAt: time.Now(),
+	}
+	if !report.Diff.Empty() {
+		utils.Log.WithField("host", dev.Host).Warnf("Configuration drift: %d missing, %d extra lines",
+			len(report.Diff.Missing), len(report.Diff.Extra))
+	}
+	return report, nil
+}
+
+// ErrNoRunningConfig is returned by RunningConfig for backups without the
+// output of a command that shows the whole configuration.
+var ErrNoRunningConfig = errors.New("the backup has no running configuration")
+
+// runningConfigCommands are the commands that show the whole configuration, by
+// platform. A trailing "*" stands for any arguments, such as the URL of an export.
+var runningConfigCommands = map[string][]string{
+	models.PlatformCiscoIOS:  {"show running-config", "show running-config all", "more system:running-config", "copy running-config *"},
+	models.PlatformCiscoNXOS: {"show running-config", "show running-config all", "copy running-config *"},
+	models.PlatformAristaEOS: {"show running-config", "show running-config all", "copy running-config *"},
+	models.PlatformJunOS:     {"show configuration", "show configuration | display set"},
+	// Other vendors' CLIs, for devices without a platform.
+	models.PlatformGeneric: {"display current-configuration", "/export"},
+}
+
+// RunningConfig returns the output of the command that shows the running
+// configuration in backup results, or ErrNoRunningConfig if there is none.
+// Commands may be abbreviated word by word ("sh run"), and a device without
+// a known platform accepts the commands of every platform.
+func RunningConfig(platform string, results []models.Result) (string, error) {
+	commands := runningConfigCommands[platform]
+	if platform == "" || platform == models.PlatformGeneric || commands == nil {
+		commands = nil
+		for _, p := range models.Platforms {
+			commands = append(commands, runningConfigCommands[p]...)
+		}
+	}
+	for _, r := range results {
+		for _, c := range commands {
+			if configCommand(c, r.Cmd) {
+				return r.Output, nil
+			}
+		}
+	}
+	return "", ErrNoRunningConfig
+}
+
+// configCommand reports whether cmd is the command, possibly abbreviated word
+// by word. Only whole commands match: "show run" is "show running-config",
+// "show interfaces trunk" is not.
+func configCommand(command, cmd string) bool {
+	want := strings.Fields(strings.ToLower(command))
+	got := strings.Fields(strings.ToLower(cmd))
+	if n := len(want); n > 0 && want[n-1] == "*" {
+		want = want[:n-1]
+		if len(got) <= len(want) {
+			return false
+		}
+		got = got[:len(want)]
+	}
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], got[i]) {
+			return false
+		}
+	}
+	return true
+}
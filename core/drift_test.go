@@ -0,0 +1,43 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+func TestRunningConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		cmds     []string
+		want     string // output of the command that is the running config, "" for none
+	}{
+		{"trunk before running-config", models.PlatformCiscoIOS, []string{"show interfaces trunk", "show running-config"}, "show running-config"},
+		{"abbreviated", models.PlatformCiscoIOS, []string{"show version", "sh run"}, "sh run"},
+		{"show run all", models.PlatformCiscoNXOS, []string{"show run all"}, "show run all"},
+		{"export", models.PlatformCiscoIOS, []string{"show version", "copy running-config tftp://10.0.0.5/r1.cfg"}, "copy running-config tftp://10.0.0.5/r1.cfg"},
+		{"junos display set", models.PlatformJunOS, []string{"show version", "show configuration | display set"}, "show configuration | display set"},
+		{"generic accepts every platform", models.PlatformGeneric, []string{"show configuration"}, "show configuration"},
+		{"no platform", "", []string{"display current-configuration"}, "display current-configuration"},
+		{"only trunk", models.PlatformCiscoIOS, []string{"show interfaces trunk", "show version"}, ""},
+		{"partial config", models.PlatformCiscoIOS, []string{"show running-config interface Gi0/1"}, ""},
+		{"startup config", models.PlatformCiscoIOS, []string{"show startup-config"}, ""},
+		{"other platform's command", models.PlatformJunOS, []string{"show running-config"}, ""},
+		{"copy without destination", models.PlatformCiscoIOS, []string{"copy running-config"}, ""},
+	}
+	for _, tt := range tests {
+		var results []models.Result
+		for _, cmd := range tt.cmds {
+			results = append(results, models.Result{Cmd: cmd, Output: cmd})
+		}
+		got, err := RunningConfig(tt.platform, results)
+		switch {
+		case tt.want == "" && !errors.Is(err, ErrNoRunningConfig):
+			t.Errorf("%s: got %q, %v, want ErrNoRunningConfig", tt.name, got, err)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("%s: got %q, %v, want the output of %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/tftp"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultExportTimeout is how long a backup waits for the files that its
+// commands told the device to upload.
+const DefaultExportTimeout = 60 * time.Second
+
+// exportPath is the path recorded for uploaded files. It is the same on every
+// run so that backups of binary files only differ when their content does.
+const exportPath = "tftp:export.cfg"
+
+// exportReceiver hands out one-time file names on the TFTP server.
+type exportReceiver struct {
+	server  *tftp.Server
+	host    string // the address devices reach the server at
+	baseURL string // "tftp://host[:port]"
+	timeout time.Duration
+}
+
+// pendingExport is an upload that a command of a backup asked for.
+type pendingExport struct {
+	index int // of the command
+	cmd   string
+	name  string
+	done  <-chan []byte
+}
+
+// SetExportReceiver enables export commands: commands with a {url} or {file}
+// placeholder make the device push a file to the TFTP server, which devices
+// reach at host and port. Each backup waits up to timeout for its uploads.
+func (s *BackupService) SetExportReceiver(server *tftp.Server, host, port string, timeout time.Duration) {
+	baseURL := "tftp://" + host
+	if port != "69" {
+		baseURL = "tftp://" + net.JoinHostPort(host, port)
+	}
+	s.exports = &exportReceiver{server: server, host: host, baseURL: baseURL, timeout: timeout}
+}
+
+// isExport reports whether a command has the device push a file.
+func isExport(cmd string) bool {
+	return strings.Contains(cmd, "{url}") || strings.Contains(cmd, "{file}")
+}
+
+// prepareExports fills in the placeholders of the export commands with a new
+// one-time file name each: {url} with its TFTP URL, {host} with the address
+// of the TFTP server and {file} with the name. It returns the commands to run
+// and the uploads to wait for; call forgetExports when done with them.
+func (s *BackupService) prepareExports(cmds []string) ([]string, []pendingExport, error) {
+	var prepared []string
+	var pending []pendingExport
+	for i, cmd := range cmds {
+		if !isExport(cmd) {
+			continue
+		}
+		if s.exports == nil {
+			s.forgetExports(pending)
+			return nil, nil, fmt.Errorf("command '%s' needs the TFTP server, started with --tftp", cmd)
+		}
+		if prepared == nil {
+			prepared = append([]string{}, cmds...)
+		}
+
+		token := make([]byte, 12)
+		if _, err := rand.Read(token); err != nil {
+			s.forgetExports(pending)
+			return nil, nil, err
+		}
+		name := "netcfg-" + hex.EncodeToString(token) + ".cfg"
+		prepared[i] = strings.NewReplacer("{url}", s.exports.baseURL+"/"+name, "{host}", s.exports.host, "{file}", name).Replace(cmd)
+		pending = append(pending, pendingExport{index: i, cmd: cmd, name: name, done: s.exports.server.Expect(name)})
+	}
+	if prepared == nil {
+		return cmds, nil, nil
+	}
+	return prepared, pending, nil
+}
+
+// awaitExports waits for the uploads of the export commands and puts the
+// received files in place of the output of their commands. A missing upload
+// fails the backup.
+func (s *BackupService) awaitExports(ctx context.Context, pending []pendingExport, results []models.Result, entry *logrus.Entry) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	timer := time.NewTimer(s.exports.timeout)
+	defer timer.Stop()
+	for _, p := range pending {
+		if p.index >= len(results) {
+			continue
+		}
+		select {
+		case data := <-p.done:
+			entry.WithFields(map[string]interface{}{"command": p.cmd, "size": len(data)}).Info("Exported file received")
+			results[p.index] = connectors.FileResult(p.cmd, exportPath, data)
+		case <-timer.C:
+			return &connectors.Error{
+				Category: models.FailureUploadTimeout,
+				Err:      fmt.Errorf("the device did not upload the file of '%s' within %s", p.cmd, s.exports.timeout),
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// forgetExports stops expecting the uploads of export commands.
+func (s *BackupService) forgetExports(pending []pendingExport) {
+	for _, p := range pending {
+		s.exports.server.Forget(p.name)
+	}
+}
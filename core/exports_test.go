@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/tftp"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+var exportNamePattern = regexp.MustCompile(`netcfg-[0-9a-f]+\.cfg`)
+
+// startExportReceiver runs a TFTP server on a free local port, enables
+// export commands with it and returns its address.
+func startExportReceiver(t *testing.T, s *BackupService, timeout time.Duration) string {
+	t.Helper()
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.LocalAddr().String()
+	probe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	server := tftp.NewServer()
+	if err := server.ListenUDP(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	s.SetExportReceiver(server, host, port, timeout)
+	return addr
+}
+
+// pushFile plays a device running an export command: it uploads data, in
+// one block, to the TFTP server at addr under the file name in the command.
+func pushFile(addr, cmd string, data []byte) error {
+	name := exportNamePattern.FindString(cmd)
+	if name == "" {
+		return fmt.Errorf("no export file name in '%s'", cmd)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	wrq := binary.BigEndian.AppendUint16(nil, 2)
+	conn.WriteTo(append(wrq, name+"\x00octet\x00"...), server)
+	buf := make([]byte, 516)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, tid, err := conn.ReadFrom(buf)
+	if err != nil {
+		return err
+	}
+	if n < 4 || binary.BigEndian.Uint16(buf) != 4 {
+		return fmt.Errorf("upload refused: %q", buf[4:n])
+	}
+	block := binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, 3), 1)
+	conn.WriteTo(append(block, data...), tid)
+	if _, _, err := conn.ReadFrom(buf); err != nil {
+		return fmt.Errorf("no acknowledgment of the data: %w", err)
+	}
+	return nil
+}
+
+func TestExports(t *testing.T) {
+	s := NewBackupService(nil, "", 1)
+	entry := utils.Log.WithField("test", t.Name())
+	cmds := []string{"show version", "copy running-config {url}", "copy startup-config tftp://{host}/{file}"}
+
+	if _, _, err := s.prepareExports(cmds); err == nil {
+		t.Fatal("export commands were accepted without a TFTP server")
+	}
+	if prepared, pending, err := s.prepareExports(cmds[:1]); err != nil || len(pending) != 0 || prepared[0] != cmds[0] {
+		t.Errorf("commands without exports: %v, %v, %v", prepared, pending, err)
+	}
+
+	addr := startExportReceiver(t, s, time.Second)
+	prepared, pending, err := s.prepareExports(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.forgetExports(pending)
+	if len(pending) != 2 || prepared[0] != cmds[0] || strings.ContainsAny(prepared[1]+prepared[2], "{}") {
+		t.Fatalf("prepared %q with %d uploads", prepared, len(pending))
+	}
+	if !strings.HasPrefix(prepared[1], "copy running-config tftp://"+addr+"/netcfg-") || !strings.HasPrefix(prepared[2], "copy startup-config tftp://127.0.0.1/netcfg-") {
+		t.Errorf("placeholders filled in as %q", prepared)
+	}
+	if exportNamePattern.FindString(prepared[1]) == exportNamePattern.FindString(prepared[2]) {
+		t.Error("two exports got the same file name")
+	}
+
+	// The device answers the commands and pushes the files, the second one first.
+	results := []models.Result{{Cmd: cmds[0], Output: "Version 1"}, {Cmd: cmds[1]}, {Cmd: cmds[2]}}
+	for i, data := range map[int]string{2: "hostname r1 (startup)\n", 1: "hostname r1\n"} {
+		if err := pushFile(addr, prepared[i], []byte(data)); err != nil {
+			t.Fatalf("upload of '%s': %v", prepared[i], err)
+		}
+	}
+	if err := s.awaitExports(context.Background(), pending, results, entry); err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Output != "Version 1" || results[1].Output != "hostname r1" || results[2].Output != "hostname r1 (startup)" {
+		t.Errorf("results %+v", results)
+	}
+	if results[1].File == nil || results[1].File.Path != exportPath || results[1].Cmd != cmds[1] {
+		t.Errorf("export result %+v", results[1])
+	}
+
+	// Once forgotten, the one-time names are refused.
+	s.forgetExports(pending)
+	if err := pushFile(addr, prepared[1], []byte("late")); err == nil {
+		t.Error("a forgotten file was accepted")
+	}
+}
+
+func TestExportTimeout(t *testing.T) {
+	s := NewBackupService(nil, "", 1)
+	entry := utils.Log.WithField("test", t.Name())
+	startExportReceiver(t, s, 100*time.Millisecond)
+
+	cmds := []string{"copy running-config {url}"}
+	_, pending, err := s.prepareExports(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.forgetExports(pending)
+	err = s.awaitExports(context.Background(), pending, []models.Result{{Cmd: cmds[0]}}, entry)
+	if connectors.Category(err) != models.FailureUploadTimeout {
+		t.Errorf("got %v (%s), want %s", err, connectors.Category(err), models.FailureUploadTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, pending, _ = s.prepareExports(cmds)
+	defer s.forgetExports(pending)
+	if err := s.awaitExports(ctx, pending, []models.Result{{Cmd: cmds[0]}}, entry); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled backup: %v", err)
+	}
+}
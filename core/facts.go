@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/facts"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/monitoring"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// CollectFacts collects facts from the given devices without taking a backup.
+// It returns the facts that were collected and the errors of devices that failed, keyed by host.
+func (s *BackupService) CollectFacts(devices []models.Device) ([]models.DeviceFacts, map[string]error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.numWorkers)
+
+	var collected []models.DeviceFacts
+	failed := make(map[string]error)
+
+	for _, dev := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(dev models.Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			entry := utils.Log.WithField("host", dev.Host)
+
+			if dev.PasswordEnv != "" {
+				dev.Password = os.Getenv(dev.PasswordEnv)
+			}
+			f, err := func() (models.DeviceFacts, error) {
+				if !connectors.CLI(dev.Protocol) {
+					return models.DeviceFacts{}, fmt.Errorf("facts are collected over ssh or telnet, not %s", dev.Protocol)
+				}
+				connector, err := connectors.New(dev, deviceTimeout(dev))
+				if err != nil {
+					return models.DeviceFacts{}, err
+				}
+				return facts.Collect(context.Background(), connector, dev)
+			}()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				entry.WithField("error", err).Error("Failed to collect facts")
+				failed[dev.Host] = err
+				return
+			}
+			s.saveFacts(f)
+			collected = append(collected, f)
+		}(dev)
+	}
+	wg.Wait()
+
+	return collected, failed
+}
+
+// saveFacts exports facts as metrics and stores them when the store keeps facts history.
+func (s *BackupService) saveFacts(f models.DeviceFacts) {
+	monitoring.SetDeviceFacts(f)
+
+	factsStore, ok := s.store.(storage.FactsStore)
+	if !ok {
+		return
+	}
+	if err := factsStore.SaveFacts(f); err != nil {
+		utils.Log.WithField("host", f.Host).Errorf("Failed to save facts: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// InventoryCount is the number of devices sharing a model or OS version.
+type InventoryCount struct {
+	Vendor string
+	Name   string
+	Count  int
+}
+
+// InventoryReport summarises the hardware and software across the inventory.
+type InventoryReport struct {
+	Models     []InventoryCount
+	OSVersions []InventoryCount
+}
+
+// BuildInventoryReport counts devices per model and per OS version from their latest facts.
+func BuildInventoryReport(latest map[string]models.DeviceFacts) InventoryReport {
+	modelCounts := make(map[[2]string]int)
+	osCounts := make(map[[2]string]int)
+	for _, f := range latest {
+		modelCounts[[2]string{f.Vendor, f.Model}]++
+		osCounts[[2]string{f.Vendor, f.OSVersion}]++
+	}
+	return InventoryReport{
+		Models:     sortedCounts(modelCounts),
+		OSVersions: sortedCounts(osCounts),
+	}
+}
+
+// sortedCounts orders counts by vendor, then by descending count.
+func sortedCounts(counts map[[2]string]int) []InventoryCount {
+	var out []InventoryCount
+	for key, n := range counts {
+		out = append(out, InventoryCount{Vendor: key[0], Name: key[1], Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Vendor != out[j].Vendor {
+			return out[i].Vendor < out[j].Vendor
+		}
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
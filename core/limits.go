@@ -0,0 +1,272 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"go.yaml.in/yaml/v2"
+)
+
+// LimitsConfig is the concurrency configuration file. Devices are selected by
+// host patterns, tags, platforms and roles, as in backup runs.
+//
+//	workers: 20
+//	groups:                        # at most max_concurrent devices at a time
+//	  - name: site-almaty
+//	    tags: [site-almaty]
+//	    max_concurrent: 2
+//	aaa:                           # new connections per minute per AAA server
+//	  - name: tacacs-east
+//	    tags: [east]
+//	    connections_per_minute: 30
+//	priorities:                    # higher first; the first matching entry counts
+//	  - roles: [core]
+//	    priority: 100
+type LimitsConfig struct {
+	Workers    int          `yaml:"workers"`
+	Groups     []GroupLimit `yaml:"groups"`
+	AAA        []AAALimit   `yaml:"aaa"`
+	Priorities []Priority   `yaml:"priorities"`
+}
+
+// GroupLimit caps the number of devices of a group, such as a site behind a
+// slow WAN link, that are connected to at the same time.
+type GroupLimit struct {
+	Name                  string `yaml:"name"`
+	models.DeviceSelector `yaml:",inline"`
+	MaxConcurrent         int `yaml:"max_concurrent"`
+}
+
+// AAALimit caps the rate of new connections to the devices that authenticate
+// against one AAA server. Burst connections may be opened at once.
+type AAALimit struct {
+	Name                  string `yaml:"name"`
+	models.DeviceSelector `yaml:",inline"`
+	ConnectionsPerMinute  int `yaml:"connections_per_minute"`
+	Burst                 int `yaml:"burst"`
+}
+
+// Priority orders the devices of a run; devices without one have priority 0.
+type Priority struct {
+	models.DeviceSelector `yaml:",inline"`
+	Priority              int `yaml:"priority"`
+}
+
+// LoadLimits reads and validates a concurrency configuration file.
+func LoadLimits(file string) (LimitsConfig, error) {
+	var cfg LimitsConfig
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading limits config %s: %w", file, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing limits config %s: %w", file, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid limits config %s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+// SetWorkers sets the number of devices handled at the same time.
+func (s *BackupService) SetWorkers(n int) {
+	if n > 0 {
+		s.numWorkers = n
+	}
+}
+
+// SetLimits applies a concurrency configuration: its worker count, if set,
+// the group limits and AAA rate limits, and the device priorities.
+func (s *BackupService) SetLimits(cfg LimitsConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	s.SetWorkers(cfg.Workers)
+	s.limits = newLimiter(cfg)
+	return nil
+}
+
+func (cfg LimitsConfig) validate() error {
+	for i, g := range cfg.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("group %d has no name", i+1)
+		}
+		if g.MaxConcurrent <= 0 {
+			return fmt.Errorf("group %s: max_concurrent must be positive", g.Name)
+		}
+		if err := validatePlatforms(g.DeviceSelector); err != nil {
+			return fmt.Errorf("group %s: %w", g.Name, err)
+		}
+	}
+	for i, a := range cfg.AAA {
+		if a.Name == "" {
+			return fmt.Errorf("aaa server %d has no name", i+1)
+		}
+		if a.ConnectionsPerMinute <= 0 {
+			return fmt.Errorf("aaa server %s: connections_per_minute must be positive", a.Name)
+		}
+		if err := validatePlatforms(a.DeviceSelector); err != nil {
+			return fmt.Errorf("aaa server %s: %w", a.Name, err)
+		}
+	}
+	for i, p := range cfg.Priorities {
+		if err := validatePlatforms(p.DeviceSelector); err != nil {
+			return fmt.Errorf("priority %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validatePlatforms rejects platforms no device can have, since a selector
+// with a misspelled platform silently matches nothing.
+func validatePlatforms(sel models.DeviceSelector) error {
+	for _, p := range sel.Platforms {
+		if !models.ValidPlatform(p) {
+			return fmt.Errorf("unknown platform '%s' (%s)", p, strings.Join(models.Platforms, ", "))
+		}
+	}
+	return nil
+}
+
+// limiter schedules the devices of worker pools under the group limits and
+// paces connections under the AAA rate limits. Group slots are shared by all
+// pools, so a backup run and a change job together respect a site's limit.
+type limiter struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	groups     []GroupLimit
+	running    []int // devices connected per group
+	aaa        []AAALimit
+	buckets    []*tokenBucket
+	priorities []Priority
+}
+
+// newLimiter builds the limiter of a validated configuration.
+func newLimiter(cfg LimitsConfig) *limiter {
+	l := &limiter{groups: cfg.Groups, aaa: cfg.AAA, priorities: cfg.Priorities}
+	l.cond = sync.NewCond(&l.mu)
+	l.running = make([]int, len(cfg.Groups))
+	for _, a := range cfg.AAA {
+		burst := a.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		l.buckets = append(l.buckets, newTokenBucket(time.Minute/time.Duration(a.ConnectionsPerMinute), burst))
+	}
+	return l
+}
+
+// order sorts devices by priority, highest first, keeping the order of
+// devices with the same priority.
+func (l *limiter) order(devices []models.Device) []models.Device {
+	out := append([]models.Device(nil), devices...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return l.priority(out[i]) > l.priority(out[j])
+	})
+	return out
+}
+
+func (l *limiter) priority(dev models.Device) int {
+	for _, p := range l.priorities {
+		if p.Matches(dev) {
+			return p.Priority
+		}
+	}
+	return 0
+}
+
+// take removes the first device of the queue whose groups all have a free
+// slot and occupies the slots. It waits while the queue holds only devices
+// of full groups, and reports false once the queue is empty.
+func (l *limiter) take(queue *[]models.Device) (models.Device, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(*queue) > 0 {
+		for i, dev := range *queue {
+			if !l.fits(dev) {
+				continue
+			}
+			for g := range l.groups {
+				if l.groups[g].Matches(dev) {
+					l.running[g]++
+				}
+			}
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return dev, true
+		}
+		l.cond.Wait()
+	}
+	return models.Device{}, false
+}
+
+func (l *limiter) fits(dev models.Device) bool {
+	for g := range l.groups {
+		if l.groups[g].Matches(dev) && l.running[g] >= l.groups[g].MaxConcurrent {
+			return false
+		}
+	}
+	return true
+}
+
+// done frees the group slots of a device and wakes the waiting workers.
+func (l *limiter) done(dev models.Device) {
+	l.mu.Lock()
+	for g := range l.groups {
+		if l.groups[g].Matches(dev) {
+			l.running[g]--
+		}
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// wait blocks until the AAA server of a device allows a new connection, or
+// until ctx is cancelled.
+func (l *limiter) wait(ctx context.Context, dev models.Device) error {
+	for i, a := range l.aaa {
+		if !a.Matches(dev) {
+			continue
+		}
+		if d := l.buckets[i].reserve(); d > 0 && !sleep(ctx, d) {
+			return ctx.Err()
+		}
+		return nil
+	}
+	return nil
+}
+
+// tokenBucket hands out one token per interval and holds at most burst.
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(interval time.Duration, burst int) *tokenBucket {
+	return &tokenBucket{interval: interval, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait until it is valid.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLimitsExample(t *testing.T) {
+	cfg, err := LoadLimits("../limits.yaml.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Groups) == 0 || len(cfg.AAA) == 0 || len(cfg.Priorities) == 0 {
+		t.Errorf("example config is incomplete: %+v", cfg)
+	}
+}
+
+func TestLoadLimitsUnknownPlatform(t *testing.T) {
+	for _, config := range []string{
+		"groups:\n  - name: firewalls\n    platforms: [junos]\n    max_concurrent: 4\n",
+		"aaa:\n  - name: tacacs\n    platforms: [cisco_ios, ios]\n    connections_per_minute: 30\n",
+		"priorities:\n  - platforms: [eos]\n    priority: 10\n",
+	} {
+		file := filepath.Join(t.TempDir(), "limits.yaml")
+		if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadLimits(file); err == nil || !strings.Contains(err.Error(), "unknown platform") {
+			t.Errorf("%s: got %v, want an unknown platform error", config, err)
+		}
+	}
+}
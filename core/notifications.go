@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/notify"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// SetNotifications enables sending notifications about failed and recovered
+// devices, configuration changes and compliance violations.
+func (s *BackupService) SetNotifications(d *notify.Dispatcher) {
+	s.notifier = d
+	s.failures = make(map[string]int)
+}
+
+// notifyJob reports the outcome of a backup job: a device failing the
+// threshold number of times in a row, a failed device recovering, and a
+// running configuration that differs from the previous backup.
+func (s *BackupService) notifyJob(dev models.Device, result models.RunResult, previous string) {
+	if s.notifier == nil || result.Status == models.RunResultCancelled {
+		return
+	}
+	threshold := s.notifier.FailureThreshold()
+
+	s.failMu.Lock()
+	failures := s.failures[dev.Host]
+	if result.Status == models.RunResultFailed {
+		s.failures[dev.Host] = failures + 1
+	} else {
+		delete(s.failures, dev.Host)
+	}
+	s.failMu.Unlock()
+
+	switch {
+	case result.Status == models.RunResultFailed && failures+1 == threshold:
+		s.notifier.Dispatch(notify.Event{
+			Type:     notify.EventDeviceFailed,
+			Severity: models.SeverityHigh,
+			Host:     dev.Host,
+			Tags:     dev.Tags,
+			Title:    fmt.Sprintf("Backup of %s failed %d times in a row", dev.Host, threshold),
+			Message:  "Last error: " + result.Error,
+		})
+	case result.Status == models.RunResultSuccess && failures >= threshold:
+		s.notifier.Dispatch(notify.Event{
+			Type:     notify.EventDeviceRecovered,
+			Severity: models.SeverityLow,
+			Host:     dev.Host,
+			Tags:     dev.Tags,
+			Title:    fmt.Sprintf("Backup of %s recovered", dev.Host),
+			Message:  fmt.Sprintf("%s was backed up again after %d failed attempts.", dev.Host, failures),
+		})
+	}
+
+	if result.Status == models.RunResultSuccess && previous != "" && previous != result.BackupFile {
+		if diff := configChanges(dev.Platform, previous, result.BackupFile); len(diff) > 0 {
+			s.notifier.Dispatch(notify.Event{
+				Type:     notify.EventConfigChanged,
+				Severity: models.SeverityMedium,
+				Host:     dev.Host,
+				Tags:     dev.Tags,
+				Title:    fmt.Sprintf("Configuration of %s changed", dev.Host),
+				Message:  fmt.Sprintf("%d lines changed since the previous backup.", len(diff)),
+				Diff:     diff,
+			})
+		}
+	}
+}
+
+// configChanges compares the running configuration of two backups and
+// returns the changed lines as "+ line" and "- line".
+func configChanges(platform, previous, current string) []string {
+	before, err := utils.ReadBackupFile(previous)
+	if err != nil {
+		return nil
+	}
+	after, err := utils.ReadBackupFile(current)
+	if err != nil {
+		return nil
+	}
+
+	afterConfig, err := RunningConfig(platform, after)
+	if err != nil {
+		return nil
+	}
+	beforeConfig, err := RunningConfig(platform, before)
+	if err != nil {
+		return nil
+	}
+
+	// Comparing the new configuration as the intent reports new lines as missing.
+	d := configdiff.Compare(afterConfig, beforeConfig, configdiff.Options{Strict: true})
+	var lines []string
+	for _, c := range d.Missing {
+		lines = append(lines, "+ "+c.String())
+	}
+	for _, c := range d.Extra {
+		lines = append(lines, "- "+c.String())
+	}
+	return lines
+}
+
+// notifyCompliance reports the rules a device violates, with the severity of
+// the most severe one.
+func (s *BackupService) notifyCompliance(dev models.Device, checked []models.ComplianceResult) {
+	if s.notifier == nil {
+		return
+	}
+	var failed []string
+	severity := models.SeverityLow
+	for _, r := range checked {
+		if r.Passed {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("[%s] %s: %s", r.Severity, r.RuleID, r.Description))
+		if models.SeverityRank(r.Severity) > models.SeverityRank(severity) {
+			severity = r.Severity
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	s.notifier.Dispatch(notify.Event{
+		Type:     notify.EventComplianceViolation,
+		Severity: severity,
+		Host:     dev.Host,
+		Tags:     dev.Tags,
+		Title:    fmt.Sprintf("%s violates %d compliance rules", dev.Host, len(failed)),
+		Message:  strings.Join(failed, "\n"),
+	})
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// progressBuffer is how many events a subscriber may fall behind before
+// events are dropped for it.
+const progressBuffer = 256
+
+// progressHub fans the progress events of the current run out to subscribers.
+// It remembers the latest event of each device, so that new subscribers
+// start from the current state of the run.
+type progressHub struct {
+	mu        sync.Mutex
+	subs      map[chan models.ProgressEvent]struct{}
+	run       *models.ProgressEvent // the run_started event of the current or last run
+	latest    map[string]models.ProgressEvent
+	hosts     []string // hosts of the run in queue order
+	done      int
+	failed    int
+	cancelled int
+	running   bool
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subs: make(map[chan models.ProgressEvent]struct{})}
+}
+
+// publish fills in the run totals of an event and sends it to all subscribers.
+// Subscribers that cannot keep up miss events rather than stall the run.
+func (h *progressHub) publish(ev models.ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ev.Time = time.Now()
+	switch ev.Type {
+	case models.ProgressRunStarted:
+		ev.StartedAt = ev.Time
+		h.run = &ev
+		h.latest = make(map[string]models.ProgressEvent)
+		h.hosts = nil
+		h.done, h.failed, h.cancelled = 0, 0, 0
+		h.running = true
+	case models.ProgressRunFinished:
+		h.running = false
+	}
+	if h.run == nil {
+		return
+	}
+	ev.RunID = h.run.RunID
+	ev.Total = h.run.Total
+	ev.StartedAt = h.run.StartedAt
+	if ev.Finished() {
+		h.done++
+		switch ev.Type {
+		case models.ProgressFailed:
+			h.failed++
+		case models.ProgressCancelled:
+			h.cancelled++
+		}
+	}
+	ev.Done, ev.Failed, ev.Cancelled = h.done, h.failed, h.cancelled
+
+	if ev.Host != "" {
+		if _, seen := h.latest[ev.Host]; !seen {
+			h.hosts = append(h.hosts, ev.Host)
+		}
+		h.latest[ev.Host] = ev
+	}
+
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of progress events and a function that ends
+// the subscription. While a run is in progress, the channel starts with its
+// run_started event and the latest event of each device.
+func (h *progressHub) subscribe() (<-chan models.ProgressEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []models.ProgressEvent
+	if h.running {
+		replay = append(replay, *h.run)
+		for _, host := range h.hosts {
+			replay = append(replay, h.latest[host])
+		}
+	}
+
+	ch := make(chan models.ProgressEvent, len(replay)+progressBuffer)
+	for _, ev := range replay {
+		ch <- ev
+	}
+	h.subs[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, ch)
+	}
+}
+
+// SubscribeProgress streams the progress events of backup runs. Call the
+// returned function to stop receiving them.
+func (s *BackupService) SubscribeProgress() (<-chan models.ProgressEvent, func()) {
+	return s.progress.subscribe()
+}
+
+// reportProgress publishes a progress event of the current run.
+func (s *BackupService) reportProgress(ev models.ProgressEvent) {
+	s.progress.publish(ev)
+}
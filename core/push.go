@@ -0,0 +1,407 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/push"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Push statuses.
+const (
+	PushPending    = "pending" // applied, waiting for confirmation
+	PushConfirmed  = "confirmed"
+	PushRolledBack = "rolled_back"
+	PushFailed     = "failed"
+)
+
+// ErrNoChanges is returned by Push when the device already has the lines of a
+// merge, or the configuration of a replace.
+var ErrNoChanges = errors.New("the device already has this configuration, nothing to push")
+
+// PushOptions describes a configuration change.
+type PushOptions struct {
+	// Lines are the configuration lines to apply. With Replace set they are the
+	// complete target configuration, such as a restored backup.
+	Lines      []string
+	Replace    bool
+	ReplaceURL string
+	// ConfirmTimeout is how long the change waits for confirmation before it is rolled back.
+	ConfirmTimeout time.Duration
+	// Force allows pushing to platforms without a rollback mechanism.
+	Force bool
+	// User and Source are recorded in the audit log.
+	User   string
+	Source string
+}
+
+// PushPreview is the change a push would make, based on the latest backup.
+type PushPreview struct {
+	Host    string
+	Backup  string
+	Plan    *push.Plan
+	Diff    configdiff.Diff
+	Warning string
+}
+
+// PushResult is the outcome of a push.
+type PushResult struct {
+	ID         int64
+	Host       string
+	User       string
+	Source     string
+	Status     string
+	PreBackup  string
+	PostBackup string
+	Plan       *push.Plan
+	Transcript string
+	Errors     []string
+	// Diff compares the running configuration after the push with the one
+	// before: Missing holds the added lines and Extra the removed ones.
+	Diff     configdiff.Diff
+	Deadline time.Time
+	Message  string
+}
+
+// pendingPush is a change waiting for confirmation.
+type pendingPush struct {
+	dev    models.Device
+	result *PushResult
+	timer  *time.Timer
+}
+
+// pushState tracks the pushes made by this process.
+type pushState struct {
+	mu      sync.Mutex
+	seq     int64
+	results map[int64]*PushResult
+	pending map[int64]*pendingPush
+}
+
+// PreviewPush computes the commands and the line changes of a push without
+// connecting to the device. The latest backup stands in for the running configuration.
+func (s *BackupService) PreviewPush(dev models.Device, opts PushOptions) (*PushPreview, error) {
+	preview := &PushPreview{Host: dev.Host}
+
+	running := ""
+	if backupFile, err := utils.LatestBackupFile(s.basePath, dev.Host); err == nil {
+		results, err := utils.ReadBackupFile(backupFile)
+		if err != nil {
+			return nil, err
+		}
+		preview.Backup = backupFile
+		if running, err = RunningConfig(dev.Platform, results); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(backupFile), err)
+		}
+	} else if opts.Replace {
+		return nil, fmt.Errorf("a replace needs a backup of the running configuration: %w", err)
+	}
+
+	plan, err := push.BuildPlan(s.pushRequest(dev, opts, running))
+	if errors.Is(err, push.ErrNoRollback) {
+		preview.Warning = fmt.Sprintf("Platform '%s' has no rollback mechanism: the change cannot be reverted automatically.", dev.Platform)
+	} else if err != nil {
+		return nil, err
+	}
+	preview.Plan = plan
+
+	target := strings.Join(opts.Lines, "\n")
+	if opts.Replace {
+		preview.Diff = configdiff.Compare(target, running, configdiff.Options{Strict: true})
+	} else {
+		// A merge only adds lines, so only the missing ones are of interest.
+		preview.Diff = configdiff.Diff{Missing: configdiff.Compare(target, running, configdiff.Options{}).Missing}
+	}
+	return preview, nil
+}
+
+// Push applies a configuration change. It takes a backup before the change,
+// sends the platform's command sequence, and verifies the device with a backup
+// after it. The change then waits for ConfirmPush; if it is not confirmed
+// before the timeout, it is rolled back. Changes the device rejected are rolled
+// back immediately.
+func (s *BackupService) Push(dev models.Device, opts PushOptions) (*PushResult, error) {
+	entry := utils.Log.WithFields(map[string]interface{}{"host": dev.Host, "user": opts.User, "source": opts.Source})
+	result := &PushResult{Host: dev.Host, User: opts.User, Source: opts.Source}
+
+	entry.Info("Taking pre-change backup")
+	preFile, preResults, err := s.backupDevice(context.Background(), dev, entry, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pre-change backup failed: %w", err)
+	}
+	result.PreBackup = preFile
+	running, err := RunningConfig(dev.Platform, preResults)
+	if err != nil {
+		return nil, fmt.Errorf("pre-change backup: %w", err)
+	}
+
+	plan, err := push.BuildPlan(s.pushRequest(dev, opts, running))
+	if errors.Is(err, push.ErrNoRollback) {
+		if !opts.Force {
+			return nil, fmt.Errorf("%w: platform '%s' (force the push to apply it anyway)", err, dev.Platform)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	result.Plan = plan
+	if len(plan.Changes) == 0 && opts.ReplaceURL == "" {
+		return nil, ErrNoChanges
+	}
+
+	resolvePassword(&dev, entry)
+	pusher, err := configPusher(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Infof("Pushing %d configuration lines (%s)", len(plan.Changes), plan.Mechanism)
+	transcript, pushErr := pusher.PushConfig(plan.Apply)
+	result.Transcript = transcript
+	result.Errors = push.DetectErrors(transcript, plan.Apply)
+
+	applied := pushErr == nil && len(result.Errors) == 0
+	status := PushPending
+	if !applied {
+		status = PushFailed
+	}
+	result.ID = s.recordPush(result, status, plan.Mechanism)
+
+	if !applied {
+		msg := "device rejected the change"
+		if pushErr != nil {
+			msg = pushErr.Error()
+		}
+		entry.Errorf("Push failed: %s", msg)
+		s.finishPush(dev, result, PushFailed, opts.User, "push failed: "+msg)
+		return result, fmt.Errorf("push failed: %s", msg)
+	}
+
+	// A backup after the change proves the device is still reachable and
+	// records what the change did.
+	postFile, postResults, err := s.backupDevice(context.Background(), dev, entry, nil)
+	if err != nil {
+		entry.Errorf("Post-change backup failed, rolling back: %v", err)
+		s.finishPush(dev, result, PushFailed, opts.User, "post-change backup failed: "+err.Error())
+		return result, fmt.Errorf("post-change backup failed: %w", err)
+	}
+	result.PostBackup = postFile
+	if post, err := RunningConfig(dev.Platform, postResults); err == nil {
+		result.Diff = configdiff.Compare(post, running, configdiff.Options{Strict: true})
+	}
+
+	timeout := opts.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = push.DefaultConfirmTimeout
+	}
+	result.Deadline = time.Now().Add(timeout)
+
+	s.pushes.mu.Lock()
+	p := &pendingPush{dev: dev, result: result}
+	p.timer = time.AfterFunc(timeout, func() {
+		if err := s.RollbackPush(result.ID, "timeout"); err != nil {
+			entry.Errorf("Automatic rollback failed: %v", err)
+		}
+	})
+	s.pushes.pending[result.ID] = p
+	s.pushes.mu.Unlock()
+
+	entry.Infof("Change applied, waiting for confirmation until %s", result.Deadline.Format("15:04:05"))
+	return result, nil
+}
+
+// ConfirmPush makes a pending change permanent.
+func (s *BackupService) ConfirmPush(id int64, user string) error {
+	p, err := s.claimPending(id)
+	if err != nil {
+		return err
+	}
+	entry := utils.Log.WithFields(map[string]interface{}{"host": p.dev.Host, "user": user, "push_id": id})
+
+	if len(p.result.Plan.Confirm) > 0 {
+		pusher, err := configPusher(p.dev)
+		if err != nil {
+			return err
+		}
+		transcript, err := pusher.PushConfig(p.result.Plan.Confirm)
+		if errs := push.DetectErrors(transcript, p.result.Plan.Confirm); err != nil || len(errs) > 0 {
+			msg := strings.Join(errs, "; ")
+			if err != nil {
+				msg = err.Error()
+			}
+			s.finishPush(p.dev, p.result, PushFailed, user, "confirmation failed: "+msg)
+			return fmt.Errorf("confirmation failed: %s", msg)
+		}
+	}
+
+	entry.Info("Change confirmed")
+	s.setPushStatus(p.result, PushConfirmed, "")
+	s.audit(models.AuditEntry{
+		User: user, Action: models.AuditConfirm, Host: p.dev.Host,
+		Source: p.result.Source, Status: PushConfirmed, Details: fmt.Sprintf("push #%d", id),
+	})
+	return nil
+}
+
+// RollbackPush reverts a pending change.
+func (s *BackupService) RollbackPush(id int64, user string) error {
+	p, err := s.claimPending(id)
+	if err != nil {
+		return err
+	}
+	s.finishPush(p.dev, p.result, PushRolledBack, user, "")
+	return nil
+}
+
+// PushStatus returns a copy of a push made by this process.
+func (s *BackupService) PushStatus(id int64) (PushResult, bool) {
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	r, ok := s.pushes.results[id]
+	if !ok {
+		return PushResult{}, false
+	}
+	return *r, true
+}
+
+// finishPush rolls back a change that will not be confirmed and records the outcome.
+func (s *BackupService) finishPush(dev models.Device, result *PushResult, status, user, reason string) {
+	entry := utils.Log.WithFields(map[string]interface{}{"host": dev.Host, "user": user, "push_id": result.ID})
+	plan := result.Plan
+
+	message := reason
+	switch {
+	case plan == nil:
+	case len(plan.Rollback) > 0:
+		pusher, err := configPusher(dev)
+		if err == nil {
+			_, err = pusher.PushConfig(plan.Rollback)
+		}
+		if err != nil {
+			message = strings.TrimPrefix(message+"; rollback failed: "+err.Error(), "; ")
+			entry.Errorf("Rollback failed: %v", err)
+		} else {
+			message = strings.TrimPrefix(message+"; rolled back", "; ")
+			entry.Warn("Change rolled back")
+		}
+	case plan.AutoRevert:
+		message = strings.TrimPrefix(message+"; the device reverts the change when its timer expires", "; ")
+		entry.Warn("Change not confirmed, the device reverts it when its timer expires")
+	default:
+		message = strings.TrimPrefix(message+"; no rollback mechanism, the change stays on the device", "; ")
+		entry.Error("Change cannot be rolled back automatically")
+	}
+
+	s.setPushStatus(result, status, message)
+	s.audit(models.AuditEntry{
+		User: user, Action: models.AuditRollback, Host: dev.Host,
+		Source: result.Source, Status: status, Details: fmt.Sprintf("push #%d: %s", result.ID, message),
+	})
+}
+
+// claimPending removes a pending push so that only one caller confirms or rolls it back.
+func (s *BackupService) claimPending(id int64) (*pendingPush, error) {
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	p, ok := s.pushes.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("push #%d is not waiting for confirmation", id)
+	}
+	delete(s.pushes.pending, id)
+	p.timer.Stop()
+	return p, nil
+}
+
+// recordPush writes the push to the audit log and remembers its result.
+func (s *BackupService) recordPush(result *PushResult, status, mechanism string) int64 {
+	details := fmt.Sprintf("%d lines via %s", len(result.Plan.Changes), mechanism)
+	if len(result.Errors) > 0 {
+		details += "; errors: " + strings.Join(result.Errors, "; ")
+	}
+	id := s.audit(models.AuditEntry{
+		User: result.User, Action: models.AuditPush, Host: result.Host,
+		Source: result.Source, Status: status, Details: details,
+	})
+
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	if id == 0 {
+		s.pushes.seq++
+		id = s.pushes.seq
+	}
+	result.ID = id
+	result.Status = status
+	s.pushes.results[id] = result
+	return id
+}
+
+func (s *BackupService) setPushStatus(result *PushResult, status, message string) {
+	s.pushes.mu.Lock()
+	defer s.pushes.mu.Unlock()
+	result.Status = status
+	result.Message = message
+}
+
+// audit appends an entry to the audit log when the store keeps one and returns its ID.
+func (s *BackupService) audit(entry models.AuditEntry) int64 {
+	auditStore, ok := s.store.(storage.AuditStore)
+	if !ok {
+		return 0
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	id, err := auditStore.AddAuditEntry(entry)
+	if err != nil {
+		utils.Log.WithField("host", entry.Host).Errorf("Failed to write audit log: %v", err)
+		return 0
+	}
+	return id
+}
+
+func (s *BackupService) pushRequest(dev models.Device, opts PushOptions, running string) push.Request {
+	return push.Request{
+		Platform:       dev.Platform,
+		Lines:          opts.Lines,
+		Replace:        opts.Replace,
+		Running:        running,
+		ReplaceURL:     opts.ReplaceURL,
+		ConfirmTimeout: opts.ConfirmTimeout,
+		Label:          "netcfg-" + time.Now().Format("20060102-150405"),
+	}
+}
+
+// configPusher returns a connector for the device that can push configuration.
+func configPusher(dev models.Device) (connectors.ConfigPusher, error) {
+	connector, err := connectors.New(dev, deviceTimeout(dev))
+	if err != nil {
+		return nil, err
+	}
+	pusher, ok := connector.(connectors.ConfigPusher)
+	if !ok {
+		return nil, fmt.Errorf("protocol '%s' does not support pushing configuration", dev.Protocol)
+	}
+	return pusher, nil
+}
+
+// resolvePassword reads the device password from its environment variable.
+func resolvePassword(dev *models.Device, entry *logrus.Entry) {
+	if dev.PasswordEnv == "" {
+		return
+	}
+	dev.Password = os.Getenv(dev.PasswordEnv)
+	if dev.Password == "" {
+		entry.Warnf("Environment variable '%s' is not set or empty", dev.PasswordEnv)
+	}
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// Unfinished jobs are leased to the process that queued or claimed them. The
+// lease is renewed while the process runs a run, so that a server starting
+// next to a CLI run on the same database does not take its jobs.
+const (
+	jobLease        = 2 * time.Minute
+	jobLeaseRenewal = jobLease / 4
+)
+
+// newQueueOwner returns the owner name of the jobs of this process: host
+// name, process ID and a random suffix, since process IDs are reused.
+func newQueueOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// queueJobs records the device jobs of a run in the persistent job queue, if
+// the store has one.
+func (s *BackupService) queueJobs(runID int64, hosts []string) error {
+	queue, ok := s.store.(storage.JobQueueStore)
+	if !ok || runID == 0 {
+		return nil
+	}
+	return queue.EnqueueRunJobs(runID, hosts, s.owner, jobLease)
+}
+
+// claimJob marks the job of a device as running. It reports false when the
+// job is not pending or leased to another process that is still alive.
+func (s *BackupService) claimJob(runID int64, host string) (bool, error) {
+	queue, ok := s.store.(storage.JobQueueStore)
+	if !ok || runID == 0 {
+		return true, nil
+	}
+	return queue.ClaimRunJob(runID, host, s.owner, jobLease)
+}
+
+// renewJobs renews the leases of the jobs of this process until ctx ends.
+func (s *BackupService) renewJobs(ctx context.Context) {
+	queue, ok := s.store.(storage.JobQueueStore)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(jobLeaseRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := queue.RenewRunJobs(s.owner, jobLease); err != nil {
+				utils.Log.WithFields(map[string]interface{}{"owner": s.owner, "error": err}).Warn("Error renewing job leases")
+			}
+		}
+	}
+}
+
+// finishJob records the final state of the job of a device.
+func (s *BackupService) finishJob(runID int64, host, status string) {
+	queue, ok := s.store.(storage.JobQueueStore)
+	if !ok || runID == 0 {
+		return
+	}
+	state := models.RunJobFailed
+	switch status {
+	case models.RunResultSuccess:
+		state = models.RunJobDone
+	case models.RunResultCancelled:
+		state = models.RunJobCancelled
+	}
+	if err := queue.FinishRunJob(runID, host, state); err != nil {
+		utils.Log.WithFields(map[string]interface{}{"run_id": runID, "host": host, "error": err}).Warn("Error recording end of job")
+	}
+}
+
+// devicesByHost returns the active devices with the given hosts, in that
+// order, and the hosts that have no active device.
+func (s *BackupService) devicesByHost(hosts []string) ([]models.Device, []string, error) {
+	all, err := s.SelectDevices(models.DeviceSelector{})
+	if err != nil {
+		return nil, nil, err
+	}
+	byHost := make(map[string]models.Device, len(all))
+	for _, dev := range all {
+		byHost[dev.Host] = dev
+	}
+	var devices []models.Device
+	var missing []string
+	for _, host := range hosts {
+		if dev, ok := byHost[host]; ok {
+			devices = append(devices, dev)
+		} else {
+			missing = append(missing, host)
+		}
+	}
+	return devices, missing, nil
+}
+
+// ResumeRuns continues the runs that a previous process did not finish. Jobs
+// whose lease has expired are taken over, those that were running are queued
+// again, the oldest unfinished run starts, and the next one waits for it. Only
+// the devices that were not backed up yet are backed up again. Runs with jobs
+// still leased to another process, such as a CLI run in progress, are left to
+// it. Call it once at startup, before any run starts.
+func (s *BackupService) ResumeRuns() error {
+	queue, ok := s.store.(storage.JobQueueStore)
+	runStore, hasHistory := s.store.(storage.RunStore)
+	if !ok || !hasHistory {
+		return nil
+	}
+	takenOver, err := queue.TakeOverExpiredJobs(s.owner, jobLease)
+	if err != nil {
+		return err
+	}
+	runs, err := queue.UnfinishedRuns()
+	if err != nil {
+		return err
+	}
+	if len(runs) > 0 {
+		utils.Log.WithFields(map[string]interface{}{"runs": len(runs), "taken_over_jobs": takenOver}).Info("Resuming unfinished backup runs")
+	}
+
+	for i := range runs {
+		run := &runs[i]
+		jobs, err := queue.ListRunJobs(run.ID)
+		if err != nil {
+			return err
+		}
+		var pending []string
+		holder := ""
+		for _, job := range jobs {
+			switch {
+			case job.State != models.RunJobPending && job.State != models.RunJobRunning:
+			case job.ClaimedBy != s.owner:
+				holder = job.ClaimedBy
+			case job.State == models.RunJobPending:
+				pending = append(pending, job.Host)
+			}
+		}
+		if holder != "" {
+			utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "owner": holder}).Info("Leaving unfinished run to the process that holds its jobs")
+			continue
+		}
+		devices, missing, err := s.devicesByHost(pending)
+		if err != nil {
+			return err
+		}
+		for _, host := range missing {
+			s.abandonJob(runStore, run.ID, host, "the device was removed or is no longer active")
+		}
+
+		hosts := make([]string, 0, len(devices))
+		for _, dev := range devices {
+			hosts = append(hosts, dev.Host)
+		}
+		entry := utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "devices": len(devices)})
+
+		s.activeMu.Lock()
+		switch {
+		case len(devices) == 0:
+			s.activeMu.Unlock()
+			entry.Info("Finishing run that has no devices left")
+			s.finishResumed(runStore, run)
+		case s.running.CompareAndSwap(false, true):
+			s.countResults(runStore, run)
+			run.Status = models.RunRunning
+			if err := runStore.UpdateRun(*run); err != nil {
+				entry.WithField("error", err).Warn("Error recording start of resumed run")
+			}
+			runCtx := s.activate(context.Background(), run.ID)
+			s.activeMu.Unlock()
+			entry.Info("Resuming backup run")
+			go s.executeRun(runCtx, run, devices)
+		case s.next == nil:
+			run.Status = models.RunQueued
+			if err := runStore.UpdateRun(*run); err != nil {
+				entry.WithField("error", err).Warn("Error recording queued run")
+			}
+			s.next = &queuedRun{run: run, hosts: hosts}
+			s.activeMu.Unlock()
+			entry.Info("Queued resumed backup run")
+		default:
+			// Only one run waits at a time; later ones give their devices to it.
+			next := s.next
+			s.activeMu.Unlock()
+			entry.WithField("queued_run_id", next.run.ID).Warn("Moving the devices of an unfinished run to the queued run")
+			s.moveToQueued(runStore, run, next, hosts)
+		}
+	}
+	return nil
+}
+
+// moveToQueued hands the devices of an unfinished run to the queued run and
+// records the unfinished run as cancelled.
+func (s *BackupService) moveToQueued(runStore storage.RunStore, run *models.Run, next *queuedRun, hosts []string) {
+	s.activeMu.Lock()
+	for _, host := range hosts {
+		if !containsString(next.hosts, host) {
+			next.hosts = append(next.hosts, host)
+			next.run.Selector.Hosts = append(next.run.Selector.Hosts, host)
+		}
+	}
+	next.run.Total = len(next.hosts)
+	err := runStore.UpdateRun(*next.run)
+	s.activeMu.Unlock()
+	if err == nil {
+		err = s.queueJobs(next.run.ID, hosts)
+	}
+	if err != nil {
+		utils.Log.WithFields(map[string]interface{}{"run_id": next.run.ID, "error": err}).Warn("Error recording queued run")
+	}
+	for _, host := range hosts {
+		s.abandonJob(runStore, run.ID, host, fmt.Sprintf("moved to run %d", next.run.ID))
+	}
+	s.finishResumed(runStore, run)
+}
+
+// abandonJob records a job of an unfinished run that will not be resumed as
+// cancelled, with the reason as its error.
+func (s *BackupService) abandonJob(runStore storage.RunStore, runID int64, host, reason string) {
+	result := models.RunResult{RunID: runID, Host: host, Status: models.RunResultCancelled, Error: reason, FinishedAt: time.Now()}
+	if err := runStore.AddRunResult(result); err != nil {
+		utils.Log.WithField("host", host).WithField("error", err).Warn("Error recording run result")
+	}
+	s.finishJob(runID, host, models.RunResultCancelled)
+}
+
+// finishResumed records the end of an unfinished run that has nothing left to do.
+func (s *BackupService) finishResumed(runStore storage.RunStore, run *models.Run) {
+	s.countResults(runStore, run)
+	finishedAt := time.Now()
+	run.Status = models.RunCompleted
+	if run.Succeeded+run.Failed == 0 && run.Cancelled > 0 {
+		run.Status = models.RunCancelled
+	}
+	run.FinishedAt = &finishedAt
+	if err := runStore.FinishRun(*run); err != nil {
+		utils.Log.WithField("run_id", run.ID).WithField("error", err).Warn("Error recording end of run")
+	}
+}
+
+// countResults sets the counts of a run from its recorded results.
+func (s *BackupService) countResults(runStore storage.RunStore, run *models.Run) {
+	results, err := runStore.GetRunResults(run.ID)
+	if err != nil {
+		utils.Log.WithField("run_id", run.ID).WithField("error", err).Warn("Error reading run results")
+		return
+	}
+	run.Succeeded, run.Failed, run.Cancelled = 0, 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case models.RunResultSuccess:
+			run.Succeeded++
+		case models.RunResultCancelled:
+			run.Cancelled++
+		default:
+			run.Failed++
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"os"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/parser"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// LoadRecords returns the structured records of a backup file. Records stored next
+// to the backup are used when present; otherwise the backup is parsed and the
+// records are stored for the next time.
+func LoadRecords(dev models.Device, backupFile string) (*parser.Document, error) {
+	doc, err := parser.ReadDocument(backupFile)
+	if err == nil {
+		return doc, nil
+	}
+	if !os.IsNotExist(err) {
+		utils.Log.WithField("file", backupFile).Warnf("Ignoring unreadable parsed records: %v", err)
+	}
+
+	results, err := utils.ReadBackupFile(backupFile)
+	if err != nil {
+		return nil, err
+	}
+	parsed := parser.NewDocument(dev, backupFile, results)
+	if err := parser.WriteDocument(backupFile, parsed); err != nil {
+		utils.Log.WithField("file", backupFile).Warnf("Failed to store parsed records: %v", err)
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,338 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// idempotencyWindow is how long the answer to a backup request is returned
+// again for a request with the same idempotency key.
+const idempotencyWindow = 24 * time.Hour
+
+// Callback delivery settings.
+const (
+	callbackTimeout  = 10 * time.Second
+	callbackAttempts = 3
+	callbackBackoff  = 5 * time.Second
+)
+
+var (
+	// ErrInvalidRequest is returned for backup requests that cannot be queued as given.
+	ErrInvalidRequest = errors.New("invalid backup request")
+	// ErrIdempotencyMismatch is returned when an idempotency key is reused
+	// for a request that differs from the one it was first sent with.
+	ErrIdempotencyMismatch = errors.New("the idempotency key was used for a different request")
+	// ErrNoRunHistory is returned when backup requests are made without a store that keeps runs.
+	ErrNoRunHistory = errors.New("this store does not keep run history")
+)
+
+// SetCallbackKey sets the key used to sign the bodies posted to callback
+// URLs. Without a key, callbacks are not signed.
+func (s *BackupService) SetCallbackKey(key []byte) {
+	s.callbackKey = key
+}
+
+// RequestBackup queues a backup of the requested devices and returns a
+// ticket with the run that will back them up. Devices that are already
+// waiting in the run in progress or the queued run are not queued again.
+// A request repeating the idempotency key of an earlier request by the same
+// owner returns the earlier ticket; replayed reports whether it did. Reusing
+// the key for a different request returns ErrIdempotencyMismatch.
+func (s *BackupService) RequestBackup(owner string, req models.BackupRequest) (ticket *models.BackupTicket, replayed bool, err error) {
+	runStore, ok := s.store.(storage.RunStore)
+	if !ok {
+		return nil, false, ErrNoRunHistory
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			return nil, false, err
+		}
+	}
+
+	s.requestMu.Lock()
+	defer s.requestMu.Unlock()
+
+	requests, remember := s.store.(storage.BackupRequestStore)
+	remember = remember && req.IdempotencyKey != ""
+	hash := requestHash(req)
+	if remember {
+		previous, previousHash, err := requests.GetBackupRequest(owner, req.IdempotencyKey, time.Now().Add(-idempotencyWindow))
+		if err != nil {
+			return nil, false, err
+		}
+		// Requests saved before the hash was recorded have none to compare.
+		if previous != nil && previousHash != "" && previousHash != hash {
+			return nil, false, ErrIdempotencyMismatch
+		}
+		if previous != nil {
+			return previous, true, nil
+		}
+	}
+
+	hosts, err := s.requestHosts(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var watch *requestWatch
+	if req.CallbackURL != "" {
+		watch = &requestWatch{hosts: make(map[string]bool, len(hosts))}
+		for _, host := range hosts {
+			watch.hosts[host] = true
+		}
+		watch.done = func(results []models.RunResult) {
+			s.deliverCallback(req, ticket.RunID, results)
+		}
+	}
+	ticket, err = s.enqueue(runStore, hosts, watch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if remember {
+		if err := requests.SaveBackupRequest(owner, req.IdempotencyKey, hash, *ticket); err != nil {
+			utils.Log.WithField("error", err).Warn("Error recording backup request")
+		}
+		if err := requests.PurgeBackupRequests(time.Now().Add(-idempotencyWindow)); err != nil {
+			utils.Log.WithField("error", err).Warn("Error purging backup requests")
+		}
+	}
+	s.startNext()
+	return ticket, false, nil
+}
+
+// requestHash identifies what a request asks for: its hosts, in any order,
+// its selector and its callback URL.
+func requestHash(req models.BackupRequest) string {
+	req.IdempotencyKey = ""
+	req.Hosts = append([]string(nil), req.Hosts...)
+	sort.Strings(req.Hosts)
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// requestHosts returns the active devices of a request, sorted. Listed hosts
+// must all be active inventory devices.
+func (s *BackupService) requestHosts(req models.BackupRequest) ([]string, error) {
+	if len(req.Hosts) == 0 {
+		devices, err := s.SelectDevices(req.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, ErrNoDevices
+		}
+		hosts := make([]string, 0, len(devices))
+		for _, dev := range devices {
+			hosts = append(hosts, dev.Host)
+		}
+		return hosts, nil
+	}
+
+	devices, err := s.SelectDevices(models.DeviceSelector{})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(devices))
+	for _, dev := range devices {
+		known[dev.Host] = true
+	}
+	var hosts, unknown []string
+	for _, host := range req.Hosts {
+		switch {
+		case !known[host]:
+			unknown = append(unknown, host)
+		case !containsString(hosts, host):
+			hosts = append(hosts, host)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: unknown or pending hosts: %s", ErrInvalidRequest, strings.Join(unknown, ", "))
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// enqueue adds the hosts that are not already waiting to the queued run,
+// recording it first if needed, and registers watch with every run involved.
+func (s *BackupService) enqueue(store storage.RunStore, hosts []string, watch *requestWatch) (*models.BackupTicket, error) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+
+	ticket := &models.BackupTicket{Hosts: hosts}
+	var fresh []string
+	for _, host := range hosts {
+		switch {
+		case s.active != nil && s.active.waiting(host):
+			s.dedup(ticket, host, s.active.id)
+		case s.next != nil && containsString(s.next.hosts, host):
+			s.dedup(ticket, host, s.next.run.ID)
+		default:
+			fresh = append(fresh, host)
+		}
+	}
+
+	if len(fresh) > 0 {
+		if s.next == nil {
+			run := &models.Run{
+				Trigger:   TriggerWebhook,
+				Selector:  models.DeviceSelector{Hosts: fresh},
+				Status:    models.RunQueued,
+				Total:     len(fresh),
+				StartedAt: time.Now(),
+			}
+			id, err := store.CreateRun(*run)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record run: %w", err)
+			}
+			run.ID = id
+			s.next = &queuedRun{run: run}
+		} else {
+			s.next.run.Selector.Hosts = append(s.next.run.Selector.Hosts, fresh...)
+			s.next.run.Total = len(s.next.hosts) + len(fresh)
+			if err := store.UpdateRun(*s.next.run); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.queueJobs(s.next.run.ID, fresh); err != nil {
+			return nil, fmt.Errorf("failed to queue jobs: %w", err)
+		}
+		s.next.hosts = append(s.next.hosts, fresh...)
+		ticket.RunID = s.next.run.ID
+	} else {
+		ticket.RunID = ticket.Deduplicated[hosts[0]]
+	}
+
+	if watch != nil {
+		runs := map[int64]bool{ticket.RunID: true}
+		for _, id := range ticket.Deduplicated {
+			runs[id] = true
+		}
+		watch.runs = len(runs)
+		for id := range runs {
+			s.watchers[id] = append(s.watchers[id], watch.runDone)
+		}
+	}
+	return ticket, nil
+}
+
+// dedup records that a host of a request is already waiting in a run.
+func (s *BackupService) dedup(ticket *models.BackupTicket, host string, runID int64) {
+	if ticket.Deduplicated == nil {
+		ticket.Deduplicated = make(map[string]int64)
+	}
+	ticket.Deduplicated[host] = runID
+}
+
+// requestWatch collects the results of the hosts of a request from the runs
+// that back them up, and calls done once all of those runs have finished.
+type requestWatch struct {
+	mu      sync.Mutex
+	hosts   map[string]bool
+	runs    int // runs that have not finished yet
+	results []models.RunResult
+	done    func(results []models.RunResult)
+}
+
+func (w *requestWatch) runDone(_ models.Run, results []models.RunResult) {
+	w.mu.Lock()
+	for _, r := range results {
+		if w.hosts[r.Host] {
+			w.results = append(w.results, r)
+		}
+	}
+	w.runs--
+	finished := w.runs == 0
+	w.mu.Unlock()
+
+	if finished {
+		sort.Slice(w.results, func(i, j int) bool { return w.results[i].Host < w.results[j].Host })
+		w.done(w.results)
+	}
+}
+
+// validateCallbackURL accepts absolute http and https URLs.
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: callback_url must be an absolute http or https URL", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// deliverCallback posts the results of a request to its callback URL,
+// retrying a few times if the receiver fails. With a callback key set, the
+// body is signed in the X-Netcfg-Signature header as "sha256=<hex HMAC>".
+func (s *BackupService) deliverCallback(req models.BackupRequest, runID int64, results []models.RunResult) {
+	payload := models.BackupCallback{
+		IdempotencyKey: req.IdempotencyKey,
+		RunID:          runID,
+		Status:         models.RunResultSuccess,
+		Results:        results,
+	}
+	for _, r := range results {
+		if r.Status != models.RunResultSuccess {
+			payload.Status = models.RunResultFailed
+			break
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		utils.Log.WithField("error", err).Error("Failed to encode backup callback")
+		return
+	}
+
+	entry := utils.Log.WithFields(map[string]interface{}{"run_id": runID, "callback_url": req.CallbackURL})
+	client := &http.Client{Timeout: callbackTimeout}
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		err = s.postCallback(client, req.CallbackURL, body)
+		if err == nil {
+			entry.Info("Delivered backup callback")
+			return
+		}
+		entry.WithFields(map[string]interface{}{"attempt": attempt, "error": err}).Warn("Backup callback failed")
+		if attempt < callbackAttempts {
+			time.Sleep(time.Duration(attempt) * callbackBackoff)
+		}
+	}
+	entry.Error("Giving up on backup callback")
+}
+
+func (s *BackupService) postCallback(client *http.Client, callbackURL string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.callbackKey) > 0 {
+		mac := hmac.New(sha256.New, s.callbackKey)
+		mac.Write(body)
+		req.Header.Set("X-Netcfg-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+func TestRequestHash(t *testing.T) {
+	req := models.BackupRequest{Hosts: []string{"r1", "r2"}, IdempotencyKey: "deploy-1", CallbackURL: "https://ci.example.com/hook"}
+	same := []models.BackupRequest{
+		{Hosts: []string{"r2", "r1"}, IdempotencyKey: "deploy-1", CallbackURL: "https://ci.example.com/hook"},
+		{Hosts: []string{"r1", "r2"}, IdempotencyKey: "deploy-2", CallbackURL: "https://ci.example.com/hook"},
+	}
+	different := []models.BackupRequest{
+		{Hosts: []string{"r1"}, IdempotencyKey: "deploy-1", CallbackURL: "https://ci.example.com/hook"},
+		{Hosts: []string{"r1", "r2"}, IdempotencyKey: "deploy-1"},
+		{Selector: models.DeviceSelector{Tags: []string{"core"}}, IdempotencyKey: "deploy-1", CallbackURL: "https://ci.example.com/hook"},
+	}
+	for _, r := range same {
+		if requestHash(r) != requestHash(req) {
+			t.Errorf("%+v hashes differently from %+v", r, req)
+		}
+	}
+	for _, r := range different {
+		if requestHash(r) == requestHash(req) {
+			t.Errorf("%+v hashes like %+v", r, req)
+		}
+	}
+	hosts := []string{"r2", "r1"}
+	requestHash(models.BackupRequest{Hosts: hosts})
+	if hosts[0] != "r2" {
+		t.Error("hashing sorted the hosts of the request")
+	}
+}
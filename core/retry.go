@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+)
+
+// Defaults of the retry policy.
+const (
+	DefaultRetries       = 2
+	DefaultRetryDelay    = 5 * time.Second
+	DefaultMaxRetryDelay = time.Minute
+)
+
+// retryPolicy is how often and how long apart a job is retried after a
+// transient failure.
+type retryPolicy struct {
+	retries   int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	retries:   DefaultRetries,
+	baseDelay: DefaultRetryDelay,
+	maxDelay:  DefaultMaxRetryDelay,
+}
+
+// SetRetry sets how many times a job is retried after a transient failure
+// (timeouts and refused connections) and the delay before the first retry.
+// The delay doubles with every retry up to maxDelay. Authentication, host
+// key and command failures are never retried.
+func (s *BackupService) SetRetry(retries int, baseDelay, maxDelay time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	s.retry = retryPolicy{retries: retries, baseDelay: baseDelay, maxDelay: maxDelay}
+}
+
+// shouldRetry reports whether a job that failed with err on the given
+// attempt, counting from 1, gets another one.
+func (p retryPolicy) shouldRetry(attempt int, err error) bool {
+	return attempt <= p.retries && connectors.Transient(connectors.Category(err))
+}
+
+// delay returns the wait before the retry following the given attempt:
+// exponential backoff with jitter, so that devices that failed together
+// are not retried together.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.baseDelay
+	for i := 1; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep waits for d or until ctx is cancelled, and reports whether it waited
+// the full time.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
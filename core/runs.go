@@ -0,0 +1,395 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// Run triggers recorded in the run history.
+const (
+	TriggerCLI     = "cli"
+	TriggerWeb     = "web"
+	TriggerAPI     = "api"
+	TriggerSyslog  = "syslog"
+	TriggerWebhook = "webhook"
+)
+
+var (
+	// ErrNoDevices is returned when a run selects no devices.
+	ErrNoDevices = errors.New("no devices selected")
+	// ErrRunInProgress is returned when a run is started while another one is running.
+	ErrRunInProgress = errors.New("a backup run is already in progress")
+	// ErrNotRunning is returned when cancelling a run or device that is not in progress.
+	ErrNotRunning = errors.New("the run or device is not in progress")
+)
+
+// activeRun holds the cancel functions of the run in progress and of each of
+// its devices that has not finished yet.
+type activeRun struct {
+	id      int64
+	cancel  context.CancelFunc
+	jobs    map[string]context.CancelFunc
+	started map[string]bool // devices a worker has picked up
+}
+
+// waiting reports whether a device of the run has not been picked up yet.
+func (a *activeRun) waiting(host string) bool {
+	_, ok := a.jobs[host]
+	return ok && !a.started[host]
+}
+
+// queuedRun is a run recorded ahead of time that starts when the run in
+// progress has finished. Backup requests add their devices to it.
+type queuedRun struct {
+	run   *models.Run
+	hosts []string
+}
+
+// runWatcher is called with a finished run and its per-device results.
+type runWatcher func(run models.Run, results []models.RunResult)
+
+// IsRunning reports whether a backup run is in progress.
+func (s *BackupService) IsRunning() bool {
+	return s.running.Load()
+}
+
+// RunSelected backs up the active devices matched by a selector and returns
+// the finished run. Cancelling ctx cancels the run.
+func (s *BackupService) RunSelected(ctx context.Context, sel models.DeviceSelector, trigger string) (*models.Run, error) {
+	run, devices, runCtx, err := s.beginRun(ctx, sel, trigger, "")
+	if err != nil {
+		return nil, err
+	}
+	s.executeRun(runCtx, run, devices)
+	return run, nil
+}
+
+// StartRun starts backing up the active devices matched by a selector in the
+// background. It returns the run as soon as it is recorded; its progress can
+// be followed in the run history, and it can be stopped with CancelRun.
+func (s *BackupService) StartRun(sel models.DeviceSelector, trigger string) (*models.Run, error) {
+	return s.startRun(sel, trigger, "")
+}
+
+// StartChangeRun starts backing up one device in the background after a
+// configuration change reported by the device. changedBy names who made the
+// change, if known, and is recorded with the run.
+func (s *BackupService) StartChangeRun(host, changedBy string) (*models.Run, error) {
+	return s.startRun(models.DeviceSelector{Hosts: []string{host}}, TriggerSyslog, changedBy)
+}
+
+func (s *BackupService) startRun(sel models.DeviceSelector, trigger, changedBy string) (*models.Run, error) {
+	run, devices, runCtx, err := s.beginRun(context.Background(), sel, trigger, changedBy)
+	if err != nil {
+		return nil, err
+	}
+	started := *run
+	go s.executeRun(runCtx, run, devices)
+	return &started, nil
+}
+
+// CancelRun cancels the run in progress. Devices being backed up are
+// disconnected and the remaining ones are skipped; all of them are recorded
+// as cancelled.
+func (s *BackupService) CancelRun(runID int64) error {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	if s.next != nil && s.next.run.ID == runID {
+		s.cancelQueued()
+		return nil
+	}
+	if s.active == nil || s.active.id != runID {
+		return ErrNotRunning
+	}
+	utils.Log.WithField("run_id", runID).Warn("Cancelling backup run")
+	s.active.cancel()
+	return nil
+}
+
+// CancelDevice cancels the backup of one device of the run in progress,
+// whether it is queued or already connected. The rest of the run goes on.
+func (s *BackupService) CancelDevice(runID int64, host string) error {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	if s.active == nil || s.active.id != runID {
+		return ErrNotRunning
+	}
+	cancel, ok := s.active.jobs[host]
+	if !ok {
+		return ErrNotRunning
+	}
+	utils.Log.WithFields(map[string]interface{}{"run_id": runID, "host": host}).Warn("Cancelling device backup")
+	cancel()
+	return nil
+}
+
+// beginRun selects the devices and records the start of a run. Only one run
+// may be in progress at a time. The returned context is cancelled by CancelRun.
+func (s *BackupService) beginRun(ctx context.Context, sel models.DeviceSelector, trigger, changedBy string) (*models.Run, []models.Device, context.Context, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, nil, nil, ErrRunInProgress
+	}
+
+	devices, err := s.SelectDevices(sel)
+	if err != nil {
+		s.release()
+		return nil, nil, nil, err
+	}
+	if len(devices) == 0 {
+		s.release()
+		return nil, nil, nil, ErrNoDevices
+	}
+	utils.Log.Infof("Loaded %d devices from configuration", len(devices))
+
+	run := &models.Run{
+		Trigger:   trigger,
+		ChangedBy: changedBy,
+		Selector:  sel,
+		Status:    models.RunRunning,
+		Total:     len(devices),
+		StartedAt: time.Now(),
+	}
+	if store, ok := s.store.(storage.RunStore); ok {
+		id, err := store.CreateRun(*run)
+		if err != nil {
+			s.release()
+			return nil, nil, nil, fmt.Errorf("failed to record run: %w", err)
+		}
+		run.ID = id
+	}
+	hosts := make([]string, 0, len(devices))
+	for _, dev := range devices {
+		hosts = append(hosts, dev.Host)
+	}
+	if err := s.queueJobs(run.ID, hosts); err != nil {
+		s.release()
+		return nil, nil, nil, fmt.Errorf("failed to queue jobs: %w", err)
+	}
+
+	s.activeMu.Lock()
+	runCtx := s.activate(ctx, run.ID)
+	s.activeMu.Unlock()
+	return run, devices, runCtx, nil
+}
+
+// activate makes a run the run in progress and returns its context. The
+// caller holds activeMu.
+func (s *BackupService) activate(ctx context.Context, runID int64) context.Context {
+	runCtx, cancel := context.WithCancel(ctx)
+	s.active = &activeRun{
+		id:      runID,
+		cancel:  cancel,
+		jobs:    make(map[string]context.CancelFunc),
+		started: make(map[string]bool),
+	}
+	return runCtx
+}
+
+// release ends the run in progress, or a failed attempt to start one, and
+// starts the queued run if there is one.
+func (s *BackupService) release() {
+	s.running.Store(false)
+	s.startNext()
+}
+
+// startNext starts the queued run unless another run is in progress.
+func (s *BackupService) startNext() {
+	for {
+		if !s.running.CompareAndSwap(false, true) {
+			return
+		}
+
+		s.activeMu.Lock()
+		next := s.next
+		s.next = nil
+		if next == nil {
+			s.activeMu.Unlock()
+			s.running.Store(false)
+			// A run may have been queued while this one was finishing.
+			s.activeMu.Lock()
+			queued := s.next != nil
+			s.activeMu.Unlock()
+			if !queued {
+				return
+			}
+			continue
+		}
+
+		run := next.run
+		devices, missing, err := s.devicesByHost(next.hosts)
+		if err != nil {
+			utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "error": err}).Error("Failed to load devices of queued run")
+		}
+		run.Status = models.RunRunning
+		run.Total = len(devices)
+		run.StartedAt = time.Now()
+		if store, ok := s.store.(storage.RunStore); ok && run.ID != 0 {
+			if err := store.UpdateRun(*run); err != nil {
+				utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "error": err}).Warn("Error recording start of queued run")
+			}
+		}
+		runCtx := s.activate(context.Background(), run.ID)
+		s.activeMu.Unlock()
+
+		if store, ok := s.store.(storage.RunStore); ok && run.ID != 0 {
+			for _, host := range missing {
+				s.abandonJob(store, run.ID, host, "the device was removed or is no longer active")
+			}
+		}
+		utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "devices": len(devices)}).Info("Starting queued backup run")
+		go s.executeRun(runCtx, run, devices)
+		return
+	}
+}
+
+// cancelQueued drops the queued run and records it as cancelled. The caller
+// holds activeMu.
+func (s *BackupService) cancelQueued() {
+	run, hosts := s.next.run, s.next.hosts
+	s.next = nil
+	utils.Log.WithField("run_id", run.ID).Warn("Cancelling queued backup run")
+
+	finishedAt := time.Now()
+	run.Status = models.RunCancelled
+	run.Cancelled = len(hosts)
+	run.FinishedAt = &finishedAt
+	results := make([]models.RunResult, 0, len(hosts))
+	for _, host := range hosts {
+		results = append(results, models.RunResult{RunID: run.ID, Host: host, Status: models.RunResultCancelled, Error: "cancelled", FinishedAt: finishedAt})
+	}
+	if store, ok := s.store.(storage.RunStore); ok && run.ID != 0 {
+		for _, r := range results {
+			if err := store.AddRunResult(r); err != nil {
+				utils.Log.WithField("host", r.Host).WithField("error", err).Warn("Error recording run result")
+			}
+			s.finishJob(run.ID, r.Host, r.Status)
+		}
+		if err := store.FinishRun(*run); err != nil {
+			utils.Log.WithField("run_id", run.ID).WithField("error", err).Warn("Error recording end of run")
+		}
+	}
+	s.notifyWatchers(*run, results)
+}
+
+// notifyWatchers calls the watchers of a finished run in the background. The
+// caller holds activeMu.
+func (s *BackupService) notifyWatchers(run models.Run, results []models.RunResult) {
+	watchers := s.watchers[run.ID]
+	delete(s.watchers, run.ID)
+	for _, w := range watchers {
+		go w(run, results)
+	}
+}
+
+// executeRun backs up the devices of a run, claiming each job in the job
+// queue, records each result and publishes the progress of the run.
+func (s *BackupService) executeRun(runCtx context.Context, run *models.Run, devices []models.Device) {
+	defer s.release()
+
+	// The leases of the queued run's jobs are renewed too, as they belong to
+	// this process as well.
+	renewCtx, stopRenewing := context.WithCancel(context.Background())
+	defer stopRenewing()
+	go s.renewJobs(renewCtx)
+
+	jobCtxs := make(map[string]context.Context, len(devices))
+	s.activeMu.Lock()
+	for _, dev := range devices {
+		jobCtx, cancel := context.WithCancel(runCtx)
+		jobCtxs[dev.Host] = jobCtx
+		s.active.jobs[dev.Host] = cancel
+	}
+	s.activeMu.Unlock()
+
+	s.reportProgress(models.ProgressEvent{Type: models.ProgressRunStarted, RunID: run.ID, Total: len(devices)})
+	for _, dev := range devices {
+		s.reportProgress(models.ProgressEvent{Type: models.ProgressQueued, Host: dev.Host})
+	}
+
+	store, hasHistory := s.store.(storage.RunStore)
+	var mu sync.Mutex
+	var results []models.RunResult
+	s.runPool(devices, func(id int, dev models.Device) {
+		s.activeMu.Lock()
+		s.active.started[dev.Host] = true
+		s.activeMu.Unlock()
+
+		claimed, err := s.claimJob(run.ID, dev.Host)
+		var result models.RunResult
+		switch {
+		case err != nil:
+			// Another process may hold the job, so the device is not backed up.
+			utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "host": dev.Host, "error": err}).Error("Error claiming job")
+			result = models.RunResult{RunID: run.ID, Host: dev.Host, Status: models.RunResultFailed, Error: err.Error(), FinishedAt: time.Now()}
+			s.reportProgress(models.ProgressEvent{Type: models.ProgressFailed, Host: dev.Host, Error: result.Error})
+		case claimed:
+			result = s.backupJob(jobCtxs[dev.Host], id, dev)
+			result.RunID = run.ID
+		}
+
+		s.activeMu.Lock()
+		if cancel, ok := s.active.jobs[dev.Host]; ok {
+			cancel()
+			delete(s.active.jobs, dev.Host)
+		}
+		s.activeMu.Unlock()
+		if err == nil && !claimed {
+			utils.Log.WithFields(map[string]interface{}{"run_id": run.ID, "host": dev.Host}).Warn("Job is no longer pending, skipping it")
+			return
+		}
+
+		mu.Lock()
+		switch result.Status {
+		case models.RunResultSuccess:
+			run.Succeeded++
+		case models.RunResultCancelled:
+			run.Cancelled++
+		default:
+			run.Failed++
+		}
+		results = append(results, result)
+		mu.Unlock()
+
+		if hasHistory {
+			if err := store.AddRunResult(result); err != nil {
+				utils.Log.WithField("host", dev.Host).WithField("error", err).Warn("Error recording run result")
+			}
+		}
+		s.finishJob(run.ID, dev.Host, result.Status)
+	})
+
+	finishedAt := time.Now()
+	run.Status = models.RunCompleted
+	if runCtx.Err() != nil {
+		run.Status = models.RunCancelled
+	}
+	run.FinishedAt = &finishedAt
+
+	s.activeMu.Lock()
+	s.active.cancel()
+	s.active = nil
+	s.notifyWatchers(*run, results)
+	s.activeMu.Unlock()
+
+	if hasHistory {
+		if err := store.FinishRun(*run); err != nil {
+			utils.Log.WithField("run_id", run.ID).WithField("error", err).Warn("Error recording end of run")
+		}
+	}
+	s.reportProgress(models.ProgressEvent{Type: models.ProgressRunFinished})
+
+	utils.Log.WithFields(map[string]interface{}{
+		"run_id":    run.ID,
+		"status":    run.Status,
+		"succeeded": run.Succeeded,
+		"failed":    run.Failed,
+		"cancelled": run.Cancelled,
+	}).Info("All backup tasks completed.")
+}
@@ -0,0 +1,241 @@
+// Package discovery finds new devices by crawling CDP and LLDP neighbor tables.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Options bounds a crawl.
+type Options struct {
+	// MaxDepth is the number of hops to follow from the seed devices.
+	MaxDepth int
+	// AllowedSubnets restricts which management addresses may be crawled. Empty means any.
+	AllowedSubnets []*net.IPNet
+	// Blacklist holds hosts (addresses or names) that are never crawled or added.
+	Blacklist []string
+	// Workers is the number of devices queried concurrently.
+	Workers int
+	// Timeout is the connection timeout for devices without their own timeout.
+	Timeout time.Duration
+}
+
+// Result is the outcome of a crawl.
+type Result struct {
+	// Neighbors holds the neighbors of every device that was queried successfully.
+	Neighbors map[string][]models.Neighbor
+	// Discovered holds new devices that are not in the inventory yet.
+	Discovered []models.Device
+	// Failed holds the error for every device that could not be queried.
+	Failed map[string]error
+}
+
+// Crawler walks the network starting from seed devices.
+type Crawler struct {
+	inventory map[string]models.Device
+	opts      Options
+}
+
+// NewCrawler creates a crawler. The inventory is used to recognise known devices
+// and to reuse their credentials.
+func NewCrawler(inventory []models.Device, opts Options) *Crawler {
+	known := make(map[string]models.Device, len(inventory))
+	for _, dev := range inventory {
+		known[dev.Host] = dev
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Crawler{inventory: known, opts: opts}
+}
+
+// Crawl queries the seeds and follows their neighbors breadth-first up to MaxDepth hops.
+// Newly found devices inherit the credentials of the device they were seen from.
+func (c *Crawler) Crawl(seeds []models.Device) *Result {
+	res := &Result{
+		Neighbors: make(map[string][]models.Neighbor),
+		Failed:    make(map[string]error),
+	}
+
+	visited := make(map[string]bool)
+	level := make([]models.Device, 0, len(seeds))
+	for _, dev := range seeds {
+		if !visited[dev.Host] {
+			visited[dev.Host] = true
+			level = append(level, dev)
+		}
+	}
+
+	for depth := 0; len(level) > 0; depth++ {
+		utils.Log.Infof("Discovery: querying %d devices at depth %d", len(level), depth)
+		found := c.queryAll(level, res)
+
+		if depth >= c.opts.MaxDepth {
+			break
+		}
+
+		var next []models.Device
+		for _, parent := range level {
+			for _, nb := range found[parent.Host] {
+				addr := nb.RemoteAddress
+				if addr == "" || visited[addr] || !c.allowed(nb) {
+					continue
+				}
+				visited[addr] = true
+
+				dev, known := c.inventory[addr]
+				if !known {
+					dev, known = c.inventory[nb.RemoteName]
+				}
+				if known && visited[dev.Host] {
+					continue
+				}
+				visited[dev.Host] = true
+				if !known {
+					dev = newDeviceFrom(parent, nb)
+					res.Discovered = append(res.Discovered, dev)
+				}
+				next = append(next, dev)
+			}
+		}
+		level = next
+	}
+
+	return res
+}
+
+// queryAll collects neighbors from a set of devices using a bounded number of workers.
+func (c *Crawler) queryAll(devices []models.Device, res *Result) map[string][]models.Neighbor {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.opts.Workers)
+
+	found := make(map[string][]models.Neighbor)
+	for _, dev := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(dev models.Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			neighbors, err := c.queryNeighbors(dev)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				utils.Log.WithField("host", dev.Host).Errorf("Discovery: failed to query neighbors: %v", err)
+				res.Failed[dev.Host] = err
+				return
+			}
+			found[dev.Host] = neighbors
+			res.Neighbors[dev.Host] = neighbors
+		}(dev)
+	}
+	wg.Wait()
+
+	return found
+}
+
+// queryNeighbors runs the CDP and LLDP commands on a device and parses their output.
+func (c *Crawler) queryNeighbors(dev models.Device) ([]models.Neighbor, error) {
+	if dev.PasswordEnv != "" {
+		dev.Password = os.Getenv(dev.PasswordEnv)
+	}
+
+	timeout := c.opts.Timeout
+	if dev.TimeoutSeconds > 0 {
+		timeout = time.Duration(dev.TimeoutSeconds) * time.Second
+	}
+
+	connector, err := connectors.New(dev, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := connector.RunCommands(context.Background(), []string{cdpCommand, lldpCommand})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run neighbor commands: %w", err)
+	}
+
+	now := time.Now()
+	var neighbors []models.Neighbor
+	for _, r := range results {
+		var parsed []models.Neighbor
+		switch r.Cmd {
+		case cdpCommand:
+			parsed = ParseCDPNeighbors(r.Output)
+		case lldpCommand:
+			parsed = ParseLLDPNeighbors(r.Output)
+		}
+		for _, nb := range parsed {
+			nb.LocalHost = dev.Host
+			nb.DiscoveredAt = now
+			neighbors = append(neighbors, nb)
+		}
+	}
+
+	return neighbors, nil
+}
+
+// allowed reports whether a neighbor passes the blacklist and subnet restrictions.
+func (c *Crawler) allowed(nb models.Neighbor) bool {
+	for _, host := range c.opts.Blacklist {
+		if host == nb.RemoteAddress || host == nb.RemoteName {
+			return false
+		}
+	}
+	if len(c.opts.AllowedSubnets) == 0 {
+		return true
+	}
+	ip := net.ParseIP(nb.RemoteAddress)
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range c.opts.AllowedSubnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDeviceFrom builds a pending inventory entry for a neighbor, reusing the parent's credentials.
+func newDeviceFrom(parent models.Device, nb models.Neighbor) models.Device {
+	platform := models.DetectPlatform(nb.Platform)
+	return models.Device{
+		Host:               nb.RemoteAddress,
+		Username:           parent.Username,
+		PasswordEnv:        parent.PasswordEnv,
+		KeyPath:            parent.KeyPath,
+		Protocol:           parent.Protocol,
+		Prompt:             parent.Prompt,
+		TimeoutSeconds:     parent.TimeoutSeconds,
+		AllowInsecureAlgos: parent.AllowInsecureAlgos,
+		Platform:           platform,
+		Status:             models.DeviceStatusPending,
+		Commands:           DefaultCommands(platform),
+	}
+}
+
+// DefaultCommands returns the backup commands used for a newly discovered device.
+func DefaultCommands(platform string) []string {
+	switch platform {
+	case models.PlatformJunOS:
+		return []string{"show configuration | display set"}
+	default:
+		return []string{"show running-config"}
+	}
+}
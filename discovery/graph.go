@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Node is a device in the adjacency graph.
+type Node struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Platform string `json:"platform,omitempty"`
+}
+
+// Edge is a link between two nodes as reported by CDP or LLDP.
+type Edge struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	FromInterface string `json:"from_interface,omitempty"`
+	ToInterface   string `json:"to_interface,omitempty"`
+	Protocol      string `json:"protocol"`
+}
+
+// Graph is the neighbor adjacency graph built from recorded neighbors.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// BuildGraph builds an undirected graph from neighbor records.
+// A link reported by both ends, or by both CDP and LLDP, appears once.
+func BuildGraph(neighbors []models.Neighbor) *Graph {
+	nodes := make(map[string]*Node)
+	addNode := func(id, name, platform string) {
+		n, ok := nodes[id]
+		if !ok {
+			n = &Node{ID: id}
+			nodes[id] = n
+		}
+		if n.Name == "" {
+			n.Name = name
+		}
+		if n.Platform == "" {
+			n.Platform = platform
+		}
+	}
+
+	seen := make(map[string]bool)
+	g := &Graph{}
+	for _, nb := range neighbors {
+		remoteID := nb.RemoteAddress
+		if remoteID == "" {
+			remoteID = nb.RemoteName
+		}
+		addNode(nb.LocalHost, "", "")
+		addNode(remoteID, nb.RemoteName, nb.Platform)
+
+		a := nb.LocalHost + "|" + nb.LocalInterface
+		b := remoteID + "|" + nb.RemoteInterface
+		if b < a {
+			a, b = b, a
+		}
+		if seen[a+"--"+b] {
+			continue
+		}
+		seen[a+"--"+b] = true
+
+		g.Edges = append(g.Edges, Edge{
+			From:          nb.LocalHost,
+			To:            remoteID,
+			FromInterface: nb.LocalInterface,
+			ToInterface:   nb.RemoteInterface,
+			Protocol:      nb.Protocol,
+		})
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+
+	return g
+}
+
+// WriteJSON writes the graph as indented JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("graph topology {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		label := n.ID
+		if n.Name != "" && n.Name != n.ID {
+			label = n.Name + "\\n" + n.ID
+		}
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(n.ID), dotQuote(label))
+	}
+	for _, e := range g.Edges {
+		label := strings.Trim(e.FromInterface+" - "+e.ToInterface, " -")
+		fmt.Fprintf(&b, "  %s -- %s [label=%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(label))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes an identifier for DOT, keeping "\n" line breaks in labels.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Commands used to collect neighbor tables from a device.
+const (
+	cdpCommand  = "show cdp neighbors detail"
+	lldpCommand = "show lldp neighbors detail"
+)
+
+var ipv4Re = regexp.MustCompile(`\b(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})\b`)
+
+// ParseCDPNeighbors parses the output of "show cdp neighbors detail" (IOS and NX-OS formats).
+func ParseCDPNeighbors(output string) []models.Neighbor {
+	var neighbors []models.Neighbor
+	var current *models.Neighbor
+	var entryAddr, mgmtAddr string
+	inMgmt := false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.RemoteAddress = mgmtAddr
+		if current.RemoteAddress == "" {
+			current.RemoteAddress = entryAddr
+		}
+		current.Platform = strings.TrimSpace(current.Platform)
+		neighbors = append(neighbors, *current)
+		current = nil
+	}
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case strings.HasPrefix(line, "Device ID:"):
+			flush()
+			current = &models.Neighbor{
+				RemoteName: strings.TrimSpace(strings.TrimPrefix(line, "Device ID:")),
+				Protocol:   "cdp",
+			}
+			entryAddr, mgmtAddr, inMgmt = "", "", false
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "Management address") || strings.HasPrefix(line, "Mgmt address"):
+			inMgmt = true
+		case strings.HasPrefix(line, "Entry address") || strings.HasPrefix(line, "Interface address"):
+			inMgmt = false
+		case strings.HasPrefix(line, "IP address:") || strings.HasPrefix(line, "IPv4 Address:"):
+			if m := ipv4Re.FindString(line); m != "" {
+				if inMgmt && mgmtAddr == "" {
+					mgmtAddr = m
+				} else if !inMgmt && entryAddr == "" {
+					entryAddr = m
+				}
+			}
+		case strings.HasPrefix(line, "Platform:"):
+			// "Platform: cisco WS-C2960X-48TS-L,  Capabilities: Switch IGMP"
+			value := strings.TrimPrefix(line, "Platform:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			current.Platform = value
+		case strings.HasPrefix(line, "Interface:"):
+			// "Interface: GigabitEthernet1/0/1,  Port ID (outgoing port): GigabitEthernet0/1"
+			parts := strings.SplitN(strings.TrimPrefix(line, "Interface:"), ",", 2)
+			current.LocalInterface = strings.TrimSpace(parts[0])
+			if len(parts) == 2 {
+				if i := strings.Index(parts[1], ":"); i >= 0 {
+					current.RemoteInterface = strings.TrimSpace(parts[1][i+1:])
+				}
+			}
+		}
+	}
+	flush()
+
+	return neighbors
+}
+
+// ParseLLDPNeighbors parses the output of "show lldp neighbors detail" (IOS, NX-OS and EOS formats).
+func ParseLLDPNeighbors(output string) []models.Neighbor {
+	var neighbors []models.Neighbor
+	var current *models.Neighbor
+	hasChassis := false
+	inDescription := false
+	inMgmt := false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if current.RemoteName != "" || current.RemoteAddress != "" {
+			current.Platform = strings.TrimSpace(current.Platform)
+			neighbors = append(neighbors, *current)
+		}
+		current = nil
+	}
+	start := func() {
+		flush()
+		current = &models.Neighbor{Protocol: "lldp"}
+		hasChassis, inDescription, inMgmt = false, false, false
+	}
+
+	for _, raw := range strings.Split(output, "\n") {
+		// EOS prefixes most fields with "- ".
+		line := strings.TrimPrefix(strings.TrimSpace(raw), "- ")
+		key, value, hasValue := splitField(line)
+
+		// A new entry starts either at its local interface (IOS) or at a second chassis id (NX-OS).
+		switch {
+		case key == "local intf" || key == "local port id" || (strings.HasPrefix(line, "Interface") && strings.Contains(line, "detected")):
+			if current == nil || current.LocalInterface != "" {
+				start()
+			}
+		case key == "chassis id" && (current == nil || hasChassis):
+			start()
+		}
+		if current == nil {
+			continue
+		}
+
+		if inDescription {
+			if line == "" || hasValue {
+				inDescription = false
+			} else {
+				current.Platform += " " + line
+				continue
+			}
+		}
+
+		switch key {
+		case "local intf", "local port id":
+			current.LocalInterface = value
+		case "chassis id":
+			hasChassis = true
+		case "port id":
+			current.RemoteInterface = strings.Trim(value, `"`)
+		case "system name":
+			current.RemoteName = strings.Trim(value, `"`)
+		case "system description":
+			current.Platform = strings.Trim(value, `"`)
+			inDescription = value == ""
+		case "management addresses", "management address", "management address(es)":
+			inMgmt = true
+			if m := ipv4Re.FindString(value); m != "" && current.RemoteAddress == "" {
+				current.RemoteAddress = m
+				inMgmt = false
+			}
+		default:
+			if strings.HasPrefix(line, "Interface") && strings.Contains(line, "detected") {
+				// EOS: "Interface Ethernet1 detected 1 LLDP neighbors:"
+				fields := strings.Fields(line)
+				if len(fields) > 1 {
+					current.LocalInterface = fields[1]
+				}
+			} else if inMgmt && current.RemoteAddress == "" {
+				if m := ipv4Re.FindString(line); m != "" {
+					current.RemoteAddress = m
+					inMgmt = false
+				}
+			}
+		}
+	}
+	flush()
+
+	return neighbors
+}
+
+// splitField splits a "Key: value" line into a lower-cased key and its trimmed value.
+func splitField(line string) (key, value string, ok bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	value = strings.TrimSpace(line[i+1:])
+	return key, value, true
+}
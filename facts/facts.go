@@ -0,0 +1,197 @@
+// Package facts collects and parses device facts such as model, serial number and OS version.
+package facts
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/connectors"
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// rule extracts one fact from the output of one command.
+type rule struct {
+	cmd   string
+	field string
+	re    *regexp.Regexp
+}
+
+// platformSpec describes how to collect facts on a platform.
+type platformSpec struct {
+	vendor   string
+	commands []string
+	rules    []rule
+}
+
+var specs = map[string]platformSpec{
+	models.PlatformCiscoIOS: {
+		vendor:   "Cisco",
+		commands: []string{"show version"},
+		rules: []rule{
+			{"show version", "hostname", regexp.MustCompile(`(?m)^(\S+) uptime is`)},
+			{"show version", "uptime", regexp.MustCompile(`(?m)uptime is (.+)$`)},
+			{"show version", "os_version", regexp.MustCompile(`Version ([^\s,]+)`)},
+			{"show version", "model", regexp.MustCompile(`(?mi)^Model number\s*:\s*(\S+)`)},
+			{"show version", "model", regexp.MustCompile(`(?m)^[Cc]isco (\S+) \(.+\) processor`)},
+			{"show version", "serial", regexp.MustCompile(`(?mi)^System serial number\s*:\s*(\S+)`)},
+			{"show version", "serial", regexp.MustCompile(`(?m)Processor board ID (\S+)`)},
+		},
+	},
+	models.PlatformCiscoNXOS: {
+		vendor:   "Cisco",
+		commands: []string{"show version"},
+		rules: []rule{
+			{"show version", "hostname", regexp.MustCompile(`(?m)^\s*Device name:\s*(\S+)`)},
+			{"show version", "uptime", regexp.MustCompile(`(?m)^Kernel uptime is (.+)$`)},
+			{"show version", "os_version", regexp.MustCompile(`(?m)^\s*(?:NXOS|system):\s+version (\S+)`)},
+			{"show version", "model", regexp.MustCompile(`(?m)^\s*cisco (.+?) [Cc]hassis`)},
+			{"show version", "serial", regexp.MustCompile(`(?mi)Processor Board ID (\S+)`)},
+		},
+	},
+	models.PlatformJunOS: {
+		vendor:   "Juniper",
+		commands: []string{"show version", "show chassis hardware", "show system uptime"},
+		rules: []rule{
+			{"show version", "hostname", regexp.MustCompile(`(?m)^Hostname:\s*(\S+)`)},
+			{"show version", "model", regexp.MustCompile(`(?m)^Model:\s*(\S+)`)},
+			{"show version", "os_version", regexp.MustCompile(`(?m)^Junos:\s*(\S+)`)},
+			{"show version", "os_version", regexp.MustCompile(`\[(\d+\.\d+[^\]]*)\]`)},
+			{"show chassis hardware", "serial", regexp.MustCompile(`(?m)^Chassis\s+(\S+)`)},
+			{"show system uptime", "uptime", regexp.MustCompile(`(?m)^System booted:.*\((.+) ago\)`)},
+		},
+	},
+	models.PlatformAristaEOS: {
+		vendor:   "Arista",
+		commands: []string{"show version", "show hostname"},
+		rules: []rule{
+			{"show hostname", "hostname", regexp.MustCompile(`(?m)^Hostname:\s*(\S+)`)},
+			{"show version", "model", regexp.MustCompile(`(?m)^Arista (\S+)`)},
+			{"show version", "serial", regexp.MustCompile(`(?m)^Serial number:\s*(\S+)`)},
+			{"show version", "os_version", regexp.MustCompile(`(?m)^Software image version:\s*(\S+)`)},
+			{"show version", "uptime", regexp.MustCompile(`(?m)^Uptime:\s*(.+)$`)},
+		},
+	},
+}
+
+// Commands returns the commands that collect facts on a platform.
+// Unknown platforms fall back to "show version".
+func Commands(platform string) []string {
+	if spec, ok := specs[platform]; ok {
+		return spec.commands
+	}
+	return []string{"show version"}
+}
+
+// Parse extracts facts from command results. Unknown platforms are matched
+// against the rules of every known platform and the first match wins.
+func Parse(host, platform string, results []models.Result) models.DeviceFacts {
+	outputs := make(map[string]string, len(results))
+	for _, r := range results {
+		outputs[r.Cmd] = r.Output
+	}
+
+	f := models.DeviceFacts{Host: host, CollectedAt: time.Now()}
+
+	candidates := []string{platform}
+	if _, ok := specs[platform]; !ok {
+		candidates = []string{models.PlatformCiscoIOS, models.PlatformCiscoNXOS, models.PlatformAristaEOS, models.PlatformJunOS}
+	}
+
+	for _, p := range candidates {
+		spec := specs[p]
+		matched := false
+		for _, r := range spec.rules {
+			m := r.re.FindStringSubmatch(outputs[r.cmd])
+			if m == nil {
+				continue
+			}
+			value := strings.TrimSpace(m[1])
+			if setField(&f, r.field, value) {
+				matched = true
+			}
+		}
+		if matched {
+			f.Vendor = spec.vendor
+			break
+		}
+	}
+
+	f.UptimeSeconds = int64(ParseUptime(f.Uptime).Seconds())
+	return f
+}
+
+// setField sets a fact unless an earlier rule already set it, and reports whether it did.
+func setField(f *models.DeviceFacts, field, value string) bool {
+	var target *string
+	switch field {
+	case "hostname":
+		target = &f.Hostname
+	case "model":
+		target = &f.Model
+	case "serial":
+		target = &f.SerialNumber
+	case "os_version":
+		target = &f.OSVersion
+	case "uptime":
+		target = &f.Uptime
+	default:
+		return false
+	}
+	if *target != "" || value == "" {
+		return false
+	}
+	*target = value
+	return true
+}
+
+var uptimeUnitRe = regexp.MustCompile(`(\d+)\s*(year|week|day|hour|minute|second)s?(?:\(s\))?`)
+
+// junosUptimeRe matches compact JunOS uptimes such as "1w2d 03:04" or "3d 10:15".
+var junosUptimeRe = regexp.MustCompile(`^(?:(\d+)w)?(?:(\d+)d)?\s*(\d+):(\d+)(?::(\d+))?$`)
+
+// ParseUptime converts a human-readable uptime into a duration.
+// It understands "1 year, 2 weeks, 3 days, 4 hours, 5 minutes" (IOS, NX-OS, EOS) and "1w2d 03:04" (JunOS).
+func ParseUptime(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if m := junosUptimeRe.FindStringSubmatch(s); m != nil {
+		n := func(i int) time.Duration {
+			v, _ := strconv.Atoi(m[i])
+			return time.Duration(v)
+		}
+		return n(1)*7*24*time.Hour + n(2)*24*time.Hour + n(3)*time.Hour + n(4)*time.Minute + n(5)*time.Second
+	}
+
+	var total time.Duration
+	for _, m := range uptimeUnitRe.FindAllStringSubmatch(s, -1) {
+		v, _ := strconv.Atoi(m[1])
+		d := time.Duration(v)
+		switch m[2] {
+		case "year":
+			total += d * 365 * 24 * time.Hour
+		case "week":
+			total += d * 7 * 24 * time.Hour
+		case "day":
+			total += d * 24 * time.Hour
+		case "hour":
+			total += d * time.Hour
+		case "minute":
+			total += d * time.Minute
+		case "second":
+			total += d * time.Second
+		}
+	}
+	return total
+}
+
+// Collect connects to a device, runs the platform's fact commands and parses the output.
+func Collect(ctx context.Context, connector connectors.Connector, dev models.Device) (models.DeviceFacts, error) {
+	results, err := connector.RunCommands(ctx, Commands(dev.Platform))
+	if err != nil {
+		return models.DeviceFacts{}, fmt.Errorf("failed to run fact commands: %w", err)
+	}
+	return Parse(dev.Host, dev.Platform, results), nil
+}
@@ -0,0 +1,115 @@
+// Package golden renders the intended ("golden") configuration of a device from
+// per-role Go templates.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// TemplateExt is the file extension of golden config templates.
+const TemplateExt = ".tmpl"
+
+// ErrNoRole is returned for devices that have no role assigned.
+var ErrNoRole = errors.New("device has no role")
+
+// Data is passed to the templates.
+type Data struct {
+	Host     string
+	Platform string
+	Role     string
+	Tags     []string
+	Vars     map[string]string
+}
+
+// Renderer renders templates from a directory holding one <role>.tmpl file per
+// role. All templates in the directory are parsed together, so a role template
+// can include shared snippets with {{template "common.tmpl" .}}.
+type Renderer struct {
+	dir string
+}
+
+// NewRenderer creates a renderer for the templates in dir.
+func NewRenderer(dir string) *Renderer {
+	return &Renderer{dir: dir}
+}
+
+// Roles lists the roles that have a template.
+func (r *Renderer) Roles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*"+TemplateExt))
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(files))
+	for _, f := range files {
+		roles = append(roles, strings.TrimSuffix(filepath.Base(f), TemplateExt))
+	}
+	return roles, nil
+}
+
+// Render renders the template of the device's role with its variables.
+// Referencing a variable that is not set is an error.
+func (r *Renderer) Render(dev models.Device, vars map[string]string) (string, error) {
+	if dev.Role == "" {
+		return "", ErrNoRole
+	}
+	name := dev.Role + TemplateExt
+	if _, err := os.Stat(filepath.Join(r.dir, name)); err != nil {
+		return "", fmt.Errorf("no template for role '%s': %w", dev.Role, err)
+	}
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(funcs(dev)).
+		ParseGlob(filepath.Join(r.dir, "*"+TemplateExt))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, newData(dev, vars)); err != nil {
+		return "", fmt.Errorf("failed to render template for role '%s': %w", dev.Role, err)
+	}
+	return buf.String(), nil
+}
+
+// RenderText renders a single template, such as a change snippet, with the
+// same data and functions as the role templates.
+func RenderText(text string, dev models.Device, vars map[string]string) (string, error) {
+	tmpl, err := template.New("snippet").Option("missingkey=error").Funcs(funcs(dev)).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newData(dev, vars)); err != nil {
+		return "", fmt.Errorf("failed to render template for %s: %w", dev.Host, err)
+	}
+	return buf.String(), nil
+}
+
+func newData(dev models.Device, vars map[string]string) Data {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	return Data{
+		Host:     dev.Host,
+		Platform: dev.Platform,
+		Role:     dev.Role,
+		Tags:     dev.Tags,
+		Vars:     vars,
+	}
+}
+
+func funcs(dev models.Device) template.FuncMap {
+	return template.FuncMap{
+		"hasTag": dev.HasTag,
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Agent is a remote worker that backs up the devices of its sites from a
+// network segment the server cannot reach. A device belongs to a site when it
+// is tagged with the site name.
+type Agent struct {
+	Name        string    `json:"name"`
+	Sites       []string  `json:"sites"`
+	Healthy     bool      `json:"healthy"`
+	Jobs        []string  `json:"jobs"` // hosts being backed up by the agent
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// AgentRegistration is sent by an agent when it connects.
+type AgentRegistration struct {
+	Name  string   `json:"name"`
+	Sites []string `json:"sites"`
+}
+
+// AgentJob is a backup job handed to an agent: the commands to run on a
+// device. The agent resolves the device's password_env in its own environment.
+type AgentJob struct {
+	ID       int64    `json:"id"`
+	Device   Device   `json:"device"`
+	Commands []string `json:"commands"`
+}
+
+// AgentResult is the outcome of an agent job: the command output, or the
+// error and its failure category.
+type AgentResult struct {
+	Results  []Result `json:"results,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Category string   `json:"category,omitempty"`
+}
+
+// AgentHeartbeat is the answer to an agent heartbeat: the jobs the agent
+// should stop, because they were cancelled or given to another agent.
+type AgentHeartbeat struct {
+	Cancel []int64 `json:"cancel"`
+}
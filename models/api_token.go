@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// API token scopes. A read-only token can read everything a viewer can, a
+// run-backup token can also start backup runs, and an admin token can do
+// everything an admin can. An agent token can only use the endpoints of
+// remote agents, and only admins may create one since jobs carry device
+// credentials.
+const (
+	ScopeReadOnly  = "read-only"
+	ScopeRunBackup = "run-backup"
+	ScopeAdmin     = "admin"
+	ScopeAgent     = "agent"
+)
+
+// TokenScopes lists the token scopes, the user scopes from least to most
+// privileged followed by the agent scope.
+var TokenScopes = []string{ScopeReadOnly, ScopeRunBackup, ScopeAdmin, ScopeAgent}
+
+// ScopeRole returns the user role a token scope grants, or "" for unknown scopes.
+func ScopeRole(scope string) string {
+	switch scope {
+	case ScopeReadOnly:
+		return RoleViewer
+	case ScopeRunBackup:
+		return RoleOperator
+	case ScopeAdmin:
+		return RoleAdmin
+	case ScopeAgent:
+		return RoleAgent
+	}
+	return ""
+}
+
+// RoleScopes returns the token scopes a user with the given role may create.
+func RoleScopes(role string) []string {
+	var scopes []string
+	for _, scope := range TokenScopes {
+		if RoleAllows(role, ScopeRole(scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// API token kinds. Personal tokens act for their owner and never get more
+// rights than the owner has; service tokens belong to no user.
+const (
+	TokenPersonal = "personal"
+	TokenService  = "service"
+)
+
+// APIToken is a bearer token for API clients. Only a hash of the secret is stored.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	Owner      string     `json:"owner,omitempty"` // creating user; the user a personal token acts for
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"` // start of the secret, to tell tokens apart
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the token can be used at the given time.
+func (t APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Audit actions.
+const (
+	AuditPush     = "push"
+	AuditConfirm  = "confirm"
+	AuditRollback = "rollback"
+)
+
+// AuditEntry records a change made to a device.
+type AuditEntry struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Action  string    `json:"action"`
+	Host    string    `json:"host"`
+	Source  string    `json:"source"`
+	Status  string    `json:"status"`
+	Details string    `json:"details,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// BackupRequest asks for a backup of some devices, typically from an
+// automation pipeline after a deploy. Hosts, when set, takes precedence over
+// Selector.
+type BackupRequest struct {
+	Hosts    []string       `json:"hosts,omitempty"`
+	Selector DeviceSelector `json:"selector"`
+	// IdempotencyKey makes retried requests return the first answer instead
+	// of queueing the backups again.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// CallbackURL receives a BackupCallback once every device is done.
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// BackupTicket is the answer to a backup request.
+type BackupTicket struct {
+	RunID int64    `json:"run_id"`
+	Hosts []string `json:"hosts"`
+	// Deduplicated maps the hosts that were already waiting in another run to its ID.
+	Deduplicated map[string]int64 `json:"deduplicated,omitempty"`
+}
+
+// BackupCallback is posted to the callback URL of a backup request.
+type BackupCallback struct {
+	IdempotencyKey string      `json:"idempotency_key,omitempty"`
+	RunID          int64       `json:"run_id"`
+	Status         string      `json:"status"` // RunResultSuccess if every device was backed up, else RunResultFailed
+	Results        []RunResult `json:"results"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Change job statuses.
+const (
+	JobPending          = "pending"
+	JobAwaitingApproval = "awaiting_approval"
+	JobRunning          = "running"
+	JobCompleted        = "completed"
+	JobAborted          = "aborted"
+)
+
+// Change job result statuses of a single device.
+const (
+	ChangeSuccess   = "success"
+	ChangeFailed    = "failed"
+	ChangeSkipped   = "skipped"
+	ChangeUnchanged = "unchanged"
+)
+
+// Change job stages.
+const (
+	StageCanary  = "canary"
+	StageRollout = "rollout"
+)
+
+// ChangeJob pushes a templated configuration snippet to a set of devices.
+type ChangeJob struct {
+	ID       int64          `json:"id"`
+	Name     string         `json:"name"`
+	User     string         `json:"user"`
+	Template string         `json:"template"`
+	Selector DeviceSelector `json:"selector"`
+	// Canary is the number of devices changed first; the rest waits for approval.
+	Canary int `json:"canary"`
+	// MaxFailures aborts the job once more devices than this have failed.
+	MaxFailures    int           `json:"max_failures"`
+	ConfirmTimeout time.Duration `json:"confirm_timeout"`
+	Force          bool          `json:"force"`
+	Status         string        `json:"status"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// ChangeJobResult is the outcome of a change job on one device.
+type ChangeJobResult struct {
+	JobID      int64     `json:"job_id"`
+	Host       string    `json:"host"`
+	Stage      string    `json:"stage"`
+	Status     string    `json:"status"`
+	PushID     int64     `json:"push_id,omitempty"`
+	PreBackup  string    `json:"pre_backup,omitempty"`
+	PostBackup string    `json:"post_backup,omitempty"`
+	Added      int       `json:"added"`
+	Removed    int       `json:"removed"`
+	Message    string    `json:"message,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
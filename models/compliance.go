@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Compliance severities, from least to most severe.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Severities lists the compliance severities from least to most severe.
+var Severities = []string{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// SeverityRank returns the position of a severity in Severities, or -1 for an unknown one.
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// ComplianceResult is the outcome of one policy rule evaluated against one device.
+type ComplianceResult struct {
+	Host        string    `json:"host"`
+	Policy      string    `json:"policy"`
+	RuleID      string    `json:"rule_id"`
+	Description string    `json:"description"`
+	Severity    string    `json:"severity"`
+	Passed      bool      `json:"passed"`
+	Message     string    `json:"message,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
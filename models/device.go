@@ -1,6 +1,19 @@
 // Package models defines the data structures used throughout the application.
 package models
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Device statuses. An empty status is treated as active so that devices
+// created before statuses existed keep being backed up.
+const (
+	DeviceStatusActive  = "active"
+	DeviceStatusPending = "pending"
+)
+
 // Device represents a network device to be backed up.
 // It contains connection details, credentials, and the commands to be executed.
 type Device struct {
@@ -14,4 +27,89 @@ type Device struct {
 	Prompt             string   `json:"prompt,omitempty"`
 	TimeoutSeconds     int      `json:"timeout_seconds,omitempty"`
 	AllowInsecureAlgos bool     `json:"allow_insecure_algos,omitempty"`
+	Platform           string   `json:"platform,omitempty"`
+	Status             string   `json:"status,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
+	Role               string   `json:"role,omitempty"`
+
+	// HTTP configures devices with the http protocol.
+	HTTP *HTTPSettings `json:"http,omitempty"`
+}
+
+// Authentication schemes of devices with the http protocol.
+const (
+	HTTPAuthNone  = "none"
+	HTTPAuthBasic = "basic" // username and password in every request
+	HTTPAuthToken = "token" // the password is an API token sent in a header
+	HTTPAuthLogin = "login" // a login request returns a session cookie
+)
+
+// HTTPSettings configures how a device with the http protocol is reached.
+// The password, or the token of the token scheme, comes from the device's
+// password or password_env.
+type HTTPSettings struct {
+	Scheme string `json:"scheme,omitempty"` // https (default) or http
+	Auth   string `json:"auth,omitempty"`   // one of the HTTPAuth* schemes, default basic
+	// TokenHeader is the header of the token scheme. The default,
+	// Authorization, sends "Bearer <token>"; other headers send the token as is.
+	TokenHeader string `json:"token_header,omitempty"`
+	// LoginPath is where the login scheme posts the username and password as
+	// a form, in LoginUserField and LoginPasswordField (default username and
+	// password). LogoutPath, if set, is requested at the end.
+	LoginPath          string            `json:"login_path,omitempty"`
+	LoginUserField     string            `json:"login_user_field,omitempty"`
+	LoginPasswordField string            `json:"login_password_field,omitempty"`
+	LogoutPath         string            `json:"logout_path,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"` // sent with every request, e.g. Accept
+	CAFile             string            `json:"ca_file,omitempty"` // PEM file of the CAs trusted for the device
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty"`
+}
+
+// Validate checks the scheme and authentication settings.
+func (s *HTTPSettings) Validate() error {
+	switch s.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unknown http scheme '%s' (http or https)", s.Scheme)
+	}
+	switch s.Auth {
+	case "", HTTPAuthNone, HTTPAuthBasic, HTTPAuthToken:
+	case HTTPAuthLogin:
+		if s.LoginPath == "" {
+			return errors.New("the login auth scheme needs a login_path")
+		}
+	default:
+		return fmt.Errorf("unknown http auth '%s' (none, basic, token or login)", s.Auth)
+	}
+	return nil
+}
+
+// Protocols lists the connection protocols of devices.
+var Protocols = []string{"ssh", "telnet", "netconf", "http"}
+
+// IsPending reports whether the device was discovered but not yet approved for backups.
+func (d Device) IsPending() bool {
+	return d.Status == DeviceStatusPending
+}
+
+// HasTag reports whether the device carries the given tag.
+func (d Device) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags splits a comma-separated list of tags, dropping empty entries.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DeviceFacts holds hardware and software details collected from a device.
+type DeviceFacts struct {
+	Host          string    `json:"host"`
+	Hostname      string    `json:"hostname"`
+	Vendor        string    `json:"vendor"`
+	Model         string    `json:"model"`
+	SerialNumber  string    `json:"serial_number"`
+	OSVersion     string    `json:"os_version"`
+	Uptime        string    `json:"uptime"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	CollectedAt   time.Time `json:"collected_at"`
+}
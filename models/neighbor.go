@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Neighbor is a single CDP or LLDP adjacency seen from a device in the inventory.
+type Neighbor struct {
+	LocalHost       string    `json:"local_host"`
+	LocalInterface  string    `json:"local_interface"`
+	RemoteName      string    `json:"remote_name"`
+	RemoteAddress   string    `json:"remote_address,omitempty"`
+	RemoteInterface string    `json:"remote_interface"`
+	Platform        string    `json:"platform,omitempty"`
+	Protocol        string    `json:"protocol"` // "cdp" or "lldp"
+	DiscoveredAt    time.Time `json:"discovered_at"`
+}
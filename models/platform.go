@@ -0,0 +1,43 @@
+package models
+
+import "strings"
+
+// Platform identifiers used to select platform-specific commands and parsers.
+const (
+	PlatformGeneric   = "generic"
+	PlatformCiscoIOS  = "cisco_ios"
+	PlatformCiscoNXOS = "cisco_nxos"
+	PlatformJunOS     = "juniper_junos"
+	PlatformAristaEOS = "arista_eos"
+)
+
+// Platforms lists every platform identifier known to the application.
+var Platforms = []string{PlatformGeneric, PlatformCiscoIOS, PlatformCiscoNXOS, PlatformJunOS, PlatformAristaEOS}
+
+// ValidPlatform reports whether platform is a known platform identifier.
+func ValidPlatform(platform string) bool {
+	for _, p := range Platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectPlatform guesses a platform identifier from a free-form description,
+// such as a CDP "Platform" field or an LLDP "System Description".
+func DetectPlatform(description string) string {
+	d := strings.ToLower(description)
+	switch {
+	case strings.Contains(d, "nx-os") || strings.Contains(d, "nexus") || strings.Contains(d, "n9k") || strings.Contains(d, "n7k"):
+		return PlatformCiscoNXOS
+	case strings.Contains(d, "cisco"):
+		return PlatformCiscoIOS
+	case strings.Contains(d, "junos") || strings.Contains(d, "juniper"):
+		return PlatformJunOS
+	case strings.Contains(d, "arista"):
+		return PlatformAristaEOS
+	default:
+		return PlatformGeneric
+	}
+}
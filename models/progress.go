@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Progress event types. A run starts with ProgressRunStarted and a
+// ProgressQueued event per device, and ends with ProgressRunFinished. Each
+// device ends with ProgressSaved, ProgressUnchanged, ProgressFailed or
+// ProgressCancelled.
+const (
+	ProgressRunStarted  = "run_started"
+	ProgressQueued      = "queued"
+	ProgressConnecting  = "connecting"
+	ProgressCommand     = "command"
+	ProgressRetrying    = "retrying"
+	ProgressSaved       = "saved"
+	ProgressUnchanged   = "unchanged"
+	ProgressFailed      = "failed"
+	ProgressCancelled   = "cancelled"
+	ProgressRunFinished = "run_finished"
+)
+
+// ProgressEvent reports the progress of a backup run. Every event carries the
+// run totals, so a client joining mid-run can draw a progress bar from any of them.
+type ProgressEvent struct {
+	Type       string    `json:"type"`
+	RunID      int64     `json:"run_id"`
+	Host       string    `json:"host,omitempty"`
+	Command    string    `json:"command,omitempty"`     // for ProgressCommand
+	BackupFile string    `json:"backup_file,omitempty"` // for ProgressSaved and ProgressUnchanged
+	Error      string    `json:"error,omitempty"`       // for ProgressFailed and ProgressRetrying
+	Attempt    int       `json:"attempt,omitempty"`     // for ProgressRetrying, the attempt about to start
+	Done       int       `json:"done"`                  // devices finished so far
+	Failed     int       `json:"failed"`                // devices failed so far
+	Cancelled  int       `json:"cancelled"`             // devices cancelled so far
+	Total      int       `json:"total"`
+	StartedAt  time.Time `json:"started_at"` // start of the run
+	Time       time.Time `json:"time"`
+}
+
+// Finished reports whether the event ends the backup of a device.
+func (e ProgressEvent) Finished() bool {
+	switch e.Type {
+	case ProgressSaved, ProgressUnchanged, ProgressFailed, ProgressCancelled:
+		return true
+	}
+	return false
+}
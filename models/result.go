@@ -5,4 +5,17 @@ package models
 type Result struct {
 	Cmd    string
 	Output string
-}
\ No newline at end of file
+	// File is the file a fetch command copied from the device. Output then
+	// holds its content if it is text, or a description of it.
+	File *FetchedFile `json:",omitempty"`
+}
+
+// FetchedFile is a file copied from a device and saved next to the text
+// backup. The manifest of a backup lists the saved files without their data.
+type FetchedFile struct {
+	Path   string `json:"path"`           // path on the device
+	Name   string `json:"name,omitempty"` // name of the saved copy
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Data   []byte `json:"data,omitempty"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Backup run statuses.
+const (
+	RunQueued    = "queued" // waiting for the run in progress to finish
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunCancelled = "cancelled"
+)
+
+// Backup run result statuses, matching the job metric labels.
+const (
+	RunResultSuccess   = "success"
+	RunResultFailed    = "failed"
+	RunResultCancelled = "cancelled"
+)
+
+// States of the device jobs of a run in the persistent job queue.
+const (
+	RunJobPending   = "pending"
+	RunJobRunning   = "running"
+	RunJobDone      = "done"
+	RunJobFailed    = "failed"
+	RunJobCancelled = "cancelled"
+)
+
+// RunJob is the queued backup of one device of a run.
+type RunJob struct {
+	RunID      int64      `json:"run_id"`
+	Host       string     `json:"host"`
+	State      string     `json:"state"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// ClaimedBy is the process that queued or runs the job, and LeaseUntil
+	// when another process may take it over unless the lease is renewed.
+	ClaimedBy  string     `json:"claimed_by,omitempty"`
+	LeaseUntil *time.Time `json:"lease_until,omitempty"`
+}
+
+// Failure categories of a failed run result, also used as the category label
+// of the job metrics. Successful and cancelled results have no category.
+const (
+	FailureDialTimeout       = "dial_timeout"       // the host did not answer, or could not be reached
+	FailureConnectionRefused = "connection_refused" // nothing listens on the port
+	FailureAuth              = "auth_failed"        // the device rejected the credentials
+	FailureHostKey           = "host_key_mismatch"  // the SSH host key is unknown or changed
+	FailurePromptTimeout     = "prompt_timeout"     // the device stopped answering during the session
+	FailureCommand           = "command_error"      // a command or saving its output failed
+	FailureNoAgent           = "agent_unavailable"  // no agent of the device's site is connected
+	FailureUploadTimeout     = "upload_timeout"     // the device did not upload an exported file in time
+)
+
+// Run is one backup run over a set of devices.
+type Run struct {
+	ID         int64          `json:"id"`
+	Trigger    string         `json:"trigger"`              // what started the run, e.g. "cli", "web" or "api"
+	ChangedBy  string         `json:"changed_by,omitempty"` // for "syslog" runs, who changed the device
+	Selector   DeviceSelector `json:"selector"`
+	Status     string         `json:"status"`
+	Total      int            `json:"total"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Cancelled  int            `json:"cancelled"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// RunResult is the outcome of backing up one device in a run.
+type RunResult struct {
+	RunID           int64     `json:"run_id"`
+	Host            string    `json:"host"`
+	Status          string    `json:"status"`
+	BackupFile      string    `json:"backup_file,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Category        string    `json:"category,omitempty"` // for failed results
+	Attempts        int       `json:"attempts"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	FinishedAt      time.Time `json:"finished_at"`
+}
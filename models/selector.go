@@ -0,0 +1,41 @@
+package models
+
+import "path/filepath"
+
+// DeviceSelector selects devices by host pattern, tag, platform and role. Each
+// non-empty list must match; within a list any entry matches.
+type DeviceSelector struct {
+	Hosts     []string `json:"hosts,omitempty"` // shell patterns, e.g. "sw-*"
+	Tags      []string `json:"tags,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// Matches reports whether the device is selected.
+func (s DeviceSelector) Matches(dev Device) bool {
+	if len(s.Hosts) > 0 && !anyMatch(s.Hosts, func(p string) bool {
+		ok, _ := filepath.Match(p, dev.Host)
+		return ok
+	}) {
+		return false
+	}
+	if len(s.Tags) > 0 && !anyMatch(s.Tags, dev.HasTag) {
+		return false
+	}
+	if len(s.Platforms) > 0 && !anyMatch(s.Platforms, func(p string) bool { return p == dev.Platform }) {
+		return false
+	}
+	if len(s.Roles) > 0 && !anyMatch(s.Roles, func(r string) bool { return r == dev.Role }) {
+		return false
+	}
+	return true
+}
+
+func anyMatch(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Web user roles, from least to most privileged. Viewers can browse devices
+// and backups, operators can also run backups and push configurations, and
+// admins can also change the inventory and manage users.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// RoleAgent is the role of agent tokens. It is not a user role: it only
+// allows the endpoints remote agents use, which admins may use as well.
+const RoleAgent = "agent"
+
+// UserRoles lists the user roles from least to most privileged.
+var UserRoles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// ValidUserRole reports whether role is a known user role.
+func ValidUserRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// RoleAllows reports whether a user with role have may do what requires role need.
+func RoleAllows(have, need string) bool {
+	if need == RoleAgent {
+		return have == RoleAgent || have == RoleAdmin
+	}
+	return ValidUserRole(have) && roleRank(have) >= roleRank(need)
+}
+
+func roleRank(role string) int {
+	for i, r := range UserRoles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// User is a local account of the web interface.
+type User struct {
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
@@ -7,18 +7,20 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/cobrich/netcfg-backup/models"
 	"github.com/cobrich/netcfg-backup/utils"
 )
 
 var (
 	// JobsTotal - a counter for the total number of backup jobs processed.
-	// Labels: host, status (success/failed)
+	// Labels: host, status (success/failed/cancelled), category (failure
+	// category of failed jobs, empty otherwise)
 	JobsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "netcfg_backup_jobs_total",
 			Help: "Total number of backup jobs processed.",
 		},
-		[]string{"host", "status"},
+		[]string{"host", "status", "category"},
 	)
 
 	// JobDuration - a histogram of the backup job duration in seconds.
@@ -31,8 +33,52 @@ var (
 		},
 		[]string{"host"},
 	)
+
+	// DeviceInfo - an info metric with the latest collected facts of a device. Its value is always 1.
+	// Labels: host, hostname, vendor, model, serial, os_version
+	DeviceInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "netcfg_backup_device_info",
+			Help: "Hardware and software facts of a device.",
+		},
+		[]string{"host", "hostname", "vendor", "model", "serial", "os_version"},
+	)
+
+	// DeviceUptime - the device uptime in seconds as of the last facts collection.
+	// Labels: host
+	DeviceUptime = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "netcfg_backup_device_uptime_seconds",
+			Help: "Device uptime in seconds at the last facts collection.",
+		},
+		[]string{"host"},
+	)
+
+	// ComplianceViolations - the number of failed compliance rules of a device at the last check.
+	// Labels: host, severity
+	ComplianceViolations = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "netcfg_backup_compliance_violations",
+			Help: "Number of compliance rule violations at the last check.",
+		},
+		[]string{"host", "severity"},
+	)
 )
 
+// SetComplianceViolations exports the violation counts of a device, keyed by severity.
+func SetComplianceViolations(host string, counts map[string]int) {
+	for severity, n := range counts {
+		ComplianceViolations.WithLabelValues(host, severity).Set(float64(n))
+	}
+}
+
+// SetDeviceFacts exports the facts of a device, replacing any previous info series for the host.
+func SetDeviceFacts(f models.DeviceFacts) {
+	DeviceInfo.DeletePartialMatch(prometheus.Labels{"host": f.Host})
+	DeviceInfo.WithLabelValues(f.Host, f.Hostname, f.Vendor, f.Model, f.SerialNumber, f.OSVersion).Set(1)
+	DeviceUptime.WithLabelValues(f.Host).Set(float64(f.UptimeSeconds))
+}
+
 // StartMetricsServer starts an HTTP server to expose Prometheus metrics.
 func StartMetricsServer() {
 	http.Handle("/metrics", promhttp.Handler())
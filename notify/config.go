@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Defaults of the notification settings.
+const (
+	DefaultFailureThreshold = 3
+	DefaultRateLimit        = 30 * time.Minute
+)
+
+// Config is the notification configuration file.
+//
+//	failure_threshold: 3   # consecutive failures before device_failed
+//	rate_limit: 30m        # minimum time between similar notifications
+//	notifiers:
+//	  - name: noc-chat
+//	    type: slack        # webhook, email, slack, mattermost or teams
+//	    url: https://hooks.slack.com/services/...
+//	  - name: noc-mail
+//	    type: email
+//	    smtp: localhost:1025
+//	    from: netcfg-backup@example.com
+//	    to: [noc@example.com]
+//	routes:
+//	  - notifiers: [noc-chat]
+//	    events: [device_failed, device_recovered]
+//	    tags: [core]
+//	  - notifiers: [noc-mail]
+//	    min_severity: high
+type Config struct {
+	FailureThreshold int              `yaml:"failure_threshold"`
+	RateLimit        string           `yaml:"rate_limit"`
+	Notifiers        []NotifierConfig `yaml:"notifiers"`
+	Routes           []Route          `yaml:"routes"`
+}
+
+// NotifierConfig configures one notifier. URL is used by the webhook and chat
+// types, the other fields by email. The SMTP password is read from the
+// environment variable named by PasswordEnv.
+type NotifierConfig struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	URL         string   `yaml:"url"`
+	SMTP        string   `yaml:"smtp"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	Username    string   `yaml:"username"`
+	PasswordEnv string   `yaml:"password_env"`
+}
+
+// Route sends the events matching all of its non-empty conditions to its
+// notifiers: one of the event types, at least the minimum severity and, for
+// devices, one of the tags.
+type Route struct {
+	Notifiers   []string `yaml:"notifiers"`
+	Events      []string `yaml:"events"`
+	MinSeverity string   `yaml:"min_severity"`
+	Tags        []string `yaml:"tags"`
+}
+
+// LoadConfig reads a notification configuration file and builds its dispatcher.
+func LoadConfig(file string) (*Dispatcher, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading notification config %s: %w", file, err)
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing notification config %s: %w", file, err)
+	}
+	return NewDispatcher(cfg)
+}
+
+// newNotifier builds a notifier from its configuration.
+func newNotifier(c NotifierConfig) (Notifier, error) {
+	switch c.Type {
+	case TypeWebhook, TypeSlack, TypeMattermost, TypeTeams:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("notifier %s: url must be an absolute http or https URL", c.Name)
+		}
+		if c.Type == TypeWebhook {
+			return &webhookNotifier{url: c.URL}, nil
+		}
+		return &chatNotifier{url: c.URL, teams: c.Type == TypeTeams}, nil
+	case TypeEmail:
+		if c.SMTP == "" || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("notifier %s: email needs smtp, from and to", c.Name)
+		}
+		return &emailNotifier{
+			addr:     c.SMTP,
+			from:     c.From,
+			to:       c.To,
+			username: c.Username,
+			password: os.Getenv(c.PasswordEnv),
+		}, nil
+	default:
+		return nil, fmt.Errorf("notifier %s: unknown type %q", c.Name, c.Type)
+	}
+}
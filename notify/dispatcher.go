@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// sendTimeout bounds the delivery of one notification.
+const sendTimeout = 15 * time.Second
+
+// Dispatcher routes events to notifiers and rate limits repeated events.
+type Dispatcher struct {
+	failureThreshold int
+	rateLimit        time.Duration
+	notifiers        map[string]Notifier
+	routes           []Route
+
+	mu   sync.Mutex
+	sent map[string]*limitState // by notifier, event type and host
+}
+
+// limitState is the rate limit state of one kind of event for one notifier.
+type limitState struct {
+	last       time.Time
+	suppressed int
+}
+
+// NewDispatcher builds the notifiers and validates the routes of a configuration.
+func NewDispatcher(cfg Config) (*Dispatcher, error) {
+	d := &Dispatcher{
+		failureThreshold: cfg.FailureThreshold,
+		rateLimit:        DefaultRateLimit,
+		notifiers:        make(map[string]Notifier, len(cfg.Notifiers)),
+		routes:           cfg.Routes,
+		sent:             make(map[string]*limitState),
+	}
+	if d.failureThreshold <= 0 {
+		d.failureThreshold = DefaultFailureThreshold
+	}
+	if cfg.RateLimit != "" {
+		limit, err := time.ParseDuration(cfg.RateLimit)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid rate_limit %q", cfg.RateLimit)
+		}
+		d.rateLimit = limit
+	}
+
+	for _, c := range cfg.Notifiers {
+		if c.Name == "" {
+			return nil, fmt.Errorf("every notifier needs a name")
+		}
+		if _, dup := d.notifiers[c.Name]; dup {
+			return nil, fmt.Errorf("duplicate notifier %s", c.Name)
+		}
+		n, err := newNotifier(c)
+		if err != nil {
+			return nil, err
+		}
+		d.notifiers[c.Name] = n
+	}
+
+	for i, r := range cfg.Routes {
+		if len(r.Notifiers) == 0 {
+			return nil, fmt.Errorf("route %d has no notifiers", i+1)
+		}
+		for _, name := range r.Notifiers {
+			if _, ok := d.notifiers[name]; !ok {
+				return nil, fmt.Errorf("route %d: unknown notifier %s", i+1, name)
+			}
+		}
+		for _, t := range r.Events {
+			if !contains(EventTypes, t) {
+				return nil, fmt.Errorf("route %d: unknown event %s", i+1, t)
+			}
+		}
+		if r.MinSeverity != "" && models.SeverityRank(r.MinSeverity) < 0 {
+			return nil, fmt.Errorf("route %d: unknown severity %s", i+1, r.MinSeverity)
+		}
+	}
+	return d, nil
+}
+
+// FailureThreshold is the number of consecutive failed backups after which a
+// device is reported as failed.
+func (d *Dispatcher) FailureThreshold() int {
+	return d.failureThreshold
+}
+
+// Dispatch sends an event to the notifiers of every matching route in the
+// background. A notifier gets an event of the same type for the same host at
+// most once per rate limit interval; the next one reports how many were skipped.
+func (d *Dispatcher) Dispatch(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, name := range d.targets(ev) {
+		out, ok := d.allow(name, ev)
+		if !ok {
+			continue
+		}
+		go d.send(name, out)
+	}
+}
+
+// Test sends a test event to every notifier right away, bypassing routes and
+// rate limits, and returns the delivery error of each notifier.
+func (d *Dispatcher) Test(ctx context.Context) map[string]error {
+	ev := Event{
+		Type:     "test",
+		Severity: models.SeverityLow,
+		Title:    "Test notification",
+		Message:  "This is a test notification from netcfg-backup.",
+		Time:     time.Now(),
+	}
+	errs := make(map[string]error, len(d.notifiers))
+	for name, n := range d.notifiers {
+		errs[name] = n.Notify(ctx, ev)
+	}
+	return errs
+}
+
+// targets returns the notifiers of the routes matching an event, once each.
+func (d *Dispatcher) targets(ev Event) []string {
+	var names []string
+	for _, r := range d.routes {
+		if !r.matches(ev) {
+			continue
+		}
+		for _, name := range r.Notifiers {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// allow applies the rate limit of a notifier to an event.
+func (d *Dispatcher) allow(notifier string, ev Event) (Event, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := notifier + "|" + ev.Type + "|" + ev.Host
+	state, ok := d.sent[key]
+	if !ok {
+		state = &limitState{}
+		d.sent[key] = state
+	}
+	if ok && ev.Time.Sub(state.last) < d.rateLimit {
+		state.suppressed++
+		return ev, false
+	}
+	ev.Suppressed = state.suppressed
+	state.last = ev.Time
+	state.suppressed = 0
+	return ev, true
+}
+
+func (d *Dispatcher) send(name string, ev Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	entry := utils.Log.WithFields(map[string]interface{}{"notifier": name, "event": ev.Type, "host": ev.Host})
+	if err := d.notifiers[name].Notify(ctx, ev); err != nil {
+		entry.WithField("error", err).Error("Failed to send notification")
+		return
+	}
+	entry.Info("Notification sent")
+}
+
+// matches reports whether a route selects an event.
+func (r Route) matches(ev Event) bool {
+	if len(r.Events) > 0 && !contains(r.Events, ev.Type) {
+		return false
+	}
+	if r.MinSeverity != "" && models.SeverityRank(ev.Severity) < models.SeverityRank(r.MinSeverity) {
+		return false
+	}
+	if len(r.Tags) > 0 {
+		for _, tag := range ev.Tags {
+			if contains(r.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+// Package notify sends notifications about device failures, recoveries,
+// configuration changes and compliance violations to webhooks, email and chat.
+package notify
+
+import "time"
+
+// Event types.
+const (
+	EventDeviceFailed        = "device_failed"        // a device failed FailureThreshold backups in a row
+	EventDeviceRecovered     = "device_recovered"     // a device reported as failed was backed up again
+	EventConfigChanged       = "config_changed"       // the running configuration differs from the previous backup
+	EventComplianceViolation = "compliance_violation" // a backup violates compliance rules
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{EventDeviceFailed, EventDeviceRecovered, EventConfigChanged, EventComplianceViolation}
+
+// Event is something a notifier reports. Severity is one of models.Severities.
+type Event struct {
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Host     string    `json:"host"`
+	Tags     []string  `json:"tags,omitempty"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Diff     []string  `json:"diff,omitempty"` // for EventConfigChanged, "+ line" and "- line"
+	Time     time.Time `json:"time"`
+	// Suppressed is the number of similar events that were rate limited since
+	// the last one sent.
+	Suppressed int `json:"suppressed,omitempty"`
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Notifier types.
+const (
+	TypeWebhook    = "webhook"
+	TypeEmail      = "email"
+	TypeSlack      = "slack"
+	TypeMattermost = "mattermost"
+	TypeTeams      = "teams"
+)
+
+// maxDiffLines bounds the diff lines included in chat messages and emails.
+const maxDiffLines = 50
+
+// Notifier delivers events to one destination.
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// webhookNotifier posts events as JSON.
+type webhookNotifier struct {
+	url string
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, ev Event) error {
+	return postJSON(ctx, n.url, ev)
+}
+
+// chatNotifier posts events to Slack, Mattermost or Microsoft Teams incoming webhooks.
+type chatNotifier struct {
+	url   string
+	teams bool
+}
+
+func (n *chatNotifier) Notify(ctx context.Context, ev Event) error {
+	text := ev.Message
+	if diff := diffText(ev.Diff); diff != "" {
+		text += "\n```\n" + diff + "\n```"
+	}
+	if ev.Suppressed > 0 {
+		text += fmt.Sprintf("\n_%d similar notifications were suppressed._", ev.Suppressed)
+	}
+
+	if n.teams {
+		return postJSON(ctx, n.url, map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    ev.Title,
+			"title":      ev.Title,
+			"themeColor": severityColor(ev.Severity),
+			"text":       strings.ReplaceAll(text, "\n", "\n\n"),
+		})
+	}
+	// Slack and Mattermost accept the same payload.
+	return postJSON(ctx, n.url, map[string]interface{}{
+		"text": "*" + ev.Title + "*\n" + text,
+	})
+}
+
+// emailNotifier sends events by SMTP.
+type emailNotifier struct {
+	addr     string // host:port
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, ev Event) error {
+	// Line breaks in the title would end the header and start new ones.
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace("[netcfg-backup] " + ev.Title)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(ev.Message + "\r\n")
+	if diff := diffText(ev.Diff); diff != "" {
+		body.WriteString("\r\n" + strings.ReplaceAll(diff, "\n", "\r\n") + "\r\n")
+	}
+	if ev.Suppressed > 0 {
+		fmt.Fprintf(&body, "\r\n%d similar notifications were suppressed.\r\n", ev.Suppressed)
+	}
+
+	err := n.send(ctx, []byte(body.String()))
+	if ctx.Err() != nil {
+		return fmt.Errorf("smtp %s: %w", n.addr, ctx.Err())
+	}
+	return err
+}
+
+// send delivers a message as smtp.SendMail does, but gives up when ctx is
+// done: the connection has the deadline of ctx and is closed on cancellation.
+func (n *emailNotifier) send(ctx context.Context, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// postJSON posts a JSON body and fails on non-2xx answers.
+func postJSON(ctx context.Context, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
+
+// diffText joins diff lines, keeping the first maxDiffLines.
+func diffText(diff []string) string {
+	if len(diff) <= maxDiffLines {
+		return strings.Join(diff, "\n")
+	}
+	return strings.Join(diff[:maxDiffLines], "\n") + fmt.Sprintf("\n... %d more lines", len(diff)-maxDiffLines)
+}
+
+// severityColor returns the Teams card color of a severity.
+func severityColor(severity string) string {
+	switch severity {
+	case models.SeverityCritical, models.SeverityHigh:
+		return "D9534F"
+	case models.SeverityMedium:
+		return "F0AD4E"
+	default:
+		return "5CB85C"
+	}
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is a local SMTP server that keeps the messages it receives.
+type smtpSink struct {
+	addr     string
+	messages chan string
+	auth     chan string // AUTH commands
+}
+
+// startSMTPSink serves SMTP on a local port. A sink that does not greet
+// accepts connections and never answers.
+func startSMTPSink(t *testing.T, greet bool) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	silent := make(chan net.Conn, 4)
+	t.Cleanup(func() {
+		ln.Close()
+		for len(silent) > 0 {
+			(<-silent).Close()
+		}
+	})
+	sink := &smtpSink{addr: ln.Addr().String(), messages: make(chan string, 4), auth: make(chan string, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if greet {
+				go sink.serve(conn)
+			} else {
+				silent <- conn
+			}
+		}
+	}()
+	return sink
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-sink")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			s.auth <- line
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.messages <- string(data)
+			tp.PrintfLine("250 2.0.0 Ok: queued")
+		case "QUIT":
+			tp.PrintfLine("221 2.0.0 Bye")
+			return
+		default: // MAIL, RCPT, RSET, NOOP
+			tp.PrintfLine("250 2.0.0 Ok")
+		}
+	}
+}
+
+// header returns the value of a header of a message.
+func header(t *testing.T, message, name string) string {
+	t.Helper()
+	h, err := textproto.NewReader(bufio.NewReader(strings.NewReader(message))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("malformed message: %v\n%s", err, message)
+	}
+	return h.Get(name)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sink := startSMTPSink(t, true)
+	n := &emailNotifier{addr: sink.addr, from: "netcfg@example.com", to: []string{"noc@example.com", "oncall@example.com"}}
+	ev := Event{
+		Type:    EventConfigChanged,
+		Title:   "Configuration of zürich-core1 changed\r\nBcc: attacker@example.com",
+		Message: "The running configuration changed.\n.\nEnd.",
+		Diff:    []string{"+ ntp server 10.0.0.1", "- ntp server 10.0.0.2"},
+		Time:    time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC),
+	}
+	if err := n.Notify(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-sink.messages
+
+	if bcc := header(t, msg, "Bcc"); bcc != "" {
+		t.Errorf("the title injected a Bcc header: %q", bcc)
+	}
+	raw := header(t, msg, "Subject")
+	if strings.ContainsAny(raw, "üÜ") {
+		t.Errorf("subject %q is not encoded", raw)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[netcfg-backup] Configuration of zürich-core1 changed  Bcc: attacker@example.com"; subject != want {
+		t.Errorf("subject %q, want %q", subject, want)
+	}
+	if to := header(t, msg, "To"); to != "noc@example.com, oncall@example.com" {
+		t.Errorf("To: %q", to)
+	}
+	// The sink reads the message with the dot-stuffing and CRLF line ends undone.
+	if !strings.Contains(msg, "\n.\nEnd.") || !strings.Contains(msg, "+ ntp server 10.0.0.1\n- ntp server 10.0.0.2") {
+		t.Errorf("body:\n%s", msg)
+	}
+	select {
+	case line := <-sink.auth:
+		t.Errorf("authenticated without credentials: %s", line)
+	default:
+	}
+}
+
+func TestEmailNotifierAuth(t *testing.T) {
+	sink := startSMTPSink(t, true)
+	n := &emailNotifier{addr: sink.addr, from: "netcfg@example.com", to: []string{"noc@example.com"}, username: "netcfg", password: "secret"}
+	if err := n.Notify(context.Background(), Event{Title: "test", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-sink.auth; !strings.HasPrefix(line, "AUTH PLAIN ") {
+		t.Errorf("auth command %q", line)
+	}
+	<-sink.messages
+}
+
+// A server that accepts the connection and never answers must not hold the
+// notification past its deadline.
+func TestEmailNotifierDeadline(t *testing.T) {
+	sink := startSMTPSink(t, false)
+	n := &emailNotifier{addr: sink.addr, from: "netcfg@example.com", to: []string{"noc@example.com"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := n.Notify(ctx, Event{Title: "test", Time: time.Now()})
+	if err == nil {
+		t.Fatal("sending to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s", elapsed)
+	}
+
+	// Cancellation without a deadline closes the connection too.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := n.Notify(ctx, Event{Title: "test", Time: time.Now()}); err == nil {
+		t.Fatal("a cancelled notification succeeded")
+	}
+}
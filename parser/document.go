@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Document is the structured form of one backup, stored next to it as JSON.
+type Document struct {
+	Host     string              `json:"host"`
+	Platform string              `json:"platform"`
+	Backup   string              `json:"backup"`
+	ParsedAt time.Time           `json:"parsed_at"`
+	Records  map[string][]Record `json:"records"`
+}
+
+// NewDocument parses the command results of a backup file.
+func NewDocument(dev models.Device, backupFile string, results []models.Result) Document {
+	return Document{
+		Host:     dev.Host,
+		Platform: dev.Platform,
+		Backup:   backupFile,
+		ParsedAt: time.Now(),
+		Records:  Parse(dev.Platform, results),
+	}
+}
+
+// JSONPath returns the path of the structured records stored next to a backup file.
+func JSONPath(backupFile string) string {
+	return strings.TrimSuffix(backupFile, ".txt") + ".json"
+}
+
+// WriteDocument stores the document next to its backup file.
+func WriteDocument(backupPath string, doc Document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling parsed records: %w", err)
+	}
+	path := JSONPath(backupPath)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing parsed records to %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadDocument loads the structured records stored next to a backup file.
+func ReadDocument(backupPath string) (*Document, error) {
+	data, err := os.ReadFile(JSONPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", JSONPath(backupPath), err)
+	}
+	return &doc, nil
+}
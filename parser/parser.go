@@ -0,0 +1,203 @@
+// Package parser turns raw command output into structured records using
+// platform- and command-specific templates.
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// Record types produced by the built-in templates.
+const (
+	RecordInterfaces   = "interfaces"
+	RecordVLANs        = "vlans"
+	RecordStaticRoutes = "static_routes"
+	RecordUsers        = "users"
+	RecordNTPServers   = "ntp_servers"
+)
+
+// Record is a single structured item, such as one interface or one route.
+type Record map[string]string
+
+// Rule matches a line. Named capture groups become record fields, and Set
+// assigns constant fields whenever the rule matches.
+type Rule struct {
+	Pattern *regexp.Regexp
+	Set     map[string]string
+}
+
+// Template describes how to extract one record type from the output of one command.
+type Template struct {
+	// Platforms the template applies to.
+	Platforms []string
+	// Command the template applies to. Abbreviated commands in backups ("sh run") also match.
+	Command string
+	// Record is the record type produced, e.g. RecordInterfaces.
+	Record string
+	// Start matches the line that begins a new record.
+	Start Rule
+	// Block makes Fields apply to the indented lines following Start, as in configuration sections.
+	Block bool
+	// Fields fill in the current record from the lines of its block.
+	Fields []Rule
+	// Defaults are assigned to every new record before any rule matches.
+	Defaults map[string]string
+	// Key names the field that identifies a record. Records with the same key,
+	// for example from the configuration and from "show ip interface brief", are merged.
+	Key string
+}
+
+// Parse applies every template matching the platform to the command results and
+// returns the records grouped by record type. The generic platform uses all templates.
+func Parse(platform string, results []models.Result) map[string][]Record {
+	out := make(map[string][]Record)
+	index := make(map[string]map[string]int) // record type -> key -> position in out
+
+	for _, tmpl := range templatesFor(platform) {
+		for _, res := range results {
+			if !commandMatches(tmpl.Command, res.Cmd) {
+				continue
+			}
+			for _, rec := range tmpl.apply(res.Output) {
+				merge(out, index, tmpl, rec)
+			}
+		}
+	}
+
+	return out
+}
+
+// Filter returns the records of one type, or all records when recordType is empty.
+func Filter(records map[string][]Record, recordType string) map[string][]Record {
+	if recordType == "" {
+		return records
+	}
+	return map[string][]Record{recordType: records[recordType]}
+}
+
+// RecordTypes returns the record types present in a parse result, sorted.
+func RecordTypes(records map[string][]Record) []string {
+	types := make([]string, 0, len(records))
+	for t := range records {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// apply runs the template over one command output.
+func (t Template) apply(output string) []Record {
+	var records []Record
+	var current Record
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		indented := line != strings.TrimLeft(line, " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if t.Block && indented && current != nil {
+			for _, rule := range t.Fields {
+				rule.fill(current, trimmed)
+			}
+			continue
+		}
+
+		current = nil
+		if t.Block && indented {
+			continue
+		}
+		if t.Start.fill(nil, trimmed) {
+			current = Record{}
+			for k, v := range t.Defaults {
+				current[k] = v
+			}
+			t.Start.fill(current, trimmed)
+			records = append(records, current)
+		}
+	}
+
+	return records
+}
+
+// fill applies the rule to a line and reports whether it matched.
+// A nil record only tests for a match.
+func (r Rule) fill(rec Record, line string) bool {
+	m := r.Pattern.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	if rec == nil {
+		return true
+	}
+	for i, name := range r.Pattern.SubexpNames() {
+		if name != "" && m[i] != "" {
+			rec[name] = strings.TrimSpace(m[i])
+		}
+	}
+	for k, v := range r.Set {
+		rec[k] = v
+	}
+	return true
+}
+
+// merge adds a record to the output, merging it into an existing record with the same key.
+func merge(out map[string][]Record, index map[string]map[string]int, tmpl Template, rec Record) {
+	key := rec[tmpl.Key]
+	if tmpl.Key == "" || key == "" {
+		out[tmpl.Record] = append(out[tmpl.Record], rec)
+		return
+	}
+
+	if index[tmpl.Record] == nil {
+		index[tmpl.Record] = make(map[string]int)
+	}
+	if pos, ok := index[tmpl.Record][key]; ok {
+		existing := out[tmpl.Record][pos]
+		for k, v := range rec {
+			if _, set := existing[k]; !set {
+				existing[k] = v
+			}
+		}
+		return
+	}
+	index[tmpl.Record][key] = len(out[tmpl.Record])
+	out[tmpl.Record] = append(out[tmpl.Record], rec)
+}
+
+// templatesFor returns the templates registered for a platform.
+func templatesFor(platform string) []Template {
+	if platform == "" || platform == models.PlatformGeneric {
+		return templates
+	}
+	var matched []Template
+	for _, t := range templates {
+		for _, p := range t.Platforms {
+			if p == platform {
+				matched = append(matched, t)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// commandMatches reports whether cmd is the template command, possibly abbreviated
+// word by word the way network CLIs allow ("sh run" for "show running-config").
+func commandMatches(templateCmd, cmd string) bool {
+	want := strings.Fields(strings.ToLower(templateCmd))
+	got := strings.Fields(strings.ToLower(cmd))
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], got[i]) {
+			return false
+		}
+	}
+	return true
+}
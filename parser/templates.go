@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"regexp"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// iosLike are the platforms sharing the IOS configuration syntax.
+var iosLike = []string{models.PlatformCiscoIOS, models.PlatformCiscoNXOS, models.PlatformAristaEOS}
+
+var junos = []string{models.PlatformJunOS}
+
+// templates is the registry of built-in templates.
+var templates = []Template{
+	// --- IOS-style running configuration ---
+	{
+		Platforms: iosLike,
+		Command:   "show running-config",
+		Record:    RecordInterfaces,
+		Key:       "name",
+		Start:     Rule{Pattern: regexp.MustCompile(`^interface (?P<name>\S+)`)},
+		Block:     true,
+		Defaults:  map[string]string{"status": "up"},
+		Fields: []Rule{
+			{Pattern: regexp.MustCompile(`^description (?P<description>.+)`)},
+			{Pattern: regexp.MustCompile(`^ip address (?P<ip_address>\d+\.\d+\.\d+\.\d+) (?P<mask>\d+\.\d+\.\d+\.\d+)$`)},
+			{Pattern: regexp.MustCompile(`^ip address (?P<ip_address>\d+\.\d+\.\d+\.\d+)/(?P<prefix_length>\d+)`)},
+			{Pattern: regexp.MustCompile(`^switchport access vlan (?P<access_vlan>\d+)`)},
+			{Pattern: regexp.MustCompile(`^switchport mode (?P<switchport_mode>\S+)`)},
+			{Pattern: regexp.MustCompile(`^shutdown$`), Set: map[string]string{"status": "down"}},
+		},
+	},
+	{
+		Platforms: iosLike,
+		Command:   "show running-config",
+		Record:    RecordVLANs,
+		Key:       "vlan_id",
+		Start:     Rule{Pattern: regexp.MustCompile(`^vlan (?P<vlan_id>\d+)$`)},
+		Block:     true,
+		Fields: []Rule{
+			{Pattern: regexp.MustCompile(`^name (?P<name>.+)`)},
+		},
+	},
+	{
+		Platforms: iosLike,
+		Command:   "show running-config",
+		Record:    RecordStaticRoutes,
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^ip route (?:vrf (?P<vrf>\S+) )?(?P<prefix>\d+\.\d+\.\d+\.\d+)[ /](?P<mask>\S+) (?P<next_hop>\S+)(?: (?P<distance>\d+))?`)},
+	},
+	{
+		Platforms: iosLike,
+		Command:   "show running-config",
+		Record:    RecordUsers,
+		Key:       "username",
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^username (?P<username>\S+)(?: privilege (?P<privilege>\d+))?(?: role (?P<role>\S+))?`)},
+	},
+	{
+		Platforms: iosLike,
+		Command:   "show running-config",
+		Record:    RecordNTPServers,
+		Key:       "server",
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^ntp server (?:vrf (?P<vrf>\S+) )?(?P<server>\S+)(?: .*?prefer)?`)},
+	},
+
+	// --- IOS-style operational tables ---
+	{
+		Platforms: iosLike,
+		Command:   "show ip interface brief",
+		Record:    RecordInterfaces,
+		Key:       "name",
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^(?P<name>[A-Za-z][\w/.:-]*\d)\s+(?P<ip_address>\d+\.\d+\.\d+\.\d+|unassigned)\s+(?:\S+\s+\S+\s+)?(?P<status>up|down|administratively down)\s+(?P<protocol>up|down)\s*$`)},
+	},
+	{
+		Platforms: iosLike,
+		Command:   "show vlan brief",
+		Record:    RecordVLANs,
+		Key:       "vlan_id",
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^(?P<vlan_id>\d+)\s+(?P<name>\S+)\s+(?P<state>active|suspended|act/lshut|sus/lshut|act/unsup)(?:\s+(?P<ports>.+))?`)},
+	},
+
+	// --- JunOS "display set" configuration ---
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordInterfaces,
+		Key:       "name",
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^set interfaces (?P<name>\S+ unit \d+) family inet address (?P<ip_address>\d+\.\d+\.\d+\.\d+)/(?P<prefix_length>\d+)`)},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordInterfaces,
+		Key:       "name",
+		Start:     Rule{Pattern: regexp.MustCompile(`^set interfaces (?P<name>\S+) description "?(?P<description>[^"]+)"?`)},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordInterfaces,
+		Key:       "name",
+		Start:     Rule{Pattern: regexp.MustCompile(`^set interfaces (?P<name>\S+) disable$`), Set: map[string]string{"status": "down"}},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordVLANs,
+		Key:       "name",
+		Start:     Rule{Pattern: regexp.MustCompile(`^set vlans (?P<name>\S+) vlan-id (?P<vlan_id>\d+)`)},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordStaticRoutes,
+		Start: Rule{Pattern: regexp.MustCompile(
+			`^set routing-options static route (?P<prefix>\d+\.\d+\.\d+\.\d+)/(?P<mask>\d+) next-hop (?P<next_hop>\S+)`)},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordUsers,
+		Key:       "username",
+		Start:     Rule{Pattern: regexp.MustCompile(`^set system login user (?P<username>\S+) class (?P<role>\S+)`)},
+	},
+	{
+		Platforms: junos,
+		Command:   "show configuration | display set",
+		Record:    RecordNTPServers,
+		Key:       "server",
+		Start:     Rule{Pattern: regexp.MustCompile(`^set system ntp server (?P<server>\S+)`)},
+	},
+}
@@ -0,0 +1,280 @@
+// Package push builds the command sequences that apply configuration changes
+// to devices, using the platform's own safety net where one exists.
+package push
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// DefaultConfirmTimeout is how long a change waits for confirmation before it is rolled back.
+const DefaultConfirmTimeout = 5 * time.Minute
+
+var (
+	// ErrNoRollback is returned for platforms without a rollback mechanism.
+	ErrNoRollback = errors.New("platform has no rollback mechanism")
+	// ErrNoRunning is returned for a replace without the running configuration,
+	// as it would push the whole target configuration without removing anything.
+	ErrNoRunning = errors.New("a replace needs the running configuration")
+)
+
+// Request describes a change to a device.
+type Request struct {
+	Platform string
+	// Lines are the configuration lines to apply. With Replace set they are the
+	// complete target configuration, otherwise they are merged into the running one.
+	Lines   []string
+	Replace bool
+	// Running is the current configuration. A replace removes its lines that
+	// are not in Lines, a merge leaves out the lines it already has.
+	Running string
+	// ReplaceURL is the location of the target configuration as seen from the
+	// device (e.g. "flash:restore.cfg" or "scp://user@server/restore.cfg"). When
+	// set, IOS and NX-OS load it with "configure replace" instead of a computed patch.
+	ReplaceURL string
+	// ConfirmTimeout is how long the device keeps the change without confirmation.
+	ConfirmTimeout time.Duration
+	// Label names the checkpoint or configuration session of the change.
+	Label string
+}
+
+// Plan is the command sequence for one change.
+type Plan struct {
+	// Mechanism describes how the change is protected, for previews and the audit log.
+	Mechanism string
+	// Changes are the configuration commands computed from the request.
+	Changes []string
+	// Apply is sent in one configuration session.
+	Apply []string
+	// Confirm makes the change permanent.
+	Confirm []string
+	// Rollback reverts the change before the device does it by itself.
+	Rollback []string
+	// AutoRevert is set when the device reverts unconfirmed changes on its own.
+	AutoRevert bool
+}
+
+// BuildPlan returns the commands that apply the request on its platform.
+// Platforms without a rollback mechanism return a plan and ErrNoRollback.
+func BuildPlan(req Request) (*Plan, error) {
+	timeout := req.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+	label := req.Label
+	if label == "" {
+		label = "netcfg-" + time.Now().Format("20060102-150405")
+	}
+	minutes := int((timeout + time.Minute - 1) / time.Minute)
+	req.Lines = stripEnd(req.Lines)
+	req.Running = strings.Join(stripEnd(strings.Split(req.Running, "\n")), "\n")
+
+	if req.Platform == models.PlatformJunOS {
+		return junosPlan(req, minutes)
+	}
+
+	p := &Plan{}
+	if req.ReplaceURL != "" {
+		switch req.Platform {
+		case models.PlatformCiscoIOS:
+			p.Mechanism = "configure replace with revert timer"
+			p.Apply = []string{fmt.Sprintf("configure replace %s force revert trigger timer %d", req.ReplaceURL, minutes)}
+			p.Confirm = []string{"configure confirm"}
+			p.Rollback = []string{"configure revert now"}
+			p.AutoRevert = true
+			return p, nil
+		case models.PlatformCiscoNXOS:
+			seconds := int(timeout / time.Second)
+			if seconds < 60 {
+				seconds = 60
+			}
+			p.Mechanism = "configure replace with commit timeout"
+			p.Apply = []string{fmt.Sprintf("configure replace %s commit-timeout %d", req.ReplaceURL, seconds)}
+			p.Confirm = []string{"configure replace commit"}
+			p.AutoRevert = true
+			return p, nil
+		default:
+			return nil, fmt.Errorf("configure replace is not supported on platform '%s'", platformName(req.Platform))
+		}
+	}
+
+	switch {
+	case req.Replace && req.Platform == models.PlatformAristaEOS:
+		// The session starts from a clean config, so it gets every line.
+		p.Changes = configdiff.Lines(strings.Join(req.Lines, "\n"))
+	case req.Replace:
+		if strings.TrimSpace(req.Running) == "" {
+			return nil, ErrNoRunning
+		}
+		p.Changes = configdiff.Patch(strings.Join(req.Lines, "\n"), req.Running, negateIOS)
+	default:
+		p.Changes = configdiff.Patch(strings.Join(req.Lines, "\n"), req.Running, keepLine)
+	}
+
+	switch req.Platform {
+	case models.PlatformCiscoIOS:
+		// Requires "archive" to be configured on the device.
+		p.Mechanism = "configure terminal revert timer"
+		p.Apply = append([]string{fmt.Sprintf("configure terminal revert timer %d", minutes)}, p.Changes...)
+		p.Apply = append(p.Apply, "end")
+		p.Confirm = []string{"configure confirm"}
+		p.Rollback = []string{"configure revert now"}
+		p.AutoRevert = true
+	case models.PlatformAristaEOS:
+		p.Mechanism = "configuration session with commit timer"
+		p.Apply = []string{"configure session " + label}
+		if req.Replace {
+			// A session starting from a clean config replaces the running config on commit.
+			p.Apply = append(p.Apply, "rollback clean-config")
+		}
+		p.Apply = append(p.Apply, p.Changes...)
+		p.Apply = append(p.Apply, fmt.Sprintf("commit timer %s", formatTimer(timeout)))
+		p.Confirm = []string{"configure session " + label + " commit"}
+		p.AutoRevert = true
+	case models.PlatformCiscoNXOS:
+		p.Mechanism = "checkpoint and rollback"
+		p.Apply = append([]string{"checkpoint " + label, "configure terminal"}, p.Changes...)
+		p.Apply = append(p.Apply, "end")
+		p.Confirm = []string{"no checkpoint " + label}
+		p.Rollback = []string{"rollback running-config checkpoint " + label, "no checkpoint " + label}
+	default:
+		p.Mechanism = "none"
+		p.Apply = append([]string{"configure terminal"}, p.Changes...)
+		p.Apply = append(p.Apply, "end")
+		return p, ErrNoRollback
+	}
+	return p, nil
+}
+
+// junosPlan applies set-format lines in a private candidate configuration with "commit confirmed".
+func junosPlan(req Request, minutes int) (*Plan, error) {
+	if req.ReplaceURL != "" {
+		return nil, fmt.Errorf("configure replace is not supported on platform '%s'", req.Platform)
+	}
+	for _, l := range configdiff.Lines(strings.Join(req.Lines, "\n")) {
+		if !strings.HasPrefix(l, "set ") && !strings.HasPrefix(l, "delete ") {
+			return nil, fmt.Errorf("JunOS changes must be in 'display set' format, got '%s'", l)
+		}
+	}
+
+	p := &Plan{Mechanism: "commit confirmed", AutoRevert: true}
+	if req.Replace {
+		if strings.TrimSpace(req.Running) == "" {
+			return nil, ErrNoRunning
+		}
+		p.Changes = configdiff.Patch(strings.Join(req.Lines, "\n"), req.Running, negateJunos)
+	} else {
+		p.Changes = configdiff.Patch(strings.Join(req.Lines, "\n"), req.Running, keepLine)
+	}
+	p.Apply = append([]string{"configure private"}, p.Changes...)
+	p.Apply = append(p.Apply, fmt.Sprintf("commit confirmed %d", minutes), "exit")
+	p.Confirm = []string{"configure private", "commit", "exit"}
+	p.Rollback = []string{"configure private", "rollback 1", "commit", "exit"}
+	return p, nil
+}
+
+// stripEnd drops the "end" lines that close IOS-style configurations, as they
+// would leave configuration mode in the middle of a change.
+func stripEnd(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "end" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// unremovable are top-level lines that are part of every IOS-style configuration
+// but cannot be negated.
+var unremovable = []string{"version ", "boot-start-marker", "boot-end-marker"}
+
+// negateIOS removes a line in IOS-style configurations.
+func negateIOS(line string) string {
+	for _, u := range unremovable {
+		if strings.HasPrefix(line, u) {
+			return ""
+		}
+	}
+	if strings.HasPrefix(line, "no ") {
+		return strings.TrimPrefix(line, "no ")
+	}
+	return "no " + line
+}
+
+// keepLine leaves the lines of the running configuration in place, so that a
+// merge only sends the lines the device does not have yet.
+func keepLine(string) string {
+	return ""
+}
+
+// negateJunos removes a set-format line.
+func negateJunos(line string) string {
+	if strings.HasPrefix(line, "set ") {
+		return "delete " + strings.TrimPrefix(line, "set ")
+	}
+	return ""
+}
+
+// errorPrefixes start the lines devices print when they reject a configuration
+// line: "% Invalid input ..." on IOS-like platforms, "error: ..." and
+// "syntax error." on JunOS.
+var errorPrefixes = []string{"% ", "error:", "syntax error"}
+
+// DetectErrors returns the lines of a session transcript that report a
+// rejected command. The echo of a sent line, with or without the prompt in
+// front of it, is never an error, whatever the line contains.
+func DetectErrors(transcript string, sent []string) []string {
+	var found []string
+	for _, line := range strings.Split(transcript, "\n") {
+		line = strings.TrimSpace(line)
+		if !hasErrorPrefix(line) || isEcho(line, sent) {
+			continue
+		}
+		found = append(found, line)
+	}
+	return found
+}
+
+func hasErrorPrefix(line string) bool {
+	lower := strings.ToLower(line)
+	for _, p := range errorPrefixes {
+		if strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isEcho(line string, sent []string) bool {
+	for _, cmd := range sent {
+		cmd = strings.TrimSpace(cmd)
+		if cmd == "" || !strings.HasSuffix(line, cmd) {
+			continue
+		}
+		// The echo follows the prompt, e.g. "r1(config)#" or "user@r1# ".
+		prompt := strings.TrimSpace(strings.TrimSuffix(line, cmd))
+		if prompt == "" || strings.ContainsAny(prompt[len(prompt)-1:], "#>$") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTimer formats a duration as hh:mm:ss for EOS commit timers.
+func formatTimer(d time.Duration) string {
+	secs := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
+
+func platformName(p string) string {
+	if p == "" {
+		return models.PlatformGeneric
+	}
+	return p
+}
@@ -0,0 +1,162 @@
+package push
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+func TestDetectErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript string
+		sent       []string
+		want       []string
+	}{
+		{
+			name:       "ios rejected line",
+			transcript: "r1(config)#ntp srever 10.0.0.1\n                ^\n% Invalid input detected at '^' marker.\n\nr1(config)#",
+			sent:       []string{"ntp srever 10.0.0.1"},
+			want:       []string{"% Invalid input detected at '^' marker."},
+		},
+		{
+			name:       "echoed lines mentioning errors",
+			transcript: "r1(config)#logging discriminator NOERR msg-body drops error:\nr1(config)#interface Gi0/1\nr1(config-if)#description syntax error tracking\nr1(config-if)#end\nr1#",
+			sent:       []string{"logging discriminator NOERR msg-body drops error:", "interface Gi0/1", "description syntax error tracking", "end"},
+			want:       nil,
+		},
+		{
+			name:       "echo without prompt",
+			transcript: "error: not a command\n% comment\n",
+			sent:       []string{"error: not a command", "% comment"},
+			want:       nil,
+		},
+		{
+			name:       "junos",
+			transcript: "user@r1# set system host-name\n                             ^\nsyntax error.\n\n[edit]\nuser@r1# commit confirmed 5\nerror: configuration check-out failed\n",
+			sent:       []string{"set system host-name", "commit confirmed 5"},
+			want:       []string{"syntax error.", "error: configuration check-out failed"},
+		},
+		{
+			name:       "error text inside device output",
+			transcript: "r1#show logging | include error\n*Oct 19 04:00:00: %LINK-3-UPDOWN: Interface Gi0/2, error: link flap\nr1#",
+			sent:       []string{"show logging | include error"},
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := DetectErrors(tt.transcript, tt.sent); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A merge only sends the lines the device does not have yet.
+func TestBuildPlanMerge(t *testing.T) {
+	running := "hostname r1\nntp server 10.0.0.1\ninterface Gi0/1\n description uplink\n shutdown\n"
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"already present", []string{"ntp server 10.0.0.1", "interface Gi0/1", " description uplink"}, nil},
+		{"new top-level line", []string{"ntp server 10.0.0.1", "ntp server 10.0.0.2"}, []string{"ntp server 10.0.0.2"}},
+		{"new child line", []string{"interface Gi0/1", " description uplink", " no shutdown"}, []string{"interface Gi0/1", " no shutdown"}},
+		{"new section", []string{"interface Gi0/2", " description spare"}, []string{"interface Gi0/2", " description spare"}},
+	}
+	for _, tt := range tests {
+		p, err := BuildPlan(Request{Platform: models.PlatformCiscoIOS, Lines: tt.lines, Running: running})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(p.Changes, tt.want) {
+			t.Errorf("%s: changes %q, want %q", tt.name, p.Changes, tt.want)
+		}
+	}
+
+	p, err := BuildPlan(Request{Platform: models.PlatformJunOS, Lines: []string{"set system ntp server 10.0.0.1", "set system ntp server 10.0.0.2"}, Running: "set system ntp server 10.0.0.1"})
+	if err != nil || !reflect.DeepEqual(p.Changes, []string{"set system ntp server 10.0.0.2"}) {
+		t.Errorf("junos merge: %q, %v", p.Changes, err)
+	}
+}
+
+func TestBuildPlanReplace(t *testing.T) {
+	iosRunning := "Building configuration...\nversion 15.2\nboot-start-marker\nboot-end-marker\nhostname r1\nno ip domain-lookup\ninterface Gi0/1\n ip address 10.0.0.1 255.255.255.0\n shutdown\nend"
+	tests := []struct {
+		name     string
+		platform string
+		lines    string
+		running  string
+		want     []string // Apply
+	}{
+		{
+			name:     "ios nested change and removed no line",
+			platform: models.PlatformCiscoIOS,
+			lines:    "version 15.2\nhostname r1\ninterface Gi0/1\n ip address 10.0.0.2 255.255.255.0\nend",
+			running:  iosRunning,
+			want: []string{"configure terminal revert timer 5",
+				"ip domain-lookup",
+				"interface Gi0/1", " no ip address 10.0.0.1 255.255.255.0", " no shutdown", " ip address 10.0.0.2 255.255.255.0",
+				"end"},
+		},
+		{
+			name:     "ios version and boot markers",
+			platform: models.PlatformCiscoIOS,
+			lines:    "hostname r2",
+			running:  "version 15.2\nboot-start-marker\nboot-end-marker\nhostname r1",
+			want:     []string{"configure terminal revert timer 5", "no hostname r1", "hostname r2", "end"},
+		},
+		{
+			name:     "nx-os checkpoint",
+			platform: models.PlatformCiscoNXOS,
+			lines:    "hostname n1\nfeature lacp",
+			running:  "hostname n1\nfeature lldp",
+			want:     []string{"checkpoint netcfg-test", "configure terminal", "no feature lldp", "feature lacp", "end"},
+		},
+		{
+			name:     "junos set and delete",
+			platform: models.PlatformJunOS,
+			lines:    "set system host-name r1\nset system ntp server 10.0.0.2",
+			running:  "set system host-name r1\nset system ntp server 10.0.0.1\nset snmp community public",
+			want: []string{"configure private",
+				"delete system ntp server 10.0.0.1", "delete snmp community public", "set system ntp server 10.0.0.2",
+				"commit confirmed 5", "exit"},
+		},
+		{
+			name:     "eos clean config",
+			platform: models.PlatformAristaEOS,
+			lines:    "hostname e1\ninterface Ethernet1\n description uplink",
+			running:  "hostname e1\nip routing",
+			want: []string{"configure session netcfg-test", "rollback clean-config",
+				"hostname e1", "interface Ethernet1", " description uplink", "commit timer 00:05:00"},
+		},
+	}
+	for _, tt := range tests {
+		p, err := BuildPlan(Request{Platform: tt.platform, Lines: strings.Split(tt.lines, "\n"), Replace: true, Running: tt.running, Label: "netcfg-test"})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Apply, tt.want) {
+			t.Errorf("%s: apply\n%q\nwant\n%q", tt.name, p.Apply, tt.want)
+		}
+	}
+}
+
+// Without the running configuration, a replace would send the whole target
+// and remove nothing.
+func TestBuildPlanReplaceWithoutRunning(t *testing.T) {
+	for _, platform := range []string{models.PlatformCiscoIOS, models.PlatformCiscoNXOS, models.PlatformJunOS, models.PlatformGeneric} {
+		_, err := BuildPlan(Request{Platform: platform, Lines: []string{"set system host-name r1"}, Replace: true, Running: "\n end\n"})
+		if !errors.Is(err, ErrNoRunning) {
+			t.Errorf("%s: got %v, want ErrNoRunning", platform, err)
+		}
+	}
+	// An EOS session starts from a clean config and does not need it.
+	if _, err := BuildPlan(Request{Platform: models.PlatformAristaEOS, Lines: []string{"hostname e1"}, Replace: true}); err != nil {
+		t.Errorf("eos: %v", err)
+	}
+}
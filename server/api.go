@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+)
+
+// APIPrefix is the path prefix of the versioned REST API.
+const APIPrefix = "/api/v1"
+
+// apiRoute describes one API endpoint. The same table registers the routes
+// and generates the OpenAPI document, so the two cannot drift apart.
+type apiRoute struct {
+	Method  string
+	Path    string // relative to APIPrefix, with {name} path parameters
+	Tag     string
+	Summary string
+	Query   []apiParam
+	Request interface{} // example of the JSON request body, nil for none
+	// Response is an example of the JSON response body; a string selects a
+	// plain text response and nil an empty one.
+	Response interface{}
+	Status   int    // status of a successful response
+	Errors   []int  // documented error statuses
+	Role     string // least user role allowed; empty for public endpoints
+	Handler  func(*Server) http.HandlerFunc
+}
+
+// apiParam is a documented query parameter.
+type apiParam struct {
+	Name        string
+	Description string
+}
+
+// apiError is the body of every API error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiRunRequest selects the devices of a run: a single host, a selector, or
+// all active devices when both are empty.
+type apiRunRequest struct {
+	Host     string                `json:"host,omitempty"`
+	Selector models.DeviceSelector `json:"selector"`
+}
+
+// apiRunDetail is a run together with its per-device results and, when the
+// store has a job queue, the state of its device jobs.
+type apiRunDetail struct {
+	Run     models.Run         `json:"run"`
+	Results []models.RunResult `json:"results"`
+	Jobs    []models.RunJob    `json:"jobs,omitempty"`
+}
+
+// apiBackupFile is one backup of a host.
+type apiBackupFile struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// apiBackupDiff lists the configuration lines that changed between two backups.
+// Nested lines are shown with their parents, as "parent > line".
+type apiBackupDiff struct {
+	Host    string   `json:"host"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// apiRoutes returns the table of API endpoints. More specific paths come
+// first, as routes are matched in order.
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{Method: "GET", Path: "/devices", Tag: "devices", Summary: "List devices",
+			Response: []models.Device{}, Status: http.StatusOK,
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListDevices},
+		{Method: "POST", Path: "/devices", Tag: "devices", Summary: "Add a device",
+			Request: models.Device{}, Response: models.Device{}, Status: http.StatusCreated,
+			Errors: []int{http.StatusBadRequest, http.StatusConflict},
+			Role:   models.RoleAdmin, Handler: (*Server).handleAPIAddDevice},
+		{Method: "GET", Path: "/devices/{host}", Tag: "devices", Summary: "Get a device",
+			Response: models.Device{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIGetDevice},
+		{Method: "PUT", Path: "/devices/{host}", Tag: "devices", Summary: "Replace a device",
+			Request: models.Device{}, Response: models.Device{}, Status: http.StatusOK,
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+			Role:   models.RoleAdmin, Handler: (*Server).handleAPIUpdateDevice},
+		{Method: "DELETE", Path: "/devices/{host}", Tag: "devices", Summary: "Remove a device",
+			Status: http.StatusNoContent, Errors: []int{http.StatusNotFound},
+			Role: models.RoleAdmin, Handler: (*Server).handleAPIRemoveDevice},
+
+		{Method: "POST", Path: "/runs", Tag: "runs", Summary: "Start a backup run for one host, a selector or all devices",
+			Request: apiRunRequest{}, Response: models.Run{}, Status: http.StatusAccepted,
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			Role:   models.RoleOperator, Handler: (*Server).handleAPIStartRun},
+		{Method: "GET", Path: "/runs", Tag: "runs", Summary: "List recent runs, newest first",
+			Query:    []apiParam{{"limit", "Number of runs to return (default 20)"}},
+			Response: []models.Run{}, Status: http.StatusOK,
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListRuns},
+		{Method: "GET", Path: "/runs/{id}", Tag: "runs", Summary: "Get a run, its per-device results and the state of its queued jobs",
+			Response: apiRunDetail{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIGetRun},
+		{Method: "POST", Path: "/runs/{id}/cancel", Tag: "runs", Summary: "Cancel a run in progress; its unfinished devices are recorded as cancelled",
+			Status: http.StatusAccepted, Errors: []int{http.StatusNotFound, http.StatusConflict},
+			Role: models.RoleOperator, Handler: (*Server).handleAPICancelRun},
+		{Method: "POST", Path: "/runs/{id}/devices/{host}/cancel", Tag: "runs", Summary: "Cancel the backup of one device of a run in progress",
+			Status: http.StatusAccepted, Errors: []int{http.StatusNotFound, http.StatusConflict},
+			Role: models.RoleOperator, Handler: (*Server).handleAPICancelRun},
+
+		{Method: "POST", Path: "/webhooks/backup", Tag: "runs", Summary: "Queue a backup of hosts or a selector, with an idempotency key and an optional result callback",
+			Request: models.BackupRequest{}, Response: models.BackupTicket{}, Status: http.StatusAccepted,
+			Errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+			Role:   models.RoleOperator, Handler: (*Server).handleAPIBackupWebhook},
+
+		{Method: "POST", Path: "/agents", Tag: "agents", Summary: "Register an agent and the sites it serves",
+			Request: models.AgentRegistration{}, Response: models.Agent{}, Status: http.StatusOK,
+			Errors: []int{http.StatusBadRequest},
+			Role:   models.RoleAgent, Handler: (*Server).handleAPIRegisterAgent},
+		{Method: "GET", Path: "/agents", Tag: "agents", Summary: "List the agents and their health",
+			Response: []models.Agent{}, Status: http.StatusOK,
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListAgents},
+		{Method: "POST", Path: "/agents/{name}/heartbeat", Tag: "agents", Summary: "Report that an agent is alive and get the jobs it should stop",
+			Response: models.AgentHeartbeat{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleAgent, Handler: (*Server).handleAPIAgentHeartbeat},
+		{Method: "POST", Path: "/agents/{name}/jobs/next", Tag: "agents", Summary: "Wait up to 25 seconds for a backup job of the agent's sites; 204 when there is none",
+			Response: models.AgentJob{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleAgent, Handler: (*Server).handleAPINextAgentJob},
+		{Method: "POST", Path: "/agents/{name}/jobs/{id}/result", Tag: "agents", Summary: "Upload the command output or error of a backup job",
+			Request: models.AgentResult{}, Status: http.StatusNoContent,
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			Role:   models.RoleAgent, Handler: (*Server).handleAPIAgentResult},
+
+		{Method: "GET", Path: "/backups", Tag: "backups", Summary: "List hosts that have backups",
+			Response: []string{}, Status: http.StatusOK,
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListBackupHosts},
+		{Method: "GET", Path: "/backups/{host}/diff", Tag: "backups", Summary: "Compare two backups of a host",
+			Query: []apiParam{
+				{"from", "Older backup file (default: the one before 'to')"},
+				{"to", "Newer backup file (default: latest)"},
+			},
+			Response: apiBackupDiff{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIDiffBackups},
+		{Method: "GET", Path: "/backups/{host}", Tag: "backups", Summary: "List the backups of a host",
+			Response: []apiBackupFile{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListBackups},
+		{Method: "GET", Path: "/backups/{host}/{filename}", Tag: "backups", Summary: "Download a backup ('latest' for the most recent)",
+			Response: "", Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIDownloadBackup},
+		{Method: "GET", Path: "/backups/{host}/{filename}/files", Tag: "backups", Summary: "List the files fetched from the device with a backup",
+			Response: []models.FetchedFile{}, Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIListFetchedFiles},
+		{Method: "GET", Path: "/backups/{host}/{filename}/files/{name}", Tag: "backups", Summary: "Download a file fetched from the device with a backup",
+			Response: "", Status: http.StatusOK, Errors: []int{http.StatusNotFound},
+			Role: models.RoleViewer, Handler: (*Server).handleAPIDownloadFetchedFile},
+
+		{Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "This OpenAPI document",
+			Response: map[string]interface{}{}, Status: http.StatusOK,
+			Handler: (*Server).handleAPISpec},
+	}
+}
+
+// registerAPIRoutes registers the API routes on a subrouter.
+func (s *Server) registerAPIRoutes() {
+	api := s.router.PathPrefix(APIPrefix).Subrouter()
+	for _, route := range apiRoutes() {
+		api.HandleFunc(route.Path, s.requireAPIRole(route.Role, route.Handler(s))).Methods(route.Method)
+	}
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "no such endpoint")
+	})
+}
+
+// writeJSON writes a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// writeAPIError writes an API error response.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// writeStoreError maps a store error to the matching status.
+func writeStoreError(w http.ResponseWriter, err error) {
+	var notFound *storage.ErrDeviceNotFound
+	var exists *storage.ErrDeviceExists
+	switch {
+	case errors.As(err, &notFound):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &exists):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// queryInt reads a positive integer query parameter.
+func queryInt(r *http.Request, name string, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
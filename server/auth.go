@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+const (
+	// sessionName is the cookie holding the login and flash messages.
+	sessionName = "netcfg-backup-session"
+	// sessionUserKey holds the name of the logged-in user.
+	sessionUserKey = "user"
+	// sessionProviderKey holds how the user logged in: providerLocal or providerOIDC.
+	sessionProviderKey = "provider"
+	// sessionRoleKey holds the role of users that have no local account.
+	sessionRoleKey = "role"
+	// sessionExpiresKey holds the Unix time at which the login expires.
+	sessionExpiresKey = "expires"
+
+	// sessionLifetime is how long a login lasts.
+	sessionLifetime = 12 * time.Hour
+)
+
+// Login providers.
+const (
+	providerLocal = "local"
+	providerOIDC  = "oidc"
+	providerToken = "token"
+)
+
+// tokenTouchInterval limits how often the last used time of a token is written.
+const tokenTouchInterval = time.Minute
+
+// sessionUser is the user a request is made by.
+type sessionUser struct {
+	Username string
+	Role     string
+	Provider string
+}
+
+// loginPageData is the data of the login page.
+type loginPageData struct {
+	Next    string
+	Error   string
+	NoUsers bool
+	OIDC    bool
+}
+
+type userContextKey struct{}
+
+func withUser(ctx context.Context, user *sessionUser) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// userFromContext returns the user stored by requireRole, or nil.
+func userFromContext(ctx context.Context) *sessionUser {
+	user, _ := ctx.Value(userContextKey{}).(*sessionUser)
+	return user
+}
+
+// currentUser returns the name recorded in the audit log for a request.
+func (s *Server) currentUser(r *http.Request) string {
+	if user := userFromContext(r.Context()); user != nil {
+		return user.Username
+	}
+	return "web"
+}
+
+// sessionUser returns the user logged in to the session of a request, or nil.
+// Local accounts are looked up on every request, so deleting a user or
+// changing their role takes effect immediately. Single sign-on users keep the
+// role mapped from their groups at login.
+func (s *Server) sessionUser(r *http.Request) *sessionUser {
+	session, _ := s.sessionStore.Get(r, sessionName)
+	username, _ := session.Values[sessionUserKey].(string)
+	expires, _ := session.Values[sessionExpiresKey].(int64)
+	if username == "" || time.Now().Unix() > expires {
+		return nil
+	}
+
+	if provider, _ := session.Values[sessionProviderKey].(string); provider == providerOIDC {
+		role, _ := session.Values[sessionRoleKey].(string)
+		if s.oidc == nil || !models.ValidUserRole(role) {
+			return nil
+		}
+		return &sessionUser{Username: username, Role: role, Provider: providerOIDC}
+	}
+
+	userStore, ok := s.store.(storage.UserStore)
+	if !ok {
+		return nil
+	}
+	user, err := userStore.GetUser(username)
+	if err != nil {
+		return nil
+	}
+	return &sessionUser{Username: user.Username, Role: user.Role, Provider: providerLocal}
+}
+
+// tokenUser authenticates the bearer token of a request. hasToken is false
+// when the request carries none. A personal token never grants more than its
+// owner's current role.
+func (s *Server) tokenUser(r *http.Request) (user *sessionUser, hasToken bool) {
+	secret, hasToken := bearerToken(r)
+	if !hasToken {
+		return nil, false
+	}
+	tokenStore, ok := s.store.(storage.TokenStore)
+	if !ok {
+		return nil, true
+	}
+	token, err := tokenStore.GetAPITokenByHash(auth.HashToken(secret))
+	if err != nil || !token.Active(time.Now()) {
+		return nil, true
+	}
+
+	user = &sessionUser{Username: token.Owner, Role: models.ScopeRole(token.Scope), Provider: providerToken}
+	if token.Kind == models.TokenService {
+		user.Username = "token:" + token.Name
+	} else if userStore, ok := s.store.(storage.UserStore); ok {
+		// Owners without a local account logged in with single sign-on; their
+		// token scope was limited to their role when it was created.
+		if owner, err := userStore.GetUser(token.Owner); err == nil && !models.RoleAllows(owner.Role, user.Role) {
+			user.Role = owner.Role
+			if token.Scope == models.ScopeAgent {
+				// An agent token of an owner who is no longer admin allows nothing.
+				user.Role = ""
+			}
+		}
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > tokenTouchInterval {
+		if err := tokenStore.TouchAPIToken(token.ID); err != nil {
+			utils.Log.WithField("error", err).Warn("Error recording token use")
+		}
+	}
+	return user, true
+}
+
+// bearerToken returns the bearer token of a request, if it has one.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, secret, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(secret), true
+}
+
+// startSession logs a user in to the session of a request. The CSRF token is
+// replaced, so that a token planted before the login cannot be used after it.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user sessionUser) error {
+	csrf, err := auth.RandomToken()
+	if err != nil {
+		return err
+	}
+	session, _ := s.sessionStore.Get(r, sessionName)
+	session.Values[sessionCSRFKey] = csrf
+	session.Values[sessionUserKey] = user.Username
+	session.Values[sessionProviderKey] = user.Provider
+	session.Values[sessionExpiresKey] = time.Now().Add(sessionLifetime).Unix()
+	if user.Provider == providerOIDC {
+		session.Values[sessionRoleKey] = user.Role
+	} else {
+		delete(session.Values, sessionRoleKey)
+	}
+	return session.Save(r, w)
+}
+
+// requireRole wraps a page handler so that it only runs for logged-in users
+// with at least the given role. Anonymous users are sent to the login page.
+func (s *Server) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := s.sessionUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		if !models.RoleAllows(user.Role, role) {
+			http.Error(w, "Forbidden: this requires the "+role+" role", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(withUser(r.Context(), user)))
+	}
+}
+
+// requireAPIRole is requireRole for API endpoints, answering with JSON errors.
+// Requests are authenticated by a bearer token or, without one, by the
+// session. An empty role leaves the endpoint public.
+func (s *Server) requireAPIRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	if role == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, hasToken := s.tokenUser(r)
+		if hasToken && user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, "invalid, expired or revoked token")
+			return
+		}
+		if !hasToken {
+			user = s.sessionUser(r)
+		}
+		if user == nil {
+			writeAPIError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !models.RoleAllows(user.Role, role) {
+			writeAPIError(w, http.StatusForbidden, "this requires the "+role+" role")
+			return
+		}
+		next(w, r.WithContext(withUser(r.Context(), user)))
+	}
+}
+
+func (s *Server) handleLoginForm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := loginPageData{Next: safeNext(r.URL.Query().Get("next")), OIDC: s.oidc != nil}
+		if userStore, ok := s.store.(storage.UserStore); ok {
+			if users, err := userStore.ListUsers(); err == nil && len(users) == 0 && s.oidc == nil {
+				data.NoUsers = true
+			}
+		}
+		s.renderTemplate(w, r, "login.html", data)
+	}
+}
+
+func (s *Server) handleLoginSubmit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		username := strings.TrimSpace(r.FormValue("username"))
+		next := safeNext(r.FormValue("next"))
+
+		userStore, ok := s.store.(storage.UserStore)
+		if !ok {
+			http.Error(w, "This store does not support user accounts", http.StatusInternalServerError)
+			return
+		}
+
+		hash := ""
+		user, err := userStore.GetUser(username)
+		if err == nil {
+			hash = user.PasswordHash
+		}
+		if !auth.CheckPassword(hash, r.FormValue("password")) {
+			utils.Log.WithFields(map[string]interface{}{
+				"user":   username,
+				"remote": r.RemoteAddr,
+			}).Warn("Failed login")
+			w.WriteHeader(http.StatusUnauthorized)
+			s.renderTemplate(w, r, "login.html", loginPageData{Next: next, Error: auth.ErrInvalidCredentials.Error(), OIDC: s.oidc != nil})
+			return
+		}
+
+		if err := s.startSession(w, r, sessionUser{Username: user.Username, Role: user.Role, Provider: providerLocal}); err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			return
+		}
+		if err := userStore.RecordLogin(user.Username); err != nil {
+			utils.Log.WithField("error", err).Warn("Error recording login")
+		}
+		utils.Log.WithField("user", user.Username).Info("User logged in")
+
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	}
+}
+
+// handleLogout ends the session. Single sign-on users are also logged out of
+// the provider when it supports RP-initiated logout.
+func (s *Server) handleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := s.sessionUser(r)
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		for _, key := range []string{sessionUserKey, sessionProviderKey, sessionRoleKey, sessionExpiresKey} {
+			delete(session.Values, key)
+		}
+		session.Save(r, w)
+
+		if user != nil && user.Provider == providerOIDC {
+			if logoutURL, ok := s.oidc.LogoutURL(s.oidcLoginURL()); ok {
+				http.Redirect(w, r, logoutURL, http.StatusSeeOther)
+				return
+			}
+		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
+
+// safeNext returns the local path to go to after logging in. Anything that
+// could lead off-site falls back to the home page.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
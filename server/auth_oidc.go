@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// Session keys of a single sign-on login in progress.
+const (
+	sessionOIDCStateKey    = "oidc_state"
+	sessionOIDCNonceKey    = "oidc_nonce"
+	sessionOIDCVerifierKey = "oidc_verifier"
+	sessionOIDCNextKey     = "oidc_next"
+)
+
+// handleOIDCLogin starts an authorization code flow with PKCE. The state,
+// nonce and code verifier are kept in the session until the callback.
+func (s *Server) handleOIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		var values [3]string
+		for i := range values {
+			v, err := auth.RandomToken()
+			if err != nil {
+				http.Error(w, "Failed to start login", http.StatusInternalServerError)
+				return
+			}
+			values[i] = v
+		}
+		state, nonce, verifier := values[0], values[1], values[2]
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		session.Values[sessionOIDCStateKey] = state
+		session.Values[sessionOIDCNonceKey] = nonce
+		session.Values[sessionOIDCVerifierKey] = verifier
+		session.Values[sessionOIDCNextKey] = safeNext(r.URL.Query().Get("next"))
+		if err := session.Save(r, w); err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, s.oidc.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+	}
+}
+
+// handleOIDCCallback completes a single sign-on login and maps the user's
+// groups to a role.
+func (s *Server) handleOIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.oidc == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		state, _ := session.Values[sessionOIDCStateKey].(string)
+		nonce, _ := session.Values[sessionOIDCNonceKey].(string)
+		verifier, _ := session.Values[sessionOIDCVerifierKey].(string)
+		next, _ := session.Values[sessionOIDCNextKey].(string)
+		for _, key := range []string{sessionOIDCStateKey, sessionOIDCNonceKey, sessionOIDCVerifierKey, sessionOIDCNextKey} {
+			delete(session.Values, key)
+		}
+		session.Save(r, w)
+
+		q := r.URL.Query()
+		fail := func(status int, message string) {
+			w.WriteHeader(status)
+			s.renderTemplate(w, r, "login.html", loginPageData{Next: safeNext(next), Error: message, OIDC: true})
+		}
+		if e := q.Get("error"); e != "" {
+			utils.Log.WithField("error", e).WithField("description", q.Get("error_description")).Warn("Single sign-on failed")
+			fail(http.StatusUnauthorized, "Single sign-on failed: "+e)
+			return
+		}
+		if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(q.Get("state"))) != 1 {
+			fail(http.StatusBadRequest, "Single sign-on failed: the login expired or was started elsewhere. Please try again.")
+			return
+		}
+
+		claims, err := s.oidc.Exchange(r.Context(), q.Get("code"), verifier, nonce)
+		if err != nil {
+			utils.Log.WithField("error", err).Warn("Single sign-on failed")
+			fail(http.StatusUnauthorized, "Single sign-on failed.")
+			return
+		}
+		role, ok := s.oidc.Role(claims)
+		if !ok {
+			utils.Log.WithFields(map[string]interface{}{
+				"user":   claims.Username,
+				"groups": claims.Groups,
+			}).Warn("Single sign-on user is in no mapped group")
+			fail(http.StatusForbidden, "Your account is not in any group that may use netcfg-backup.")
+			return
+		}
+
+		if err := s.startSession(w, r, sessionUser{Username: claims.Username, Role: role, Provider: providerOIDC}); err != nil {
+			http.Error(w, "Failed to save session", http.StatusInternalServerError)
+			return
+		}
+		utils.Log.WithField("user", claims.Username).WithField("role", role).Info("User logged in with single sign-on")
+
+		http.Redirect(w, r, safeNext(next), http.StatusSeeOther)
+	}
+}
+
+// oidcLoginURL is where the provider sends users back to after logging out:
+// the login page on the host of the callback URL.
+func (s *Server) oidcLoginURL() string {
+	u, err := url.Parse(s.oidc.RedirectURL())
+	if err != nil {
+		return "/login"
+	}
+	u.Path = "/login"
+	u.RawQuery = ""
+	return u.String()
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 
 	"github.com/cobrich/netcfg-backup/backups"
+	"github.com/cobrich/netcfg-backup/core"
 	"github.com/cobrich/netcfg-backup/models"
 	"github.com/cobrich/netcfg-backup/utils"
 	"github.com/gorilla/mux"
@@ -14,6 +17,7 @@ import (
 func (s *Server) handleDevicesList() http.HandlerFunc {
 	type PageData struct {
 		Devices         []models.Device
+		Facts           map[string]models.DeviceFacts
 		FlashMessages   []interface{}
 		IsBackupRunning bool
 	}
@@ -25,17 +29,18 @@ func (s *Server) handleDevicesList() http.HandlerFunc {
 			return
 		}
 
-		session, _ := s.sessionStore.Get(r, "netcfg-backup-session")
+		session, _ := s.sessionStore.Get(r, sessionName)
 		flashes := session.Flashes()
 		session.Save(r, w)
 
 		data := PageData{
 			Devices:         devices,
+			Facts:           s.latestFacts(),
 			FlashMessages:   flashes,
-			IsBackupRunning: s.isBackupRunning,
+			IsBackupRunning: s.coreService.IsRunning(),
 		}
 
-		renderTemplate(w, "devices.html", data)
+		s.renderTemplate(w, r, "devices.html", data)
 	}
 }
 
@@ -43,9 +48,11 @@ func (s *Server) handleDeviceAddForm() http.HandlerFunc {
 	type PageData struct {
 		Device      models.Device
 		CommandsStr string
+		TagsStr     string
+		Platforms   []string
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		renderTemplate(w, "device_form.html", PageData{})
+		s.renderTemplate(w, r, "device_form.html", PageData{Platforms: models.Platforms})
 	}
 }
 
@@ -72,6 +79,9 @@ func (s *Server) handleDeviceAddSubmit() http.HandlerFunc {
 			KeyPath:     r.FormValue("key_path"),
 			PasswordEnv: r.FormValue("password_env"),
 			Prompt:      r.FormValue("prompt"),
+			Platform:    r.FormValue("platform"),
+			Tags:        models.ParseTags(r.FormValue("tags")),
+			Role:        strings.TrimSpace(r.FormValue("role")),
 			Commands:    commands,
 		}
 
@@ -87,6 +97,8 @@ func (s *Server) handleDeviceEditForm() http.HandlerFunc {
 	type PageData struct {
 		Device      models.Device
 		CommandsStr string
+		TagsStr     string
+		Platforms   []string
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -99,7 +111,12 @@ func (s *Server) handleDeviceEditForm() http.HandlerFunc {
 
 		commandsStr := strings.Join(device.Commands, "\n")
 
-		renderTemplate(w, "device_form.html", PageData{Device: *device, CommandsStr: commandsStr})
+		s.renderTemplate(w, r, "device_form.html", PageData{
+			Device:      *device,
+			CommandsStr: commandsStr,
+			TagsStr:     strings.Join(device.Tags, ", "),
+			Platforms:   models.Platforms,
+		})
 	}
 }
 
@@ -121,6 +138,12 @@ func (s *Server) handleDeviceEditSubmit() http.HandlerFunc {
 			}
 		}
 
+		existing, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
 		updatedDevice := models.Device{
 			Host:        host,
 			Username:    r.FormValue("username"),
@@ -128,6 +151,11 @@ func (s *Server) handleDeviceEditSubmit() http.HandlerFunc {
 			KeyPath:     r.FormValue("key_path"),
 			PasswordEnv: r.FormValue("password_env"),
 			Prompt:      r.FormValue("prompt"),
+			Platform:    r.FormValue("platform"),
+			Status:      existing.Status, // The status is changed only by approval
+			HTTP:        existing.HTTP,   // HTTP settings are edited through the API and the CLI
+			Tags:        models.ParseTags(r.FormValue("tags")),
+			Role:        strings.TrimSpace(r.FormValue("role")),
 			Commands:    commands,
 		}
 
@@ -154,6 +182,28 @@ func (s *Server) handleDeviceRemove() http.HandlerFunc {
 	}
 }
 
+// handleDeviceApprove marks a pending device as active so it is included in backups.
+func (s *Server) handleDeviceApprove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		host := vars["host"]
+
+		device, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		device.Status = models.DeviceStatusActive
+		if err := s.store.UpdateDevice(*device); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to approve device: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
 // handleBackupHostsList shows a list of hosts that have backups.
 func (s *Server) handleBackupHostsList() http.HandlerFunc {
 	type PageData struct {
@@ -165,7 +215,7 @@ func (s *Server) handleBackupHostsList() http.HandlerFunc {
 			http.Error(w, "Failed to list backup hosts", http.StatusInternalServerError)
 			return
 		}
-		renderTemplate(w, "backups_hosts.html", PageData{Hosts: hosts})
+		s.renderTemplate(w, r, "backups_hosts.html", PageData{Hosts: hosts})
 	}
 }
 
@@ -174,6 +224,7 @@ func (s *Server) handleBackupFilesList() http.HandlerFunc {
 	type PageData struct {
 		Host    string
 		Backups []backups.BackupInfo
+		Files   map[string][]models.FetchedFile // files fetched with each backup
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -183,7 +234,18 @@ func (s *Server) handleBackupFilesList() http.HandlerFunc {
 			http.Error(w, "Failed to list backups for host", http.StatusInternalServerError)
 			return
 		}
-		renderTemplate(w, "backups_files.html", PageData{Host: host, Backups: backupList})
+
+		files := map[string][]models.FetchedFile{}
+		for _, backup := range backupList {
+			path, ok := s.backupFilePath(host, backup.Filename)
+			if !ok || filepath.Ext(path) != ".txt" {
+				continue
+			}
+			if fetched, err := utils.ReadFetchedFiles(path); err == nil && fetched != nil {
+				files[backup.Filename] = fetched
+			}
+		}
+		s.renderTemplate(w, r, "backups_files.html", PageData{Host: host, Backups: backupList, Files: files})
 	}
 }
 
@@ -203,29 +265,29 @@ func (s *Server) handleBackupView() http.HandlerFunc {
 			http.Error(w, "Failed to read backup file", http.StatusInternalServerError)
 			return
 		}
-		renderTemplate(w, "backup_view.html", PageData{Host: host, Filename: filename, Content: content})
+		s.renderTemplate(w, r, "backup_view.html", PageData{Host: host, Filename: filename, Content: content})
 	}
 }
 
 // handleRunBackup triggers the backup process in the background.
 func (s *Server) handleRunBackup() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.isBackupRunning {
+		_, err := s.coreService.StartRun(models.DeviceSelector{}, core.TriggerWeb)
+		if errors.Is(err, core.ErrRunInProgress) {
 			http.Error(w, "A backup process is already running.", http.StatusConflict)
 			return
 		}
 
-		go func() {
-			s.isBackupRunning = true
-			defer func() { s.isBackupRunning = false }()
-
-			if err := s.coreService.Run(); err != nil {
-				utils.Log.Errorf("Background backup run failed: %v", err)
-			}
-		}()
-
-		session, _ := s.sessionStore.Get(r, "netcfg-backup-session")
-		session.AddFlash("✅ Backup process started in the background!")
+		session, _ := s.sessionStore.Get(r, sessionName)
+		switch {
+		case errors.Is(err, core.ErrNoDevices):
+			session.AddFlash("Device list is empty. Nothing to back up.")
+		case err != nil:
+			utils.Log.Errorf("Background backup run failed: %v", err)
+			session.AddFlash(fmt.Sprintf("❌ Backup run failed to start: %v", err))
+		default:
+			session.AddFlash("✅ Backup process started in the background!")
+		}
 		session.Save(r, w)
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/gorilla/mux"
+)
+
+// agentPollTimeout is how long a request for the next agent job waits for one.
+const agentPollTimeout = 25 * time.Second
+
+func (s *Server) handleAPIRegisterAgent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reg models.AgentRegistration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid registration: %v", err))
+			return
+		}
+		agent, err := s.coreService.RegisterAgent(reg.Name, reg.Sites)
+		if err != nil {
+			writeAgentError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, agent)
+	}
+}
+
+func (s *Server) handleAPIListAgents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.coreService.Agents())
+	}
+}
+
+func (s *Server) handleAPIAgentHeartbeat() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beat, err := s.coreService.AgentHeartbeat(mux.Vars(r)["name"])
+		if err != nil {
+			writeAgentError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, beat)
+	}
+}
+
+func (s *Server) handleAPINextAgentJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), agentPollTimeout)
+		defer cancel()
+		job, err := s.coreService.NextAgentJob(ctx, mux.Vars(r)["name"])
+		switch {
+		case err != nil:
+			writeAgentError(w, err)
+		case job == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(w, http.StatusOK, job)
+		}
+	}
+}
+
+func (s *Server) handleAPIAgentResult() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		var result models.AgentResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid job result: %v", err))
+			return
+		}
+		if err := s.coreService.CompleteAgentJob(mux.Vars(r)["name"], id, result); err != nil {
+			writeAgentError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeAgentError maps an agent error to the matching status.
+func writeAgentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrInvalidAgent):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, core.ErrUnknownAgent):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, core.ErrUnknownAgentJob):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	}
+}
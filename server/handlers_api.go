@@ -0,0 +1,503 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/gorilla/mux"
+)
+
+// redactDevice hides the stored password of a device in API responses.
+func redactDevice(dev models.Device) models.Device {
+	dev.Password = ""
+	return dev
+}
+
+// decodeDevice reads and validates a device from a request body. The host
+// defaults to host when the body has none.
+func decodeDevice(r *http.Request, host string) (models.Device, error) {
+	dev := models.Device{Host: host}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&dev); err != nil {
+		return dev, fmt.Errorf("invalid device: %v", err)
+	}
+
+	dev.Host = strings.TrimSpace(dev.Host)
+	if dev.Protocol == "" {
+		dev.Protocol = "ssh"
+	}
+	if dev.Platform == "" {
+		dev.Platform = models.PlatformGeneric
+	}
+	switch {
+	case dev.Host == "":
+		return dev, errors.New("host is required")
+	case !knownProtocol(dev.Protocol):
+		return dev, fmt.Errorf("unknown protocol '%s' (%s)", dev.Protocol, strings.Join(models.Protocols, ", "))
+	case !models.ValidPlatform(dev.Platform):
+		return dev, fmt.Errorf("unknown platform '%s'", dev.Platform)
+	case dev.Status != "" && dev.Status != models.DeviceStatusActive && dev.Status != models.DeviceStatusPending:
+		return dev, fmt.Errorf("unknown status '%s'", dev.Status)
+	case dev.HTTP != nil:
+		if err := dev.HTTP.Validate(); err != nil {
+			return dev, err
+		}
+	}
+	return dev, nil
+}
+
+func knownProtocol(protocol string) bool {
+	for _, p := range models.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleAPIListDevices() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		devices, err := s.store.GetAllDevices()
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		out := make([]models.Device, 0, len(devices))
+		for _, dev := range devices {
+			out = append(out, redactDevice(dev))
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func (s *Server) handleAPIAddDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dev, err := decodeDevice(r, "")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.store.AddDevice(dev); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("Location", APIPrefix+"/devices/"+dev.Host)
+		writeJSON(w, http.StatusCreated, redactDevice(dev))
+	}
+}
+
+func (s *Server) handleAPIGetDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dev, err := s.store.GetDeviceByHost(mux.Vars(r)["host"])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, redactDevice(*dev))
+	}
+}
+
+// handleAPIUpdateDevice replaces a device. The host in the path wins; a
+// password left out of the body keeps the stored one.
+func (s *Server) handleAPIUpdateDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+		existing, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		dev, err := decodeDevice(r, host)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if dev.Host != host {
+			writeAPIError(w, http.StatusBadRequest, "host in body does not match the path")
+			return
+		}
+		if dev.Password == "" {
+			dev.Password = existing.Password
+		}
+		if err := s.store.UpdateDevice(dev); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, redactDevice(dev))
+	}
+}
+
+func (s *Server) handleAPIRemoveDevice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.store.RemoveDevice(mux.Vars(r)["host"]); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleAPIStartRun starts a backup run in the background and returns it
+// immediately; poll /runs/{id} for its progress.
+func (s *Server) handleAPIStartRun() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apiRunRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid run request: %v", err))
+				return
+			}
+		}
+
+		sel := req.Selector
+		if req.Host != "" {
+			dev, err := s.store.GetDeviceByHost(req.Host)
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+			if dev.IsPending() {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("device '%s' is pending approval", dev.Host))
+				return
+			}
+			sel = models.DeviceSelector{Hosts: []string{dev.Host}}
+		}
+
+		run, err := s.coreService.StartRun(sel, core.TriggerAPI)
+		switch {
+		case errors.Is(err, core.ErrRunInProgress):
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		case errors.Is(err, core.ErrNoDevices):
+			writeAPIError(w, http.StatusBadRequest, "the selector matches no active devices")
+			return
+		case err != nil:
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if run.ID != 0 {
+			w.Header().Set("Location", fmt.Sprintf("%s/runs/%d", APIPrefix, run.ID))
+		}
+		writeJSON(w, http.StatusAccepted, run)
+	}
+}
+
+// handleAPIBackupWebhook queues a backup for automation clients. The
+// idempotency key may also be sent in the Idempotency-Key header; a repeated
+// key returns the first ticket with 200 instead of 202, or 422 when it comes
+// with a different request.
+func (s *Server) handleAPIBackupWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.BackupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid backup request: %v", err))
+			return
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			req.IdempotencyKey = key
+		}
+
+		ticket, replayed, err := s.coreService.RequestBackup(s.currentUser(r), req)
+		switch {
+		case errors.Is(err, core.ErrNoDevices):
+			writeAPIError(w, http.StatusBadRequest, "the selector matches no active devices")
+			return
+		case errors.Is(err, core.ErrInvalidRequest):
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, core.ErrIdempotencyMismatch):
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		case errors.Is(err, core.ErrNoRunHistory):
+			writeAPIError(w, http.StatusNotImplemented, err.Error())
+			return
+		case err != nil:
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/runs/%d", APIPrefix, ticket.RunID))
+		status := http.StatusAccepted
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+			status = http.StatusOK
+		}
+		writeJSON(w, status, ticket)
+	}
+}
+
+func (s *Server) handleAPIListRuns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runStore, ok := s.store.(storage.RunStore)
+		if !ok {
+			writeAPIError(w, http.StatusNotImplemented, "this store does not keep run history")
+			return
+		}
+		runs, err := runStore.ListRuns(queryInt(r, "limit", 20))
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if runs == nil {
+			runs = []models.Run{}
+		}
+		writeJSON(w, http.StatusOK, runs)
+	}
+}
+
+func (s *Server) handleAPIGetRun() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runStore, ok := s.store.(storage.RunStore)
+		if !ok {
+			writeAPIError(w, http.StatusNotImplemented, "this store does not keep run history")
+			return
+		}
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "run not found")
+			return
+		}
+		run, err := runStore.GetRun(id)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		results, err := runStore.GetRunResults(id)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if results == nil {
+			results = []models.RunResult{}
+		}
+		detail := apiRunDetail{Run: *run, Results: results}
+		if queue, ok := s.store.(storage.JobQueueStore); ok {
+			if detail.Jobs, err = queue.ListRunJobs(id); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, detail)
+	}
+}
+
+func (s *Server) handleAPIListBackupHosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hosts, err := s.backupService.ListBackedUpHosts()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if hosts == nil {
+			hosts = []string{}
+		}
+		writeJSON(w, http.StatusOK, hosts)
+	}
+}
+
+func (s *Server) handleAPIListBackups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+		if !validBackupHost(host) {
+			writeAPIError(w, http.StatusNotFound, "host not found")
+			return
+		}
+		files, err := s.backupService.ListBackupsForHost(host)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no backups found for host '%s'", host))
+			return
+		}
+		out := make([]apiBackupFile, 0, len(files))
+		for _, f := range files {
+			out = append(out, apiBackupFile{Filename: f.Filename, Size: f.Size})
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func (s *Server) handleAPIDownloadBackup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		path, ok := s.backupFilePath(vars["host"], vars["filename"])
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		w.Write(data)
+	}
+}
+
+// handleAPIListFetchedFiles lists the files fetched from the device with a backup.
+func (s *Server) handleAPIListFetchedFiles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		path, ok := s.backupFilePath(vars["host"], vars["filename"])
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		files, err := utils.ReadFetchedFiles(path)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if files == nil {
+			files = []models.FetchedFile{}
+		}
+		writeJSON(w, http.StatusOK, files)
+	}
+}
+
+// handleAPIDownloadFetchedFile downloads a file fetched from the device with a backup.
+func (s *Server) handleAPIDownloadFetchedFile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		path, ok := s.backupFilePath(vars["host"], vars["filename"])
+		if ok {
+			path, ok = fetchedFilePath(path, vars["name"])
+		}
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		serveFetchedFile(w, r, path)
+	}
+}
+
+// handleAPIDiffBackups compares the configuration in two backups of a host.
+func (s *Server) handleAPIDiffBackups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+		toName := r.URL.Query().Get("to")
+		if toName == "" {
+			toName = "latest"
+		}
+		toPath, ok := s.backupFilePath(host, toName)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+
+		fromName := r.URL.Query().Get("from")
+		var fromPath string
+		if fromName == "" {
+			fromPath, ok = s.previousBackup(host, toPath)
+		} else {
+			fromPath, ok = s.backupFilePath(host, fromName)
+		}
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "no earlier backup to compare with")
+			return
+		}
+
+		from, err := utils.ReadBackupFile(fromPath)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+		to, err := utils.ReadBackupFile(toPath)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "backup not found")
+			return
+		}
+
+		// Backups of removed devices are compared with the commands of every platform.
+		platform := ""
+		if dev, err := s.store.GetDeviceByHost(host); err == nil {
+			platform = dev.Platform
+		}
+		toConfig, err := core.RunningConfig(platform, to)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s: %v", filepath.Base(toPath), err))
+			return
+		}
+		fromConfig, err := core.RunningConfig(platform, from)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s: %v", filepath.Base(fromPath), err))
+			return
+		}
+
+		// Comparing "to" as the intent against "from" reports new lines as missing.
+		diff := configdiff.Compare(toConfig, fromConfig, configdiff.Options{Strict: true})
+		out := apiBackupDiff{
+			Host:    host,
+			From:    filepath.Base(fromPath),
+			To:      filepath.Base(toPath),
+			Added:   []string{},
+			Removed: []string{},
+		}
+		for _, c := range diff.Missing {
+			out.Added = append(out.Added, c.String())
+		}
+		for _, c := range diff.Extra {
+			out.Removed = append(out.Removed, c.String())
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// previousBackup returns the backup of a host taken right before the given one.
+func (s *Server) previousBackup(host, path string) (string, bool) {
+	files, err := utils.ListBackupFiles(s.coreService.BasePath(), host)
+	if err != nil {
+		return "", false
+	}
+	for i, f := range files {
+		if filepath.Base(f) == filepath.Base(path) && i > 0 {
+			return files[i-1], true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) handleAPISpec() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, OpenAPISpec())
+	}
+}
+
+// handleAPICancelRun cancels the run in progress, or a single device of it
+// when the path names a host.
+func (s *Server) handleAPICancelRun() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "run not found")
+			return
+		}
+		if host := mux.Vars(r)["host"]; host != "" {
+			err = s.coreService.CancelDevice(id, host)
+		} else {
+			err = s.coreService.CancelRun(id)
+		}
+		if errors.Is(err, core.ErrNotRunning) {
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
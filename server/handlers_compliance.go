@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/compliance"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/gorilla/mux"
+)
+
+// handleCompliance shows the compliance dashboard: a summary per device and the
+// list of violations. With a host in the path, it shows every rule of that device.
+func (s *Server) handleCompliance() http.HandlerFunc {
+	type DeviceSummary struct {
+		Host       string
+		Checked    int
+		Violations map[string]int
+		Total      int
+		CheckedAt  time.Time
+	}
+	type PageData struct {
+		Host       string
+		Severities []string
+		Summaries  []DeviceSummary
+		Results    []models.ComplianceResult
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+
+		complianceStore, ok := s.store.(storage.ComplianceStore)
+		if !ok {
+			http.Error(w, "Compliance is not supported by this store", http.StatusNotImplemented)
+			return
+		}
+		results, err := complianceStore.GetComplianceResults(host)
+		if err != nil {
+			http.Error(w, "Failed to load compliance results", http.StatusInternalServerError)
+			return
+		}
+
+		byHost := make(map[string][]models.ComplianceResult)
+		for _, res := range results {
+			byHost[res.Host] = append(byHost[res.Host], res)
+		}
+
+		data := PageData{Host: host, Severities: models.Severities}
+		for h, hostResults := range byHost {
+			summary := DeviceSummary{
+				Host:       h,
+				Checked:    len(hostResults),
+				Violations: compliance.CountViolations(hostResults),
+				CheckedAt:  hostResults[0].CheckedAt,
+			}
+			for _, n := range summary.Violations {
+				summary.Total += n
+			}
+			data.Summaries = append(data.Summaries, summary)
+		}
+		sort.Slice(data.Summaries, func(i, j int) bool {
+			if data.Summaries[i].Total != data.Summaries[j].Total {
+				return data.Summaries[i].Total > data.Summaries[j].Total
+			}
+			return data.Summaries[i].Host < data.Summaries[j].Host
+		})
+
+		// The dashboard lists violations only; the device page lists every rule.
+		for _, res := range results {
+			if host != "" || !res.Passed {
+				data.Results = append(data.Results, res)
+			}
+		}
+
+		s.renderTemplate(w, r, "compliance.html", data)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/cobrich/netcfg-backup/configdiff"
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/golden"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/gorilla/mux"
+)
+
+// handleDrift compares the golden config of a device with its latest backup.
+// Add ?strict=1 to also report top-level lines the template does not mention.
+func (s *Server) handleDrift() http.HandlerFunc {
+	type Variable struct {
+		Name  string
+		Value string
+	}
+	type PageData struct {
+		Host   string
+		Strict bool
+		Error  string
+		Report *core.DriftReport
+		Vars   []Variable
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+
+		dev, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		if s.golden == nil {
+			http.Error(w, "Golden config templates are not configured", http.StatusNotImplemented)
+			return
+		}
+
+		data := PageData{Host: host, Strict: r.URL.Query().Get("strict") == "1"}
+
+		if varStore, ok := s.store.(storage.VariableStore); ok {
+			if vars, err := varStore.GetDeviceVars(host); err == nil {
+				for name, value := range vars {
+					data.Vars = append(data.Vars, Variable{Name: name, Value: value})
+				}
+				sort.Slice(data.Vars, func(i, j int) bool { return data.Vars[i].Name < data.Vars[j].Name })
+			}
+		}
+
+		report, err := s.coreService.DetectDrift(s.golden, *dev, configdiff.Options{Strict: data.Strict})
+		switch {
+		case errors.Is(err, golden.ErrNoRole):
+			data.Error = "This device has no role. Set one to compare it with a golden config template."
+		case errors.Is(err, os.ErrNotExist):
+			data.Error = "No golden template or backup found: " + err.Error()
+		case err != nil:
+			data.Error = err.Error()
+		default:
+			data.Report = report
+		}
+
+		s.renderTemplate(w, r, "drift.html", data)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/gorilla/mux"
+)
+
+// latestFacts returns the latest facts of every device, or an empty map when
+// the store does not keep facts.
+func (s *Server) latestFacts() map[string]models.DeviceFacts {
+	factsStore, ok := s.store.(storage.FactsStore)
+	if !ok {
+		return map[string]models.DeviceFacts{}
+	}
+	latest, err := factsStore.GetLatestFacts()
+	if err != nil {
+		utils.Log.Errorf("Failed to load device facts: %v", err)
+		return map[string]models.DeviceFacts{}
+	}
+	return latest
+}
+
+// handleDeviceFacts shows the facts history of a device.
+func (s *Server) handleDeviceFacts() http.HandlerFunc {
+	type PageData struct {
+		Host    string
+		History []models.DeviceFacts
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		host := vars["host"]
+
+		factsStore, ok := s.store.(storage.FactsStore)
+		if !ok {
+			http.Error(w, "Facts are not supported by this store", http.StatusNotImplemented)
+			return
+		}
+		history, err := factsStore.GetFactsHistory(host, 50)
+		if err != nil {
+			http.Error(w, "Failed to load facts", http.StatusInternalServerError)
+			return
+		}
+		s.renderTemplate(w, r, "device_facts.html", PageData{Host: host, History: history})
+	}
+}
+
+// handleInventoryReport shows device counts per model and OS version.
+func (s *Server) handleInventoryReport() http.HandlerFunc {
+	type PageData struct {
+		Report core.InventoryReport
+		Total  int
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		latest := s.latestFacts()
+		s.renderTemplate(w, r, "inventory.html", PageData{Report: core.BuildInventoryReport(latest), Total: len(latest)})
+	}
+}
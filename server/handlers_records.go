@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/parser"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/gorilla/mux"
+)
+
+// backupFilePath resolves a backup file of a host inside the backup directory.
+// The filename "latest" selects the most recent backup.
+func (s *Server) backupFilePath(host, filename string) (string, bool) {
+	if !validBackupHost(host) {
+		return "", false
+	}
+	if filename == "latest" {
+		path, err := utils.LatestBackupFile(s.coreService.BasePath(), host)
+		return path, err == nil
+	}
+	if filepath.Base(filename) != filename || strings.Contains(filename, "..") {
+		return "", false
+	}
+	return filepath.Join(s.coreService.BasePath(), host, filename), true
+}
+
+// fetchedFilePath returns the path of a file fetched with a backup, checking
+// that it is listed in the manifest of the backup.
+func fetchedFilePath(backupPath, name string) (string, bool) {
+	files, err := utils.ReadFetchedFiles(backupPath)
+	if err != nil {
+		return "", false
+	}
+	for _, file := range files {
+		if file.Name == name && filepath.Base(name) == name {
+			return filepath.Join(utils.FilesDir(backupPath), name), true
+		}
+	}
+	return "", false
+}
+
+// serveFetchedFile sends a fetched file as a download.
+func serveFetchedFile(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
+
+// handleFetchedFileDownload downloads a file fetched from the device with a backup.
+func (s *Server) handleFetchedFileDownload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		path, ok := s.backupFilePath(vars["host"], vars["filename"])
+		if ok {
+			path, ok = fetchedFilePath(path, vars["name"])
+		}
+		if !ok {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		serveFetchedFile(w, r, path)
+	}
+}
+
+// validBackupHost reports whether a host names a directory directly inside the backup directory.
+func validBackupHost(host string) bool {
+	return host != "" && !strings.Contains(host, "..") && filepath.Base(host) == host
+}
+
+// handleBackupRecords returns the structured records of a backup as JSON.
+// An optional "type" query parameter selects one record type.
+func (s *Server) handleBackupRecords() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		host := vars["host"]
+
+		path, ok := s.backupFilePath(host, vars["filename"])
+		if !ok {
+			http.Error(w, "Backup not found", http.StatusNotFound)
+			return
+		}
+
+		dev := models.Device{Host: host, Platform: models.PlatformGeneric}
+		if stored, err := s.store.GetDeviceByHost(host); err == nil {
+			dev = *stored
+		}
+
+		doc, err := core.LoadRecords(dev, path)
+		if err != nil {
+			http.Error(w, "Backup not found", http.StatusNotFound)
+			return
+		}
+		doc.Records = parser.Filter(doc.Records, r.URL.Query().Get("type"))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/cobrich/netcfg-backup/utils"
+	"github.com/gorilla/mux"
+)
+
+// restorePageData is shared by the restore form and its preview.
+type restorePageData struct {
+	Host           string
+	File           string
+	Lines          string
+	Merge          bool
+	ReplaceURL     string
+	ConfirmMinutes int
+	Preview        *core.PushPreview
+	Error          string
+}
+
+// handleRestoreForm previews restoring a backup (?file=) or shows an empty form for pushing lines.
+func (s *Server) handleRestoreForm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+		dev, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		data := restorePageData{Host: host, File: r.URL.Query().Get("file"), ConfirmMinutes: 5}
+		if data.File != "" {
+			opts, err := s.restoreOptions(*dev, data)
+			if err == nil {
+				data.Preview, err = s.coreService.PreviewPush(*dev, opts)
+			}
+			if err != nil {
+				data.Error = err.Error()
+			}
+		}
+		s.renderTemplate(w, r, "restore.html", data)
+	}
+}
+
+// handleRestoreSubmit previews or applies a restore, depending on the "action" field.
+func (s *Server) handleRestoreSubmit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := mux.Vars(r)["host"]
+		dev, err := s.store.GetDeviceByHost(host)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		minutes, _ := strconv.Atoi(r.FormValue("confirm_minutes"))
+		if minutes <= 0 {
+			minutes = 5
+		}
+		data := restorePageData{
+			Host:           host,
+			File:           r.FormValue("file"),
+			Lines:          r.FormValue("lines"),
+			Merge:          r.FormValue("merge") == "on",
+			ReplaceURL:     strings.TrimSpace(r.FormValue("replace_url")),
+			ConfirmMinutes: minutes,
+		}
+
+		opts, err := s.restoreOptions(*dev, data)
+		if err != nil {
+			data.Error = err.Error()
+			s.renderTemplate(w, r, "restore.html", data)
+			return
+		}
+		opts.Force = r.FormValue("force") == "on"
+		opts.User = s.currentUser(r)
+
+		if r.FormValue("action") != "apply" {
+			data.Preview, err = s.coreService.PreviewPush(*dev, opts)
+			if err != nil {
+				data.Error = err.Error()
+			}
+			s.renderTemplate(w, r, "restore.html", data)
+			return
+		}
+
+		result, err := s.coreService.Push(*dev, opts)
+		if result == nil {
+			data.Error = err.Error()
+			s.renderTemplate(w, r, "restore.html", data)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/pushes/%d", result.ID), http.StatusSeeOther)
+	}
+}
+
+// restoreOptions builds the push options from the form: the lines of a backup
+// file to replace (or merge into) the running configuration, or lines to merge.
+func (s *Server) restoreOptions(dev models.Device, data restorePageData) (core.PushOptions, error) {
+	opts := core.PushOptions{
+		ReplaceURL:     data.ReplaceURL,
+		ConfirmTimeout: time.Duration(data.ConfirmMinutes) * time.Minute,
+	}
+
+	if strings.TrimSpace(data.Lines) != "" {
+		opts.Lines = strings.Split(strings.ReplaceAll(data.Lines, "\r\n", "\n"), "\n")
+		opts.Source = "lines"
+		return opts, nil
+	}
+	if data.File == "" {
+		return opts, errors.New("select a backup or enter configuration lines")
+	}
+
+	path, ok := s.backupFilePath(dev.Host, data.File)
+	if !ok {
+		return opts, errors.New("backup not found")
+	}
+	results, err := utils.ReadBackupFile(path)
+	if err != nil {
+		return opts, err
+	}
+	running, err := core.RunningConfig(dev.Platform, results)
+	if err != nil {
+		return opts, err
+	}
+	opts.Lines = strings.Split(running, "\n")
+	opts.Replace = !data.Merge
+	opts.Source = "backup:" + filepath.Base(path)
+	return opts, nil
+}
+
+// handlePushStatus shows the outcome of a push and lets a pending change be confirmed or rolled back.
+func (s *Server) handlePushStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid push ID", http.StatusBadRequest)
+			return
+		}
+		result, ok := s.coreService.PushStatus(id)
+		if !ok {
+			http.Error(w, "Push not found. Pushes made before a restart are only in the audit log.", http.StatusNotFound)
+			return
+		}
+		s.renderTemplate(w, r, "push.html", result)
+	}
+}
+
+// handlePushDecision confirms or rolls back a pending push.
+func (s *Server) handlePushDecision(confirm bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid push ID", http.StatusBadRequest)
+			return
+		}
+
+		if confirm {
+			err = s.coreService.ConfirmPush(id, s.currentUser(r))
+		} else {
+			err = s.coreService.RollbackPush(id, s.currentUser(r))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/pushes/%d", id), http.StatusSeeOther)
+	}
+}
+
+// handleAuditLog lists the audit log, optionally for one host (?host=).
+func (s *Server) handleAuditLog() http.HandlerFunc {
+	type PageData struct {
+		Host    string
+		Entries []models.AuditEntry
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		auditStore, ok := s.store.(storage.AuditStore)
+		if !ok {
+			http.Error(w, "The audit log is not supported by this store", http.StatusNotImplemented)
+			return
+		}
+		host := r.URL.Query().Get("host")
+		entries, err := auditStore.GetAuditLog(host, 200)
+		if err != nil {
+			http.Error(w, "Failed to load the audit log", http.StatusInternalServerError)
+			return
+		}
+		s.renderTemplate(w, r, "audit.html", PageData{Host: host, Entries: entries})
+	}
+}
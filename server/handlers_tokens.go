@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/cobrich/netcfg-backup/models"
+	"github.com/cobrich/netcfg-backup/storage"
+	"github.com/gorilla/mux"
+)
+
+// tokensPageData is the data of the API tokens page.
+type tokensPageData struct {
+	Tokens   []models.APIToken
+	Scopes   []string
+	IsAdmin  bool
+	NewToken string
+	Error    string
+	Now      time.Time
+}
+
+// tokensPage loads the tokens a user may see: their own, or all for admins.
+func (s *Server) tokensPage(r *http.Request, tokenStore storage.TokenStore) (tokensPageData, error) {
+	user := userFromContext(r.Context())
+	data := tokensPageData{
+		Scopes:  models.RoleScopes(user.Role),
+		IsAdmin: user.Role == models.RoleAdmin,
+		Now:     time.Now(),
+	}
+	owner := user.Username
+	if data.IsAdmin {
+		owner = ""
+	}
+	tokens, err := tokenStore.ListAPITokens(owner)
+	data.Tokens = tokens
+	return data, err
+}
+
+func (s *Server) handleTokensList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStore, ok := s.store.(storage.TokenStore)
+		if !ok {
+			http.Error(w, "This store does not support API tokens", http.StatusInternalServerError)
+			return
+		}
+		data, err := s.tokensPage(r, tokenStore)
+		if err != nil {
+			http.Error(w, "Failed to load API tokens", http.StatusInternalServerError)
+			return
+		}
+		s.renderTemplate(w, r, "tokens.html", data)
+	}
+}
+
+// handleTokenCreate creates a token and shows its secret once. Users can only
+// create tokens within their own role; only admins create service tokens.
+func (s *Server) handleTokenCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStore, ok := s.store.(storage.TokenStore)
+		if !ok {
+			http.Error(w, "This store does not support API tokens", http.StatusInternalServerError)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		user := userFromContext(r.Context())
+
+		kind := models.TokenPersonal
+		if r.FormValue("service") == "on" {
+			kind = models.TokenService
+		}
+		scope := r.FormValue("scope")
+		days, _ := strconv.Atoi(r.FormValue("days"))
+
+		var secret string
+		var createErr error
+		switch {
+		case kind == models.TokenService && user.Role != models.RoleAdmin:
+			createErr = errors.New("only admins can create service tokens")
+		case !models.RoleAllows(user.Role, models.ScopeRole(scope)):
+			createErr = fmt.Errorf("your role does not allow the '%s' scope", scope)
+		default:
+			var token models.APIToken
+			token, secret, createErr = auth.NewAPIToken(r.FormValue("name"), kind, user.Username, scope, time.Duration(days)*24*time.Hour)
+			if createErr == nil {
+				_, createErr = tokenStore.CreateAPIToken(token)
+			}
+		}
+
+		data, err := s.tokensPage(r, tokenStore)
+		if err != nil {
+			http.Error(w, "Failed to load API tokens", http.StatusInternalServerError)
+			return
+		}
+		if createErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			data.Error = createErr.Error()
+		} else {
+			data.NewToken = secret
+		}
+		s.renderTemplate(w, r, "tokens.html", data)
+	}
+}
+
+// handleTokenRevoke revokes a token of the user, or any token for admins.
+func (s *Server) handleTokenRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenStore, ok := s.store.(storage.TokenStore)
+		if !ok {
+			http.Error(w, "This store does not support API tokens", http.StatusInternalServerError)
+			return
+		}
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		token, err := tokenStore.GetAPIToken(id)
+		user := userFromContext(r.Context())
+		if err != nil || (token.Owner != user.Username && user.Role != models.RoleAdmin) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		if err := tokenStore.RevokeAPIToken(id); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+	}
+}
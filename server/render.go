@@ -4,17 +4,34 @@ import (
 	"html/template"
 	"net/http"
 	"path/filepath"
+
+	"github.com/cobrich/netcfg-backup/models"
 )
 
 // renderTemplate finds the specified template, combines it with the layout,
-// and writes the result to the http.ResponseWriter.
-func renderTemplate(w http.ResponseWriter, tmplName string, data interface{}) {
+// and writes the result to the http.ResponseWriter. Templates can call
+// currentUser and can "role" to adapt to the logged-in user, and must put
+// csrfField in every POST form.
+func (s *Server) renderTemplate(w http.ResponseWriter, r *http.Request, tmplName string, data interface{}) {
 	paths := []string{
 		"templates/layout.html",
 		filepath.Join("templates", tmplName),
 	}
 
-	tmpl, err := template.ParseFiles(paths...)
+	user := userFromContext(r.Context())
+	funcs := template.FuncMap{
+		"currentUser": func() *sessionUser { return user },
+		"can": func(role string) bool {
+			return user != nil && models.RoleAllows(user.Role, role)
+		},
+		"csrfToken": func() string { return csrfToken(r) },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfFormField + `" value="` + template.HTMLEscapeString(csrfToken(r)) + `">`)
+		},
+		"cspNonce": func() string { return cspNonce(r) },
+	}
+
+	tmpl, err := template.New(filepath.Base(paths[0])).Funcs(funcs).ParseFiles(paths...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -24,4 +41,4 @@ func renderTemplate(w http.ResponseWriter, tmplName string, data interface{}) {
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-}
\ No newline at end of file
+}
@@ -1,20 +1,54 @@
 // server/routes.go
 package server
 
+import "github.com/cobrich/netcfg-backup/models"
+
+// routes registers every page with the least user role allowed to use it.
 func (s *Server) routes() {
+	s.router.HandleFunc("/login", s.handleLoginForm()).Methods("GET")
+	s.router.HandleFunc("/login", s.handleLoginSubmit()).Methods("POST")
+	s.router.HandleFunc("/logout", s.handleLogout()).Methods("POST")
+	s.router.HandleFunc("/auth/oidc/login", s.handleOIDCLogin()).Methods("GET")
+	s.router.HandleFunc("/auth/oidc/callback", s.handleOIDCCallback()).Methods("GET")
+
 	// Our first route: the home page that lists all devices.
-	s.router.HandleFunc("/", s.handleDevicesList()).Methods("GET")
+	s.router.HandleFunc("/", s.requireRole(models.RoleViewer, s.handleDevicesList())).Methods("GET")
+
+	s.router.HandleFunc("/devices/add", s.requireRole(models.RoleAdmin, s.handleDeviceAddForm())).Methods("GET")
+	s.router.HandleFunc("/devices/add", s.requireRole(models.RoleAdmin, s.handleDeviceAddSubmit())).Methods("POST")
+
+	s.router.HandleFunc("/devices/edit/{host}", s.requireRole(models.RoleAdmin, s.handleDeviceEditForm())).Methods("GET")
+	s.router.HandleFunc("/devices/edit/{host}", s.requireRole(models.RoleAdmin, s.handleDeviceEditSubmit())).Methods("POST")
+	s.router.HandleFunc("/devices/remove/{host}", s.requireRole(models.RoleAdmin, s.handleDeviceRemove())).Methods("POST")
+	s.router.HandleFunc("/devices/approve/{host}", s.requireRole(models.RoleOperator, s.handleDeviceApprove())).Methods("POST")
+
+	s.router.HandleFunc("/devices/facts/{host}", s.requireRole(models.RoleViewer, s.handleDeviceFacts())).Methods("GET")
+	s.router.HandleFunc("/inventory", s.requireRole(models.RoleViewer, s.handleInventoryReport())).Methods("GET")
+
+	s.router.HandleFunc("/compliance", s.requireRole(models.RoleViewer, s.handleCompliance())).Methods("GET")
+	s.router.HandleFunc("/compliance/{host}", s.requireRole(models.RoleViewer, s.handleCompliance())).Methods("GET")
+	s.router.HandleFunc("/drift/{host}", s.requireRole(models.RoleViewer, s.handleDrift())).Methods("GET")
+
+	s.router.HandleFunc("/restore/{host}", s.requireRole(models.RoleOperator, s.handleRestoreForm())).Methods("GET")
+	s.router.HandleFunc("/restore/{host}", s.requireRole(models.RoleOperator, s.handleRestoreSubmit())).Methods("POST")
+	s.router.HandleFunc("/pushes/{id}", s.requireRole(models.RoleViewer, s.handlePushStatus())).Methods("GET")
+	s.router.HandleFunc("/pushes/{id}/confirm", s.requireRole(models.RoleOperator, s.handlePushDecision(true))).Methods("POST")
+	s.router.HandleFunc("/pushes/{id}/rollback", s.requireRole(models.RoleOperator, s.handlePushDecision(false))).Methods("POST")
+	s.router.HandleFunc("/audit", s.requireRole(models.RoleViewer, s.handleAuditLog())).Methods("GET")
 
-	s.router.HandleFunc("/devices/add", s.handleDeviceAddForm()).Methods("GET")
-	s.router.HandleFunc("/devices/add", s.handleDeviceAddSubmit()).Methods("POST")
+	s.router.HandleFunc("/backups", s.requireRole(models.RoleViewer, s.handleBackupHostsList())).Methods("GET")
+	s.router.HandleFunc("/backups/{host}", s.requireRole(models.RoleViewer, s.handleBackupFilesList())).Methods("GET")
+	s.router.HandleFunc("/backups/{host}/{filename}", s.requireRole(models.RoleViewer, s.handleBackupView())).Methods("GET")
+	s.router.HandleFunc("/backups/{host}/{filename}/records", s.requireRole(models.RoleViewer, s.handleBackupRecords())).Methods("GET")
+	s.router.HandleFunc("/backups/{host}/{filename}/files/{name}", s.requireRole(models.RoleViewer, s.handleFetchedFileDownload())).Methods("GET")
 
-	s.router.HandleFunc("/devices/edit/{host}", s.handleDeviceEditForm()).Methods("GET")
-	s.router.HandleFunc("/devices/edit/{host}", s.handleDeviceEditSubmit()).Methods("POST")
-	s.router.HandleFunc("/devices/remove/{host}", s.handleDeviceRemove()).Methods("POST")
+	s.router.HandleFunc("/tokens", s.requireRole(models.RoleViewer, s.handleTokensList())).Methods("GET")
+	s.router.HandleFunc("/tokens", s.requireRole(models.RoleViewer, s.handleTokenCreate())).Methods("POST")
+	s.router.HandleFunc("/tokens/{id}/revoke", s.requireRole(models.RoleViewer, s.handleTokenRevoke())).Methods("POST")
 
-	s.router.HandleFunc("/backups", s.handleBackupHostsList()).Methods("GET")
-	s.router.HandleFunc("/backups/{host}", s.handleBackupFilesList()).Methods("GET")
-	s.router.HandleFunc("/backups/{host}/{filename}", s.handleBackupView()).Methods("GET")
+	// The event stream is also read by CLI clients, so it accepts API tokens.
+	s.router.HandleFunc("/events", s.requireAPIRole(models.RoleViewer, s.handleEvents())).Methods("GET")
+	s.router.HandleFunc("/run-backup", s.requireRole(models.RoleOperator, s.handleRunBackup())).Methods("POST")
 
-	s.router.HandleFunc("/run-backup", s.handleRunBackup()).Methods("POST")
+	s.registerAPIRoutes()
 }
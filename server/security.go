@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/auth"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// sessionCSRFKey holds the CSRF token of a session.
+	sessionCSRFKey = "csrf"
+	// csrfFormField is the form field carrying the CSRF token.
+	csrfFormField = "csrf_token"
+	// csrfHeader carries the CSRF token of API calls authenticated by the session.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// Options configures the web server.
+type Options struct {
+	// Dev allows running without session keys and over plain HTTP. Random keys
+	// are generated, so logins do not survive a restart.
+	Dev bool
+}
+
+// newSessionStore creates the cookie store from SESSION_AUTH_KEY (signing,
+// at least 32 bytes) and SESSION_ENCRYPTION_KEY (AES, 16, 24 or 32 bytes),
+// both hex encoded. Outside dev mode both keys are required and cookies are
+// only sent over HTTPS.
+func newSessionStore(opts Options) (*sessions.CookieStore, error) {
+	authKey, err := sessionKey("SESSION_AUTH_KEY")
+	if err != nil {
+		return nil, err
+	}
+	encKey, err := sessionKey("SESSION_ENCRYPTION_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	if authKey == nil || encKey == nil {
+		if !opts.Dev {
+			return nil, errors.New("SESSION_AUTH_KEY and SESSION_ENCRYPTION_KEY must be set (generate each with 'openssl rand -hex 32'), or start in dev mode")
+		}
+		log.Println("Warning: session keys not set. Using temporary keys for dev mode; logins end on restart.")
+		authKey, encKey = make([]byte, 32), make([]byte, 32)
+		if _, err := rand.Read(authKey); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(encKey); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(authKey) < 32:
+		return nil, errors.New("SESSION_AUTH_KEY must be at least 32 bytes")
+	case len(encKey) != 16 && len(encKey) != 24 && len(encKey) != 32:
+		return nil, errors.New("SESSION_ENCRYPTION_KEY must be 16, 24 or 32 bytes")
+	case subtle.ConstantTimeCompare(authKey, encKey) == 1:
+		return nil, errors.New("SESSION_AUTH_KEY and SESSION_ENCRYPTION_KEY must differ")
+	}
+
+	store := sessions.NewCookieStore(authKey, encKey)
+	store.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		Secure:   !opts.Dev,
+		HttpOnly: true,
+		// Lax rather than Strict, so that the cookie comes along when the
+		// identity provider redirects back to the single sign-on callback.
+		SameSite: http.SameSiteLaxMode,
+	}
+	return store, nil
+}
+
+// sessionKey decodes a hex encoded key from the environment, or returns nil when it is not set.
+func sessionKey(name string) ([]byte, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hex encoded: %w", name, err)
+	}
+	return key, nil
+}
+
+type nonceContextKey struct{}
+
+type csrfContextKey struct{}
+
+// securityHeaders sets the content security policy and related headers. The
+// nonce lets the inline script of the layout run; all other inline scripts
+// are blocked.
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			http.Error(w, "Failed to generate nonce", http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.StdEncoding.EncodeToString(buf)
+
+		h := w.Header()
+		h.Set("Content-Security-Policy", strings.Join([]string{
+			"default-src 'self'",
+			"script-src 'self' 'nonce-" + nonce + "' https://cdn.jsdelivr.net",
+			"style-src 'self' https://cdn.jsdelivr.net",
+			"img-src 'self' data:",
+			"object-src 'none'",
+			"base-uri 'self'",
+			"frame-ancestors 'none'",
+		}, "; "))
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceContextKey{}, nonce)))
+	})
+}
+
+// csrfProtect gives every session a CSRF token and rejects state-changing
+// requests that do not echo it in the csrf_token form field or the
+// X-CSRF-Token header. Requests with a bearer token carry no cookies that a
+// forged request could use, so they are exempt.
+func (s *Server) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, hasToken := bearerToken(r); hasToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, _ := s.sessionStore.Get(r, sessionName)
+		token, _ := session.Values[sessionCSRFKey].(string)
+		if token == "" {
+			var err error
+			if token, err = auth.RandomToken(); err != nil {
+				http.Error(w, "Failed to generate CSRF token", http.StatusInternalServerError)
+				return
+			}
+			session.Values[sessionCSRFKey] = token
+			if err := session.Save(r, w); err != nil {
+				http.Error(w, "Failed to save session", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" {
+				sent = r.PostFormValue(csrfFormField)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				if strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+					writeAPIError(w, http.StatusForbidden, "missing or invalid CSRF token")
+				} else {
+					http.Error(w, "Forbidden: missing or invalid CSRF token. Reload the page and try again.", http.StatusForbidden)
+				}
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, token)))
+	})
+}
+
+// cspNonce returns the nonce of the content security policy of a request.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceContextKey{}).(string)
+	return nonce
+}
+
+// csrfToken returns the CSRF token to include in the forms of a page.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
@@ -4,10 +4,11 @@ package server
 import (
 	"log"
 	"net/http"
-	"os"
 
+	"github.com/cobrich/netcfg-backup/auth"
 	"github.com/cobrich/netcfg-backup/backups"
 	"github.com/cobrich/netcfg-backup/core"
+	"github.com/cobrich/netcfg-backup/golden"
 	"github.com/cobrich/netcfg-backup/storage"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -15,20 +16,21 @@ import (
 
 // Server holds the dependencies for the web server.
 type Server struct {
-	store           storage.Store
-	router          *mux.Router
-	backupService   *backups.Service
-	coreService     *core.BackupService
-	sessionStore    *sessions.CookieStore
-	isBackupRunning bool
+	store         storage.Store
+	router        *mux.Router
+	backupService *backups.Service
+	coreService   *core.BackupService
+	sessionStore  *sessions.CookieStore
+	golden        *golden.Renderer
+	oidc          *auth.OIDCProvider
 }
 
-// New creates a new Server instance.
-func New(store storage.Store, backupService *backups.Service, coreService *core.BackupService) *Server {
-	authKey := []byte(os.Getenv("SESSION_AUTH_KEY"))
-	if len(authKey) == 0 {
-		log.Println("Warning: SESSION_AUTH_KEY not set. Using a temporary insecure key.")
-		authKey = []byte("a-very-insecure-temporary-secret")
+// New creates a new Server instance. It fails when the session keys are
+// missing or invalid outside dev mode.
+func New(store storage.Store, backupService *backups.Service, coreService *core.BackupService, opts Options) (*Server, error) {
+	sessionStore, err := newSessionStore(opts)
+	if err != nil {
+		return nil, err
 	}
 
 	s := &Server{
@@ -36,10 +38,21 @@ func New(store storage.Store, backupService *backups.Service, coreService *core.
 		router:        mux.NewRouter(),
 		backupService: backupService,
 		coreService:   coreService,
-		sessionStore:  sessions.NewCookieStore(authKey),
+		sessionStore:  sessionStore,
 	}
+	s.router.Use(s.securityHeaders, s.csrfProtect)
 	s.routes()
-	return s
+	return s, nil
+}
+
+// SetGolden enables the drift pages using the given golden config templates.
+func (s *Server) SetGolden(renderer *golden.Renderer) {
+	s.golden = renderer
+}
+
+// SetOIDC enables single sign-on through an OpenID Connect provider.
+func (s *Server) SetOIDC(provider *auth.OIDCProvider) {
+	s.oidc = provider
 }
 
 // Start begins listening for HTTP requests.
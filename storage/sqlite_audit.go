@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// AddAuditEntry appends an entry to the audit log.
+func (s *SQLiteStore) AddAuditEntry(entry models.AuditEntry) (int64, error) {
+	query := `
+    INSERT INTO audit_log (time, user, action, host, source, status, details)
+    VALUES (?, ?, ?, ?, ?, ?, ?);`
+
+	res, err := s.db.Exec(query, entry.Time, entry.User, entry.Action, entry.Host, entry.Source, entry.Status, entry.Details)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert audit entry for %s: %w", entry.Host, err)
+	}
+	return res.LastInsertId()
+}
+
+// GetAuditLog returns audit entries, newest first.
+func (s *SQLiteStore) GetAuditLog(host string, limit int) ([]models.AuditEntry, error) {
+	query := `
+    SELECT id, time, user, action, host, source, status, details
+    FROM audit_log`
+	var args []interface{}
+	if host != "" {
+		query += " WHERE host = ?"
+		args = append(args, host)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.User, &e.Action, &e.Host, &e.Source, &e.Status, &e.Details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit row: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// ReplaceComplianceResults replaces the stored compliance results of a host in a single transaction.
+func (s *SQLiteStore) ReplaceComplianceResults(host string, results []models.ComplianceResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM compliance_results WHERE host = ?", host); err != nil {
+		return fmt.Errorf("failed to delete compliance results of %s: %w", host, err)
+	}
+
+	query := `
+    INSERT INTO compliance_results (host, policy, rule_id, description, severity, passed, message, checked_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+	for _, r := range results {
+		_, err := tx.Exec(query, host, r.Policy, r.RuleID, r.Description, r.Severity, r.Passed, r.Message, r.CheckedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert compliance result %s of %s: %w", r.RuleID, host, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetComplianceResults returns the stored results of a host, or of all hosts when host is empty.
+func (s *SQLiteStore) GetComplianceResults(host string) ([]models.ComplianceResult, error) {
+	query := `
+    SELECT host, policy, rule_id, description, severity, passed, message, checked_at
+    FROM compliance_results`
+	var args []interface{}
+	if host != "" {
+		query += " WHERE host = ?"
+		args = append(args, host)
+	}
+	query += " ORDER BY host, policy, rule_id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query compliance results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.ComplianceResult
+	for rows.Next() {
+		var r models.ComplianceResult
+		err := rows.Scan(&r.Host, &r.Policy, &r.RuleID, &r.Description, &r.Severity, &r.Passed, &r.Message, &r.CheckedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan compliance row: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+const factsColumns = "host, hostname, vendor, model, serial_number, os_version, uptime, uptime_seconds, collected_at"
+
+// SaveFacts appends a facts record to the device's history.
+func (s *SQLiteStore) SaveFacts(f models.DeviceFacts) error {
+	query := `
+    INSERT INTO device_facts (` + factsColumns + `)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	_, err := s.db.Exec(query,
+		f.Host, f.Hostname, f.Vendor, f.Model, f.SerialNumber,
+		f.OSVersion, f.Uptime, f.UptimeSeconds, f.CollectedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save facts for host %s: %w", f.Host, err)
+	}
+	return nil
+}
+
+// GetLatestFacts returns the most recent facts of every device, keyed by host.
+func (s *SQLiteStore) GetLatestFacts() (map[string]models.DeviceFacts, error) {
+	rows, err := s.db.Query(`
+    SELECT ` + factsColumns + ` FROM device_facts
+    WHERE id IN (SELECT MAX(id) FROM device_facts GROUP BY host)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query facts: %w", err)
+	}
+	defer rows.Close()
+
+	facts := make(map[string]models.DeviceFacts)
+	for rows.Next() {
+		f, err := scanFacts(rows)
+		if err != nil {
+			return nil, err
+		}
+		facts[f.Host] = f
+	}
+	return facts, rows.Err()
+}
+
+// GetFactsHistory returns up to limit facts records of a host, newest first.
+func (s *SQLiteStore) GetFactsHistory(host string, limit int) ([]models.DeviceFacts, error) {
+	rows, err := s.db.Query("SELECT "+factsColumns+" FROM device_facts WHERE host = ? ORDER BY id DESC LIMIT ?", host, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query facts history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.DeviceFacts
+	for rows.Next() {
+		f, err := scanFacts(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, f)
+	}
+	return history, rows.Err()
+}
+
+// scanFacts reads a facts record selected with factsColumns.
+func scanFacts(rows *sql.Rows) (models.DeviceFacts, error) {
+	var f models.DeviceFacts
+	err := rows.Scan(
+		&f.Host, &f.Hostname, &f.Vendor, &f.Model, &f.SerialNumber,
+		&f.OSVersion, &f.Uptime, &f.UptimeSeconds, &f.CollectedAt,
+	)
+	if err != nil {
+		return f, fmt.Errorf("failed to scan facts row: %w", err)
+	}
+	return f, nil
+}
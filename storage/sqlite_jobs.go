@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// changeJobColumns is the column list shared by change job queries, in scanChangeJob order.
+const changeJobColumns = "id, name, user, template, selector, canary, max_failures, confirm_timeout_seconds, force, status, created_at, updated_at"
+
+// CreateChangeJob stores a new change job and returns its ID.
+func (s *SQLiteStore) CreateChangeJob(job models.ChangeJob) (int64, error) {
+	selectorJSON, err := json.Marshal(job.Selector)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal selector: %w", err)
+	}
+
+	now := time.Now()
+	query := `
+    INSERT INTO change_jobs (name, user, template, selector, canary, max_failures, confirm_timeout_seconds, force, status, created_at, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	res, err := s.db.Exec(query, job.Name, job.User, job.Template, string(selectorJSON), job.Canary,
+		job.MaxFailures, int64(job.ConfirmTimeout/time.Second), job.Force, job.Status, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert change job: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// UpdateChangeJobStatus changes the status of a job.
+func (s *SQLiteStore) UpdateChangeJobStatus(id int64, status string) error {
+	res, err := s.db.Exec("UPDATE change_jobs SET status = ?, updated_at = ? WHERE id = ?", status, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update change job %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return fmt.Errorf("change job %d not found", id)
+	}
+	return err
+}
+
+// GetChangeJob finds a change job by its ID.
+func (s *SQLiteStore) GetChangeJob(id int64) (*models.ChangeJob, error) {
+	row := s.db.QueryRow("SELECT "+changeJobColumns+" FROM change_jobs WHERE id = ?", id)
+	job, err := scanChangeJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("change job %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to scan change job row: %w", err)
+	}
+	return &job, nil
+}
+
+// ListChangeJobs returns the most recent change jobs, newest first.
+func (s *SQLiteStore) ListChangeJobs(limit int) ([]models.ChangeJob, error) {
+	rows, err := s.db.Query("SELECT "+changeJobColumns+" FROM change_jobs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query change jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.ChangeJob
+	for rows.Next() {
+		job, err := scanChangeJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan change job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanChangeJob(row rowScanner) (models.ChangeJob, error) {
+	var job models.ChangeJob
+	var selectorJSON string
+	var timeoutSeconds int64
+
+	err := row.Scan(&job.ID, &job.Name, &job.User, &job.Template, &selectorJSON, &job.Canary,
+		&job.MaxFailures, &timeoutSeconds, &job.Force, &job.Status, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal([]byte(selectorJSON), &job.Selector); err != nil {
+		return job, fmt.Errorf("failed to unmarshal selector of job %d: %w", job.ID, err)
+	}
+	job.ConfirmTimeout = time.Duration(timeoutSeconds) * time.Second
+	return job, nil
+}
+
+// SaveChangeJobResult creates or replaces the result of a device in a job.
+func (s *SQLiteStore) SaveChangeJobResult(r models.ChangeJobResult) error {
+	query := `
+    INSERT OR REPLACE INTO change_job_results (job_id, host, stage, status, push_id, pre_backup, post_backup, added, removed, message, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	_, err := s.db.Exec(query, r.JobID, r.Host, r.Stage, r.Status, r.PushID, r.PreBackup, r.PostBackup,
+		r.Added, r.Removed, r.Message, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save result of %s in job %d: %w", r.Host, r.JobID, err)
+	}
+	return nil
+}
+
+// GetChangeJobResults returns the per-device results of a job.
+func (s *SQLiteStore) GetChangeJobResults(jobID int64) ([]models.ChangeJobResult, error) {
+	query := `
+    SELECT job_id, host, stage, status, push_id, pre_backup, post_backup, added, removed, message, updated_at
+    FROM change_job_results WHERE job_id = ? ORDER BY stage, host`
+
+	rows, err := s.db.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results of job %d: %w", jobID, err)
+	}
+	defer rows.Close()
+
+	var results []models.ChangeJobResult
+	for rows.Next() {
+		var r models.ChangeJobResult
+		err := rows.Scan(&r.JobID, &r.Host, &r.Stage, &r.Status, &r.PushID, &r.PreBackup, &r.PostBackup,
+			&r.Added, &r.Removed, &r.Message, &r.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job result row: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
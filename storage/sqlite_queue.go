@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// EnqueueRunJobs adds pending jobs for hosts to a run, after its existing
+// jobs, leased to owner.
+func (s *SQLiteStore) EnqueueRunJobs(runID int64, hosts []string, owner string, lease time.Duration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var position int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(position), 0) FROM run_jobs WHERE run_id = ?", runID).Scan(&position); err != nil {
+		return fmt.Errorf("failed to read the queue of run %d: %w", runID, err)
+	}
+	leaseUntil := time.Now().UTC().Add(lease)
+	for _, host := range hosts {
+		position++
+		_, err := tx.Exec("INSERT OR IGNORE INTO run_jobs (run_id, host, position, state, claimed_by, lease_until) VALUES (?, ?, ?, ?, ?, ?)",
+			runID, host, position, models.RunJobPending, owner, leaseUntil)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s in run %d: %w", host, runID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimRunJob moves the job of a host from pending to running. The state and
+// lease checks and the update are one statement, so two workers cannot both
+// claim a job. Lease times are stored in UTC so that they compare as text.
+func (s *SQLiteStore) ClaimRunJob(runID int64, host, owner string, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	res, err := s.db.Exec(`
+    UPDATE run_jobs SET state = ?, claimed_at = ?, claimed_by = ?, lease_until = ?
+    WHERE run_id = ? AND host = ? AND state = ?
+      AND (claimed_by IN ('', ?) OR lease_until IS NULL OR lease_until < ?)`,
+		models.RunJobRunning, now, owner, now.Add(lease), runID, host, models.RunJobPending, owner, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s in run %d: %w", host, runID, err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RenewRunJobs extends the lease of the pending and running jobs of owner.
+func (s *SQLiteStore) RenewRunJobs(owner string, lease time.Duration) error {
+	_, err := s.db.Exec("UPDATE run_jobs SET lease_until = ? WHERE claimed_by = ? AND state IN (?, ?)",
+		time.Now().UTC().Add(lease), owner, models.RunJobPending, models.RunJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to renew the job leases of %s: %w", owner, err)
+	}
+	return nil
+}
+
+// FinishRunJob stores the final state of a job.
+func (s *SQLiteStore) FinishRunJob(runID int64, host, state string) error {
+	_, err := s.db.Exec("UPDATE run_jobs SET state = ?, finished_at = ? WHERE run_id = ? AND host = ?",
+		state, time.Now(), runID, host)
+	if err != nil {
+		return fmt.Errorf("failed to finish %s in run %d: %w", host, runID, err)
+	}
+	return nil
+}
+
+// ListRunJobs returns the jobs of a run in queue order.
+func (s *SQLiteStore) ListRunJobs(runID int64) ([]models.RunJob, error) {
+	rows, err := s.db.Query("SELECT run_id, host, state, claimed_at, finished_at, claimed_by, lease_until FROM run_jobs WHERE run_id = ? ORDER BY position", runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs of run %d: %w", runID, err)
+	}
+	defer rows.Close()
+
+	var jobs []models.RunJob
+	for rows.Next() {
+		var job models.RunJob
+		var claimedAt, finishedAt, leaseUntil sql.NullTime
+		if err := rows.Scan(&job.RunID, &job.Host, &job.State, &claimedAt, &finishedAt, &job.ClaimedBy, &leaseUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan run job row: %w", err)
+		}
+		if claimedAt.Valid {
+			job.ClaimedAt = &claimedAt.Time
+		}
+		if finishedAt.Valid {
+			job.FinishedAt = &finishedAt.Time
+		}
+		if leaseUntil.Valid && job.State != models.RunJobDone && job.State != models.RunJobFailed && job.State != models.RunJobCancelled {
+			job.LeaseUntil = &leaseUntil.Time
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// TakeOverExpiredJobs leases the pending and running jobs whose lease has
+// expired to owner and moves the running ones back to pending. Jobs without a
+// lease were queued before leases existed and are taken over as well.
+func (s *SQLiteStore) TakeOverExpiredJobs(owner string, lease time.Duration) (int64, error) {
+	now := time.Now().UTC()
+	res, err := s.db.Exec(`
+    UPDATE run_jobs SET state = ?, claimed_at = NULL, claimed_by = ?, lease_until = ?
+    WHERE state IN (?, ?) AND (lease_until IS NULL OR lease_until < ?)`,
+		models.RunJobPending, owner, now.Add(lease), models.RunJobPending, models.RunJobRunning, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to take over expired jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// UnfinishedRuns returns the running and queued runs, oldest first.
+func (s *SQLiteStore) UnfinishedRuns() ([]models.Run, error) {
+	rows, err := s.db.Query("SELECT "+runColumns+" FROM runs WHERE status IN (?, ?) ORDER BY id",
+		models.RunRunning, models.RunQueued)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unfinished runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
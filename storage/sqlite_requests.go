@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// GetBackupRequest returns the ticket and the request hash of a request made
+// by owner with the key since the given time, or nil if there is none.
+func (s *SQLiteStore) GetBackupRequest(owner, key string, since time.Time) (*models.BackupTicket, string, error) {
+	var ticketJSON, hash string
+	err := s.db.QueryRow("SELECT ticket, request_hash FROM backup_requests WHERE owner = ? AND idempotency_key = ? AND created_at >= ?",
+		owner, key, since).Scan(&ticketJSON, &hash)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query backup request: %w", err)
+	}
+
+	var ticket models.BackupTicket
+	if err := json.Unmarshal([]byte(ticketJSON), &ticket); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal backup request ticket: %w", err)
+	}
+	return &ticket, hash, nil
+}
+
+// SaveBackupRequest stores the ticket and the request hash of a request,
+// replacing an expired one with the same key.
+func (s *SQLiteStore) SaveBackupRequest(owner, key, hash string, ticket models.BackupTicket) error {
+	ticketJSON, err := json.Marshal(ticket)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup request ticket: %w", err)
+	}
+	query := `
+    INSERT OR REPLACE INTO backup_requests (owner, idempotency_key, ticket, request_hash, created_at)
+    VALUES (?, ?, ?, ?, ?);`
+
+	if _, err := s.db.Exec(query, owner, key, string(ticketJSON), hash, time.Now()); err != nil {
+		return fmt.Errorf("failed to save backup request: %w", err)
+	}
+	return nil
+}
+
+// PurgeBackupRequests forgets the requests made before the given time.
+func (s *SQLiteStore) PurgeBackupRequests(before time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM backup_requests WHERE created_at < ?", before); err != nil {
+		return fmt.Errorf("failed to purge backup requests: %w", err)
+	}
+	return nil
+}
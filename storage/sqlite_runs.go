@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// runColumns is the column list shared by run queries, in scanRun order.
+const runColumns = "id, triggered_by, changed_by, selector, status, total, succeeded, failed, cancelled, started_at, finished_at"
+
+// CreateRun stores a new run and returns its ID.
+func (s *SQLiteStore) CreateRun(run models.Run) (int64, error) {
+	selectorJSON, err := json.Marshal(run.Selector)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal selector: %w", err)
+	}
+
+	query := `
+    INSERT INTO runs (triggered_by, changed_by, selector, status, total, succeeded, failed, started_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+	res, err := s.db.Exec(query, run.Trigger, run.ChangedBy, string(selectorJSON), run.Status, run.Total,
+		run.Succeeded, run.Failed, run.StartedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert run: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// UpdateRun stores the selector, status, total and start time of a run.
+func (s *SQLiteStore) UpdateRun(run models.Run) error {
+	selectorJSON, err := json.Marshal(run.Selector)
+	if err != nil {
+		return fmt.Errorf("failed to marshal selector: %w", err)
+	}
+	_, err = s.db.Exec("UPDATE runs SET selector = ?, status = ?, total = ?, started_at = ? WHERE id = ?",
+		string(selectorJSON), run.Status, run.Total, run.StartedAt, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update run %d: %w", run.ID, err)
+	}
+	return nil
+}
+
+// FinishRun stores the final status and counts of a run.
+func (s *SQLiteStore) FinishRun(run models.Run) error {
+	finishedAt := time.Now()
+	if run.FinishedAt != nil {
+		finishedAt = *run.FinishedAt
+	}
+	res, err := s.db.Exec("UPDATE runs SET status = ?, succeeded = ?, failed = ?, cancelled = ?, finished_at = ? WHERE id = ?",
+		run.Status, run.Succeeded, run.Failed, run.Cancelled, finishedAt, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update run %d: %w", run.ID, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return fmt.Errorf("run %d not found", run.ID)
+	}
+	return err
+}
+
+// GetRun finds a run by its ID. The counts of a running run are taken from
+// the results recorded so far.
+func (s *SQLiteStore) GetRun(id int64) (*models.Run, error) {
+	row := s.db.QueryRow("SELECT "+runColumns+" FROM runs WHERE id = ?", id)
+	run, err := scanRun(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("run %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to scan run row: %w", err)
+	}
+
+	if run.Status == models.RunRunning {
+		err := s.db.QueryRow(`
+        SELECT COALESCE(SUM(status = ?), 0), COALESCE(SUM(status = ?), 0), COALESCE(SUM(status = ?), 0)
+        FROM run_results WHERE run_id = ?`, models.RunResultSuccess, models.RunResultFailed, models.RunResultCancelled, id).
+			Scan(&run.Succeeded, &run.Failed, &run.Cancelled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count results of run %d: %w", id, err)
+		}
+	}
+	return &run, nil
+}
+
+// ListRuns returns the most recent runs, newest first.
+func (s *SQLiteStore) ListRuns(limit int) ([]models.Run, error) {
+	rows, err := s.db.Query("SELECT "+runColumns+" FROM runs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func scanRun(row rowScanner) (models.Run, error) {
+	var run models.Run
+	var selectorJSON string
+	var finishedAt sql.NullTime
+
+	err := row.Scan(&run.ID, &run.Trigger, &run.ChangedBy, &selectorJSON, &run.Status, &run.Total,
+		&run.Succeeded, &run.Failed, &run.Cancelled, &run.StartedAt, &finishedAt)
+	if err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal([]byte(selectorJSON), &run.Selector); err != nil {
+		return run, fmt.Errorf("failed to unmarshal selector of run %d: %w", run.ID, err)
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return run, nil
+}
+
+// AddRunResult stores the result of a device in a run.
+func (s *SQLiteStore) AddRunResult(r models.RunResult) error {
+	query := `
+    INSERT OR REPLACE INTO run_results (run_id, host, status, backup_file, error, category, attempts, duration_seconds, finished_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	_, err := s.db.Exec(query, r.RunID, r.Host, r.Status, r.BackupFile, r.Error, r.Category, r.Attempts, r.DurationSeconds, r.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save result of %s in run %d: %w", r.Host, r.RunID, err)
+	}
+	return nil
+}
+
+// GetRunResults returns the per-device results of a run.
+func (s *SQLiteStore) GetRunResults(runID int64) ([]models.RunResult, error) {
+	query := `
+    SELECT run_id, host, status, backup_file, error, category, attempts, duration_seconds, finished_at
+    FROM run_results WHERE run_id = ? ORDER BY host`
+
+	rows, err := s.db.Query(query, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results of run %d: %w", runID, err)
+	}
+	defer rows.Close()
+
+	var results []models.RunResult
+	for rows.Next() {
+		var r models.RunResult
+		err := rows.Scan(&r.RunID, &r.Host, &r.Status, &r.BackupFile, &r.Error, &r.Category, &r.Attempts, &r.DurationSeconds, &r.FinishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run result row: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -18,6 +18,15 @@ func (e *ErrDeviceExists) Error() string {
 	return fmt.Sprintf("device with host '%s' already exists", e.Host)
 }
 
+// ErrDeviceNotFound is returned when no device has the requested host.
+type ErrDeviceNotFound struct {
+	Host string
+}
+
+func (e *ErrDeviceNotFound) Error() string {
+	return fmt.Sprintf("device with host '%s' not found", e.Host)
+}
+
 // SQLiteStore implements the Store interface using a SQLite database.
 type SQLiteStore struct {
 	db *sql.DB
@@ -40,6 +49,9 @@ func NewSQLiteStore(filePath string) (*SQLiteStore, error) {
 	return store, nil
 }
 
+// deviceColumns is the column list shared by all device queries, in scanDevice order.
+const deviceColumns = "host, username, password, password_env, key_path, commands, protocol, prompt, timeout_seconds, allow_insecure_algos, platform, status, tags, role, http"
+
 // initSchema creates the necessary tables in the database.
 func (s *SQLiteStore) initSchema() error {
 	query := `
@@ -54,15 +66,268 @@ func (s *SQLiteStore) initSchema() error {
         prompt TEXT,
         timeout_seconds INTEGER,
         allow_insecure_algos BOOLEAN
+    );
+    CREATE TABLE IF NOT EXISTS neighbors (
+        local_host TEXT NOT NULL,
+        local_interface TEXT NOT NULL,
+        remote_name TEXT NOT NULL,
+        remote_address TEXT NOT NULL DEFAULT '',
+        remote_interface TEXT NOT NULL,
+        platform TEXT NOT NULL DEFAULT '',
+        protocol TEXT NOT NULL,
+        discovered_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_neighbors_local_host ON neighbors (local_host);
+    CREATE TABLE IF NOT EXISTS device_facts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        host TEXT NOT NULL,
+        hostname TEXT NOT NULL,
+        vendor TEXT NOT NULL,
+        model TEXT NOT NULL,
+        serial_number TEXT NOT NULL,
+        os_version TEXT NOT NULL,
+        uptime TEXT NOT NULL,
+        uptime_seconds INTEGER NOT NULL,
+        collected_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_device_facts_host ON device_facts (host, collected_at);
+    CREATE TABLE IF NOT EXISTS compliance_results (
+        host TEXT NOT NULL,
+        policy TEXT NOT NULL,
+        rule_id TEXT NOT NULL,
+        description TEXT NOT NULL,
+        severity TEXT NOT NULL,
+        passed BOOLEAN NOT NULL,
+        message TEXT NOT NULL,
+        checked_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_compliance_results_host ON compliance_results (host);
+    CREATE TABLE IF NOT EXISTS device_vars (
+        host TEXT NOT NULL,
+        name TEXT NOT NULL,
+        value TEXT NOT NULL,
+        PRIMARY KEY (host, name)
+    );
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        time DATETIME NOT NULL,
+        user TEXT NOT NULL,
+        action TEXT NOT NULL,
+        host TEXT NOT NULL,
+        source TEXT NOT NULL,
+        status TEXT NOT NULL,
+        details TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_audit_log_host ON audit_log (host, time);
+    CREATE TABLE IF NOT EXISTS change_jobs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        user TEXT NOT NULL,
+        template TEXT NOT NULL,
+        selector TEXT NOT NULL, -- JSON object
+        canary INTEGER NOT NULL,
+        max_failures INTEGER NOT NULL,
+        confirm_timeout_seconds INTEGER NOT NULL,
+        force BOOLEAN NOT NULL,
+        status TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS change_job_results (
+        job_id INTEGER NOT NULL,
+        host TEXT NOT NULL,
+        stage TEXT NOT NULL,
+        status TEXT NOT NULL,
+        push_id INTEGER NOT NULL,
+        pre_backup TEXT NOT NULL,
+        post_backup TEXT NOT NULL,
+        added INTEGER NOT NULL,
+        removed INTEGER NOT NULL,
+        message TEXT NOT NULL,
+        updated_at DATETIME NOT NULL,
+        PRIMARY KEY (job_id, host)
+    );
+    CREATE TABLE IF NOT EXISTS runs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        triggered_by TEXT NOT NULL,
+        changed_by TEXT NOT NULL DEFAULT '',
+        selector TEXT NOT NULL, -- JSON object
+        status TEXT NOT NULL,
+        total INTEGER NOT NULL,
+        succeeded INTEGER NOT NULL DEFAULT 0,
+        failed INTEGER NOT NULL DEFAULT 0,
+        cancelled INTEGER NOT NULL DEFAULT 0,
+        started_at DATETIME NOT NULL,
+        finished_at DATETIME
+    );
+    CREATE TABLE IF NOT EXISTS run_results (
+        run_id INTEGER NOT NULL,
+        host TEXT NOT NULL,
+        status TEXT NOT NULL,
+        backup_file TEXT NOT NULL,
+        error TEXT NOT NULL,
+        category TEXT NOT NULL DEFAULT '',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        duration_seconds REAL NOT NULL,
+        finished_at DATETIME NOT NULL,
+        PRIMARY KEY (run_id, host)
+    );
+    CREATE TABLE IF NOT EXISTS run_jobs (
+        run_id INTEGER NOT NULL,
+        host TEXT NOT NULL,
+        position INTEGER NOT NULL,
+        state TEXT NOT NULL,
+        claimed_at DATETIME,
+        finished_at DATETIME,
+        claimed_by TEXT NOT NULL DEFAULT '',
+        lease_until DATETIME,
+        PRIMARY KEY (run_id, host)
+    );
+    CREATE INDEX IF NOT EXISTS idx_run_jobs_state ON run_jobs (state);
+    CREATE TABLE IF NOT EXISTS users (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        username TEXT NOT NULL UNIQUE,
+        password_hash TEXT NOT NULL,
+        role TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        last_login_at DATETIME
+    );
+    CREATE TABLE IF NOT EXISTS api_tokens (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        kind TEXT NOT NULL,
+        owner TEXT NOT NULL,
+        scope TEXT NOT NULL,
+        prefix TEXT NOT NULL,
+        hash TEXT NOT NULL UNIQUE,
+        created_at DATETIME NOT NULL,
+        expires_at DATETIME,
+        last_used_at DATETIME,
+        revoked_at DATETIME
+    );
+    CREATE TABLE IF NOT EXISTS backup_requests (
+        owner TEXT NOT NULL,
+        idempotency_key TEXT NOT NULL,
+        ticket TEXT NOT NULL, -- JSON object
+        request_hash TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (owner, idempotency_key)
     );`
 
-	_, err := s.db.Exec(query)
-	return err
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+
+	// Columns added after the first release. Existing databases get them with a default value.
+	if err := s.addColumnIfMissing("devices", "platform", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("devices", "status", "TEXT NOT NULL DEFAULT 'active'"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("devices", "tags", "TEXT NOT NULL DEFAULT '[]'"); err != nil { // JSON array string
+		return err
+	}
+	if err := s.addColumnIfMissing("devices", "role", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("devices", "http", "TEXT NOT NULL DEFAULT ''"); err != nil { // JSON object string
+		return err
+	}
+	if err := s.addColumnIfMissing("runs", "cancelled", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("runs", "changed_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("run_results", "category", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("run_results", "attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("run_jobs", "claimed_by", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("run_jobs", "lease_until", "DATETIME"); err != nil {
+		return err
+	}
+	return s.addColumnIfMissing("backup_requests", "request_hash", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already there.
+func (s *SQLiteStore) addColumnIfMissing(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info for %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDevice reads a device selected with deviceColumns.
+func scanDevice(row rowScanner) (models.Device, error) {
+	var dev models.Device
+	var commandsJSON, tagsJSON, httpJSON string // We'll read the JSON strings here
+
+	err := row.Scan(
+		&dev.Host, &dev.Username, &dev.Password, &dev.PasswordEnv,
+		&dev.KeyPath, &commandsJSON, &dev.Protocol, &dev.Prompt,
+		&dev.TimeoutSeconds, &dev.AllowInsecureAlgos, &dev.Platform, &dev.Status,
+		&tagsJSON, &dev.Role, &httpJSON,
+	)
+	if err != nil {
+		return dev, err
+	}
+
+	// Convert the JSON string of commands back to a string slice
+	if err := json.Unmarshal([]byte(commandsJSON), &dev.Commands); err != nil {
+		return dev, fmt.Errorf("failed to unmarshal commands for host %s: %w", dev.Host, err)
+	}
+	if err := json.Unmarshal([]byte(tagsJSON), &dev.Tags); err != nil {
+		return dev, fmt.Errorf("failed to unmarshal tags for host %s: %w", dev.Host, err)
+	}
+	if httpJSON != "" {
+		if err := json.Unmarshal([]byte(httpJSON), &dev.HTTP); err != nil {
+			return dev, fmt.Errorf("failed to unmarshal http settings for host %s: %w", dev.Host, err)
+		}
+	}
+	return dev, nil
 }
 
 // GetAllDevices retrieves all devices from the database.
 func (s *SQLiteStore) GetAllDevices() ([]models.Device, error) {
-	rows, err := s.db.Query("SELECT host, username, password, password_env, key_path, commands, protocol, prompt, timeout_seconds, allow_insecure_algos FROM devices ORDER BY host")
+	rows, err := s.db.Query("SELECT " + deviceColumns + " FROM devices ORDER BY host")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query devices: %w", err)
 	}
@@ -70,23 +335,10 @@ func (s *SQLiteStore) GetAllDevices() ([]models.Device, error) {
 
 	var devices []models.Device
 	for rows.Next() {
-		var dev models.Device
-		var commandsJSON string // We'll read the JSON string here
-
-		err := rows.Scan(
-			&dev.Host, &dev.Username, &dev.Password, &dev.PasswordEnv,
-			&dev.KeyPath, &commandsJSON, &dev.Protocol, &dev.Prompt,
-			&dev.TimeoutSeconds, &dev.AllowInsecureAlgos,
-		)
+		dev, err := scanDevice(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device row: %w", err)
 		}
-
-		// Convert the JSON string of commands back to a string slice
-		if err := json.Unmarshal([]byte(commandsJSON), &dev.Commands); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal commands for host %s: %w", dev.Host, err)
-		}
-
 		devices = append(devices, dev)
 	}
 
@@ -95,27 +347,16 @@ func (s *SQLiteStore) GetAllDevices() ([]models.Device, error) {
 
 // GetDeviceByHost finds a single device by its host.
 func (s *SQLiteStore) GetDeviceByHost(host string) (*models.Device, error) {
-	row := s.db.QueryRow("SELECT host, username, password, password_env, key_path, commands, protocol, prompt, timeout_seconds, allow_insecure_algos FROM devices WHERE host = ?", host)
+	row := s.db.QueryRow("SELECT "+deviceColumns+" FROM devices WHERE host = ?", host)
 
-	var dev models.Device
-	var commandsJSON string
-
-	err := row.Scan(
-		&dev.Host, &dev.Username, &dev.Password, &dev.PasswordEnv,
-		&dev.KeyPath, &commandsJSON, &dev.Protocol, &dev.Prompt,
-		&dev.TimeoutSeconds, &dev.AllowInsecureAlgos,
-	)
+	dev, err := scanDevice(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("device with host '%s' not found", host)
+			return nil, &ErrDeviceNotFound{Host: host}
 		}
 		return nil, fmt.Errorf("failed to scan device row: %w", err)
 	}
 
-	if err := json.Unmarshal([]byte(commandsJSON), &dev.Commands); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal commands for host %s: %w", dev.Host, err)
-	}
-
 	return &dev, nil
 }
 
@@ -126,15 +367,24 @@ func (s *SQLiteStore) AddDevice(dev models.Device) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal commands to JSON: %w", err)
 	}
+	tagsJSON, err := marshalTags(dev.Tags)
+	if err != nil {
+		return err
+	}
+	httpJSON, err := marshalHTTP(dev.HTTP)
+	if err != nil {
+		return err
+	}
 
 	query := `
-    INSERT INTO devices (host, username, password, password_env, key_path, commands, protocol, prompt, timeout_seconds, allow_insecure_algos)
-    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+    INSERT INTO devices (` + deviceColumns + `)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 
 	_, err = s.db.Exec(query,
 		dev.Host, dev.Username, dev.Password, dev.PasswordEnv,
 		dev.KeyPath, string(commandsJSON), dev.Protocol, dev.Prompt,
-		dev.TimeoutSeconds, dev.AllowInsecureAlgos,
+		dev.TimeoutSeconds, dev.AllowInsecureAlgos, dev.Platform, deviceStatus(dev),
+		tagsJSON, dev.Role, httpJSON,
 	)
 
 	// Check for unique constraint violation (duplicate host)
@@ -151,16 +401,26 @@ func (s *SQLiteStore) UpdateDevice(dev models.Device) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal commands to JSON: %w", err)
 	}
+	tagsJSON, err := marshalTags(dev.Tags)
+	if err != nil {
+		return err
+	}
+	httpJSON, err := marshalHTTP(dev.HTTP)
+	if err != nil {
+		return err
+	}
 
 	query := `
     UPDATE devices SET
         username = ?, password = ?, password_env = ?, key_path = ?, commands = ?,
-        protocol = ?, prompt = ?, timeout_seconds = ?, allow_insecure_algos = ?
+        protocol = ?, prompt = ?, timeout_seconds = ?, allow_insecure_algos = ?,
+        platform = ?, status = ?, tags = ?, role = ?, http = ?
     WHERE host = ?;`
 
 	res, err := s.db.Exec(query,
 		dev.Username, dev.Password, dev.PasswordEnv, dev.KeyPath, string(commandsJSON),
 		dev.Protocol, dev.Prompt, dev.TimeoutSeconds, dev.AllowInsecureAlgos,
+		dev.Platform, deviceStatus(dev), tagsJSON, dev.Role, httpJSON,
 		dev.Host, // This is for the WHERE clause
 	)
 	if err != nil {
@@ -169,7 +429,7 @@ func (s *SQLiteStore) UpdateDevice(dev models.Device) error {
 
 	rowsAffected, err := res.RowsAffected()
 	if err == nil && rowsAffected == 0 {
-		return fmt.Errorf("device with host '%s' not found to update", dev.Host)
+		return &ErrDeviceNotFound{Host: dev.Host}
 	}
 
 	return err
@@ -184,8 +444,41 @@ func (s *SQLiteStore) RemoveDevice(host string) error {
 
 	rowsAffected, err := res.RowsAffected()
 	if err == nil && rowsAffected == 0 {
-		return fmt.Errorf("device with host '%s' not found", host)
+		return &ErrDeviceNotFound{Host: host}
 	}
 
 	return err
 }
+
+// deviceStatus returns the status to persist, defaulting to active.
+func deviceStatus(dev models.Device) string {
+	if dev.Status == "" {
+		return models.DeviceStatusActive
+	}
+	return dev.Status
+}
+
+// marshalTags converts tags to the JSON array string stored in the tags column.
+func marshalTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tags to JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// marshalHTTP converts HTTP settings to the JSON string stored in the http
+// column; devices without them store an empty string.
+func marshalHTTP(settings *models.HTTPSettings) (string, error) {
+	if settings == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal http settings to JSON: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// tokenColumns is the column list shared by token queries, in scanAPIToken order.
+const tokenColumns = "id, name, kind, owner, scope, prefix, hash, created_at, expires_at, last_used_at, revoked_at"
+
+// CreateAPIToken stores a new token and returns its ID.
+func (s *SQLiteStore) CreateAPIToken(t models.APIToken) (int64, error) {
+	query := `
+    INSERT INTO api_tokens (name, kind, owner, scope, prefix, hash, created_at, expires_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+	res, err := s.db.Exec(query, t.Name, t.Kind, t.Owner, t.Scope, t.Prefix, t.Hash, time.Now(), t.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert API token: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetAPIToken finds a token by its ID.
+func (s *SQLiteStore) GetAPIToken(id int64) (*models.APIToken, error) {
+	return s.getAPIToken("SELECT "+tokenColumns+" FROM api_tokens WHERE id = ?", id)
+}
+
+// GetAPITokenByHash finds a token by the hash of its secret.
+func (s *SQLiteStore) GetAPITokenByHash(hash string) (*models.APIToken, error) {
+	return s.getAPIToken("SELECT "+tokenColumns+" FROM api_tokens WHERE hash = ?", hash)
+}
+
+func (s *SQLiteStore) getAPIToken(query string, arg interface{}) (*models.APIToken, error) {
+	t, err := scanAPIToken(s.db.QueryRow(query, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API token not found")
+		}
+		return nil, fmt.Errorf("failed to scan API token row: %w", err)
+	}
+	return &t, nil
+}
+
+// ListAPITokens returns the tokens created by a user, or all tokens when
+// owner is empty, newest first.
+func (s *SQLiteStore) ListAPITokens(owner string) ([]models.APIToken, error) {
+	query := "SELECT " + tokenColumns + " FROM api_tokens"
+	var args []interface{}
+	if owner != "" {
+		query += " WHERE owner = ?"
+		args = append(args, owner)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token row: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func scanAPIToken(row rowScanner) (models.APIToken, error) {
+	var t models.APIToken
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Name, &t.Kind, &t.Owner, &t.Scope, &t.Prefix, &t.Hash,
+		&t.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	t.ExpiresAt = nullTimePtr(expiresAt)
+	t.LastUsedAt = nullTimePtr(lastUsedAt)
+	t.RevokedAt = nullTimePtr(revokedAt)
+	return t, err
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// RevokeAPIToken revokes a token. Revoked tokens are kept for the record.
+func (s *SQLiteStore) RevokeAPIToken(id int64) error {
+	res, err := s.db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return fmt.Errorf("API token %d not found or already revoked", id)
+	}
+	return err
+}
+
+// TouchAPIToken sets the last used time of a token to now.
+func (s *SQLiteStore) TouchAPIToken(id int64) error {
+	_, err := s.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update API token %d: %w", id, err)
+	}
+	return nil
+}
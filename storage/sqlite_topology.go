@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// ReplaceNeighbors replaces all neighbors recorded for a host in a single transaction.
+func (s *SQLiteStore) ReplaceNeighbors(host string, neighbors []models.Neighbor) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM neighbors WHERE local_host = ?", host); err != nil {
+		return fmt.Errorf("failed to delete neighbors of %s: %w", host, err)
+	}
+
+	query := `
+    INSERT INTO neighbors (local_host, local_interface, remote_name, remote_address, remote_interface, platform, protocol, discovered_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+	for _, n := range neighbors {
+		_, err := tx.Exec(query,
+			host, n.LocalInterface, n.RemoteName, n.RemoteAddress,
+			n.RemoteInterface, n.Platform, n.Protocol, n.DiscoveredAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert neighbor %s of %s: %w", n.RemoteName, host, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAllNeighbors returns every recorded adjacency, ordered by local host.
+func (s *SQLiteStore) GetAllNeighbors() ([]models.Neighbor, error) {
+	rows, err := s.db.Query(`
+    SELECT local_host, local_interface, remote_name, remote_address, remote_interface, platform, protocol, discovered_at
+    FROM neighbors ORDER BY local_host, local_interface`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query neighbors: %w", err)
+	}
+	defer rows.Close()
+
+	var neighbors []models.Neighbor
+	for rows.Next() {
+		var n models.Neighbor
+		err := rows.Scan(
+			&n.LocalHost, &n.LocalInterface, &n.RemoteName, &n.RemoteAddress,
+			&n.RemoteInterface, &n.Platform, &n.Protocol, &n.DiscoveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan neighbor row: %w", err)
+		}
+		neighbors = append(neighbors, n)
+	}
+
+	return neighbors, rows.Err()
+}
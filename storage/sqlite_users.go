@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// ErrUserNotFound is returned when no user has the requested name.
+type ErrUserNotFound struct {
+	Username string
+}
+
+func (e *ErrUserNotFound) Error() string {
+	return fmt.Sprintf("user '%s' not found", e.Username)
+}
+
+// userColumns is the column list shared by user queries, in scanUser order.
+const userColumns = "id, username, password_hash, role, created_at, last_login_at"
+
+// CreateUser stores a new user and returns its ID.
+func (s *SQLiteStore) CreateUser(user models.User) (int64, error) {
+	res, err := s.db.Exec("INSERT INTO users (username, password_hash, role, created_at) VALUES (?, ?, ?, ?)",
+		user.Username, user.PasswordHash, user.Role, time.Now())
+	if err != nil && err.Error() == "UNIQUE constraint failed: users.username" {
+		return 0, fmt.Errorf("user '%s' already exists", user.Username)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert user: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetUser finds a user by name.
+func (s *SQLiteStore) GetUser(username string) (*models.User, error) {
+	row := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username)
+	user, err := scanUser(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &ErrUserNotFound{Username: username}
+		}
+		return nil, fmt.Errorf("failed to scan user row: %w", err)
+	}
+	return &user, nil
+}
+
+// ListUsers returns all users sorted by name.
+func (s *SQLiteStore) ListUsers() ([]models.User, error) {
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users ORDER BY username")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	var lastLogin sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &lastLogin)
+	if lastLogin.Valid {
+		user.LastLoginAt = &lastLogin.Time
+	}
+	return user, err
+}
+
+// UpdateUserPassword replaces the password hash of a user.
+func (s *SQLiteStore) UpdateUserPassword(username, passwordHash string) error {
+	return s.updateUser(username, "UPDATE users SET password_hash = ? WHERE username = ?", passwordHash, username)
+}
+
+// UpdateUserRole changes the role of a user.
+func (s *SQLiteStore) UpdateUserRole(username, role string) error {
+	return s.updateUser(username, "UPDATE users SET role = ? WHERE username = ?", role, username)
+}
+
+// RecordLogin sets the last login time of a user to now.
+func (s *SQLiteStore) RecordLogin(username string) error {
+	return s.updateUser(username, "UPDATE users SET last_login_at = ? WHERE username = ?", time.Now(), username)
+}
+
+// DeleteUser removes a user and revokes their personal API tokens.
+func (s *SQLiteStore) DeleteUser(username string) error {
+	if err := s.updateUser(username, "DELETE FROM users WHERE username = ?", username); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE owner = ? AND kind = ? AND revoked_at IS NULL",
+		time.Now(), username, models.TokenPersonal)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens of user '%s': %w", username, err)
+	}
+	return nil
+}
+
+// updateUser runs a statement that must affect the row of a user.
+func (s *SQLiteStore) updateUser(username, query string, args ...interface{}) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update user '%s': %w", username, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return &ErrUserNotFound{Username: username}
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package storage
+
+import "fmt"
+
+// GetDeviceVars returns all variables of a host.
+func (s *SQLiteStore) GetDeviceVars(host string) (map[string]string, error) {
+	rows, err := s.db.Query("SELECT name, value FROM device_vars WHERE host = ?", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query variables of %s: %w", host, err)
+	}
+	defer rows.Close()
+
+	vars := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan variable row: %w", err)
+		}
+		vars[name] = value
+	}
+	return vars, rows.Err()
+}
+
+// SetDeviceVar creates or replaces a variable of a host.
+func (s *SQLiteStore) SetDeviceVar(host, name, value string) error {
+	_, err := s.db.Exec(`
+    INSERT INTO device_vars (host, name, value) VALUES (?, ?, ?)
+    ON CONFLICT (host, name) DO UPDATE SET value = excluded.value;`, host, name, value)
+	if err != nil {
+		return fmt.Errorf("failed to set variable %s of %s: %w", name, host, err)
+	}
+	return nil
+}
+
+// DeleteDeviceVar removes a variable of a host.
+func (s *SQLiteStore) DeleteDeviceVar(host, name string) error {
+	res, err := s.db.Exec("DELETE FROM device_vars WHERE host = ? AND name = ?", host, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete variable %s of %s: %w", name, host, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 {
+		return fmt.Errorf("variable '%s' of host '%s' not found", name, host)
+	}
+	return err
+}
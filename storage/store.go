@@ -1,7 +1,11 @@
 // Package storage defines the interface for data persistence.
 package storage
 
-import "github.com/cobrich/netcfg-backup/models"
+import (
+	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
 
 // Store is the interface for device storage.
 // It abstracts the underlying storage mechanism (e.g., JSON file, database).
@@ -12,3 +16,133 @@ type Store interface {
 	UpdateDevice(updatedDevice models.Device) error
 	RemoveDevice(host string) error
 }
+
+// TopologyStore persists the neighbor adjacency graph built by discovery.
+type TopologyStore interface {
+	// ReplaceNeighbors replaces all neighbors previously recorded for a host.
+	ReplaceNeighbors(host string, neighbors []models.Neighbor) error
+	GetAllNeighbors() ([]models.Neighbor, error)
+}
+
+// FactsStore keeps the history of facts collected from devices.
+type FactsStore interface {
+	SaveFacts(facts models.DeviceFacts) error
+	// GetLatestFacts returns the most recent facts of every device, keyed by host.
+	GetLatestFacts() (map[string]models.DeviceFacts, error)
+	// GetFactsHistory returns the facts of a host, newest first.
+	GetFactsHistory(host string, limit int) ([]models.DeviceFacts, error)
+}
+
+// ComplianceStore keeps the latest compliance results of each device.
+type ComplianceStore interface {
+	// ReplaceComplianceResults replaces all results previously stored for a host.
+	ReplaceComplianceResults(host string, results []models.ComplianceResult) error
+	// GetComplianceResults returns the results of a host, or of all hosts when host is empty.
+	GetComplianceResults(host string) ([]models.ComplianceResult, error)
+}
+
+// VariableStore keeps per-device variables used to render templates.
+type VariableStore interface {
+	GetDeviceVars(host string) (map[string]string, error)
+	SetDeviceVar(host, name, value string) error
+	DeleteDeviceVar(host, name string) error
+}
+
+// AuditStore keeps an append-only log of changes made to devices.
+type AuditStore interface {
+	// AddAuditEntry stores an entry and returns its ID.
+	AddAuditEntry(entry models.AuditEntry) (int64, error)
+	// GetAuditLog returns the entries of a host, or of all hosts when host is empty, newest first.
+	GetAuditLog(host string, limit int) ([]models.AuditEntry, error)
+}
+
+// ChangeJobStore keeps bulk configuration change jobs and their per-device results.
+type ChangeJobStore interface {
+	CreateChangeJob(job models.ChangeJob) (int64, error)
+	// UpdateChangeJobStatus changes the status of a job.
+	UpdateChangeJobStatus(id int64, status string) error
+	GetChangeJob(id int64) (*models.ChangeJob, error)
+	// ListChangeJobs returns the most recent jobs, newest first.
+	ListChangeJobs(limit int) ([]models.ChangeJob, error)
+	// SaveChangeJobResult creates or replaces the result of a device.
+	SaveChangeJobResult(result models.ChangeJobResult) error
+	GetChangeJobResults(jobID int64) ([]models.ChangeJobResult, error)
+}
+
+// RunStore keeps the history of backup runs and their per-device results.
+type RunStore interface {
+	// CreateRun stores a new run and returns its ID.
+	CreateRun(run models.Run) (int64, error)
+	// UpdateRun stores the selector, status, total and start time of a run
+	// that was recorded while queued.
+	UpdateRun(run models.Run) error
+	// FinishRun marks a run completed with its final counts.
+	FinishRun(run models.Run) error
+	AddRunResult(result models.RunResult) error
+	GetRun(id int64) (*models.Run, error)
+	// ListRuns returns the most recent runs, newest first.
+	ListRuns(limit int) ([]models.Run, error)
+	GetRunResults(runID int64) ([]models.RunResult, error)
+}
+
+// JobQueueStore keeps the device jobs of runs, so that a restarted server can
+// resume the runs it did not finish. Unfinished jobs are leased to the process
+// that queued or claimed them, identified by an owner string; the owner renews
+// the lease while it is alive, and other processes only take over jobs whose
+// lease has expired.
+type JobQueueStore interface {
+	// EnqueueRunJobs adds pending jobs for hosts to a run, after its existing
+	// jobs, leased to owner; hosts the run already has are skipped.
+	EnqueueRunJobs(runID int64, hosts []string, owner string, lease time.Duration) error
+	// ClaimRunJob moves the job of a host from pending to running and reports
+	// whether it was pending and leased to owner or not leased at all, so that
+	// only one worker gets it.
+	ClaimRunJob(runID int64, host, owner string, lease time.Duration) (bool, error)
+	// RenewRunJobs extends the lease of the unfinished jobs of owner.
+	RenewRunJobs(owner string, lease time.Duration) error
+	// FinishRunJob stores the final state of a job.
+	FinishRunJob(runID int64, host, state string) error
+	// ListRunJobs returns the jobs of a run in queue order.
+	ListRunJobs(runID int64) ([]models.RunJob, error)
+	// TakeOverExpiredJobs leases the unfinished jobs whose lease has expired to
+	// owner, moving running ones back to pending, and returns how many there
+	// were. Jobs of processes that are still alive are left alone.
+	TakeOverExpiredJobs(owner string, lease time.Duration) (int64, error)
+	// UnfinishedRuns returns the running and queued runs, oldest first.
+	UnfinishedRuns() ([]models.Run, error)
+}
+
+// BackupRequestStore remembers the answers to backup requests by idempotency key.
+type BackupRequestStore interface {
+	// GetBackupRequest returns the ticket and the request hash of a request
+	// made by owner with the key since the given time, or nil if there is none.
+	GetBackupRequest(owner, key string, since time.Time) (*models.BackupTicket, string, error)
+	SaveBackupRequest(owner, key, hash string, ticket models.BackupTicket) error
+	// PurgeBackupRequests forgets the requests made before the given time.
+	PurgeBackupRequests(before time.Time) error
+}
+
+// UserStore keeps the local accounts of the web interface.
+type UserStore interface {
+	CreateUser(user models.User) (int64, error)
+	GetUser(username string) (*models.User, error)
+	ListUsers() ([]models.User, error)
+	UpdateUserPassword(username, passwordHash string) error
+	UpdateUserRole(username, role string) error
+	DeleteUser(username string) error
+	// RecordLogin sets the last login time of a user to now.
+	RecordLogin(username string) error
+}
+
+// TokenStore keeps hashed API tokens.
+type TokenStore interface {
+	// CreateAPIToken stores a new token and returns its ID.
+	CreateAPIToken(token models.APIToken) (int64, error)
+	GetAPIToken(id int64) (*models.APIToken, error)
+	GetAPITokenByHash(hash string) (*models.APIToken, error)
+	// ListAPITokens returns the tokens created by a user, or all tokens when owner is empty.
+	ListAPITokens(owner string) ([]models.APIToken, error)
+	RevokeAPIToken(id int64) error
+	// TouchAPIToken records that a token was used.
+	TouchAPIToken(id int64) error
+}
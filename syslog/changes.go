@@ -0,0 +1,78 @@
+package syslog
+
+import (
+	"regexp"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// changeRule recognizes the configuration change messages of a platform. The
+// "user" group of the pattern, when it matches, names who made the change.
+type changeRule struct {
+	platforms []string
+	pattern   *regexp.Regexp
+}
+
+var changeRules = []changeRule{
+	// %SYS-5-CONFIG_I: Configured from console by admin on vty0 (10.0.0.5)
+	{
+		platforms: []string{models.PlatformCiscoIOS, models.PlatformAristaEOS},
+		pattern:   regexp.MustCompile(`%SYS-\d-CONFIG_I: Configured from \S+(?: by (?P<user>[^\s(]+))?`),
+	},
+	// %SYS-5-CONFIG_SESSION_COMMIT_SUCCESS: User admin committed configuration session s1
+	{
+		platforms: []string{models.PlatformAristaEOS},
+		pattern:   regexp.MustCompile(`%SYS-\d-CONFIG_SESSION_COMMIT_SUCCESS: User (?P<user>\S+)`),
+	},
+	// %MGBL-CONFIG-6-DB_COMMIT : Configuration committed by user 'admin'.
+	{
+		platforms: []string{models.PlatformCiscoIOS},
+		pattern:   regexp.MustCompile(`%MGBL-CONFIG-\d-DB_COMMIT\s*: Configuration committed(?: by user '(?P<user>[^']+)')?`),
+	},
+	// %VSHD-5-VSHD_SYSLOG_CONFIG_I: Configured from vty by admin on 10.0.0.5@pts/0
+	{
+		platforms: []string{models.PlatformCiscoNXOS},
+		pattern:   regexp.MustCompile(`%VSHD-\d-VSHD_SYSLOG_CONFIG_I: Configured from \S+(?: by (?P<user>\S+))?`),
+	},
+	// UI_COMMIT: User 'admin' requested 'commit' operation (comment: none)
+	{
+		platforms: []string{models.PlatformJunOS},
+		pattern:   regexp.MustCompile(`\bUI_COMMIT(?:\[\d+\])?: User '(?P<user>[^']+)'`),
+	},
+}
+
+// MatchChange reports whether a message from a device of the given platform
+// announces a configuration change, and returns the user who made it if the
+// message names one. The generic or an empty platform matches the messages
+// of every platform.
+func MatchChange(platform string, msg Message) (string, bool) {
+	content := msg.Content()
+	for _, rule := range changeRules {
+		if !rule.appliesTo(platform) {
+			continue
+		}
+		m := rule.pattern.FindStringSubmatch(content)
+		if m == nil {
+			continue
+		}
+		user := m[rule.pattern.SubexpIndex("user")]
+		if user == "console" {
+			// IOS reports changes on the console without login as "by console".
+			user = ""
+		}
+		return user, true
+	}
+	return "", false
+}
+
+func (r changeRule) appliesTo(platform string) bool {
+	if platform == "" || platform == models.PlatformGeneric {
+		return true
+	}
+	for _, p := range r.platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// maxMessageSize bounds a single message; longer messages are truncated over
+// UDP and end the connection over TCP.
+const maxMessageSize = 64 * 1024
+
+// tcpIdleTimeout closes TCP connections that stay silent this long.
+const tcpIdleTimeout = 10 * time.Minute
+
+// Handler is called with every message received and the address of its sender.
+type Handler func(source net.IP, msg Message)
+
+// Listener receives syslog messages over UDP and TCP.
+type Listener struct {
+	handler Handler
+}
+
+// NewListener creates a listener that passes every message to handler.
+// Messages are handled one at a time per socket or connection.
+func NewListener(handler Handler) *Listener {
+	return &Listener{handler: handler}
+}
+
+// ListenUDP receives messages on a UDP address, one message per datagram,
+// until ctx is cancelled. It returns once the socket is bound.
+func (l *Listener) ListenUDP(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	utils.Log.WithField("address", conn.LocalAddr().String()).Info("Syslog listener started (udp)")
+
+	go func() {
+		buf := make([]byte, maxMessageSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					utils.Log.WithField("error", err).Error("Syslog udp listener stopped")
+				}
+				return
+			}
+			l.handle(addrIP(from), buf[:n])
+		}
+	}()
+	return nil
+}
+
+// ListenTCP receives messages on a TCP address until ctx is cancelled. Both
+// RFC 6587 framings are accepted: octet counting ("<length> <message>") and
+// messages terminated by a newline. It returns once the socket is bound.
+func (l *Listener) ListenTCP(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+	context.AfterFunc(ctx, func() { ln.Close() })
+	utils.Log.WithField("address", ln.Addr().String()).Info("Syslog listener started (tcp)")
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					utils.Log.WithField("error", err).Error("Syslog tcp listener stopped")
+				}
+				return
+			}
+			go l.serveConn(ctx, conn)
+		}
+	}()
+	return nil
+}
+
+// serveConn reads the messages of one TCP connection.
+func (l *Listener) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	source := addrIP(conn.RemoteAddr())
+	r := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				utils.Log.WithFields(map[string]interface{}{"source": source.String(), "error": err}).Warn("Closing syslog connection")
+			}
+			return
+		}
+		if len(frame) > 0 {
+			l.handle(source, frame)
+		}
+	}
+}
+
+// readFrame reads one octet-counted or newline-terminated message.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("message longer than %d bytes", maxMessageSize)
+		}
+		if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+			return nil, err
+		}
+		return line, nil
+	}
+
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(prefix[:len(prefix)-1])
+	if err != nil || length <= 0 || length > maxMessageSize {
+		return nil, fmt.Errorf("invalid message length %q", prefix)
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// handle parses a message and passes it on. Malformed messages are dropped.
+func (l *Listener) handle(source net.IP, data []byte) {
+	msg, err := Parse(data)
+	if err != nil {
+		utils.Log.WithFields(map[string]interface{}{"source": source.String(), "error": err}).Debug("Dropping malformed syslog message")
+		return
+	}
+	l.handler(source, msg)
+}
+
+// addrIP returns the IP address of a UDP or TCP address.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
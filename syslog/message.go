@@ -0,0 +1,152 @@
+// Package syslog receives syslog messages from devices and recognizes the
+// ones that report a configuration change.
+package syslog
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a parsed syslog message in either RFC 3164 or RFC 5424 format.
+// Fields missing from the message are left empty.
+type Message struct {
+	Priority       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	MsgID          string // RFC 5424 only
+	StructuredData string // RFC 5424 only, unparsed
+	Text           string
+}
+
+// Content returns the message ID, when there is one, followed by the text, so
+// that RFC 5424 messages read like their RFC 3164 counterparts, e.g.
+// "UI_COMMIT: User 'admin' requested 'commit' operation".
+func (m Message) Content() string {
+	if m.MsgID == "" {
+		return m.Text
+	}
+	return m.MsgID + ": " + m.Text
+}
+
+// Parse parses a syslog message. RFC 3164 is parsed leniently: a message
+// without a timestamp and hostname keeps everything after the priority as text.
+func Parse(data []byte) (Message, error) {
+	line := strings.TrimRight(string(data), "\r\n\x00")
+	if !strings.HasPrefix(line, "<") {
+		return Message{}, errors.New("missing priority")
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return Message{}, errors.New("invalid priority")
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri > 191 {
+		return Message{}, errors.New("invalid priority")
+	}
+	rest := line[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		msg := parse5424(rest[2:])
+		msg.Priority = pri
+		return msg, nil
+	}
+	msg := parse3164(rest)
+	msg.Priority = pri
+	return msg, nil
+}
+
+// parse5424 parses the part of an RFC 5424 message after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+func parse5424(rest string) Message {
+	var msg Message
+	fields := make([]string, 5)
+	for i := range fields {
+		fields[i], rest = nextField(rest)
+	}
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		msg.Timestamp = t
+	}
+	msg.Hostname = nilValue(fields[1])
+	msg.AppName = nilValue(fields[2])
+	msg.MsgID = nilValue(fields[4])
+
+	sd, rest := structuredData(rest)
+	msg.StructuredData = nilValue(sd)
+	msg.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return msg
+}
+
+// structuredData splits the structured data element off the rest of an RFC
+// 5424 message. Brackets inside quoted parameter values do not end an element.
+func structuredData(s string) (string, string) {
+	if !strings.HasPrefix(s, "[") {
+		sd, rest := nextField(s)
+		return sd, rest
+	}
+	inElement, inValue, escaped := false, false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inValue && c == '\\':
+			escaped = true
+		case inElement && c == '"':
+			inValue = !inValue
+		case inValue:
+		case c == '[':
+			inElement = true
+		case c == ']':
+			inElement = false
+		case !inElement:
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// parse3164 parses the part of an RFC 3164 message after the priority:
+// TIMESTAMP HOSTNAME TAG: MSG.
+func parse3164(rest string) Message {
+	var msg Message
+	if len(rest) < len(time.Stamp) {
+		msg.Text = rest
+		return msg
+	}
+	t, err := time.Parse(time.Stamp, rest[:len(time.Stamp)])
+	if err != nil {
+		msg.Text = rest
+		return msg
+	}
+	now := time.Now()
+	msg.Timestamp = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	msg.Hostname, rest = nextField(strings.TrimPrefix(rest[len(time.Stamp):], " "))
+
+	// The tag ends with a colon, optionally after a [pid].
+	if tag, text, ok := strings.Cut(rest, ": "); ok && tag != "" && !strings.ContainsAny(tag, " %") {
+		if i := strings.IndexByte(tag, '['); i > 0 {
+			tag = tag[:i]
+		}
+		msg.AppName = tag
+		rest = text
+	}
+	msg.Text = rest
+	return msg
+}
+
+// nextField splits off the next space-separated field.
+func nextField(s string) (string, string) {
+	field, rest, _ := strings.Cut(s, " ")
+	return field, rest
+}
+
+// nilValue maps the RFC 5424 nil value "-" to an empty string.
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
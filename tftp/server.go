@@ -0,0 +1,325 @@
+// Package tftp receives files that devices push over TFTP (RFC 1350), such
+// as the configuration exported with "copy running-config tftp://...".
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cobrich/netcfg-backup/utils"
+)
+
+// Opcodes of the protocol.
+const (
+	opRRQ   = 1
+	opWRQ   = 2
+	opData  = 3
+	opAck   = 4
+	opError = 5
+	opOACK  = 6
+)
+
+// Error codes of the protocol.
+const (
+	errNotDefined = 0
+	errAccess     = 2
+	errDiskFull   = 3
+	errIllegalOp  = 4
+	errUnknownTID = 5
+)
+
+const (
+	defaultBlksize  = 512
+	maxBlksize      = 65464
+	retransmitAfter = 2 * time.Second
+	maxRetransmits  = 5
+)
+
+// MaxFileSize is the largest file the server receives.
+const MaxFileSize = 64 << 20
+
+// Server receives uploads of expected file names only, so that devices
+// cannot write anything else; nothing is written to disk and nothing can be
+// read.
+type Server struct {
+	mu       sync.Mutex
+	expected map[string]*upload
+}
+
+// upload is an expected file.
+type upload struct {
+	done chan []byte
+	peer string // the device whose transfer is in progress or complete
+}
+
+// NewServer creates a server that expects no files yet.
+func NewServer() *Server {
+	return &Server{expected: make(map[string]*upload)}
+}
+
+// Expect registers a file name and returns a channel that receives the
+// content of the first complete upload of it. Call Forget when the upload
+// is no longer wanted.
+func (s *Server) Expect(name string) <-chan []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &upload{done: make(chan []byte, 1)}
+	s.expected[name] = u
+	return u.done
+}
+
+// Forget stops expecting a file name.
+func (s *Server) Forget(name string) {
+	s.mu.Lock()
+	delete(s.expected, name)
+	s.mu.Unlock()
+}
+
+// ListenUDP receives write requests on a UDP address until ctx is
+// cancelled. Each transfer gets its own socket, as the protocol requires. It
+// returns once the socket is bound.
+func (s *Server) ListenUDP(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	utils.Log.WithField("address", conn.LocalAddr().String()).Info("TFTP server started")
+
+	// Transfers are answered from the address the request was sent to.
+	host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					utils.Log.WithField("error", err).Error("TFTP server stopped")
+				}
+				return
+			}
+			s.handleRequest(ctx, conn, host, from, append([]byte{}, buf[:n]...))
+		}
+	}()
+	return nil
+}
+
+// handleRequest starts the transfer of a write request for an expected file
+// and refuses everything else.
+func (s *Server) handleRequest(ctx context.Context, conn net.PacketConn, host string, from net.Addr, packet []byte) {
+	logger := utils.Log.WithField("source", from.String())
+	if len(packet) < 2 {
+		return
+	}
+	switch binary.BigEndian.Uint16(packet) {
+	case opWRQ:
+	case opRRQ:
+		sendError(conn, from, errAccess, "reading files is not allowed")
+		return
+	default:
+		sendError(conn, from, errIllegalOp, "illegal TFTP operation")
+		return
+	}
+
+	name, mode, options, err := parseRequest(packet[2:])
+	if err != nil {
+		sendError(conn, from, errNotDefined, err.Error())
+		return
+	}
+	if mode != "octet" && mode != "netascii" {
+		sendError(conn, from, errNotDefined, "unsupported transfer mode "+mode)
+		return
+	}
+
+	// A device repeats its request when the first reply is lost or slow; the
+	// transfer already answers it from its own socket.
+	s.mu.Lock()
+	u, ok := s.expected[strings.TrimPrefix(name, "/")]
+	peer := ""
+	if ok {
+		peer = u.peer
+		if peer == "" {
+			u.peer = from.String()
+		}
+	}
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		logger.WithField("file", name).Warn("Refusing TFTP upload of an unexpected file")
+		sendError(conn, from, errAccess, "unexpected file")
+		return
+	case peer == from.String():
+		logger.WithField("file", name).Debug("Ignoring repeated TFTP write request")
+		return
+	case peer != "":
+		logger.WithFields(map[string]interface{}{"file": name, "uploader": peer}).Warn("Refusing TFTP upload of a file another device uploads")
+		sendError(conn, from, errAccess, "the file is uploaded by another device")
+		return
+	}
+
+	logger.WithField("file", name).Info("Receiving TFTP upload")
+	go func() {
+		data, err := receive(ctx, host, from, options)
+		if err != nil {
+			// Let the device try again.
+			s.mu.Lock()
+			u.peer = ""
+			s.mu.Unlock()
+			logger.WithFields(map[string]interface{}{"file": name, "error": err}).Error("TFTP upload failed")
+			return
+		}
+		if mode == "netascii" {
+			data = fromNetascii(data)
+		}
+		logger.WithFields(map[string]interface{}{"file": name, "size": len(data)}).Info("✅ TFTP upload received")
+		select {
+		case u.done <- data:
+		default: // an earlier upload of the file was received already
+		}
+	}()
+}
+
+// receive runs one transfer on a new socket and returns the received data.
+func receive(ctx context.Context, host string, peer net.Addr, options map[string]string) ([]byte, error) {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+	dallying := false
+	defer func() {
+		if !dallying {
+			conn.Close()
+		}
+	}()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// The only option accepted is the block size (RFC 2348). A request
+	// without options is answered with the acknowledgment of block 0.
+	blksize := defaultBlksize
+	reply := ack(0)
+	if value, ok := options["blksize"]; ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 8 {
+			blksize = min(n, maxBlksize)
+			reply = binary.BigEndian.AppendUint16(nil, opOACK)
+			reply = append(reply, "blksize\x00"+strconv.Itoa(blksize)+"\x00"...)
+		}
+	}
+
+	var data bytes.Buffer
+	buf := make([]byte, blksize+4)
+	var block uint16 = 1
+	retransmits := 0
+	for {
+		if _, err := conn.WriteTo(reply, peer); err != nil {
+			return nil, err
+		}
+		n, err := readBlock(conn, peer, buf, block)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && retransmits < maxRetransmits {
+				retransmits++
+				continue
+			}
+			return nil, err
+		}
+		if data.Len()+n > MaxFileSize {
+			sendError(conn, peer, errDiskFull, "file too large")
+			return nil, fmt.Errorf("file is larger than %d bytes", MaxFileSize)
+		}
+		data.Write(buf[4 : 4+n])
+		reply = ack(block)
+		retransmits = 0
+		if n < blksize {
+			conn.WriteTo(reply, peer)
+			dallying = true
+			go func(lastAck []byte) {
+				dally(conn, peer, lastAck)
+				conn.Close()
+			}(reply)
+			return data.Bytes(), nil
+		}
+		block++ // wraps around after block 65535
+	}
+}
+
+// readBlock waits one retransmit interval for a block from the peer and
+// returns the size of its data. Packets from other senders and repeated
+// blocks, sent when an acknowledgment was lost, are skipped.
+func readBlock(conn net.PacketConn, peer net.Addr, buf []byte, block uint16) (int, error) {
+	conn.SetReadDeadline(time.Now().Add(retransmitAfter))
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		if from.String() != peer.String() {
+			sendError(conn, from, errUnknownTID, "unknown transfer ID")
+			continue
+		}
+		if n < 4 {
+			continue
+		}
+		switch binary.BigEndian.Uint16(buf) {
+		case opData:
+			if binary.BigEndian.Uint16(buf[2:]) == block {
+				return n - 4, nil
+			}
+		case opError:
+			return 0, fmt.Errorf("device aborted the transfer: %s", strings.TrimRight(string(buf[4:n]), "\x00"))
+		}
+	}
+}
+
+// dally answers a repeated last block, sent when the final acknowledgment
+// was lost, for one retransmit interval.
+func dally(conn net.PacketConn, peer net.Addr, lastAck []byte) {
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(retransmitAfter))
+	for {
+		_, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if from.String() == peer.String() {
+			conn.WriteTo(lastAck, peer)
+		}
+	}
+}
+
+// parseRequest parses the file name, mode and options of a request.
+func parseRequest(b []byte) (name, mode string, options map[string]string, err error) {
+	fields := strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00")
+	if len(fields) < 2 || fields[0] == "" {
+		return "", "", nil, errors.New("malformed request")
+	}
+	options = make(map[string]string)
+	for i := 2; i+1 < len(fields); i += 2 {
+		options[strings.ToLower(fields[i])] = fields[i+1]
+	}
+	return fields[0], strings.ToLower(fields[1]), options, nil
+}
+
+// fromNetascii converts netascii line ends to newlines.
+func fromNetascii(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\r\x00"), []byte("\r"))
+}
+
+func ack(block uint16) []byte {
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, opAck), block)
+}
+
+func sendError(conn net.PacketConn, to net.Addr, code uint16, msg string) {
+	packet := binary.BigEndian.AppendUint16(nil, opError)
+	packet = binary.BigEndian.AppendUint16(packet, code)
+	conn.WriteTo(append(packet, msg+"\x00"...), to)
+}
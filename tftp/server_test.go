@@ -0,0 +1,265 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer runs a server on a free local port and returns its address.
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.LocalAddr().String()
+	probe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s := NewServer()
+	if err := s.ListenUDP(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	return s, addr
+}
+
+// device is a TFTP client, as a network device pushing its configuration.
+type device struct {
+	t    *testing.T
+	conn net.PacketConn
+}
+
+func newDevice(t *testing.T) *device {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &device{t: t, conn: conn}
+}
+
+func (d *device) send(to string, packet []byte) {
+	d.t.Helper()
+	addr, err := net.ResolveUDPAddr("udp", to)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	if _, err := d.conn.WriteTo(packet, addr); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// read returns the next packet and its sender, or nil after the timeout.
+func (d *device) read(timeout time.Duration) ([]byte, string) {
+	buf := make([]byte, maxBlksize+4)
+	d.conn.SetReadDeadline(time.Now().Add(timeout))
+	n, from, err := d.conn.ReadFrom(buf)
+	if err != nil {
+		return nil, ""
+	}
+	return buf[:n], from.String()
+}
+
+func request(op uint16, name, mode string, options ...string) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, op)
+	for _, field := range append([]string{name, mode}, options...) {
+		packet = append(packet, field+"\x00"...)
+	}
+	return packet
+}
+
+func dataPacket(block uint16, data []byte) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, opData)
+	return append(binary.BigEndian.AppendUint16(packet, block), data...)
+}
+
+// errorCode returns the code of an error packet, or -1 for other packets.
+func errorCode(packet []byte) int {
+	if len(packet) < 4 || binary.BigEndian.Uint16(packet) != opError {
+		return -1
+	}
+	return int(binary.BigEndian.Uint16(packet[2:]))
+}
+
+// upload sends data in blocks of blksize to the transfer that answered the
+// request from tid, the transfer's address, starting with the reply in first.
+func (d *device) upload(tid string, first []byte, data []byte, blksize int) error {
+	reply := first
+	for block := uint16(1); ; block++ {
+		if want := ack(block - 1); block > 1 || binary.BigEndian.Uint16(reply) != opOACK {
+			if !bytes.Equal(reply, want) {
+				return fmt.Errorf("got %v, want the acknowledgment of block %d", reply, block-1)
+			}
+		}
+		n := min(blksize, len(data))
+		d.send(tid, dataPacket(block, data[:n]))
+		data = data[n:]
+		var from string
+		if reply, from = d.read(time.Second); reply == nil || from != tid {
+			return fmt.Errorf("no acknowledgment of block %d from %s", block, tid)
+		}
+		if n < blksize {
+			if !bytes.Equal(reply, ack(block)) {
+				return fmt.Errorf("got %v, want the acknowledgment of the last block %d", reply, block)
+			}
+			return nil
+		}
+	}
+}
+
+// push uploads a file the way a device does and returns an error for a
+// refused or failed transfer.
+func (d *device) push(server, name, mode string, data []byte, options ...string) error {
+	d.send(server, request(opWRQ, name, mode, options...))
+	reply, tid := d.read(time.Second)
+	switch {
+	case reply == nil:
+		return fmt.Errorf("no answer to the write request")
+	case errorCode(reply) >= 0:
+		return fmt.Errorf("refused with code %d: %s", errorCode(reply), strings.TrimRight(string(reply[4:]), "\x00"))
+	case tid == server:
+		return fmt.Errorf("transfer answered from the server port")
+	}
+	blksize := defaultBlksize
+	if len(options) == 2 {
+		fmt.Sscan(options[1], &blksize)
+	}
+	return d.upload(tid, reply, data, blksize)
+}
+
+func receiveWithin(t *testing.T, done <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case data := <-done:
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatal("the upload was not received")
+		return nil
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s, addr := startServer(t)
+	config := bytes.Repeat([]byte("interface GigabitEthernet0/1\n description uplink\n!\n"), 40)
+
+	tests := []struct {
+		name    string
+		mode    string
+		options []string
+		data    []byte
+		want    []byte
+	}{
+		{"r1.cfg", "octet", nil, config, config},
+		{"/r2.cfg", "octet", []string{"blksize", "1024"}, config, config},
+		{"r3.cfg", "octet", nil, config[:1024], config[:1024]}, // ends with an empty block
+		{"r4.cfg", "NETASCII", nil, []byte("hostname r4\r\nend\r\n"), []byte("hostname r4\nend\n")},
+	}
+	for _, tt := range tests {
+		done := s.Expect(strings.TrimPrefix(tt.name, "/"))
+		if err := newDevice(t).push(addr, tt.name, tt.mode, tt.data, tt.options...); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := receiveWithin(t, done); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: received %d bytes, want %d", tt.name, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestRefusedRequests(t *testing.T) {
+	s, addr := startServer(t)
+	s.Expect("r1.cfg")
+	s.Expect("forgotten.cfg")
+	s.Forget("forgotten.cfg")
+
+	dev := newDevice(t)
+	for _, packet := range [][]byte{
+		request(opWRQ, "other.cfg", "octet"),
+		request(opWRQ, "forgotten.cfg", "octet"),
+		request(opRRQ, "r1.cfg", "octet"),
+		request(opWRQ, "r1.cfg", "mail"),
+		request(opWRQ, "", "octet"),
+		dataPacket(1, []byte("stray")),
+	} {
+		dev.send(addr, packet)
+		if reply, _ := dev.read(time.Second); errorCode(reply) < 0 {
+			t.Errorf("request %q: got %v, want an error", packet, reply)
+		}
+	}
+}
+
+// A device that repeats its write request, because the first answer was
+// slow, must not be refused while its transfer runs.
+func TestRepeatedWriteRequest(t *testing.T) {
+	s, addr := startServer(t)
+	done := s.Expect("r1.cfg")
+	dev := newDevice(t)
+	wrq := request(opWRQ, "r1.cfg", "octet")
+	dev.send(addr, wrq)
+	dev.send(addr, wrq)
+
+	reply, tid := dev.read(time.Second)
+	if !bytes.Equal(reply, ack(0)) || tid == addr {
+		t.Fatalf("got %v from %s, want the acknowledgment of block 0 from the transfer", reply, tid)
+	}
+	if extra, from := dev.read(200 * time.Millisecond); extra != nil {
+		t.Fatalf("the repeated request was answered with %v from %s", extra, from)
+	}
+
+	// Another device cannot take over the file in the meantime.
+	if err := newDevice(t).push(addr, "r1.cfg", "octet", []byte("hostname evil\n")); err == nil {
+		t.Error("a second device uploaded the file during the transfer")
+	}
+
+	if err := dev.upload(tid, reply, []byte("hostname r1\n"), defaultBlksize); err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveWithin(t, done); string(got) != "hostname r1\n" {
+		t.Errorf("received %q", got)
+	}
+
+	// A request repeated after the transfer is ignored as well.
+	dev.send(addr, wrq)
+	if extra, _ := dev.read(200 * time.Millisecond); extra != nil && !bytes.Equal(extra, ack(1)) {
+		t.Errorf("the request repeated after the transfer was answered with %v", extra)
+	}
+}
+
+func TestOversizedUpload(t *testing.T) {
+	s, addr := startServer(t)
+	s.Expect("big.cfg")
+	dev := newDevice(t)
+	dev.send(addr, request(opWRQ, "big.cfg", "octet", "blksize", "65464"))
+	reply, tid := dev.read(time.Second)
+	if binary.BigEndian.Uint16(reply) != opOACK {
+		t.Fatalf("got %v, want an option acknowledgment", reply)
+	}
+	block := make([]byte, maxBlksize)
+	for i := uint16(1); ; i++ {
+		dev.send(tid, dataPacket(i, block))
+		reply, _ = dev.read(time.Second)
+		if code := errorCode(reply); code == errDiskFull {
+			return
+		} else if !bytes.Equal(reply, ack(i)) {
+			t.Fatalf("block %d: got %v", i, reply)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	name, mode, options, err := parseRequest([]byte("r1.cfg\x00OCTET\x00BLKSIZE\x001428\x00tsize\x000\x00"))
+	if err != nil || name != "r1.cfg" || mode != "octet" || options["blksize"] != "1428" || options["tsize"] != "0" {
+		t.Errorf("got %q, %q, %v, %v", name, mode, options, err)
+	}
+	if _, _, _, err := parseRequest([]byte("r1.cfg\x00")); err == nil {
+		t.Error("a request without mode was accepted")
+	}
+}
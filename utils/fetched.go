@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cobrich/netcfg-backup/models"
+)
+
+// manifestName is the file in a files directory that lists its files.
+const manifestName = "manifest.json"
+
+// FilesDir returns the directory where the files fetched with a backup are
+// saved: the backup path with ".files" instead of ".txt".
+func FilesDir(backupPath string) string {
+	return strings.TrimSuffix(backupPath, filepath.Ext(backupPath)) + ".files"
+}
+
+// WriteFetchedFiles saves the files fetched by the results of a backup in
+// its files directory, together with a manifest of their sizes and
+// checksums. It sets the name of each saved file and does nothing when no
+// result fetched a file.
+func WriteFetchedFiles(backupPath string, results []models.Result) error {
+	var manifest []models.FetchedFile
+	taken := map[string]bool{manifestName: true}
+	dir := FilesDir(backupPath)
+	for i := range results {
+		file := results[i].File
+		if file == nil {
+			continue
+		}
+		if manifest == nil {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create folder %s: %w", dir, err)
+			}
+		}
+
+		// Device paths may use "flash:vlan.dat" as well as "/config/config.boot".
+		base := filepath.Base(strings.ReplaceAll(file.Path, ":", "/"))
+		if base == "." || base == "/" || base == ".." {
+			base = "file"
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%d_%s", n, base)
+		}
+		taken[name] = true
+		file.Name = name
+
+		if err := os.WriteFile(filepath.Join(dir, name), file.Data, 0644); err != nil {
+			return fmt.Errorf("failed to save fetched file %s: %w", file.Path, err)
+		}
+		entry := *file
+		entry.Data = nil
+		manifest = append(manifest, entry)
+	}
+	if manifest == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), data, 0644); err != nil {
+		return fmt.Errorf("failed to save the manifest of fetched files: %w", err)
+	}
+	Log.WithField("dir", dir).Infof("✅ %d fetched files saved", len(manifest))
+	return nil
+}
+
+// ReadFetchedFiles returns the manifest of the files fetched with a backup,
+// or nil if none were.
+func ReadFetchedFiles(backupPath string) ([]models.FetchedFile, error) {
+	data, err := os.ReadFile(filepath.Join(FilesDir(backupPath), manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []models.FetchedFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("error parsing the manifest of %s: %w", FilesDir(backupPath), err)
+	}
+	return files, nil
+}
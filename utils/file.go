@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath" // Very important for securely joining paths
-	"github.com/cobrich/netcfg-backup/models"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/cobrich/netcfg-backup/models"
 )
 
 // CreateBackup ensures the base directory for backups exists.
@@ -50,8 +53,8 @@ func GetBackupFilename(basePath, host string) (string, error) {
 	return filepath.Join(dir, filename), nil
 }
 
-// WriteResultsToFile writes the command results to a backup file.
-func WriteResultsToFile(basePath string, dev models.Device, results []models.Result) error {
+// WriteResultsToFile writes the command results to a backup file and returns its path.
+func WriteResultsToFile(basePath string, dev models.Device, results []models.Result) (string, error) {
 	// Get the full filename, passing basePath
 	filename, err := GetBackupFilename(basePath, dev.Host)
 	entry := Log.WithFields(map[string]interface{}{
@@ -59,13 +62,13 @@ func WriteResultsToFile(basePath string, dev models.Device, results []models.Res
 	})
 	if err != nil {
 		entry.Error(err)
-		return err
+		return "", err
 	}
 
 	f, err := os.Create(filename)
 	if err != nil {
 		entry.WithField("file", filename).Errorf("Failed to create file: %v", err)
-		return err
+		return "", err
 	}
 	defer f.Close()
 
@@ -83,5 +86,68 @@ func WriteResultsToFile(basePath string, dev models.Device, results []models.Res
 	}
 
 	entry.WithField("file", filename).Info("✅ Result saved")
-	return nil
+	return filename, nil
+}
+
+// ParseBackupContent splits the content of a backup file back into command results.
+// The header written by WriteResultsToFile is skipped.
+func ParseBackupContent(content string) []models.Result {
+	var results []models.Result
+	var current *models.Result
+	var output strings.Builder
+
+	flush := func() {
+		if current != nil {
+			current.Output = strings.TrimSuffix(output.String(), "\n\n")
+			results = append(results, *current)
+		}
+		output.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(trimmed, "### ") && strings.HasSuffix(trimmed, " ###") && len(trimmed) > 8 {
+			flush()
+			current = &models.Result{Cmd: strings.TrimSuffix(strings.TrimPrefix(trimmed, "### "), " ###")}
+			continue
+		}
+		if current != nil {
+			output.WriteString(line)
+		}
+	}
+	flush()
+
+	return results
+}
+
+// ListBackupFiles returns the paths of a host's text backups, oldest first.
+func ListBackupFiles(basePath, host string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(basePath, host, "backup_*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	// Timestamps in the file names sort chronologically.
+	sort.Strings(files)
+	return files, nil
+}
+
+// LatestBackupFile returns the path of a host's most recent text backup.
+func LatestBackupFile(basePath, host string) (string, error) {
+	files, err := ListBackupFiles(basePath, host)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no backups found for host '%s'", host)
+	}
+	return files[len(files)-1], nil
+}
+
+// ReadBackupFile reads a backup file and splits it into command results.
+func ReadBackupFile(path string) ([]models.Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBackupContent(string(data)), nil
 }